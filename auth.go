@@ -0,0 +1,219 @@
+package opio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Authenticator 决定连接如何向服务端证明身份。
+// 每个新建立的物理连接 (连接池扩容、重连、订阅) 登录时调用 Handshake，
+// 登录成功后以及 Client 每次借出连接发送请求前调用 Authorize。
+type Authenticator interface {
+	// Handshake 返回登录握手使用的用户名与口令，口令与服务端问候包中的随机数散列后发送，为空时不发送口令。
+	// ctx 为建立连接的 context，实现可以用它从外部获取口令。
+	Handshake(ctx context.Context) (user string, secret string, err error)
+	// Authorize 返回附加到该连接后续请求上的会话令牌 (Token 属性)，空字符串表示不附加。
+	// 实现可以在 op 上收发请求 (例如获取或刷新令牌)，调用时连接上没有进行中的请求。
+	Authorize(ctx context.Context, op *IOConnect) (token string, err error)
+}
+
+// WithAuthenticator 使用 auth 进行登录认证，此时 Connect / InitContext 的 user 与 pass 参数被忽略。
+// 未设置时使用 PasswordAuth{User: user, Password: pass}。不能与 WithCredentials 同时使用，
+// 需要轮换口令时把 CredentialProvider 交给 Authenticator (见 NewTokenAuth)。
+func WithAuthenticator(auth Authenticator) ConnectOption {
+	return func(o *connectOptions) {
+		o.auth = auth
+	}
+}
+
+// PasswordAuth 是默认的口令认证：每次登录都发送散列后的口令，请求不附加令牌。
+type PasswordAuth struct {
+	User     string
+	Password string
+}
+
+// Handshake 返回 User 与 Password。
+func (a PasswordAuth) Handshake(ctx context.Context) (string, string, error) {
+	return a.User, a.Password, nil
+}
+
+// Authorize 不附加令牌。
+func (a PasswordAuth) Authorize(ctx context.Context, op *IOConnect) (string, error) {
+	return "", nil
+}
+
+// TokenAuth 使用会话令牌认证：每个连接都用口令登录，登录后通过 Token 主题获取令牌，之后的请求都附加 Token 属性。
+// TokenAuth 不保存口令，每次登录握手时从 CredentialProvider 获取，口令轮换后新连接自动使用新口令。
+// 令牌临近过期 (服务端在应答的 Time 属性中给出过期时间) 时，在下一次调用前用当前令牌换取新令牌；
+// 令牌已经过期或刷新被服务端拒绝时，在口令登录的连接上重新申请令牌，因此空闲超过令牌有效期的连接池仍然可以建立新连接。
+// 同一个 TokenAuth 可以被多个连接与 Client 共享，并发安全。
+type TokenAuth struct {
+	creds         CredentialProvider // 登录握手使用的凭据，令牌不用于登录
+	refreshBefore time.Duration
+
+	mu      sync.Mutex
+	token   string    // 当前会话令牌
+	expires time.Time // 令牌过期时间，零值表示服务端未给出
+
+	refreshMu sync.Mutex // 保证同一时间只有一个连接在刷新令牌
+}
+
+// NewTokenAuth 创建令牌认证，每个新连接登录前从 creds 获取用户名与口令 (例如 FileCredentials、EnvCredentials)。
+// 令牌在过期前 1 分钟开始刷新，可以通过 SetRefreshBefore 调整。
+func NewTokenAuth(creds CredentialProvider) *TokenAuth {
+	return &TokenAuth{creds: creds, refreshBefore: time.Minute}
+}
+
+// SetRefreshBefore 设置令牌过期前多久开始刷新，d 不能为负。
+func (a *TokenAuth) SetRefreshBefore(d time.Duration) error {
+	if d < 0 {
+		return errors.New("opio: TokenAuth refresh window must not be negative")
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.refreshBefore = d
+	return nil
+}
+
+// Token 返回当前的会话令牌及其过期时间，尚未获取令牌时返回空字符串。
+func (a *TokenAuth) Token() (string, time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.token, a.expires
+}
+
+// Handshake 从 CredentialProvider 获取用户名与口令。
+func (a *TokenAuth) Handshake(ctx context.Context) (string, string, error) {
+	if a.creds == nil {
+		return "", "", errors.New("opio: TokenAuth has no CredentialProvider")
+	}
+	return a.creds.Credentials(ctx)
+}
+
+// Authorize 返回当前令牌；尚未获取令牌、令牌临近过期或已经过期时先在 op 上获取新令牌。
+func (a *TokenAuth) Authorize(ctx context.Context, op *IOConnect) (string, error) {
+	if token, ok := a.fresh(); ok {
+		return token, nil
+	}
+	a.refreshMu.Lock()
+	defer a.refreshMu.Unlock()
+	// 等待期间其他连接可能已经完成了刷新
+	if token, ok := a.fresh(); ok {
+		return token, nil
+	}
+	token, expires, err := a.renew(op)
+	if err != nil {
+		return "", err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.token, a.expires = token, expires
+	return token, nil
+}
+
+// renew - 在 op 上申请新令牌。当前令牌未过期时随请求附带 (刷新)；
+// 令牌已经过期或刷新被服务端拒绝时，不附带令牌重新申请 (连接已用口令登录)。
+func (a *TokenAuth) renew(op *IOConnect) (string, time.Time, error) {
+	a.mu.Lock()
+	current, expires := a.token, a.expires
+	a.mu.Unlock()
+	if current != "" && (expires.IsZero() || time.Now().Before(expires)) {
+		op.token = current
+		token, expires, err := op.requestToken()
+		var serverErr *OpioServerError
+		if err == nil || !errors.As(err, &serverErr) {
+			return token, expires, err
+		}
+	}
+	op.token = ""
+	return op.requestToken()
+}
+
+// fresh - 当前令牌存在且不需要刷新
+func (a *TokenAuth) fresh() (string, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token == "" {
+		return "", false
+	}
+	if a.expires.IsZero() || time.Now().Add(a.refreshBefore).Before(a.expires) {
+		return a.token, true
+	}
+	return "", false
+}
+
+// authorize - 由 Authenticator 更新连接附加到请求上的会话令牌，未设置 Authenticator 时不做任何事
+func (op *IOConnect) authorize(ctx context.Context) error {
+	if op.opts.auth == nil {
+		return nil
+	}
+	token, err := op.opts.auth.Authorize(ctx, op)
+	if err != nil {
+		return err
+	}
+	op.token = token
+	return nil
+}
+
+// requestToken - 通过 Token 主题向服务端申请会话令牌，连接上已有令牌时随请求附带 (即刷新)
+func (op *IOConnect) requestToken() (string, time.Time, error) {
+	req := op.NewRequest(nil)
+	defer req.Reset()
+	req.SetService("openplant")
+	req.SetAction(ActionSelect)
+	req.SetSubject(SubjectToken)
+	if err := req.WriteAndFlush(); err != nil {
+		return "", time.Time{}, fmt.Errorf("opio: 发送令牌请求失败: %w", err)
+	}
+	res, err := req.GetResponse()
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("opio: 读取令牌应答失败: %w", err)
+	}
+	if res.GetErrNo() != 0 {
+		serverErr := &OpioServerError{Code: res.GetErrNo(), Message: res.GetError()}
+		return "", time.Time{}, fmt.Errorf("opio: 获取令牌失败: %w", serverErr)
+	}
+	token, _ := res.Get(PropToken).(string)
+	if token == "" {
+		return "", time.Time{}, errors.New("opio: 令牌应答中缺少 Token")
+	}
+	var expires time.Time
+	if sec, ok := numberValue(res.Get(PropTimestamp)); ok && sec > 0 {
+		whole, frac := math.Modf(sec)
+		expires = time.Unix(int64(whole), int64(frac*1e9))
+	}
+	return token, expires, nil
+}
+
+// numberValue - 把应答中解码出的数值属性转换为 float64
+func numberValue(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
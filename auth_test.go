@@ -0,0 +1,239 @@
+package opio_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tc252617228/opio"
+	"github.com/tc252617228/opio/internal/utils"
+)
+
+// tokenServer 模拟开启令牌认证的服务端：记录每次登录发送的口令散列 (未开启令牌认证的测试也用它记录登录)，
+// 对 Token 主题的请求依次签发 tok-1、tok-2 ...，对其他请求记录附带的令牌。
+type tokenServer struct {
+	ttl         time.Duration
+	delay       time.Duration // 普通请求的处理时间
+	rejectRenew bool          // 拒绝附带旧令牌的刷新请求
+
+	mu       sync.Mutex
+	secrets  [][]byte // 每次登录应答中的口令散列
+	issued   int      // 已签发的令牌数
+	renewals []string // 刷新请求附带的旧令牌
+	seen     []string // 普通请求附带的令牌
+}
+
+func (s *tokenServer) serve(conn net.Conn) {
+	defer conn.Close()
+	greeting := make([]byte, 100)
+	copy(greeting, "OpenPlant test")
+	if writeFrame(conn, greeting) != nil {
+		return
+	}
+	reply, err := readMessage(conn)
+	if err != nil {
+		return
+	}
+	n := int(binary.BigEndian.Uint16(reply[60:]))
+	s.mu.Lock()
+	s.secrets = append(s.secrets, append([]byte(nil), reply[62:62+n]...))
+	s.mu.Unlock()
+	if writeFrame(conn, make([]byte, 16)) != nil {
+		return
+	}
+	for {
+		msg, err := readMessage(conn)
+		if err != nil {
+			return
+		}
+		resp := okResponse
+		s.mu.Lock()
+		presented := s.presented(msg)
+		if bytes.Contains(msg, []byte("\xa7Subject\xa5Token")) {
+			s.renewals = append(s.renewals, presented)
+			if s.rejectRenew && presented != "" {
+				resp = staleResponse
+			} else {
+				s.issued++
+				resp = tokenResponse("tok-"+strconv.Itoa(s.issued), time.Now().Add(s.ttl))
+			}
+		} else {
+			s.seen = append(s.seen, presented)
+		}
+		s.mu.Unlock()
+		time.Sleep(s.delay)
+		if writeFrame(conn, resp) != nil {
+			return
+		}
+	}
+}
+
+// presented - 请求中 Token 属性的值，没有附带令牌时为空
+func (s *tokenServer) presented(msg []byte) string {
+	for i := 1; i <= s.issued; i++ {
+		tok := "tok-" + strconv.Itoa(i)
+		if bytes.Contains(msg, append([]byte("\xa5Token"), append([]byte{0xa0 | byte(len(tok))}, tok...)...)) {
+			return tok
+		}
+	}
+	return ""
+}
+
+// tokenResponse 编码 {"Errno": 0, "Token": token, "Time": expires} + nil
+func tokenResponse(token string, expires time.Time) []byte {
+	b := []byte{0x83, 0xa5, 'E', 'r', 'r', 'n', 'o', 0x00}
+	b = append(b, 0xa5, 'T', 'o', 'k', 'e', 'n', 0xa0|byte(len(token)))
+	b = append(b, token...)
+	b = append(b, 0xa4, 'T', 'i', 'm', 'e', 0xcb)
+	var sec [8]byte
+	binary.BigEndian.PutUint64(sec[:], math.Float64bits(float64(expires.UnixNano())/1e9))
+	b = append(b, sec[:]...)
+	return append(b, 0xc0)
+}
+
+// staticCredentials 固定返回 sis/openplant
+var staticCredentials = opio.CredentialsFunc(func(ctx context.Context) (string, string, error) {
+	return "sis", "openplant", nil
+})
+
+func TestTokenAuthAttachesAndRefreshes(t *testing.T) {
+	srv := &tokenServer{ttl: time.Hour}
+	host, port := listenLocal(t, srv.serve)
+	random := make([]byte, 20) // fakeLogin 问候包中的随机数全为 0
+
+	var mu sync.Mutex
+	password := "openplant"
+	auth := opio.NewTokenAuth(opio.CredentialsFunc(func(ctx context.Context) (string, string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return "sis", password, nil
+	}))
+	client, err := opio.Connect(context.Background(), host, port, "", "", time.Second, opio.WithAuthenticator(auth))
+	require.NoError(t, err)
+	defer client.Close()
+
+	token, expires := auth.Token()
+	assert.Equal(t, "tok-1", token, "登录后应立即获取令牌")
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expires, time.Minute)
+
+	_, err = client.ExecSQL(context.Background(), "SELECT 1")
+	require.NoError(t, err)
+
+	// 令牌进入刷新窗口：下一次调用前用旧令牌换取新令牌，请求附带新令牌
+	require.NoError(t, auth.SetRefreshBefore(2*time.Hour))
+	_, err = client.ExecSQL(context.Background(), "SELECT 1")
+	require.NoError(t, err)
+	require.NoError(t, auth.SetRefreshBefore(0))
+	_, err = client.ExecSQL(context.Background(), "SELECT 1")
+	require.NoError(t, err)
+
+	// 新建的物理连接仍然用口令登录，口令在登录时从 CredentialProvider 获取，轮换后立即生效
+	mu.Lock()
+	password = "rotated"
+	mu.Unlock()
+	op, err := opio.InitContext(context.Background(), host, port, "", "", opio.WithAuthenticator(auth))
+	require.NoError(t, err)
+	_ = op.Close()
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	assert.Equal(t, []string{"", "tok-1"}, srv.renewals)
+	assert.Equal(t, []string{"tok-1", "tok-2", "tok-2"}, srv.seen)
+	require.Len(t, srv.secrets, 2)
+	assert.Equal(t, utils.Scramle(random, []byte("openplant")), srv.secrets[0])
+	assert.Equal(t, utils.Scramle(random, []byte("rotated")), srv.secrets[1])
+}
+
+func TestTokenAuthReloginAfterExpiry(t *testing.T) {
+	srv := &tokenServer{ttl: -time.Second} // 签发的令牌已经过期
+	host, port := listenLocal(t, srv.serve)
+
+	auth := opio.NewTokenAuth(staticCredentials)
+	op, err := opio.InitContext(context.Background(), host, port, "", "", opio.WithAuthenticator(auth))
+	require.NoError(t, err)
+	_ = op.Close()
+
+	// 令牌过期后新连接仍然用口令登录，并且不附带过期的令牌重新申请
+	op, err = opio.InitContext(context.Background(), host, port, "", "", opio.WithAuthenticator(auth))
+	require.NoError(t, err)
+	_ = op.Close()
+	token, _ := auth.Token()
+	assert.Equal(t, "tok-2", token)
+
+	srv.mu.Lock()
+	assert.Equal(t, []string{"", ""}, srv.renewals)
+	require.Len(t, srv.secrets, 2)
+	assert.Equal(t, srv.secrets[0], srv.secrets[1])
+	srv.mu.Unlock()
+	assert.Error(t, auth.SetRefreshBefore(-time.Second))
+}
+
+func TestTokenAuthRenewRejected(t *testing.T) {
+	srv := &tokenServer{ttl: time.Hour, rejectRenew: true}
+	host, port := listenLocal(t, srv.serve)
+
+	auth := opio.NewTokenAuth(staticCredentials)
+	client, err := opio.Connect(context.Background(), host, port, "", "", time.Second, opio.WithAuthenticator(auth))
+	require.NoError(t, err)
+	defer client.Close()
+
+	// 服务端拒绝刷新时不附带旧令牌重新申请
+	require.NoError(t, auth.SetRefreshBefore(2*time.Hour))
+	_, err = client.ExecSQL(context.Background(), "SELECT 1")
+	require.NoError(t, err)
+	token, _ := auth.Token()
+	assert.Equal(t, "tok-2", token)
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	assert.Equal(t, []string{"", "tok-1", ""}, srv.renewals)
+	assert.Equal(t, []string{"tok-2"}, srv.seen)
+}
+
+func TestPasswordAuthHandshake(t *testing.T) {
+	var secret []byte
+	done := make(chan struct{})
+	host, port := listenLocal(t, func(conn net.Conn) {
+		defer conn.Close()
+		greeting := make([]byte, 100)
+		copy(greeting, "OpenPlant test")
+		if writeFrame(conn, greeting) != nil {
+			return
+		}
+		reply, err := readMessage(conn)
+		if err != nil {
+			return
+		}
+		secret = reply[62:82]
+		close(done)
+		_ = writeFrame(conn, make([]byte, 16))
+		_, _ = io.Copy(io.Discard, conn)
+	})
+
+	op, err := opio.InitContext(context.Background(), host, port, "", "", opio.WithAuthenticator(opio.PasswordAuth{User: "sis", Password: "openplant"}))
+	require.NoError(t, err)
+	defer op.Close()
+	<-done
+	assert.Equal(t, utils.Scramle(make([]byte, 20), []byte("openplant")), secret)
+}
+
+func TestAuthenticatorWithCredentialsRejected(t *testing.T) {
+	// 两种凭据来源同时设置时直接返回错误，不会拨号
+	opts := []opio.ConnectOption{opio.WithAuthenticator(opio.NewTokenAuth(staticCredentials)), opio.WithCredentials(staticCredentials)}
+	_, err := opio.InitContext(context.Background(), "127.0.0.1", 1, "", "", opts...)
+	assert.ErrorContains(t, err, "cannot be used together")
+	_, err = opio.Connect(context.Background(), "127.0.0.1", 1, "", "", time.Second, opts...)
+	assert.ErrorContains(t, err, "cannot be used together")
+
+	_, err = opio.OpenConfig(context.Background(), &opio.Config{Host: "127.0.0.1", Port: 1, Auth: opio.NewTokenAuth(staticCredentials), PasswordFile: "/run/secrets/op"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,450 @@
+package opio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrBulkInserterClosed 表示在已关闭的 BulkInserter 上添加数据或刷新。
+var ErrBulkInserterClosed = errors.New("opio: bulk inserter is closed")
+
+// 批次大小的默认值
+const (
+	DefaultBulkMaxRows  = 1000
+	DefaultBulkMaxBytes = 1 << 20
+)
+
+// BulkOptions 是 BulkInserter 的参数，零值字段使用默认值。
+type BulkOptions struct {
+	MaxRows       int                  // 每批最多的行数，默认 DefaultBulkMaxRows
+	MaxBytes      int                  // 每批行数据编码后的最大字节数 (按 Table.bufSize 统计)，默认 DefaultBulkMaxBytes；单行超过时单独成批
+	FlushInterval time.Duration        // 一批的第一行加入后最多等待多久发送，0 表示只按行数与字节数发送
+	Concurrency   int                  // 同时发送的批次数，每个批次占用连接池中的一个连接，默认 1
+	OnError       func(err *BulkError) // 每个失败的批次调用一次，在发送批次的 goroutine 中调用
+}
+
+// BulkError 描述一个写入失败的批次。FirstRow 为批次第一行的序号 (按 Add/AddStruct 接受的顺序，从 0 开始)。
+type BulkError struct {
+	Table    string
+	FirstRow int64
+	Rows     int
+	Err      error
+}
+
+func (e *BulkError) Error() string {
+	return fmt.Sprintf("opio: 批量插入 %s 第 %d-%d 行失败: %v", e.Table, e.FirstRow, e.FirstRow+int64(e.Rows)-1, e.Err)
+}
+
+func (e *BulkError) Unwrap() error {
+	return e.Err
+}
+
+// BulkStats 是 BulkInserter 的累计统计。
+type BulkStats struct {
+	Rows         int64 // 写入成功的行数
+	Chunks       int64 // 写入成功的批次数
+	FailedRows   int64 // 写入失败的行数
+	FailedChunks int64 // 写入失败的批次数
+}
+
+// BulkInserter 把逐行添加的数据分批插入一张表，由 Client.BulkInserter 创建。
+// 每行在 Add/AddStruct 时立即编码，行数达到 MaxRows、编码后的字节数达到 MaxBytes 或等待超过 FlushInterval 时
+// 当前批次在后台发送，最多 Concurrency 个批次同时发送，全部在发送中时 Add 阻塞。
+// 并发发送时批次的写入顺序不确定。
+//
+// 列由第一行决定：map 的键 (按名称排序) 或结构体的字段 (映射规则与 InsertStructs 相同)，类型由第一行的值推断。
+// 之后的行缺少的列或值为 nil 的列不设置，多出的列返回错误。
+//
+// 失败的批次通过 OnError 报告，Flush 与 Close 等待发送中的批次并返回其中第一个错误。
+// BulkInserter 可以在多个 goroutine 中并发使用。
+type BulkInserter struct {
+	c     *Client
+	ctx   context.Context
+	table string
+	opts  BulkOptions
+
+	mu       sync.Mutex
+	cols     []bulkColumn           // 第一行确定的列
+	colIndex map[string]int         // 小写列名 -> 列下标
+	fields   map[reflect.Type][]int // 结构体类型 -> 每列对应的字段下标，-1 表示没有该字段
+	enc      *Table                 // 编码当前行
+	seen     []bool                 // 编码 map 时已设置的列
+	pending  []OPRow                // 当前批次
+	bytes    int                    // 当前批次的字节数
+	first    int64                  // 当前批次第一行的序号
+	next     int64                  // 下一行的序号
+	batch    int64                  // 批次编号，用于判断定时器是否过期
+	timer    *time.Timer
+	closed   bool
+
+	sem chan struct{} // 发送中的批次
+	wg  sync.WaitGroup
+
+	errMu    sync.Mutex
+	flushErr error // 上一次 Flush 之后第一个失败批次的错误
+	stats    BulkStats
+}
+
+type bulkColumn struct {
+	name string
+	typ  int
+}
+
+// BulkInserter 返回向 tableName 分批插入数据的 BulkInserter，用完后必须调用 Close。
+// ctx 作用于所有批次的发送 (每个批次另外受客户端默认超时的限制)，ctx 结束后 Add 与 Flush 返回错误。
+func (c *Client) BulkInserter(ctx context.Context, tableName string, opts *BulkOptions) (*BulkInserter, error) {
+	if c.closed() {
+		return nil, ErrConnectionClosed
+	}
+	b := &BulkInserter{c: c, ctx: ctx, table: tableName}
+	if opts != nil {
+		b.opts = *opts
+	}
+	if b.opts.MaxRows < 0 || b.opts.MaxBytes < 0 || b.opts.FlushInterval < 0 || b.opts.Concurrency < 0 {
+		return nil, errors.New("opio.Client.BulkInserter: BulkOptions 的参数不能为负数")
+	}
+	if b.opts.MaxRows == 0 {
+		b.opts.MaxRows = DefaultBulkMaxRows
+	}
+	if b.opts.MaxBytes == 0 {
+		b.opts.MaxBytes = DefaultBulkMaxBytes
+	}
+	if b.opts.Concurrency == 0 {
+		b.opts.Concurrency = 1
+	}
+	b.sem = make(chan struct{}, b.opts.Concurrency)
+	return b, nil
+}
+
+// Add 添加一行 map 数据，键为列名 (不区分大小写)。值无法编码为列的类型时返回错误，该行不会被插入。
+// 创建时的 ctx 结束后，需要发送批次的 Add 返回 ctx 的错误，该批次记为失败。
+func (b *BulkInserter) Add(row map[string]interface{}) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrBulkInserterClosed
+	}
+	if b.cols == nil {
+		names := make([]string, 0, len(row))
+		for name := range row {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		cols := make([]bulkColumn, len(names))
+		for i, name := range names {
+			v, ok := bulkValue(reflect.ValueOf(row[name]))
+			if !ok {
+				return fmt.Errorf("opio.BulkInserter.Add: 第一行的列 %s 为 nil，无法推断类型", name)
+			}
+			cols[i] = bulkColumn{name: name, typ: columnType(v)}
+		}
+		if err := b.setColumns(cols); err != nil {
+			return fmt.Errorf("opio.BulkInserter.Add: %w", err)
+		}
+	}
+
+	for i := range b.seen {
+		b.seen[i] = false
+	}
+	for name, value := range row {
+		col, ok := b.colIndex[strings.ToLower(name)]
+		if !ok {
+			b.enc.discardRow()
+			return fmt.Errorf("opio.BulkInserter.Add: 列 %s 不在批量插入的列中", name)
+		}
+		b.seen[col] = true
+		if err := b.setValue(col, reflect.ValueOf(value)); err != nil {
+			return fmt.Errorf("opio.BulkInserter.Add: %w", err)
+		}
+	}
+	for col, set := range b.seen {
+		if !set {
+			b.setEmpty(col)
+		}
+	}
+	return b.bindLocked()
+}
+
+// AddStruct 添加一个结构体 (或结构体指针) 的数据，也可以传入结构体切片一次添加多行。
+// 字段与列的映射规则与 InsertStructs 相同，结构体中没有的列不设置。
+// 切片中某个元素出错时返回错误，之前的元素已经添加。
+func (b *BulkInserter) AddStruct(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		for i := 0; i < rv.Len(); i++ {
+			if err := b.AddStruct(rv.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("opio.BulkInserter.AddStruct: %w: %T", ErrScanElementInvalid, v)
+	}
+	plan, err := structPlanOf(rv.Type())
+	if err != nil {
+		return fmt.Errorf("opio.BulkInserter.AddStruct: %w", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrBulkInserterClosed
+	}
+	if b.cols == nil {
+		cols := make([]bulkColumn, len(plan.columns))
+		for i, name := range plan.columns {
+			// 按字段类型推断列类型，指针字段为 nil 时同样适用
+			typ := rv.Type().Field(plan.fields[strings.ToLower(name)]).Type
+			for typ.Kind() == reflect.Ptr {
+				typ = typ.Elem()
+			}
+			cols[i] = bulkColumn{name: name, typ: columnType(reflect.Zero(typ).Interface())}
+		}
+		if err = b.setColumns(cols); err != nil {
+			return fmt.Errorf("opio.BulkInserter.AddStruct: %w", err)
+		}
+	}
+
+	fields, ok := b.fields[rv.Type()]
+	if !ok {
+		fields = make([]int, len(b.cols))
+		for i, col := range b.cols {
+			idx, found := plan.fields[strings.ToLower(col.name)]
+			if !found {
+				idx = -1
+			}
+			fields[i] = idx
+		}
+		b.fields[rv.Type()] = fields
+	}
+	for col, idx := range fields {
+		if idx < 0 {
+			b.setEmpty(col)
+			continue
+		}
+		if err = b.setValue(col, rv.Field(idx)); err != nil {
+			return fmt.Errorf("opio.BulkInserter.AddStruct: %w", err)
+		}
+	}
+	return b.bindLocked()
+}
+
+// setColumns - 由第一行确定列并创建编码用的 Table
+func (b *BulkInserter) setColumns(cols []bulkColumn) error {
+	if len(cols) == 0 {
+		return errors.New("第一行没有可插入的列")
+	}
+	b.colIndex = make(map[string]int, len(cols))
+	for i, col := range cols {
+		key := strings.ToLower(col.name)
+		if _, dup := b.colIndex[key]; dup {
+			return fmt.Errorf("列名 %s 重复 (不区分大小写)", col.name)
+		}
+		b.colIndex[key] = i
+	}
+	b.cols = cols
+	b.fields = make(map[reflect.Type][]int)
+	b.seen = make([]bool, len(cols))
+	b.enc = b.newTable(1)
+	return nil
+}
+
+func (b *BulkInserter) newTable(capacity int) *Table {
+	t := NewTable(b.table, uint(capacity))
+	for _, col := range b.cols {
+		t.AddColumn(col.name, col.typ, 0)
+	}
+	return t
+}
+
+// setValue - 设置当前行的一列，nil 值不设置；出错时丢弃当前行
+func (b *BulkInserter) setValue(col int, v reflect.Value) error {
+	value, ok := bulkValue(v)
+	if !ok {
+		b.setEmpty(col)
+		return nil
+	}
+	if err := b.enc.SetColumnValue(uint32(col), value); err != nil {
+		b.enc.discardRow()
+		return fmt.Errorf("列 %s: %w", b.cols[col].name, err)
+	}
+	return nil
+}
+
+// setEmpty - 未设置的变长列需要写入空值，定长列保持未设置
+func (b *BulkInserter) setEmpty(col int) {
+	switch b.cols[col].typ {
+	case VtObject, VtBinary, VtString, VtSlice, VtMap, VtStructure:
+		_ = b.enc.SetColumnEmpty(uint32(col))
+	}
+}
+
+// bindLocked - 把编码好的当前行加入批次，达到批次上限时发送
+func (b *BulkInserter) bindLocked() error {
+	size := b.enc.bufSize
+	b.enc.BindRow()
+	row := b.enc.rows[len(b.enc.rows)-1]
+	b.enc.Clear()
+
+	if len(b.pending) > 0 && b.bytes+size > b.opts.MaxBytes {
+		if err := b.sendLocked(); err != nil {
+			return err
+		}
+	}
+	if len(b.pending) == 0 {
+		b.first = b.next
+		if b.opts.FlushInterval > 0 {
+			batch := b.batch
+			b.timer = time.AfterFunc(b.opts.FlushInterval, func() { b.flushBatch(batch) })
+		}
+	}
+	b.pending = append(b.pending, row)
+	b.bytes += size
+	b.next++
+	if len(b.pending) >= b.opts.MaxRows || b.bytes >= b.opts.MaxBytes {
+		return b.sendLocked()
+	}
+	return nil
+}
+
+// flushBatch - FlushInterval 到期时发送批次，批次已经发送过时什么也不做
+func (b *BulkInserter) flushBatch(batch int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.batch == batch && len(b.pending) > 0 {
+		_ = b.sendLocked()
+	}
+}
+
+// sendLocked - 在后台发送当前批次，发送中的批次达到 Concurrency 时等待
+func (b *BulkInserter) sendLocked() error {
+	rows, first := b.pending, b.first
+	b.pending, b.bytes = nil, 0
+	b.batch++
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+
+	// ctx 已经结束时不再发送，select 在两个分支都就绪时随机选择
+	if b.ctx.Err() == nil {
+		select {
+		case b.sem <- struct{}{}:
+		case <-b.ctx.Done():
+		}
+	}
+	if b.ctx.Err() != nil {
+		err := ctxError(b.ctx, "批量插入操作", b.table)
+		b.finish(first, len(rows), err)
+		return err
+	}
+	t := b.newTable(0)
+	t.SetRows(&rows)
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		err := b.c.insertTable(b.ctx, b.table, t)
+		<-b.sem
+		b.finish(first, len(rows), err)
+	}()
+	return nil
+}
+
+// finish - 记录一个批次的结果，失败时调用 OnError
+func (b *BulkInserter) finish(first int64, rows int, err error) {
+	var bulkErr *BulkError
+	b.errMu.Lock()
+	if err == nil {
+		b.stats.Rows += int64(rows)
+		b.stats.Chunks++
+	} else {
+		b.stats.FailedRows += int64(rows)
+		b.stats.FailedChunks++
+		bulkErr = &BulkError{Table: b.table, FirstRow: first, Rows: rows, Err: err}
+		if b.flushErr == nil {
+			b.flushErr = bulkErr
+		}
+	}
+	b.errMu.Unlock()
+	if bulkErr != nil && b.opts.OnError != nil {
+		b.opts.OnError(bulkErr)
+	}
+}
+
+// Flush 发送当前批次并等待所有发送中的批次完成，返回上一次 Flush 之后第一个失败批次的错误 (*BulkError)。
+func (b *BulkInserter) Flush() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrBulkInserterClosed
+	}
+	return b.flushLocked()
+}
+
+// Close 发送剩余的数据、等待所有批次完成并关闭 BulkInserter，返回值与 Flush 相同。可以重复调用。
+func (b *BulkInserter) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	return b.flushLocked()
+}
+
+// flushLocked - 在持有 mu 时调用，发送批次后释放 mu 再等待，发送中的批次完成时不需要 mu
+func (b *BulkInserter) flushLocked() error {
+	var err error
+	if len(b.pending) > 0 {
+		err = b.sendLocked()
+	}
+	b.mu.Unlock()
+	b.wg.Wait()
+
+	b.errMu.Lock()
+	defer b.errMu.Unlock()
+	if b.flushErr != nil {
+		err, b.flushErr = b.flushErr, nil
+	}
+	return err
+}
+
+// Stats 返回累计的写入统计。
+func (b *BulkInserter) Stats() BulkStats {
+	b.errMu.Lock()
+	defer b.errMu.Unlock()
+	return b.stats
+}
+
+// bulkValue - 取出要写入的值：指针取其指向的值，nil 与 nil 指针返回 false
+func bulkValue(v reflect.Value) (interface{}, bool) {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return nil, false
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil, false
+	}
+	return v.Interface(), true
+}
+
+// columnType - 与 Insert 相同，由值推断列类型，无法推断时使用 VtObject
+func columnType(v interface{}) int {
+	typ := inferOpioType(v)
+	if typ == VtNull {
+		typ = VtObject
+	}
+	return typ
+}
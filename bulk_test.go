@@ -0,0 +1,171 @@
+package opio_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tc252617228/opio"
+	"github.com/tc252617228/opio/opiotest"
+)
+
+type bulkRow struct {
+	ID   int32
+	Name *string   `opio:"GN"`
+	Time time.Time `db:"TM"`
+	AV   float64
+	Skip string `opio:"-"`
+}
+
+// seedBulk 创建批量写入使用的 Bulk 表
+func seedBulk(srv *opiotest.Server) {
+	srv.CreateTable("Bulk",
+		opiotest.Column{Name: "ID", Type: opio.VtInt32, Key: true},
+		opiotest.Column{Name: "GN", Type: opio.VtString},
+		opiotest.Column{Name: "TM", Type: opio.VtDateTime},
+		opiotest.Column{Name: "AV", Type: opio.VtDouble},
+	)
+}
+
+func TestBulkInserterRows(t *testing.T) {
+	srv, client := opiotest.NewClient(t, seedBulk)
+	ctx := context.Background()
+
+	bulk, err := client.BulkInserter(ctx, "Bulk", &opio.BulkOptions{MaxRows: 10})
+	require.NoError(t, err)
+	tm := time.Unix(1700000000, 0)
+	for i := 0; i < 25; i++ {
+		row := map[string]interface{}{"ID": int32(i), "TM": tm.Add(time.Duration(i) * time.Second), "AV": float64(i) / 2}
+		if i%2 == 0 {
+			row["gn"] = fmt.Sprintf("W3.B.%d", i) // 列名不区分大小写，缺少的列不设置
+		}
+		require.NoError(t, bulk.Add(row))
+	}
+	// 两个满批次已经发送，剩余 5 行在 Close 时发送
+	require.NoError(t, bulk.Close())
+	assert.Equal(t, opio.BulkStats{Rows: 25, Chunks: 3}, bulk.Stats())
+	assert.Equal(t, 3, srv.Requests(opio.ActionInsert))
+	assert.ErrorIs(t, bulk.Add(map[string]interface{}{"ID": int32(99)}), opio.ErrBulkInserterClosed)
+
+	rows := srv.Rows("Bulk")
+	require.Len(t, rows, 25)
+	assert.Equal(t, "W3.B.4", rows[4]["GN"])
+	assert.Equal(t, 12.0, rows[24]["AV"])
+	res, err := client.ExecSQL(ctx, "SELECT TM FROM Bulk WHERE ID = 7")
+	require.NoError(t, err)
+	require.Len(t, res.Rows, 1)
+	assert.Equal(t, int64(1700000007), res.Rows[0]["TM"].(time.Time).Unix())
+}
+
+func TestBulkInserterStructs(t *testing.T) {
+	srv, client := opiotest.NewClient(t, seedBulk)
+	ctx := context.Background()
+
+	// 按字节数分批，多个批次并发发送
+	bulk, err := client.BulkInserter(ctx, "Bulk", &opio.BulkOptions{MaxBytes: 400, Concurrency: 3})
+	require.NoError(t, err)
+	data := make([]bulkRow, 100)
+	for i := range data {
+		data[i] = bulkRow{ID: int32(i), Time: time.Unix(1700000000, 0), AV: 1, Skip: "x"}
+		if i%3 == 0 {
+			name := fmt.Sprintf("W3.S.%03d", i)
+			data[i].Name = &name
+		}
+	}
+	require.NoError(t, bulk.AddStruct(data[:50]))
+	for i := range data[50:] {
+		require.NoError(t, bulk.AddStruct(&data[50+i]))
+	}
+	require.NoError(t, bulk.Flush())
+	stats := bulk.Stats()
+	assert.Equal(t, int64(100), stats.Rows)
+	assert.Greater(t, stats.Chunks, int64(3))
+	assert.Equal(t, int(stats.Chunks), srv.Requests(opio.ActionInsert))
+
+	rows := srv.Rows("Bulk")
+	require.Len(t, rows, 100)
+	names := 0
+	for _, row := range rows {
+		if row["GN"] != "" && row["GN"] != nil {
+			names++
+		}
+	}
+	assert.Equal(t, 34, names)
+
+	// 不能编码的行被拒绝，不影响其他行
+	err = bulk.Add(map[string]interface{}{"ID": "not a number"})
+	assert.Error(t, err)
+	err = bulk.Add(map[string]interface{}{"ID": int32(200), "XX": 1})
+	assert.Error(t, err)
+	require.NoError(t, bulk.Add(map[string]interface{}{"ID": int32(201), "AV": 2.5}))
+	require.NoError(t, bulk.Close())
+	assert.Len(t, srv.Rows("Bulk"), 101)
+	require.NoError(t, bulk.Close())
+}
+
+func TestBulkInserterInterval(t *testing.T) {
+	srv, client := opiotest.NewClient(t, seedBulk)
+	bulk, err := client.BulkInserter(context.Background(), "Bulk", &opio.BulkOptions{FlushInterval: 20 * time.Millisecond})
+	require.NoError(t, err)
+	defer bulk.Close()
+
+	require.NoError(t, bulk.Add(map[string]interface{}{"ID": int32(1), "AV": 1.0}))
+	require.NoError(t, bulk.Add(map[string]interface{}{"ID": int32(2), "AV": 2.0}))
+	assert.Eventually(t, func() bool { return len(srv.Rows("Bulk")) == 2 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, 1, srv.Requests(opio.ActionInsert))
+}
+
+func TestBulkInserterErrors(t *testing.T) {
+	_, client := opiotest.NewClient(t, seedBulk)
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var reported []*opio.BulkError
+	bulk, err := client.BulkInserter(ctx, "Missing", &opio.BulkOptions{
+		MaxRows:     4,
+		Concurrency: 2,
+		OnError: func(err *opio.BulkError) {
+			mu.Lock()
+			reported = append(reported, err)
+			mu.Unlock()
+		},
+	})
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, bulk.Add(map[string]interface{}{"ID": int32(i)}))
+	}
+	err = bulk.Close()
+	var bulkErr *opio.BulkError
+	require.True(t, errors.As(err, &bulkErr), "%v", err)
+	assert.Equal(t, "Missing", bulkErr.Table)
+	var serverErr *opio.OpioServerError
+	assert.True(t, errors.As(err, &serverErr), "%v", err)
+
+	mu.Lock()
+	require.Len(t, reported, 3)
+	first := map[int64]int{}
+	for _, r := range reported {
+		first[r.FirstRow] = r.Rows
+	}
+	mu.Unlock()
+	assert.Equal(t, map[int64]int{0: 4, 4: 4, 8: 2}, first)
+	assert.Equal(t, opio.BulkStats{FailedRows: 10, FailedChunks: 3}, bulk.Stats())
+	assert.Equal(t, 0, client.PoolStats().InUse)
+
+	// ctx 结束后发送失败
+	cctx, cancel := context.WithCancel(ctx)
+	bulk, err = client.BulkInserter(cctx, "Bulk", &opio.BulkOptions{MaxRows: 1})
+	require.NoError(t, err)
+	cancel()
+	err = bulk.Add(map[string]interface{}{"ID": int32(1)})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, bulk.Close(), context.Canceled)
+
+	_, err = client.BulkInserter(ctx, "Bulk", &opio.BulkOptions{MaxRows: -1})
+	assert.Error(t, err)
+}
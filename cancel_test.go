@@ -0,0 +1,120 @@
+package opio_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tc252617228/opio"
+)
+
+// staleResponse 是一个 Errno=1 的应答，如果被后续请求读到说明数据流已经错位
+var staleResponse = []byte{0x81, 0xa5, 'E', 'r', 'r', 'n', 'o', 0x01, 0xc0}
+
+func TestCancelledCallDoesNotDesyncNextCall(t *testing.T) {
+	var dials int32
+	host, port := listenLocal(t, func(conn net.Conn) {
+		defer conn.Close()
+		atomic.AddInt32(&dials, 1)
+		if fakeLogin(conn) != nil {
+			return
+		}
+		for {
+			msg, err := readMessage(conn)
+			if err != nil {
+				return
+			}
+			resp := okResponse
+			if bytes.Contains(msg, []byte("SLOW")) {
+				time.Sleep(300 * time.Millisecond) // 应答晚于客户端的截止时间到达
+				resp = staleResponse
+			}
+			if writeFrame(conn, resp) != nil {
+				return
+			}
+		}
+	})
+
+	client, err := opio.Connect(context.Background(), host, port, "sis", "openplant", time.Second)
+	require.NoError(t, err)
+	defer client.Close()
+	cfg := opio.DefaultPoolConfig()
+	cfg.MaxConns = 1 // 强制两次调用使用同一个连接槽位
+	require.NoError(t, client.SetPoolConfig(cfg))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = client.ExecSQL(ctx, "SELECT SLOW")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, opio.ErrTimeout)
+	assert.Less(t, time.Since(start), 250*time.Millisecond, "截止时间应当打断阻塞中的读取")
+
+	_, err = client.ExecSQL(context.Background(), "SELECT 1")
+	require.NoError(t, err, "被取消的调用残留的应答不应被下一个请求读到")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&dials), "被污染的连接应当被替换")
+}
+
+func TestCancelInterruptsBlockedCall(t *testing.T) {
+	host, port := listenLocal(t, func(conn net.Conn) {
+		defer conn.Close()
+		if fakeLogin(conn) != nil {
+			return
+		}
+		_, _ = readMessage(conn)
+		_, _ = readMessage(conn) // 从不应答，直到客户端关闭连接
+	})
+
+	client, err := opio.Connect(context.Background(), host, port, "sis", "openplant", time.Second)
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err = client.ExecSQL(ctx, "SELECT 1")
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Less(t, time.Since(start), time.Second)
+
+	// 调用返回时连接已经归还 (并被丢弃)，而不是仍被后台 goroutine 占用
+	assert.Equal(t, 0, client.PoolStats().InUse)
+	assert.Equal(t, 0, client.PoolStats().Open)
+}
+
+func TestDeadlineReportsTimeoutNotDisconnect(t *testing.T) {
+	host, port := listenLocal(t, func(conn net.Conn) {
+		defer conn.Close()
+		if fakeLogin(conn) != nil {
+			return
+		}
+		for {
+			if _, err := readMessage(conn); err != nil { // 从不应答
+				return
+			}
+		}
+	})
+	client, err := opio.Connect(context.Background(), host, port, "sis", "openplant", time.Second)
+	require.NoError(t, err)
+	defer client.Close()
+	var disconnects int32
+	require.NoError(t, client.SetReconnectPolicy(opio.ReconnectPolicy{
+		OnDisconnect: func(err error) { atomic.AddInt32(&disconnects, 1) },
+	}))
+
+	// 连接上的截止时间与 ctx 的定时器同时到期，谁先触发都应当按超时处理，而不是断线
+	for i := 0; i < 20; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		_, err = client.ExecSQL(ctx, "SELECT 1")
+		cancel()
+		require.ErrorIs(t, err, opio.ErrTimeout)
+	}
+	assert.Equal(t, int32(0), atomic.LoadInt32(&disconnects))
+	assert.Equal(t, opio.HealthHealthy, client.Health().State)
+}
@@ -0,0 +1,51 @@
+package opio
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// Capabilities 描述服务端的版本，由登录问候包中的版本号与版本信息推导，可用于按版本选择功能。
+type Capabilities struct {
+	Major, Minor, Patch int
+	Info                string // 问候包中的服务端版本信息，例如 "OpenPlant 4.1.2"
+}
+
+// versionPattern - 从版本信息中提取 "主.次[.修订]" 形式的版本号
+var versionPattern = regexp.MustCompile(`(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// newCapabilities - 问候包中的版本号 (0x00MMmmpp) 为 0 时 (部分旧版本服务端不填写) 改从版本信息中解析
+func newCapabilities(version int32, info string) Capabilities {
+	c := Capabilities{Info: info}
+	if version != 0 {
+		c.Major, c.Minor, c.Patch = int(uint8(version>>16)), int(uint8(version>>8)), int(uint8(version))
+	} else if m := versionPattern.FindStringSubmatch(info); m != nil {
+		c.Major, _ = strconv.Atoi(m[1])
+		c.Minor, _ = strconv.Atoi(m[2])
+		c.Patch, _ = strconv.Atoi(m[3]) // 缺省时为 0
+	}
+	return c
+}
+
+// AtLeast 判断服务端版本是否不低于 major.minor。
+func (c Capabilities) AtLeast(major, minor int) bool {
+	return c.Major > major || (c.Major == major && c.Minor >= minor)
+}
+
+// String 返回 "主.次.修订" 形式的版本号。
+func (c Capabilities) String() string {
+	return fmt.Sprintf("%d.%d.%d", c.Major, c.Minor, c.Patch)
+}
+
+// Capabilities 返回连接登录时从服务端问候包推导出的协议特性。
+func (op *IOConnect) Capabilities() Capabilities {
+	return newCapabilities(op.version, op.info)
+}
+
+// Capabilities 返回客户端当前连接的服务端 (最近一次新建连接的端点) 支持的协议特性。
+func (c *Client) Capabilities() Capabilities {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.caps
+}
@@ -0,0 +1,106 @@
+package opio_test
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tc252617228/opio"
+)
+
+// pointColumns 是 {"Errno": 0, "Columns": [{"Name": "ID", "Type": VtInt32, "Length": 4}]}
+var pointColumns = []byte{
+	0x82, 0xa5, 'E', 'r', 'r', 'n', 'o', 0x00,
+	0xa7, 'C', 'o', 'l', 'u', 'm', 'n', 's', 0x91,
+	0x83, 0xa4, 'N', 'a', 'm', 'e', 0xa2, 'I', 'D',
+	0xa4, 'T', 'y', 'p', 'e', 0x04,
+	0xa6, 'L', 'e', 'n', 'g', 't', 'h', 0x04,
+}
+
+// idRow 编码只有一个 int32 列的数据行：4 字节定长数据 + 1 字节非空标记
+func idRow(id int32) []byte {
+	row := make([]byte, 5)
+	binary.BigEndian.PutUint32(row, uint32(id))
+	row[4] = 0x01
+	return row
+}
+
+// versionServer 在问候包中声明服务端版本，返回 ID 为 7、8 的两行数据。
+type versionServer struct {
+	version int32
+	info    string
+	msgs    chan []byte // 收到的请求，为空时不记录
+}
+
+func (s *versionServer) serve(conn net.Conn) {
+	defer conn.Close()
+	greeting := make([]byte, 100)
+	copy(greeting, s.info)
+	binary.BigEndian.PutUint32(greeting[96:], uint32(s.version))
+	if writeFrame(conn, greeting) != nil {
+		return
+	}
+	if _, err := readMessage(conn); err != nil {
+		return
+	}
+	if writeFrame(conn, make([]byte, 16)) != nil {
+		return
+	}
+	for {
+		msg, err := readMessage(conn)
+		if err != nil {
+			return
+		}
+		select {
+		case s.msgs <- msg:
+		default:
+		}
+		resp := append([]byte(nil), pointColumns...)
+		resp = append(resp, 0x92)
+		for _, id := range []int32{7, 8} {
+			resp = append(append(resp, 0xc4, 5), idRow(id)...)
+		}
+		resp = append(resp, 0xc0)
+		if writeFrame(conn, resp) != nil {
+			return
+		}
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		version int32
+		info    string
+		want    string
+	}{
+		{"v3 server", 0x030512, "OpenPlant 3.5.18", "3.5.18"},
+		{"v4 server", 0x040100, "OpenPlant", "4.1.0"},
+		{"version from info", 0, "OpenPlant 4.2.7 (x64)", "4.2.7"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := &versionServer{version: tc.version, info: tc.info, msgs: make(chan []byte, 1)}
+			host, port := listenLocal(t, srv.serve)
+			client, err := opio.Connect(context.Background(), host, port, "sis", "openplant", time.Second)
+			require.NoError(t, err)
+			defer client.Close()
+
+			caps := client.Capabilities()
+			assert.Equal(t, tc.want, caps.String())
+			assert.True(t, caps.AtLeast(3, 5))
+			assert.False(t, caps.AtLeast(5, 0))
+
+			// 服务端版本不影响应答格式，请求中也不带额外的属性
+			res, err := client.Query(context.Background(), "Point", []string{"ID"}, nil)
+			require.NoError(t, err)
+			assert.NotContains(t, string(<-srv.msgs), "Protocol")
+			require.Len(t, res.Rows, 2)
+			assert.Equal(t, int32(7), res.Rows[0]["ID"])
+			assert.Equal(t, int32(8), res.Rows[1]["ID"])
+		})
+	}
+}
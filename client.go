@@ -8,9 +8,12 @@ import (
 	"reflect" // 导入反射包
 	"strconv" // 导入字符串转换包
 	"strings" // 导入字符串处理包
+	"sync"
 	"time"
 
 	"encoding/json" // 用于 JSON 处理 (Scan TODO)
+
+	"github.com/tc252617228/opio/internal/utils"
 )
 
 // ====================================================================================
@@ -60,11 +63,42 @@ func (e *OpioServerError) Unwrap() error {
 
 // Client 代表与 OpenPlant 服务的连接，封装了底层操作。
 // 它提供了 V2 风格的通用 CRUD、V3 风格的时序数据操作、SQL 执行和实时数据订阅功能。
+// 每次调用都会从内置连接池借出一个独立的连接，调用结束后归还，因此同一个 Client 可以被多个 goroutine 并发使用。
 type Client struct {
-	conn            *IOConnect    // 底层连接对象
+	pool            *connPool     // 内置连接池
 	compressionMode byte          // 当前连接的压缩模式
 	Logger          *log.Logger   // 可选的日志记录器
 	defaultTimeout  time.Duration // 默认请求超时 (如果 context 没有设置)
+	db              string        // 默认数据库 (来自 Config.DB)，QueryOptions.DB 为空时使用
+
+	// 连接参数，连接池新建连接与断线重连时复用
+	host        string
+	port        int
+	user        string
+	pass        string
+	dialTimeout time.Duration  // 单次拨号与登录的超时
+	opts        connectOptions // 拨号器、TLS 等连接选项
+
+	mu           sync.Mutex      // 保护下面的重连、保活与健康状态
+	reconnect    ReconnectPolicy // 断线重连策略
+	disconnected bool            // 是否处于断线状态 (已触发 OnDisconnect，尚未重连成功)
+
+	keepaliveStop chan struct{} // 关闭时停止后台保活任务，nil 表示未启用
+	lastRoundTrip time.Time     // 最近一次成功往返的时间
+	rtt           time.Duration // 最近一次保活探测的往返时间
+	failures      int           // 连续失败次数
+	lastErr       error         // 最近一次失败的错误
+	dialBroken    bool          // 最近一次新建连接失败
+
+	endpoints    []Endpoint              // 主端点与备用端点，按优先级排列
+	failover     FailoverConfig          // 故障切换配置
+	active       int                     // 当前活动端点 (最近一次成功建立连接的端点) 的下标
+	activeDown   bool                    // 当前活动端点上的连接刚刚断开
+	downErr      error                   // 导致 activeDown 的错误
+	retryAt      []time.Time             // 拨号失败的端点在此时间之前不优先尝试 (FailoverSticky)，按需分配
+	failoverStop chan struct{}           // 关闭时停止切回主服务器的探测，nil 表示未启用
+	subs         map[*Subscribe]struct{} // 客户端创建的订阅，切换端点时一并迁移
+	caps         Capabilities            // 最近一次新建连接的服务端协议特性
 }
 
 // SetDefaultTimeout 设置客户端操作的默认超时时间。
@@ -77,6 +111,107 @@ func (c *Client) SetDefaultTimeout(duration time.Duration) {
 	c.defaultTimeout = duration
 }
 
+// SetPoolConfig 设置客户端内置连接池的参数 (最少/最多连接数、空闲超时、最长存活时间、借出时的健康检查)。
+// 新的 MaxConns 对之后的借用生效，已打开的连接在归还或维护时按新参数处理。
+// 如果客户端已关闭，则返回 ErrConnectionClosed。
+func (c *Client) SetPoolConfig(cfg PoolConfig) error {
+	if c.closed() {
+		return ErrConnectionClosed
+	}
+	return c.pool.setConfig(cfg)
+}
+
+// PoolStats 返回客户端连接池当前状态的快照。
+func (c *Client) PoolStats() PoolStats {
+	if c.pool == nil {
+		return PoolStats{}
+	}
+	return c.pool.stats()
+}
+
+// closed 报告客户端是否已关闭。
+func (c *Client) closed() bool {
+	return c.pool == nil || c.pool.isClosed()
+}
+
+// withConn 从连接池借出一个连接，并在当前 goroutine 中执行 fn。
+// ctx 的截止时间与取消通过 net.Conn 的读写截止时间生效，会直接打断阻塞中的网络 IO，
+// 而不是让后台 goroutine 继续占用连接。被打断或中途出错的连接会被标记为污染并在归还时关闭，
+// 成功的连接在归还前读掉残留的应答，因此一次超时的调用不会让后续请求读到错位的数据。
+func (c *Client) withConn(ctx context.Context, fn func(op *IOConnect) error) error {
+	_, err := c.runConn(ctx, fn)
+	return err
+}
+
+// withReadConn 与 withConn 相同，用于幂等的读操作：
+// 如果连接在执行过程中断开且重连策略启用了 RetryIdempotent，则在重连后重试一次。
+func (c *Client) withReadConn(ctx context.Context, fn func(op *IOConnect) error) error {
+	lost, err := c.runConn(ctx, fn)
+	if lost && ctx.Err() == nil && c.reconnectPolicy().RetryIdempotent {
+		_, err = c.runConn(ctx, fn)
+	}
+	return err
+}
+
+// runConn 借出连接执行 fn，lost 报告失败是否由连接断开 (而不是 ctx 结束或服务端错误) 引起。
+func (c *Client) runConn(ctx context.Context, fn func(op *IOConnect) error) (lost bool, err error) {
+	op, err := c.pool.acquire(ctx) // 从连接池借出一个连接
+	if err != nil {
+		return false, fmt.Errorf("获取连接失败: %w", err)
+	}
+	defer c.pool.release(op) // 操作结束后归还连接
+
+	stop := op.watchContext(ctx)
+	if err = op.authorize(ctx); err == nil { // 令牌临近过期时先在该连接上刷新
+		err = fn(op)
+	}
+	stop()
+	return c.settleConn(ctx, op, err), err
+}
+
+// settleConn 在一次请求结束、连接归还之前记录连接的健康状态并整理数据流，返回失败是否由连接断开引起。
+func (c *Client) settleConn(ctx context.Context, op *IOConnect, err error) (lost bool) {
+	if err != nil && ctx.Err() == nil {
+		// watchContext 把 ctx 的截止时间设置到连接上，连接的截止时间可能比 ctx 的定时器先触发，
+		// 此时等待 ctx 结束，按超时处理而不是断线
+		if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+			<-ctx.Done()
+		}
+	}
+
+	var serverErr *OpioServerError
+	switch {
+	case err != nil && ctx.Err() == nil && op.io.Err() != nil:
+		// 读写出错时 Response 可能被解析成一个服务端错误，以连接的出错状态为准
+		lost = true
+		c.endpointLost(op, op.io.Err())
+		c.recordFailure(op.io.Err())
+		c.connectionLost(op.io.Err())
+	case err == nil || errors.As(err, &serverErr):
+		c.recordRoundTrip(0)
+	}
+	// 服务端返回的业务错误不影响数据流，连接仍可复用；其他错误和取消都可能让应答只读了一半
+	op.settle(err != nil && !errors.As(err, &serverErr))
+	return lost
+}
+
+// ctxError 在 ctx 已结束时返回统一包装的超时 (ErrTimeout) 或取消错误，否则返回 nil。
+// action 为操作描述 (例如 "插入操作")，tableName 非空时附加到错误信息中。
+func ctxError(ctx context.Context, action string, tableName string) error {
+	err := ctx.Err()
+	if err == nil {
+		return nil
+	}
+	detail := ""
+	if tableName != "" {
+		detail = fmt.Sprintf(" (Table: %s)", tableName)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%s超时%s: %w", action, detail, ErrTimeout)
+	}
+	return fmt.Errorf("%s被取消%s: %w", action, detail, err)
+}
+
 // SetLogger 设置客户端使用的日志记录器。
 // logger: 一个 *log.Logger 实例。如果为 nil，则禁用日志记录。
 func (c *Client) SetLogger(logger *log.Logger) {
@@ -88,23 +223,42 @@ func (c *Client) SetLogger(logger *log.Logger) {
 }
 
 // Connect 建立到 OpenPlant 服务的新连接。
-// ctx: 用于控制连接生命周期的上下文。当此上下文被取消时，客户端将尝试自动关闭。
+// ctx: 控制拨号与登录握手。ctx 的截止时间或取消会中断连接过程并关闭半开的 socket。
 // host: 服务器主机名或 IP 地址。
 // port: 服务器端口号。
 // user: 用户名。
 // pass: 密码。
-// timeout: 连接尝试的超时时间。
-// 返回一个 Client 实例或错误。
-func Connect(ctx context.Context, host string, port int, user string, pass string, timeout time.Duration) (*Client, error) {
-	// 注意：原始的 Init 函数不接受 context，超时是在内部的 DialTimeout 中处理的。
-	// 这里暂时选择重用现有的 Init 函数。
-	op, err := Init(host, port, int(timeout.Seconds()), user, pass) // 重用现有的 Init 函数进行连接
+// timeout: 连接尝试 (拨号 + 登录握手) 的超时时间。如果为 0 或负数，则完全依赖 ctx。
+// opts: 可选的连接选项，例如 WithTLS、WithDialer。连接池新建的连接和订阅连接都使用相同的选项。
+// 返回一个 Client 实例或错误。连接失败时错误链中包含 *ConnectError，可通过 errors.As 获取失败阶段。
+func Connect(ctx context.Context, host string, port int, user string, pass string, timeout time.Duration, opts ...ConnectOption) (*Client, error) {
+	connectOpts := newConnectOptions(opts)
+	if err := connectOpts.validate(); err != nil {
+		return nil, err
+	}
+	connectOpts.traffic = new(utils.TrafficCounter) // 汇总该客户端所有连接的收发流量
+
+	// 创建 Client 实例，连接池中新建的连接复用相同的连接参数
+	client := &Client{host: host, port: port, user: user, pass: pass, dialTimeout: timeout, opts: connectOpts}
+	client.endpoints = []Endpoint{{Host: host, Port: port}}
+	if connectOpts.failover != nil {
+		if err := connectOpts.failover.validate(); err != nil {
+			return nil, err
+		}
+		client.failover = *connectOpts.failover
+		client.endpoints = append(client.endpoints, client.failover.Endpoints...)
+	}
+	// 首个连接按端点顺序依次尝试，timeout 约束每个端点的单次尝试
+	op, err := client.dialOnce(ctx)
 	if err != nil {
-		// Use custom error type if possible, otherwise wrap
 		return nil, fmt.Errorf("opio.Connect: 无法初始化连接到 %s:%d: %w", host, port, err)
 	}
 
-	client := &Client{conn: op} // 创建 Client 实例
+	client.pool = newConnPool(DefaultPoolConfig(), client.dial)
+	client.pool.stale = client.staleEndpoint
+	client.pool.put(op) // 首个连接作为空闲连接放入连接池
+	client.lastRoundTrip = time.Now()
+	client.startFailoverProbe()
 
 	// --- Ping 服务器以验证连接 (已注释掉) ---
 	// 在连接后执行 Ping 操作可能会因为服务器限制或权限问题导致失败 (例如 SELECT 1 返回 -116)。
@@ -127,13 +281,18 @@ func Connect(ctx context.Context, host string, port int, user string, pass strin
 }
 
 // Close 关闭与 OpenPlant 服务的连接。
+// 连接池中的空闲连接会被立即关闭，正在使用的连接在当前调用结束归还时关闭。
 // 如果连接已关闭或从未建立，则返回 ErrConnectionClosed。
 func (c *Client) Close() error {
-	if c.conn == nil {
+	if c.closed() {
 		return ErrConnectionClosed // 使用自定义错误
 	}
-	err := c.conn.Close() // 调用底层 IOConnect 的 Close 方法
-	c.conn = nil          // 将底层连接设为 nil，标记客户端为已关闭状态
+	c.stopKeepalive()
+	c.stopFailoverProbe()
+	err := c.pool.close() // 关闭连接池及其中的连接
+	if errors.Is(err, ErrConnectionClosed) {
+		return err
+	}
 	if err != nil {
 		// Enhanced error message
 		return fmt.Errorf("opio.Client.Close: 关闭连接时出错: %w", err)
@@ -145,11 +304,11 @@ func (c *Client) Close() error {
 // model: 压缩模式常量 (例如 opio.ZIP_MODEL_Uncompressed, opio.ZIP_MODEL_Frame)。类型为 byte。
 // 如果客户端未连接，则返回 ErrConnectionClosed。
 func (c *Client) SetCompression(model byte) error {
-	if c.conn == nil {
+	if c.closed() {
 		return ErrConnectionClosed // 使用自定义错误
 	}
-	// 调用底层 IOConnect 的 SetCompressModel 方法
-	err := c.conn.SetCompressModel(model)
+	// 设置连接池中所有连接的压缩模式，使用中的连接在下次借出时同步
+	err := c.pool.setCompression(compressSetting{mode: model})
 	if err == nil {
 		c.compressionMode = model // 如果设置成功，更新客户端实例中保存的压缩模式状态
 	}
@@ -159,7 +318,7 @@ func (c *Client) SetCompression(model byte) error {
 // Ping 向服务器发送一个简单的请求以检查连接是否仍然活跃。
 // ctx: 用于控制操作的上下文。
 func (c *Client) Ping(ctx context.Context) error {
-	if c.conn == nil {
+	if c.closed() {
 		return ErrConnectionClosed
 	}
 
@@ -189,6 +348,7 @@ func (c *Client) Ping(ctx context.Context) error {
 type QueryOptions struct {
 	DB      string   // 指定要查询的数据库名称 (如果需要)
 	Filters []Filter // 查询过滤器列表
+	Where   *Cond    // 用 Where/Col 构造的过滤条件，转换为 Filters 发送，不能与 Filters 同时设置
 	OrderBy string   // 排序条件 (例如 "column_name ASC")
 	Limit   string   // 分页限制 (例如 "10" 或 "10, 20")
 	// 可以根据 request.go 中的 Set* 方法添加其他相关选项，如 Key, Indexes 等。
@@ -210,9 +370,13 @@ type QueryResult struct {
 // 此方法封装了构建 Request、发送请求和解析 Response 的过程。
 // 如果提供的 context 没有截止时间，并且设置了 Client.defaultTimeout，则会应用默认超时。
 func (c *Client) Query(ctx context.Context, tableName string, columns []string, opts *QueryOptions) (*QueryResult, error) {
-	if c.conn == nil {
+	if c.closed() {
 		return nil, ErrConnectionClosed // 使用自定义错误
 	}
+	filters, err := opts.filters()
+	if err != nil {
+		return nil, fmt.Errorf("opio.Client.Query: %w", err)
+	}
 
 	// 应用默认超时 (如果需要且 context 没有 deadline)
 	var cancel context.CancelFunc
@@ -221,69 +385,20 @@ func (c *Client) Query(ctx context.Context, tableName string, columns []string,
 		defer cancel() // 确保在函数退出时取消
 	}
 
-	// 定义一个结构体，用于在 goroutine 和主线程之间传递结果和错误
-	type queryResultWithError struct {
-		result *QueryResult
-		err    error
-	}
-	done := make(chan queryResultWithError, 1) // 创建带缓冲的通道
-
-	// 启动一个 goroutine 来执行可能阻塞的网络操作
-	go func() {
-		// --- 在 goroutine 中执行实际的查询逻辑 ---
-		req := c.conn.NewRequest(nil) // 创建一个新的请求对象
-		defer req.Reset()             // 确保请求对象在使用后被重置，以便复用
-
-		// 设置基本的请求属性
-		req.SetService("openplant") // 假设服务名总是 "openplant"
-		req.SetAction(ActionSelect) // 设置操作类型为查询
-		req.SetTableName(tableName) // 设置要查询的表名
-
-		// --- 处理要查询的列 ---
-		// 创建一个临时的 Table 对象来承载要查询的列信息
-		queryTable := NewTable(tableName, 0) // 容量设为 0，因为我们只用它定义列
-		if len(columns) == 0 || (len(columns) == 1 && columns[0] == "*") {
-			// 如果请求查询所有列 ("*")
-			// 需要一种方式来告诉服务器查询所有列。
-			// 假设通过添加一个名为 "*" 的特殊列来实现。
-			queryTable.AddColumn("*", VtNull, 0) // 类型和长度可能不重要
-		} else {
-			// 如果指定了具体的列名
-			for _, colName := range columns {
-				// 添加指定的列名。查询时通常不需要指定类型和长度，服务器会返回。
-				queryTable.AddColumn(colName, VtNull, 0) // 使用 VtNull 作为占位符类型？
-			}
-		}
-		// 将包含列定义的 Table 对象设置到请求的 PropColumns 属性中
-		// 注意：原始的 SetTable 方法同时设置了 PropTable 和 PropColumns。
-		// 这里假设有一个 Set 方法可以直接设置属性，或者需要调整 SetTable/SetColumns 的逻辑。
-		req.Set(PropColumns, queryTable) // 假设这样可以将列定义传递给请求
+	// 在借出的连接上同步执行查询，ctx 结束时阻塞中的网络 IO 会被直接打断
+	var result *QueryResult
+	err = c.withReadConn(ctx, func(op *IOConnect) error {
+		req := op.NewRequest(nil) // 创建一个新的请求对象
+		defer req.Reset()         // 确保请求对象在使用后被重置，以便复用
 
-		// --- 应用查询选项 ---
-		if opts != nil {
-			if opts.DB != "" {
-				req.SetDB(opts.DB) // 设置数据库名
-			}
-			if len(opts.Filters) > 0 {
-				// 假设 Filter 结构与底层兼容
-				req.SetFilters(opts.Filters) // 设置过滤器
-			}
-			if opts.OrderBy != "" {
-				req.SetOrderBy(opts.OrderBy) // 设置排序条件
-			}
-			if opts.Limit != "" {
-				req.SetLimit(opts.Limit) // 设置分页限制
-			}
-			// 在此可以添加设置其他选项的逻辑...
-		}
+		c.setQuery(req, tableName, columns, opts, filters)
 
 		// --- 发送请求 ---
 		// 对于查询操作，通常只发送请求头 (包含属性)，没有数据体。
 		err := req.WriteAndFlush() // 发送请求头并刷新缓冲区
 		if err != nil {
 			err = fmt.Errorf("opio.Client.Query: 发送查询请求失败 (Table: %s): %w", tableName, err) // Enhanced error
-			done <- queryResultWithError{result: nil, err: err}
-			return
+			return err
 		}
 
 		// --- 获取并处理响应 ---
@@ -291,8 +406,7 @@ func (c *Client) Query(ctx context.Context, tableName string, columns []string,
 		res, err := req.GetResponse()
 		if err != nil {
 			err = fmt.Errorf("opio.Client.Query: 获取查询响应失败 (Table: %s): %w", tableName, err) // Enhanced error
-			done <- queryResultWithError{result: nil, err: err}
-			return
+			return err
 		}
 		// 注意：Response 对象本身通常不需要关闭，但其包含的 DataSet 需要关闭。
 
@@ -301,8 +415,7 @@ func (c *Client) Query(ctx context.Context, tableName string, columns []string,
 			// Wrap server error using custom type
 			serverErr := &OpioServerError{Code: res.GetErrNo(), Message: res.GetError()}
 			err = fmt.Errorf("opio.Client.Query: 查询失败 (Table: %s): %w", tableName, serverErr)
-			done <- queryResultWithError{result: nil, err: err}
-			return
+			return err
 		}
 
 		// 从响应中提取数据集 (DataSet)
@@ -310,13 +423,13 @@ func (c *Client) Query(ctx context.Context, tableName string, columns []string,
 		if dataSet == nil {
 			// 如果没有返回数据集 (可能是空结果或实现问题)
 			// 返回一个空的 QueryResult
-			done <- queryResultWithError{result: &QueryResult{Columns: []Column{}, Rows: []map[string]interface{}{}}, err: nil}
-			return
+			result = &QueryResult{Columns: []Column{}, Rows: []map[string]interface{}{}}
+			return nil
 		}
 		defer dataSet.Close() // 确保数据集在使用完毕后关闭
 
 		// --- 构建 QueryResult ---
-		result := &QueryResult{}
+		result = &QueryResult{}
 		result.Columns = dataSet.GetColumns()           // 从数据集中获取列定义信息
 		result.Rows = make([]map[string]interface{}, 0) // 初始化行数据切片
 
@@ -327,8 +440,7 @@ func (c *Client) Query(ctx context.Context, tableName string, columns []string,
 				// Enhanced error message
 				err = fmt.Errorf("opio.Client.Query: 读取数据集下一行时出错 (Table: %s): %w", tableName, err)
 				dataSet.Close()
-				done <- queryResultWithError{result: result, err: err}
-				return
+				return err
 			}
 			if !hasNext {
 				// 没有更多行了，退出循环
@@ -352,23 +464,77 @@ func (c *Client) Query(ctx context.Context, tableName string, columns []string,
 			result.Rows = append(result.Rows, rowMap) // 将当前行的 map 添加到结果切片中
 		}
 
-		// 所有行都已成功处理，将最终结果和 nil 错误发送到通道
-		// dataSet 会在 defer 语句中关闭
-		done <- queryResultWithError{result: result, err: nil}
-		// --- goroutine 结束 ---
-	}()
+		// 所有行都已成功处理，dataSet 会在 defer 语句中关闭
+		return nil
+	})
+	if err != nil {
+		if ctxErr := ctxError(ctx, "opio.Client.Query: 查询操作", tableName); ctxErr != nil {
+			return nil, ctxErr // 返回更具体的错误类型
+		}
+	}
+	return result, err
+}
 
-	// 使用 select 语句等待 goroutine 完成或外部 context 被取消
-	select {
-	case <-ctx.Done():
-		err := ctx.Err()
-		// 返回更具体的错误类型
-		if errors.Is(err, context.DeadlineExceeded) {
-			return nil, fmt.Errorf("opio.Client.Query: 查询操作超时 (Table: %s): %w", tableName, ErrTimeout)
+// filters 返回查询的过滤条件：Filters 或由 Where 转换得到的 Filters。
+func (opts *QueryOptions) filters() ([]Filter, error) {
+	if opts == nil {
+		return nil, nil
+	}
+	if opts.Where == nil {
+		return opts.Filters, nil
+	}
+	if len(opts.Filters) > 0 {
+		return nil, fmt.Errorf("%w: QueryOptions 的 Where 与 Filters 不能同时设置", ErrInvalidFilter)
+	}
+	return opts.Where.Filters()
+}
+
+// setQuery 按 Query 的参数设置查询请求的属性，Query 与 QueryRows 共用。filters 为 opts.filters 的结果。
+func (c *Client) setQuery(req *Request, tableName string, columns []string, opts *QueryOptions, filters []Filter) {
+	// 设置基本的请求属性
+	req.SetService("openplant") // 假设服务名总是 "openplant"
+	req.SetAction(ActionSelect) // 设置操作类型为查询
+	req.SetTableName(tableName) // 设置要查询的表名
+
+	// --- 处理要查询的列 ---
+	// 创建一个临时的 Table 对象来承载要查询的列信息
+	queryTable := NewTable(tableName, 0) // 容量设为 0，因为我们只用它定义列
+	if len(columns) == 0 || (len(columns) == 1 && columns[0] == "*") {
+		// 如果请求查询所有列 ("*")
+		// 需要一种方式来告诉服务器查询所有列。
+		// 假设通过添加一个名为 "*" 的特殊列来实现。
+		queryTable.AddColumn("*", VtNull, 0) // 类型和长度可能不重要
+	} else {
+		// 如果指定了具体的列名
+		for _, colName := range columns {
+			// 添加指定的列名。查询时通常不需要指定类型和长度，服务器会返回。
+			queryTable.AddColumn(colName, VtNull, 0) // 使用 VtNull 作为占位符类型？
+		}
+	}
+	// 将包含列定义的 Table 对象设置到请求的 PropColumns 属性中
+	// 注意：原始的 SetTable 方法同时设置了 PropTable 和 PropColumns。
+	// 这里假设有一个 Set 方法可以直接设置属性，或者需要调整 SetTable/SetColumns 的逻辑。
+	req.Set(PropColumns, queryTable) // 假设这样可以将列定义传递给请求
+
+	// --- 应用查询选项 ---
+	if c.db != "" {
+		req.SetDB(c.db) // 客户端配置的默认数据库，QueryOptions.DB 可以覆盖
+	}
+	if opts != nil {
+		if opts.DB != "" {
+			req.SetDB(opts.DB) // 设置数据库名
+		}
+		if len(filters) > 0 {
+			// 假设 Filter 结构与底层兼容
+			req.SetFilters(filters) // 设置过滤器
+		}
+		if opts.OrderBy != "" {
+			req.SetOrderBy(opts.OrderBy) // 设置排序条件
 		}
-		return nil, fmt.Errorf("opio.Client.Query: 查询操作被取消 (Table: %s): %w", tableName, err)
-	case res := <-done:
-		return res.result, res.err // 返回 goroutine 计算得到的结果和错误
+		if opts.Limit != "" {
+			req.SetLimit(opts.Limit) // 设置分页限制
+		}
+		// 在此可以添加设置其他选项的逻辑...
 	}
 }
 
@@ -717,13 +883,66 @@ func assignWithConversion(targetField reflect.Value, sourceValue reflect.Value)
 // 如果插入成功，返回 nil，否则返回错误。
 // 如果提供的 context 没有截止时间，并且设置了 Client.defaultTimeout，则会应用默认超时。
 func (c *Client) Insert(ctx context.Context, tableName string, data []map[string]interface{}) error {
-	if c.conn == nil {
+	if c.closed() {
 		return ErrConnectionClosed
 	}
 	if len(data) == 0 {
 		return errors.New("没有要插入的数据")
 	}
 
+	// --- 创建并准备用于插入的 Table 对象 ---
+	insertTable := NewTable(tableName, uint(len(data))) // 创建 Table，容量为数据行数
+
+	// 从第一行数据推断列名和 opio 数据类型
+	firstRow := data[0]
+	columnNames := make([]string, 0, len(firstRow)) // 存储列名顺序
+	columnTypes := make(map[string]int)             // 存储列名到 opio 类型 (Vt*) 的映射
+
+	for colName, val := range firstRow { // 遍历第一行的列
+		columnNames = append(columnNames, colName) // 记录列名
+		// 推断 opio 类型 (这是一个简化的辅助函数)
+		vtType := inferOpioType(val)
+		if vtType == VtNull && val != nil { // 如果推断为 Null 但实际值不是 nil，则使用更通用的 VtObject
+			vtType = VtObject
+		}
+		columnTypes[colName] = vtType // 存储推断的类型
+		// 将列添加到 Table 定义中，长度设为 0 (让 SetColumnValue 自动处理或根据类型决定)
+		insertTable.AddColumn(colName, vtType, 0)
+	}
+
+	// --- 填充 Table 的行数据 ---
+	for _, rowMap := range data { // 遍历每一行要插入的数据
+		for i, colName := range columnNames { // 按照推断的列顺序填充
+			value, exists := rowMap[colName] // 获取当前行对应列的值
+			if !exists {
+				// 如果当前行缺少某个列，可以选择设置为空值或返回错误
+				// 这里选择尝试设置为空值
+				err := insertTable.SetColumnEmpty(uint32(i))
+				if err != nil {
+					// 记录设置空值时可能出现的错误
+				}
+				continue // 继续处理下一列
+			}
+			// 使用 SetColumnValue 将值设置到 Table 的当前行、指定列索引
+			err := insertTable.SetColumnValue(uint32(i), value)
+			if err != nil {
+				// 处理设置列值时可能发生的错误 (例如类型不匹配)
+				// 可以选择记录错误并继续，或者立即中断并返回错误
+				// 这里选择记录警告并继续，最终错误会在 SetTable 时统一检查
+			}
+		}
+		// 当前行的所有列都已设置 (或尝试设置)，绑定当前行数据到 Table
+		insertTable.BindRow()
+		// 可以在这里检查 insertTable.GetErrors() 来提前发现错误，但 SetTable 也会进行检查
+	}
+
+	// --- 在借出的连接上发送 Table 并检查应答 ---
+	return c.insertTable(ctx, tableName, insertTable)
+}
+
+// insertTable 在借出的连接上发送插入请求 (请求头 + Table 数据) 并检查应答，Insert、InsertStructs 与 BulkInserter 共用。
+// 如果提供的 context 没有截止时间，并且设置了 Client.defaultTimeout，则会应用默认超时。
+func (c *Client) insertTable(ctx context.Context, tableName string, insertTable *Table) error {
 	// 应用默认超时
 	var cancel context.CancelFunc
 	if _, deadlineSet := ctx.Deadline(); !deadlineSet && c.defaultTimeout > 0 {
@@ -731,70 +950,20 @@ func (c *Client) Insert(ctx context.Context, tableName string, data []map[string
 		defer cancel()
 	}
 
-	done := make(chan error, 1)
-
-	go func() {
-		// --- 在 goroutine 中执行实际的插入逻辑 ---
-		req := c.conn.NewRequest(nil) // 创建请求对象
-		defer req.Reset()             // 确保重置
+	err := c.withConn(ctx, func(op *IOConnect) error {
+		req := op.NewRequest(nil) // 创建请求对象
+		defer req.Reset()         // 确保重置
 
 		// 设置基本请求属性
 		req.SetService("openplant") // 服务名
 		req.SetAction(ActionInsert) // 操作类型为插入
 		req.SetTableName(tableName) // 目标表名
 
-		// --- 创建并准备用于插入的 Table 对象 ---
-		insertTable := NewTable(tableName, uint(len(data))) // 创建 Table，容量为数据行数
-
-		// 从第一行数据推断列名和 opio 数据类型
-		firstRow := data[0]
-		columnNames := make([]string, 0, len(firstRow)) // 存储列名顺序
-		columnTypes := make(map[string]int)             // 存储列名到 opio 类型 (Vt*) 的映射
-
-		for colName, val := range firstRow { // 遍历第一行的列
-			columnNames = append(columnNames, colName) // 记录列名
-			// 推断 opio 类型 (这是一个简化的辅助函数)
-			vtType := inferOpioType(val)
-			if vtType == VtNull && val != nil { // 如果推断为 Null 但实际值不是 nil，则使用更通用的 VtObject
-				vtType = VtObject
-			}
-			columnTypes[colName] = vtType // 存储推断的类型
-			// 将列添加到 Table 定义中，长度设为 0 (让 SetColumnValue 自动处理或根据类型决定)
-			insertTable.AddColumn(colName, vtType, 0)
-		}
-
-		// --- 填充 Table 的行数据 ---
-		for _, rowMap := range data { // 遍历每一行要插入的数据
-			for i, colName := range columnNames { // 按照推断的列顺序填充
-				value, exists := rowMap[colName] // 获取当前行对应列的值
-				if !exists {
-					// 如果当前行缺少某个列，可以选择设置为空值或返回错误
-					// 这里选择尝试设置为空值
-					err := insertTable.SetColumnEmpty(uint32(i))
-					if err != nil {
-						// 记录设置空值时可能出现的错误
-					}
-					continue // 继续处理下一列
-				}
-				// 使用 SetColumnValue 将值设置到 Table 的当前行、指定列索引
-				err := insertTable.SetColumnValue(uint32(i), value)
-				if err != nil {
-					// 处理设置列值时可能发生的错误 (例如类型不匹配)
-					// 可以选择记录错误并继续，或者立即中断并返回错误
-					// 这里选择记录警告并继续，最终错误会在 SetTable 时统一检查
-				}
-			}
-			// 当前行的所有列都已设置 (或尝试设置)，绑定当前行数据到 Table
-			insertTable.BindRow()
-			// 可以在这里检查 insertTable.GetErrors() 来提前发现错误，但 SetTable 也会进行检查
-		}
-
 		// --- 将填充好的 Table 设置到 Request 对象中 ---
 		err := req.SetTable(insertTable) // SetTable 会进行内部验证，例如检查是否有错误
 		if err != nil {
-			// 如果 SetTable 失败 (例如内部有错误)，将错误发送到通道
-			done <- fmt.Errorf("设置插入表时出错: %w", err)
-			return
+			// 如果 SetTable 失败 (例如内部有错误)，直接返回错误
+			return fmt.Errorf("设置插入表时出错: %w", err)
 		}
 
 		// --- 发送请求 ---
@@ -802,14 +971,12 @@ func (c *Client) Insert(ctx context.Context, tableName string, data []map[string
 		// 1. 发送请求头
 		err = req.Write()
 		if err != nil {
-			done <- fmt.Errorf("发送插入请求头失败: %w", err)
-			return
+			return fmt.Errorf("发送插入请求头失败: %w", err)
 		}
 		// 2. 发送请求体 (Table 数据)
 		err = req.WriteContent(insertTable)
 		if err != nil {
-			done <- fmt.Errorf("发送插入数据体失败: %w", err)
-			return
+			return fmt.Errorf("发送插入数据体失败: %w", err)
 		}
 		// 3. 刷新网络缓冲区，确保数据发送出去
 		req.Flush()
@@ -817,32 +984,27 @@ func (c *Client) Insert(ctx context.Context, tableName string, data []map[string
 		// --- 获取并处理响应 ---
 		res, err := req.GetResponse() // 获取服务器的响应
 		if err != nil {
-			done <- fmt.Errorf("获取插入响应失败: %w", err)
-			return
+			return fmt.Errorf("获取插入响应失败 (Table: %s): %w", tableName, err)
+		}
+		if op.io.Err() != nil {
+			return fmt.Errorf("获取插入响应失败 (Table: %s): %w", tableName, op.io.Err())
 		}
 
 		// 检查响应中是否包含错误
 		if res.GetErrNo() != 0 {
 			serverErr := &OpioServerError{Code: res.GetErrNo(), Message: res.GetError()}
-			done <- fmt.Errorf("插入失败 (Table: %s): %w", tableName, serverErr)
-			return
+			return fmt.Errorf("插入失败 (Table: %s): %w", tableName, serverErr)
 		}
 
 		// 如果没有错误，表示插入成功
-		done <- nil
-		// --- goroutine 结束 ---
-	}()
-
-	select {
-	case <-ctx.Done():
-		err := ctx.Err()
-		if errors.Is(err, context.DeadlineExceeded) {
-			return fmt.Errorf("插入操作超时 (Table: %s): %w", tableName, ErrTimeout)
+		return nil
+	})
+	if err != nil {
+		if ctxErr := ctxError(ctx, "插入操作", tableName); ctxErr != nil {
+			return ctxErr
 		}
-		return fmt.Errorf("插入操作被取消 (Table: %s): %w", tableName, err)
-	case err := <-done:
-		return err
 	}
+	return err
 }
 
 // Update 更新指定表中符合过滤条件的行 (使用 map 接口)。
@@ -853,7 +1015,7 @@ func (c *Client) Insert(ctx context.Context, tableName string, data []map[string
 // 如果更新成功，返回 nil，否则返回错误。
 // 如果提供的 context 没有截止时间，并且设置了 Client.defaultTimeout，则会应用默认超时。
 func (c *Client) Update(ctx context.Context, tableName string, updates map[string]interface{}, filters []Filter) error {
-	if c.conn == nil {
+	if c.closed() {
 		return ErrConnectionClosed
 	}
 	if len(updates) == 0 {
@@ -871,12 +1033,9 @@ func (c *Client) Update(ctx context.Context, tableName string, updates map[strin
 		defer cancel()
 	}
 
-	done := make(chan error, 1)
-
-	go func() {
-		// --- 在 goroutine 中执行实际的更新逻辑 ---
-		req := c.conn.NewRequest(nil) // 创建请求对象
-		defer req.Reset()             // 确保重置
+	err := c.withConn(ctx, func(op *IOConnect) error {
+		req := op.NewRequest(nil) // 创建请求对象
+		defer req.Reset()         // 确保重置
 
 		// 设置基本请求属性
 		req.SetService("openplant") // 服务名
@@ -923,53 +1082,42 @@ func (c *Client) Update(ctx context.Context, tableName string, updates map[strin
 		// --- 将包含更新数据的 Table 设置到 Request 对象中 ---
 		err := req.SetTable(updateTable) // SetTable 会进行验证
 		if err != nil {
-			done <- fmt.Errorf("设置更新表时出错: %w", err)
-			return
+			return fmt.Errorf("设置更新表时出错: %w", err)
 		}
 
 		// --- 发送请求 ---
 		// 更新操作也需要发送请求头 (属性，包含过滤器) 和请求体 (Table 数据)
 		err = req.Write() // 发送请求头
 		if err != nil {
-			done <- fmt.Errorf("发送更新请求头失败: %w", err)
-			return
+			return fmt.Errorf("发送更新请求头失败: %w", err)
 		}
 		err = req.WriteContent(updateTable) // 发送包含更新数据的请求体
 		if err != nil {
-			done <- fmt.Errorf("发送更新数据体失败: %w", err)
-			return
+			return fmt.Errorf("发送更新数据体失败: %w", err)
 		}
 		req.Flush() // 刷新缓冲区
 
 		// --- 获取并处理响应 ---
 		res, err := req.GetResponse() // 获取服务器响应
 		if err != nil {
-			done <- fmt.Errorf("获取更新响应失败: %w", err)
-			return
+			return fmt.Errorf("获取更新响应失败: %w", err)
 		}
 
 		// 检查响应中是否包含错误
 		if res.GetErrNo() != 0 {
 			serverErr := &OpioServerError{Code: res.GetErrNo(), Message: res.GetError()}
-			done <- fmt.Errorf("更新失败 (Table: %s): %w", tableName, serverErr)
-			return
+			return fmt.Errorf("更新失败 (Table: %s): %w", tableName, serverErr)
 		}
 
 		// 更新成功
-		done <- nil
-		// --- goroutine 结束 ---
-	}()
-
-	select {
-	case <-ctx.Done():
-		err := ctx.Err()
-		if errors.Is(err, context.DeadlineExceeded) {
-			return fmt.Errorf("更新操作超时 (Table: %s): %w", tableName, ErrTimeout)
+		return nil
+	})
+	if err != nil {
+		if ctxErr := ctxError(ctx, "更新操作", tableName); ctxErr != nil {
+			return ctxErr
 		}
-		return fmt.Errorf("更新操作被取消 (Table: %s): %w", tableName, err)
-	case err := <-done:
-		return err
 	}
+	return err
 }
 
 // Delete 删除指定表中符合过滤条件的行。
@@ -980,7 +1128,7 @@ func (c *Client) Update(ctx context.Context, tableName string, updates map[strin
 // 如果删除成功，返回 nil，否则返回错误。
 // 如果提供的 context 没有截止时间，并且设置了 Client.defaultTimeout，则会应用默认超时。
 func (c *Client) Delete(ctx context.Context, tableName string, filters []Filter) error {
-	if c.conn == nil {
+	if c.closed() {
 		return ErrConnectionClosed
 	}
 	// 考虑是否强制要求 filters 不为空
@@ -995,12 +1143,9 @@ func (c *Client) Delete(ctx context.Context, tableName string, filters []Filter)
 		defer cancel()
 	}
 
-	done := make(chan error, 1)
-
-	go func() {
-		// --- 在 goroutine 中执行实际的删除逻辑 ---
-		req := c.conn.NewRequest(nil) // 创建请求对象
-		defer req.Reset()             // 确保重置
+	err := c.withConn(ctx, func(op *IOConnect) error {
+		req := op.NewRequest(nil) // 创建请求对象
+		defer req.Reset()         // 确保重置
 
 		// 设置基本请求属性
 		req.SetService("openplant") // 服务名
@@ -1017,39 +1162,30 @@ func (c *Client) Delete(ctx context.Context, tableName string, filters []Filter)
 		// 删除操作通常只需要发送请求头 (包含属性和过滤器)，不需要数据体。
 		err := req.WriteAndFlush() // 发送请求头并刷新缓冲区
 		if err != nil {
-			done <- fmt.Errorf("发送删除请求失败: %w", err)
-			return
+			return fmt.Errorf("发送删除请求失败: %w", err)
 		}
 
 		// --- 获取并处理响应 ---
 		res, err := req.GetResponse() // 获取服务器响应
 		if err != nil {
-			done <- fmt.Errorf("获取删除响应失败: %w", err)
-			return
+			return fmt.Errorf("获取删除响应失败: %w", err)
 		}
 
 		// 检查响应中是否包含错误
 		if res.GetErrNo() != 0 {
 			serverErr := &OpioServerError{Code: res.GetErrNo(), Message: res.GetError()}
-			done <- fmt.Errorf("删除失败 (Table: %s): %w", tableName, serverErr)
-			return
+			return fmt.Errorf("删除失败 (Table: %s): %w", tableName, serverErr)
 		}
 
 		// 删除成功
-		done <- nil
-		// --- goroutine 结束 ---
-	}()
-
-	select {
-	case <-ctx.Done():
-		err := ctx.Err()
-		if errors.Is(err, context.DeadlineExceeded) {
-			return fmt.Errorf("删除操作超时 (Table: %s): %w", tableName, ErrTimeout)
+		return nil
+	})
+	if err != nil {
+		if ctxErr := ctxError(ctx, "删除操作", tableName); ctxErr != nil {
+			return ctxErr
 		}
-		return fmt.Errorf("删除操作被取消 (Table: %s): %w", tableName, err)
-	case err := <-done:
-		return err
 	}
+	return err
 }
 
 // inferOpioType 是一个辅助函数，尝试从给定的 Go interface{} 值推断出对应的 opio Vt* 类型常量。
@@ -1147,17 +1283,10 @@ func (c *Client) QueryInto(ctx context.Context, dest interface{}, tableName stri
 // 如果插入成功，返回 nil，否则返回错误。
 // 如果提供的 context 没有截止时间，并且设置了 Client.defaultTimeout，则会应用默认超时。
 func (c *Client) InsertStructs(ctx context.Context, tableName string, data interface{}) error {
-	if c.conn == nil {
+	if c.closed() {
 		return ErrConnectionClosed
 	}
 
-	// 应用默认超时
-	var cancel context.CancelFunc
-	if _, deadlineSet := ctx.Deadline(); !deadlineSet && c.defaultTimeout > 0 {
-		ctx, cancel = context.WithTimeout(ctx, c.defaultTimeout)
-		defer cancel()
-	}
-
 	// 1. 验证输入类型并获取切片值
 	val := reflect.ValueOf(data)
 	if val.Kind() == reflect.Ptr { // 如果是指针，获取其指向的值
@@ -1247,58 +1376,8 @@ func (c *Client) InsertStructs(ctx context.Context, tableName string, data inter
 		insertTable.BindRow() // 绑定当前行
 	}
 
-	// 4. 执行插入操作 (使用 goroutine 和 context)
-	done := make(chan error, 1)
-	go func() {
-		req := c.conn.NewRequest(nil)
-		defer req.Reset()
-		req.SetService("openplant")
-		req.SetAction(ActionInsert)
-		req.SetTableName(tableName)
-
-		err := req.SetTable(insertTable) // 设置 Table 到请求
-		if err != nil {
-			done <- fmt.Errorf("设置插入表时出错: %w", err)
-			return
-		}
-
-		// 发送请求头和内容
-		err = req.Write()
-		if err != nil {
-			done <- fmt.Errorf("发送插入请求头失败: %w", err)
-			return
-		}
-		err = req.WriteContent(insertTable)
-		if err != nil {
-			done <- fmt.Errorf("发送插入数据体失败: %w", err)
-			return
-		}
-		req.Flush()
-
-		// 获取响应
-		res, err := req.GetResponse()
-		if err != nil {
-			done <- fmt.Errorf("获取插入响应失败 (Table: %s): %w", tableName, err)
-			return
-		}
-		if res.GetErrNo() != 0 {
-			serverErr := &OpioServerError{Code: res.GetErrNo(), Message: res.GetError()}
-			done <- fmt.Errorf("插入失败 (Table: %s): %w", tableName, serverErr)
-			return
-		}
-		done <- nil // 成功
-	}()
-
-	select {
-	case <-ctx.Done():
-		err := ctx.Err()
-		if errors.Is(err, context.DeadlineExceeded) {
-			return fmt.Errorf("插入操作超时 (Table: %s): %w", tableName, ErrTimeout)
-		}
-		return fmt.Errorf("插入操作被取消 (Table: %s): %w", tableName, err)
-	case err := <-done:
-		return err
-	}
+	// 4. 执行插入操作 (在借出的连接上同步执行，受 ctx 控制)
+	return c.insertTable(ctx, tableName, insertTable)
 }
 
 // UpdateStruct 根据结构体实例更新数据。
@@ -1312,7 +1391,7 @@ func (c *Client) InsertStructs(ctx context.Context, tableName string, data inter
 // 如果更新成功，返回 nil，否则返回错误。
 // 如果提供的 context 没有截止时间，并且设置了 Client.defaultTimeout，则会应用默认超时。
 func (c *Client) UpdateStruct(ctx context.Context, tableName string, data interface{}, filters []Filter, updateFields ...string) error {
-	if c.conn == nil {
+	if c.closed() {
 		return ErrConnectionClosed
 	}
 	if len(filters) == 0 {
@@ -1388,60 +1467,37 @@ func (c *Client) UpdateStruct(ctx context.Context, tableName string, data interf
 }
 
 // DeleteByID 根据单个 ID 删除记录的便捷方法。
-// 这是 Delete 方法针对按 ID 删除场景的封装。
 // ctx: 用于控制操作的上下文。
 // tableName: 要删除数据的目标表名。
 // idColumn: 作为主键或唯一标识的列名。
 // id: 要删除的记录的 ID 值。其类型应与 idColumn 的数据库类型兼容 (例如 int, int32, int64, string)。
-// **安全警告:** 当前的 ID 到字符串转换逻辑非常基础，仅处理常见类型且包含极其简单的 SQL 转义 (仅替换单引号)。
-// 这 **绝对不足以** 防止所有类型的 SQL 注入攻击，尤其是在处理用户输入时。
-// **强烈建议** 在生产环境中使用参数化查询（如果 OpenPlant 支持）或使用经过验证的 SQL 构建库来处理 ID 值，而不是依赖此基础转换。
-// TODO: (DeleteByID) 替换此基础转换逻辑为更安全的机制。
+// 删除通过参数化的 ExecSQL 执行 (DELETE FROM 表 WHERE 列 = ?)，ID 按 BindSQL 的规则渲染与转义；
+// 表名与列名只能包含字母、数字、下划线与 "."，否则返回 ErrInvalidSQLArg。
 // 如果删除成功，返回 nil，否则返回错误。
 // 如果提供的 context 没有截止时间，并且设置了 Client.defaultTimeout，则会应用默认超时。
 func (c *Client) DeleteByID(ctx context.Context, tableName string, idColumn string, id interface{}) error {
-	if c.conn == nil {
+	if c.closed() {
 		return ErrConnectionClosed
 	}
 
-	// 应用默认超时 (注意：超时应用于底层的 Delete 调用)
-	// 这里不直接应用，让 Delete 方法处理
-
-	// 1. 将 ID 值转换为适合过滤器的字符串形式 (注意警告)
-	var idStr string
-	switch v := id.(type) {
-	case string:
-		// 对字符串进行简单的 SQL 转义 (替换单引号) 并添加引号
-		// 注意：这只是基础的转义，不能完全防止 SQL 注入。
-		// 对于生产环境，应考虑使用更健壮的库或参数化查询（如果后端支持）。
-		escaped := strings.ReplaceAll(v, "'", "''")
-		idStr = fmt.Sprintf("'%s'", escaped)
-	case int, int8, int16, int32, int64:
-		idStr = strconv.FormatInt(reflect.ValueOf(v).Int(), 10)
-	case uint, uint8, uint16, uint32, uint64:
-		idStr = strconv.FormatUint(reflect.ValueOf(v).Uint(), 10)
-	case float32:
-		idStr = strconv.FormatFloat(float64(v), 'f', -1, 32)
-	case float64:
-		idStr = strconv.FormatFloat(v, 'f', -1, 64)
-	case bool:
-		// 根据数据库习惯，可能需要 'true'/'false' 或 1/0
-		if v {
-			idStr = "1" // 或者 'true'
-		} else {
-			idStr = "0" // 或者 'false'
-		}
+	// 1. ID 只能是标量值，切片等会被渲染为列表，nil 会被渲染为 NULL
+	switch id.(type) {
+	case string, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, bool:
 	default:
 		return fmt.Errorf("%w: %T", ErrUnsupportedIDType, id) // 使用自定义错误
 	}
 
-	// 2. 创建过滤器
-	filters := []Filter{
-		*NewFilter(idColumn, OperEQ, idStr, RelationAnd),
+	// 2. 表名与列名无法作为参数绑定，只允许安全的标识符
+	if !validIdent(tableName) {
+		return fmt.Errorf("%w: 无效的表名 %q", ErrInvalidSQLArg, tableName)
+	}
+	if !validIdent(idColumn) {
+		return fmt.Errorf("%w: 无效的列名 %q", ErrInvalidSQLArg, idColumn)
 	}
 
-	// 3. 调用现有的 Delete 方法 (基于 Filter 的版本)
-	return c.Delete(ctx, tableName, filters)
+	// 3. ID 作为参数绑定，由 ExecSQL 处理 context 和超时
+	_, err := c.ExecSQL(ctx, "DELETE FROM "+tableName+" WHERE "+idColumn+" = ?", id)
+	return err
 }
 
 // ====================================================================================
@@ -1457,7 +1513,7 @@ func (c *Client) DeleteByID(ctx context.Context, tableName string, idColumn stri
 // 如果读取成功，返回 nil，否则返回错误。
 // 如果提供的 context 没有截止时间，并且设置了 Client.defaultTimeout，则会应用默认超时。
 func (c *Client) ReadRealtime(ctx context.Context, values []Value) error {
-	if c.conn == nil {
+	if c.closed() {
 		return ErrConnectionClosed
 	}
 	if len(values) == 0 {
@@ -1471,30 +1527,17 @@ func (c *Client) ReadRealtime(ctx context.Context, values []Value) error {
 		defer cancel()
 	}
 
-	// 使用通道在 goroutine 和主线程间传递错误信息
-	done := make(chan error, 1)
-
-	// 启动 goroutine 执行可能阻塞的底层调用
-	go func() {
-		err := c.conn.ReadRealtime(values) // 调用底层的 ReadRealtime
-		done <- err                        // 将执行结果 (错误或 nil) 发送到通道
-	}()
-
-	// 使用 select 等待 goroutine 完成或 context 被取消
-	select {
-	case <-ctx.Done():
-		err := ctx.Err()
-		if errors.Is(err, context.DeadlineExceeded) {
-			return fmt.Errorf("读取实时数据操作超时: %w", ErrTimeout)
-		}
-		return fmt.Errorf("读取实时数据操作被取消: %w", err)
-	case err := <-done:
-		if err != nil {
-			// TODO: Check if err from conn.ReadRealtime can be wrapped with OpioServerError
-			return fmt.Errorf("读取实时数据失败: %w", err)
+	err := c.withReadConn(ctx, func(op *IOConnect) error {
+		return op.ReadRealtime(values) // 调用底层的 ReadRealtime
+	})
+	if err != nil {
+		if ctxErr := ctxError(ctx, "读取实时数据操作", ""); ctxErr != nil {
+			return ctxErr
 		}
-		return nil
+		// TODO: Check if err from conn.ReadRealtime can be wrapped with OpioServerError
+		return fmt.Errorf("读取实时数据失败: %w", err)
 	}
+	return nil
 }
 
 // WriteRealtime 写入实时数据 (V3 API)。
@@ -1503,7 +1546,7 @@ func (c *Client) ReadRealtime(ctx context.Context, values []Value) error {
 // 如果写入成功，返回 nil，否则返回错误。
 // 如果提供的 context 没有截止时间，并且设置了 Client.defaultTimeout，则会应用默认超时。
 func (c *Client) WriteRealtime(ctx context.Context, values []Value) error {
-	if c.conn == nil {
+	if c.closed() {
 		return ErrConnectionClosed
 	}
 	if len(values) == 0 {
@@ -1517,26 +1560,17 @@ func (c *Client) WriteRealtime(ctx context.Context, values []Value) error {
 		defer cancel()
 	}
 
-	done := make(chan error, 1)
-	go func() {
-		err := c.conn.WriteRealtime(values) // 调用底层的 WriteRealtime
-		done <- err                         // 发送结果
-	}()
-
-	select {
-	case <-ctx.Done():
-		err := ctx.Err()
-		if errors.Is(err, context.DeadlineExceeded) {
-			return fmt.Errorf("写入实时数据操作超时: %w", ErrTimeout)
-		}
-		return fmt.Errorf("写入实时数据操作被取消: %w", err)
-	case err := <-done:
-		if err != nil {
-			// TODO: Check if err from conn.WriteRealtime can be wrapped with OpioServerError
-			return fmt.Errorf("写入实时数据失败: %w", err)
+	err := c.withConn(ctx, func(op *IOConnect) error {
+		return op.WriteRealtime(values) // 调用底层的 WriteRealtime
+	})
+	if err != nil {
+		if ctxErr := ctxError(ctx, "写入实时数据操作", ""); ctxErr != nil {
+			return ctxErr
 		}
-		return nil
+		// TODO: Check if err from conn.WriteRealtime can be wrapped with OpioServerError
+		return fmt.Errorf("写入实时数据失败: %w", err)
 	}
+	return nil
 }
 
 // ReadArchive 读取历史数据 (V3 API)。
@@ -1548,7 +1582,7 @@ func (c *Client) WriteRealtime(ctx context.Context, values []Value) error {
 // 返回值: 包含查询结果的 Archive 指针切片，或者一个错误。
 // 如果提供的 context 没有截止时间，并且设置了 Client.defaultTimeout，则会应用默认超时。
 func (c *Client) ReadArchive(ctx context.Context, ids []int32, mode int32, begin, end time.Time, interval int32) ([]*Archive, error) {
-	if c.conn == nil {
+	if c.closed() {
 		return nil, ErrConnectionClosed
 	}
 
@@ -1559,33 +1593,19 @@ func (c *Client) ReadArchive(ctx context.Context, ids []int32, mode int32, begin
 		defer cancel()
 	}
 
-	// 定义用于 goroutine 通信的结构体
-	type result struct {
-		archives []*Archive
-		err      error
-	}
-	done := make(chan result, 1) // 通道传递结果和错误
-
-	go func() {
-		// 调用底层的 ReadArchive
-		archives, err := c.conn.ReadArchive(ids, mode, begin, end, interval)
-		done <- result{archives: archives, err: err} // 发送结果
-	}()
-
-	select {
-	case <-ctx.Done():
-		err := ctx.Err()
-		if errors.Is(err, context.DeadlineExceeded) {
-			return nil, fmt.Errorf("读取历史数据操作超时: %w", ErrTimeout)
-		}
-		return nil, fmt.Errorf("读取历史数据操作被取消: %w", err)
-	case res := <-done:
-		if res.err != nil {
-			// TODO: Check if err from conn.ReadArchive can be wrapped with OpioServerError
-			return nil, fmt.Errorf("读取历史数据失败: %w", res.err)
+	var archives []*Archive
+	err := c.withReadConn(ctx, func(op *IOConnect) (err error) {
+		archives, err = op.ReadArchive(ids, mode, begin, end, interval) // 调用底层的 ReadArchive
+		return err
+	})
+	if err != nil {
+		if ctxErr := ctxError(ctx, "读取历史数据操作", ""); ctxErr != nil {
+			return nil, ctxErr
 		}
-		return res.archives, nil
+		// TODO: Check if err from conn.ReadArchive can be wrapped with OpioServerError
+		return nil, fmt.Errorf("读取历史数据失败: %w", err)
 	}
+	return archives, nil
 }
 
 // WriteArchive 写入历史数据 (V3 API)。
@@ -1595,7 +1615,7 @@ func (c *Client) ReadArchive(ctx context.Context, ids []int32, mode int32, begin
 // 如果写入成功，返回 nil，否则返回错误。
 // 如果提供的 context 没有截止时间，并且设置了 Client.defaultTimeout，则会应用默认超时。
 func (c *Client) WriteArchive(ctx context.Context, archives []*Archive, cache bool) error {
-	if c.conn == nil {
+	if c.closed() {
 		return ErrConnectionClosed
 	}
 
@@ -1606,26 +1626,17 @@ func (c *Client) WriteArchive(ctx context.Context, archives []*Archive, cache bo
 		defer cancel()
 	}
 
-	done := make(chan error, 1)
-	go func() {
-		err := c.conn.WriteArchive(archives, cache) // 调用底层的 WriteArchive
-		done <- err                                 // 发送结果
-	}()
-
-	select {
-	case <-ctx.Done():
-		err := ctx.Err()
-		if errors.Is(err, context.DeadlineExceeded) {
-			return fmt.Errorf("写入历史数据操作超时: %w", ErrTimeout)
-		}
-		return fmt.Errorf("写入历史数据操作被取消: %w", err)
-	case err := <-done:
-		if err != nil {
-			// TODO: Check if err from conn.WriteArchive can be wrapped with OpioServerError
-			return fmt.Errorf("写入历史数据失败: %w", err)
+	err := c.withConn(ctx, func(op *IOConnect) error {
+		return op.WriteArchive(archives, cache) // 调用底层的 WriteArchive
+	})
+	if err != nil {
+		if ctxErr := ctxError(ctx, "写入历史数据操作", ""); ctxErr != nil {
+			return ctxErr
 		}
-		return nil
+		// TODO: Check if err from conn.WriteArchive can be wrapped with OpioServerError
+		return fmt.Errorf("写入历史数据失败: %w", err)
 	}
+	return nil
 }
 
 // ReadStat 读取统计数据 (V3 API)。
@@ -1637,7 +1648,7 @@ func (c *Client) WriteArchive(ctx context.Context, archives []*Archive, cache bo
 // 返回值: 包含查询结果的 Stat 指针切片，或者一个错误。
 // 如果提供的 context 没有截止时间，并且设置了 Client.defaultTimeout，则会应用默认超时。
 func (c *Client) ReadStat(ctx context.Context, ids []int32, mode int32, begin, end time.Time, interval int32) ([]*Stat, error) {
-	if c.conn == nil {
+	if c.closed() {
 		return nil, ErrConnectionClosed
 	}
 
@@ -1648,33 +1659,19 @@ func (c *Client) ReadStat(ctx context.Context, ids []int32, mode int32, begin, e
 		defer cancel()
 	}
 
-	// 定义用于 goroutine 通信的结构体
-	type result struct {
-		stats []*Stat
-		err   error
-	}
-	done := make(chan result, 1) // 通道传递结果和错误
-
-	go func() {
-		// 调用底层的 ReadStat
-		stats, err := c.conn.ReadStat(ids, mode, begin, end, interval)
-		done <- result{stats: stats, err: err} // 发送结果
-	}()
-
-	select {
-	case <-ctx.Done():
-		err := ctx.Err()
-		if errors.Is(err, context.DeadlineExceeded) {
-			return nil, fmt.Errorf("读取统计数据操作超时: %w", ErrTimeout)
-		}
-		return nil, fmt.Errorf("读取统计数据操作被取消: %w", err)
-	case res := <-done:
-		if res.err != nil {
-			// TODO: Check if err from conn.ReadStat can be wrapped with OpioServerError
-			return nil, fmt.Errorf("读取统计数据失败: %w", res.err)
+	var stats []*Stat
+	err := c.withReadConn(ctx, func(op *IOConnect) (err error) {
+		stats, err = op.ReadStat(ids, mode, begin, end, interval) // 调用底层的 ReadStat
+		return err
+	})
+	if err != nil {
+		if ctxErr := ctxError(ctx, "读取统计数据操作", ""); ctxErr != nil {
+			return nil, ctxErr
 		}
-		return res.stats, nil
+		// TODO: Check if err from conn.ReadStat can be wrapped with OpioServerError
+		return nil, fmt.Errorf("读取统计数据失败: %w", err)
 	}
+	return stats, nil
 }
 
 // ====================================================================================
@@ -1684,8 +1681,9 @@ func (c *Client) ReadStat(ctx context.Context, ids []int32, mode int32, begin, e
 // SubscriptionEvent 代表从实时数据订阅接收到的单个事件。
 // 它可能包含一行数据 (Data) 或一个错误 (Err)。
 type SubscriptionEvent struct {
-	Data map[string]interface{} // 接收到的行数据 (列名 -> 值)
-	Err  error                  // 如果发生错误，此字段非 nil
+	Data    map[string]interface{} // 接收到的行数据 (列名 -> 值)
+	Columns []Column               // 推送结果集的列定义 (按列的顺序)，Err 非 nil 时为空
+	Err     error                  // 如果发生错误，此字段非 nil
 }
 
 // Subscription 代表一个活动的实时数据订阅会话。
@@ -1779,7 +1777,7 @@ type SubscribeOptions struct {
 // 返回值: 一个 Subscription 对象用于管理订阅和接收事件，或者一个错误。
 // 注意：订阅通常使用独立的连接，不受 Client.defaultTimeout 影响。其生命周期由传入的 context 控制。
 func (c *Client) Subscribe(ctx context.Context, tableName string, keyName string, keys interface{}, opts *SubscribeOptions) (*Subscription, error) {
-	if c.conn == nil {
+	if c.closed() {
 		return nil, ErrConnectionClosed
 	}
 
@@ -1798,12 +1796,20 @@ func (c *Client) Subscribe(ctx context.Context, tableName string, keyName string
 	// }
 
 	// 创建底层的 opio.Subscribe 对象。
-	// 注意：NewSubscribe 方法通常会复制当前的连接设置，为订阅创建一个独立的连接，
+	// 订阅使用按客户端连接参数新建的独立连接 (不占用连接池)，
 	// 以避免与客户端上的其他操作（如查询、写入）互相干扰。
-	sub, err := c.conn.NewSubscribe(tableName)
+	nop, err := c.pool.dialConn(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("创建底层订阅失败: %w", err)
 	}
+	sub, err := newSubscribe(nop, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("创建底层订阅失败: %w", err)
+	}
+	// 断线后经由客户端重新连接，从而遵循重连策略与端点切换
+	sub.redial = func() (*IOConnect, error) {
+		return c.pool.dialConn(context.Background())
+	}
 
 	// 设置订阅选项 (例如是否获取快照)
 	useSnapshot := false
@@ -1901,7 +1907,7 @@ func (c *Client) Subscribe(ctx context.Context, tableName string, keyName string
 				}
 			}
 			// 创建数据事件并尝试发送到事件通道
-			dataEvent := SubscriptionEvent{Data: rowMap}
+			dataEvent := SubscriptionEvent{Data: rowMap, Columns: columns}
 			select {
 			case eventCh <- dataEvent: // 发送数据事件
 			case <-subCtx.Done(): // 如果在发送时上下文被取消，则放弃发送并返回
@@ -1924,7 +1930,9 @@ func (c *Client) Subscribe(ctx context.Context, tableName string, keyName string
 	}
 
 	// 启动一个 goroutine，用于监听外部传入的 context (ctx) 的取消信号
+	c.trackSubscription(sub)
 	go func() {
+		defer c.untrackSubscription(sub)
 		select {
 		case <-ctx.Done(): // 如果外部 context 被取消
 			subscription.Close() // 调用 Close 方法来关闭整个订阅
@@ -1945,17 +1953,28 @@ func (c *Client) Subscribe(ctx context.Context, tableName string, keyName string
 
 // ExecSQL 执行原始的 SQL 查询或命令。
 // ctx: 用于控制操作的上下文。
-// sql: 要执行的 SQL 语句。
+// sql: 要执行的 SQL 语句，可以包含 ? 或 :name 占位符。
+// args: 占位符对应的参数，按 BindSQL 的规则渲染为 SQL 字面值后替换占位符，参数无效时返回 ErrInvalidSQLArg。
+//
+//	res, err := client.ExecSQL(ctx, "SELECT ID, GN FROM Point WHERE GN LIKE ? AND RT IN (?)", prefix+"%", []int{0, 1})
+//
 // 返回值:
 // - 对于 SELECT 语句，返回包含结果的 QueryResult 指针。
 // - 对于非 SELECT 语句 (如 INSERT, UPDATE, DELETE, CREATE)，如果执行成功，通常返回一个空的 QueryResult (无行无列) 和 nil 错误。
 // - 如果执行失败，返回 nil QueryResult 和一个错误。
 // 此方法支持通过 context 进行取消或超时控制。
 // 如果提供的 context 没有截止时间，并且设置了 Client.defaultTimeout，则会应用默认超时。
-func (c *Client) ExecSQL(ctx context.Context, sql string) (*QueryResult, error) {
-	if c.conn == nil {
+func (c *Client) ExecSQL(ctx context.Context, sql string, args ...interface{}) (*QueryResult, error) {
+	if c.closed() {
 		return nil, ErrConnectionClosed
 	}
+	if len(args) > 0 {
+		bound, err := BindSQL(sql, args...)
+		if err != nil {
+			return nil, fmt.Errorf("opio.Client.ExecSQL: %w", err)
+		}
+		sql = bound
+	}
 
 	// 应用默认超时
 	var cancel context.CancelFunc
@@ -1964,17 +1983,11 @@ func (c *Client) ExecSQL(ctx context.Context, sql string) (*QueryResult, error)
 		defer cancel()
 	}
 
-	// 定义用于 goroutine 通信的结构体
-	type execResultWithError struct {
-		result *QueryResult
-		err    error
-	}
-	done := make(chan execResultWithError, 1) // 通道传递结果和错误
-
-	go func() {
-		// --- 在 goroutine 中执行 SQL ---
-		req := c.conn.NewRequest(nil) // 创建请求对象
-		defer req.Reset()             // 确保重置
+	// 在借出的连接上同步执行 SQL，ctx 结束时阻塞中的网络 IO 会被直接打断
+	var result *QueryResult
+	err := c.withConn(ctx, func(op *IOConnect) error {
+		req := op.NewRequest(nil) // 创建请求对象
+		defer req.Reset()         // 确保重置
 
 		// 设置请求属性
 		req.SetService("openplant")  // 服务名
@@ -1984,35 +1997,32 @@ func (c *Client) ExecSQL(ctx context.Context, sql string) (*QueryResult, error)
 		// 发送请求 (ExecSQL 通常只发送请求头)
 		err := req.WriteAndFlush()
 		if err != nil {
-			done <- execResultWithError{result: nil, err: fmt.Errorf("发送 SQL 请求失败: %w", err)}
-			return
+			return fmt.Errorf("发送 SQL 请求失败: %w", err)
 		}
 
 		// 获取响应
 		res, err := req.GetResponse()
 		if err != nil {
-			done <- execResultWithError{result: nil, err: fmt.Errorf("获取 SQL 响应失败: %w", err)}
-			return
+			return fmt.Errorf("获取 SQL 响应失败: %w", err)
 		}
 
 		// 检查响应错误
 		if res.GetErrNo() != 0 {
 			serverErr := &OpioServerError{Code: res.GetErrNo(), Message: res.GetError()}
-			done <- execResultWithError{result: nil, err: fmt.Errorf("SQL 执行失败: %w", serverErr)}
-			return
+			return fmt.Errorf("SQL 执行失败: %w", serverErr)
 		}
 
 		// 处理可能返回的结果集 (主要针对 SELECT 语句)
 		dataSet := res.GetDataSet()
 		if dataSet == nil {
 			// 如果没有数据集 (例如非 SELECT 语句或 SELECT 无结果)，返回空的 QueryResult
-			done <- execResultWithError{result: &QueryResult{Columns: []Column{}, Rows: []map[string]interface{}{}}, err: nil}
-			return
+			result = &QueryResult{Columns: []Column{}, Rows: []map[string]interface{}{}}
+			return nil
 		}
 		defer dataSet.Close() // 确保关闭数据集
 
 		// 构建 QueryResult
-		result := &QueryResult{}
+		result = &QueryResult{}
 		result.Columns = dataSet.GetColumns()           // 获取列信息
 		result.Rows = make([]map[string]interface{}, 0) // 初始化行数据切片
 
@@ -2022,8 +2032,7 @@ func (c *Client) ExecSQL(ctx context.Context, sql string) (*QueryResult, error)
 			if err != nil {
 				// 读取行出错
 				dataSet.Close() // 关闭数据集
-				done <- execResultWithError{result: result, err: fmt.Errorf("读取 SQL 结果集下一行时出错: %w", err)}
-				return
+				return fmt.Errorf("读取 SQL 结果集下一行时出错: %w", err)
 			}
 			if !hasNext {
 				break // 没有更多行
@@ -2044,20 +2053,14 @@ func (c *Client) ExecSQL(ctx context.Context, sql string) (*QueryResult, error)
 		}
 
 		// 成功处理完结果集
-		done <- execResultWithError{result: result, err: nil}
-		// --- goroutine 结束 ---
-	}()
-
-	select {
-	case <-ctx.Done():
-		err := ctx.Err()
-		if errors.Is(err, context.DeadlineExceeded) {
-			return nil, fmt.Errorf("SQL 执行操作超时: %w", ErrTimeout)
+		return nil
+	})
+	if err != nil {
+		if ctxErr := ctxError(ctx, "SQL 执行操作", ""); ctxErr != nil {
+			return nil, ctxErr
 		}
-		return nil, fmt.Errorf("SQL 执行操作被取消: %w", err)
-	case res := <-done:
-		return res.result, res.err
 	}
+	return result, err
 }
 
 // ====================================================================================
@@ -2070,14 +2073,10 @@ func (c *Client) ExecSQL(ctx context.Context, sql string) (*QueryResult, error)
 //    - 可以为更具体的操作失败（如 Insert 失败、Update 失败）定义更细粒度的错误类型，但这可能会增加复杂性。
 // 2. UpdateStruct:
 //    - 可以添加一个选项 (例如 `UpdateOptions` 结构体参数) 来支持 "只更新非零值字段" 的策略。这需要使用反射检查字段值是否为其类型的零值。
-// 3. DeleteByID:
-//    - ID 到字符串的转换和 SQL 转义仍然是基本的。对于生产环境，强烈建议研究 OpenPlant 是否支持参数化查询，或者使用更健壮的 SQL 构建库来处理不同类型的 ID 和转义。
-// 4. Scan/assignWithConversion:
+// 3. Scan/assignWithConversion:
 //    - JSON 转换已添加基础支持。可以扩展以处理更多边缘情况或配置选项（例如处理 null）。
 //    - 可以添加对其他常见数据交换格式（如 XML、CSV 行）的转换支持。
-// 5. 连接池:
-//    - 对于需要高并发处理大量短连接请求的场景，实现或集成连接池（如 database/sql/driver 风格或自定义池）将显著提高性能和资源利用率。这通常是一个重要的架构决策。
-// 6. V3 API 结构体:
+// 4. V3 API 结构体:
 //    - Value, Archive, Stat 结构体定义在 `api_v3.go` (假设)。可以考虑将它们移到更中心的位置（如 `types.go`）或在此文件中复制定义（如果 `api_v3.go` 不适合作为公共 API 的一部分）。
 
 // ====================================================================================
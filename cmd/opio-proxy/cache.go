@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/tc252617228/opio"
+)
+
+// realtimeCache - 带短期缓存的 V3Handler：ttl 内重复读取的实时值直接返回，其余命令经由上游转发。
+// 通过代理写入的测点立即失效，因此代理的客户端总能读到自己刚写入的值。
+type realtimeCache struct {
+	opio.V3Handler
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	values  map[int32]cachedValue
+	gen     uint64           // 每次写入递增
+	written map[int32]uint64 // 上游读取进行期间写入的测点及写入时的 gen，没有进行中的读取时清空
+	reading int              // 进行中的上游读取数
+}
+
+type cachedValue struct {
+	value opio.Value
+	at    time.Time
+}
+
+func newRealtimeCache(upstream opio.V3Handler, ttl time.Duration) *realtimeCache {
+	return &realtimeCache{
+		V3Handler: upstream,
+		ttl:       ttl,
+		now:       time.Now,
+		values:    make(map[int32]cachedValue),
+		written:   make(map[int32]uint64),
+	}
+}
+
+// ReadRealtime 先从缓存中取值，只向上游读取缺失或过期的测点。
+// 读取期间被写入的测点不缓存读到的值，避免用写入之前的旧值覆盖失效。
+func (c *realtimeCache) ReadRealtime(ctx context.Context, values []opio.Value) error {
+	now := c.now()
+	var missing []int
+	c.mu.Lock()
+	for i := range values {
+		if v, ok := c.values[values[i].ID]; ok && now.Sub(v.at) < c.ttl {
+			values[i] = v.value
+		} else {
+			missing = append(missing, i)
+		}
+	}
+	if len(missing) == 0 {
+		c.mu.Unlock()
+		return nil
+	}
+	start := c.gen
+	c.reading++
+	c.mu.Unlock()
+
+	read := make([]opio.Value, len(missing))
+	for i, j := range missing {
+		read[i].ID = values[j].ID
+	}
+	err := c.V3Handler.ReadRealtime(ctx, read)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reading--
+	if err == nil {
+		for i, j := range missing {
+			values[j] = read[i]
+			if read[i].RT != -1 && c.written[read[i].ID] <= start {
+				c.values[read[i].ID] = cachedValue{value: read[i], at: now}
+			}
+		}
+		c.prune(now)
+	}
+	if c.reading == 0 && len(c.written) > 0 {
+		c.written = make(map[int32]uint64)
+	}
+	return err
+}
+
+// WriteRealtime 转发写入，写入完成后使这些测点失效。
+func (c *realtimeCache) WriteRealtime(ctx context.Context, values []opio.Value) error {
+	err := c.V3Handler.WriteRealtime(ctx, values)
+	c.mu.Lock()
+	c.gen++
+	for _, v := range values {
+		delete(c.values, v.ID)
+		if c.reading > 0 {
+			c.written[v.ID] = c.gen
+		}
+	}
+	c.mu.Unlock()
+	return err
+}
+
+// prune - 缓存较大时删除过期的值，调用方持有 c.mu
+func (c *realtimeCache) prune(now time.Time) {
+	if len(c.values) < 4096 {
+		return
+	}
+	for id, v := range c.values {
+		if now.Sub(v.at) >= c.ttl {
+			delete(c.values, id)
+		}
+	}
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/tc252617228/opio"
+)
+
+// fanout - 合并下游连接的订阅：同一张表、同一种键类型的订阅共用一个上游订阅，每个键在上游只订阅一次，
+// 上游推送的行按键分发给订阅了该键的下游连接。
+//
+// 上游订阅总是带快照，代理保存每个键最近一次推送的行：下游订阅已在上游订阅过的键且要求快照时，由代理发送保存的行。
+// 因此第一个订阅某个键的下游连接即使没有要求快照，也会收到一次该键的当前值。
+type fanout struct {
+	client *opio.Client
+
+	mu        sync.Mutex
+	upstreams map[string]*upstream       // 表名 (小写) + 键类型 -> 上游订阅
+	conns     map[*opio.Pusher][]*member // 下游连接 -> 它在各上游订阅中的成员
+}
+
+// upstream - 一个上游订阅
+type upstream struct {
+	name, table, key string
+	kind             keyKind
+	sub              *opio.Subscription
+	holders          map[interface{}]map[*member]struct{} // 键 -> 订阅了该键的下游
+	last             map[interface{}]event                // 键 -> 最近一次推送的行
+}
+
+// member - 一个下游连接在某个上游订阅中订阅的键
+type member struct {
+	pusher *opio.Pusher
+	up     *upstream
+	keys   map[interface{}]struct{}
+}
+
+// event - 一行推送数据
+type event struct {
+	cols []opio.Column
+	data map[string]interface{}
+}
+
+// keyKind - 订阅键的类型，对应 Indexes 的 []int32、[]int64 与 []string
+type keyKind int
+
+const (
+	kindInt32 keyKind = iota + 1
+	kindInt64
+	kindString
+)
+
+func newFanout(client *opio.Client) *fanout {
+	return &fanout{
+		client:    client,
+		upstreams: make(map[string]*upstream),
+		conns:     make(map[*opio.Pusher][]*member),
+	}
+}
+
+// serve - 处理下游的订阅请求：没有 Subscribe 属性时替换该连接对这张表的订阅，Subscribe=1/0 时增删订阅键
+func (f *fanout) serve(ctx context.Context, req *opio.Request) error {
+	pusher, ok := opio.PusherFromContext(ctx)
+	if !ok {
+		return errors.New("opio-proxy: subscription without connection")
+	}
+	keys, kind := splitKeys(req.GetIndexes())
+	if kind == 0 {
+		return fmt.Errorf("opio-proxy: unsupported subscription keys %T", req.GetIndexes())
+	}
+	table := req.GetTableName()
+	key, _ := req.Get(opio.PropKey).(string)
+	if key == "" {
+		key = "ID"
+		if kind == kindString {
+			key = "GN"
+		}
+	}
+	change, isChange := intValue(req.Get(opio.PropSubscribe))
+	snapshot, _ := req.Get(opio.PropSnapshot).(bool)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, watched := f.conns[pusher]; !watched {
+		f.conns[pusher] = nil
+		go func() {
+			<-ctx.Done()
+			f.drop(pusher)
+		}()
+	}
+	name := fmt.Sprintf("%s/%d", strings.ToLower(table), kind)
+	up := f.upstreams[name]
+	var m *member
+	if up != nil {
+		m = f.member(pusher, up)
+	}
+	if isChange && change == 0 {
+		if m != nil {
+			f.remove(m, keys)
+		}
+		return nil
+	}
+	if !isChange && m != nil {
+		// 替换订阅：先退订原有的键，最后一个键退订时上游订阅会被关闭
+		f.remove(m, m.keysList())
+		up, m = f.upstreams[name], nil
+	}
+
+	if up == nil {
+		up = &upstream{name: name, table: table, key: key, kind: kind,
+			holders: make(map[interface{}]map[*member]struct{}), last: make(map[interface{}]event)}
+	}
+	if m == nil {
+		m = &member{pusher: pusher, up: up, keys: make(map[interface{}]struct{})}
+	}
+	// added 为上游尚未订阅的键，known 为其他下游已经订阅的键
+	var added, known []interface{}
+	for _, k := range keys {
+		if _, ok := m.keys[k]; ok {
+			continue
+		}
+		m.keys[k] = struct{}{}
+		if up.holders[k] == nil {
+			up.holders[k] = make(map[*member]struct{})
+			added = append(added, k)
+		} else {
+			known = append(known, k)
+		}
+		up.holders[k][m] = struct{}{}
+	}
+
+	var err error
+	switch {
+	case up.sub == nil:
+		if up.sub, err = f.client.Subscribe(context.Background(), table, key, kind.slice(added), &opio.SubscribeOptions{Snapshot: true}); err == nil {
+			f.upstreams[name] = up
+			go f.dispatch(up, up.sub)
+		}
+	case len(added) > 0:
+		err = up.sub.AddKeys(kind.slice(added))
+	}
+	if err != nil {
+		for _, k := range append(added, known...) {
+			delete(m.keys, k)
+			delete(up.holders[k], m)
+			if len(up.holders[k]) == 0 {
+				delete(up.holders, k)
+			}
+		}
+		return fmt.Errorf("opio-proxy: subscribe %s: %w", table, err)
+	}
+	if !containsMember(f.conns[pusher], m) {
+		f.conns[pusher] = append(f.conns[pusher], m)
+	}
+	if snapshot {
+		for _, k := range known {
+			if ev, ok := up.last[k]; ok {
+				go m.push(ev)
+			}
+		}
+	}
+	return nil
+}
+
+// member - 下游连接在上游订阅 up 中的成员，调用方持有 f.mu
+func (f *fanout) member(pusher *opio.Pusher, up *upstream) *member {
+	for _, m := range f.conns[pusher] {
+		if m.up == up {
+			return m
+		}
+	}
+	return nil
+}
+
+// remove - 删除成员 m 订阅的键，没有下游订阅的键从上游退订，调用方持有 f.mu
+func (f *fanout) remove(m *member, keys []interface{}) {
+	up := m.up
+	var removed []interface{}
+	for _, k := range keys {
+		if _, ok := m.keys[k]; !ok {
+			continue
+		}
+		delete(m.keys, k)
+		delete(up.holders[k], m)
+		if len(up.holders[k]) == 0 {
+			delete(up.holders, k)
+			delete(up.last, k)
+			removed = append(removed, k)
+		}
+	}
+	if len(m.keys) == 0 {
+		f.conns[m.pusher] = removeMember(f.conns[m.pusher], m)
+	}
+	if len(up.holders) == 0 {
+		// 最后一个下游退订之后关闭上游订阅
+		if f.upstreams[up.name] == up {
+			delete(f.upstreams, up.name)
+		}
+		_ = up.sub.Close()
+		return
+	}
+	if len(removed) > 0 {
+		if err := up.sub.RemoveKeys(up.kind.slice(removed)); err != nil {
+			log.Printf("opio-proxy: unsubscribe %s: %v", up.table, err)
+		}
+	}
+}
+
+// drop - 下游连接断开时删除它的所有订阅
+func (f *fanout) drop(pusher *opio.Pusher) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, m := range append([]*member(nil), f.conns[pusher]...) {
+		f.remove(m, m.keysList())
+	}
+	delete(f.conns, pusher)
+}
+
+// dispatch - 把上游推送的行分发给订阅了该键的下游连接
+func (f *fanout) dispatch(up *upstream, sub *opio.Subscription) {
+	for ev := range sub.Events() {
+		if ev.Err != nil {
+			log.Printf("opio-proxy: subscription %s: %v", up.table, ev.Err)
+			continue
+		}
+		k, ok := up.kind.normalize(ev.Data[up.key])
+		if !ok {
+			continue
+		}
+		e := event{cols: ev.Columns, data: ev.Data}
+		f.mu.Lock()
+		if f.upstreams[up.name] != up || up.holders[k] == nil {
+			f.mu.Unlock()
+			continue
+		}
+		up.last[k] = e
+		members := make([]*member, 0, len(up.holders[k]))
+		for m := range up.holders[k] {
+			members = append(members, m)
+		}
+		f.mu.Unlock()
+		for _, m := range members {
+			m.push(e)
+		}
+	}
+}
+
+// push - 向下游连接发送一行，连接已断开时由 drop 清理
+func (m *member) push(ev event) {
+	_ = m.pusher.Push(func(res *opio.Response) {
+		ds := res.DataSet(m.up.table)
+		ds.AddColumns(ev.cols)
+		_ = ds.AppendMap(ev.data)
+	})
+}
+
+func (m *member) keysList() []interface{} {
+	keys := make([]interface{}, 0, len(m.keys))
+	for k := range m.keys {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func removeMember(ms []*member, m *member) []*member {
+	out := ms[:0]
+	for _, x := range ms {
+		if x != m {
+			out = append(out, x)
+		}
+	}
+	return out
+}
+
+func containsMember(ms []*member, m *member) bool {
+	for _, x := range ms {
+		if x == m {
+			return true
+		}
+	}
+	return false
+}
+
+// splitKeys - 把 Indexes 的键列表拆成单个的键
+func splitKeys(v interface{}) ([]interface{}, keyKind) {
+	var keys []interface{}
+	switch ks := v.(type) {
+	case []int32:
+		for _, k := range ks {
+			keys = append(keys, k)
+		}
+		return keys, kindInt32
+	case []int64:
+		for _, k := range ks {
+			keys = append(keys, k)
+		}
+		return keys, kindInt64
+	case []string:
+		for _, k := range ks {
+			keys = append(keys, k)
+		}
+		return keys, kindString
+	}
+	return nil, 0
+}
+
+// slice - 转换为 Client.Subscribe 接受的键列表
+func (kind keyKind) slice(keys []interface{}) interface{} {
+	switch kind {
+	case kindInt32:
+		out := make([]int32, len(keys))
+		for i, k := range keys {
+			out[i] = k.(int32)
+		}
+		return out
+	case kindInt64:
+		out := make([]int64, len(keys))
+		for i, k := range keys {
+			out[i] = k.(int64)
+		}
+		return out
+	}
+	out := make([]string, len(keys))
+	for i, k := range keys {
+		out[i] = k.(string)
+	}
+	return out
+}
+
+// normalize - 把推送行中键列的值转换为与订阅键相同的类型
+func (kind keyKind) normalize(v interface{}) (interface{}, bool) {
+	if kind == kindString {
+		s, ok := v.(string)
+		return s, ok
+	}
+	n, ok := intValue(v)
+	if !ok {
+		return nil, false
+	}
+	if kind == kindInt32 {
+		return int32(n), true
+	}
+	return n, true
+}
+
+// intValue - 属性与列值中的整数
+func intValue(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int8:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint8:
+		return int64(n), true
+	case uint16:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	case uint64:
+		return int64(n), true
+	case int:
+		return int64(n), true
+	}
+	return 0, false
+}
@@ -0,0 +1,106 @@
+// opio 是 opio 客户端的命令行工具。
+//
+// 用法:
+//
+//	opio capture [-payload] [-conn N] file   以文本形式打印 CaptureTracer 写出的捕获文件
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/tc252617228/opio"
+)
+
+// command - 一个子命令
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"capture": {"capture [-payload] [-conn N] file   打印捕获文件", runCapture},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "opio: 未知的子命令 %q\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "opio:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(os.Stderr, "用法:")
+	for _, name := range names {
+		fmt.Fprintln(os.Stderr, "  opio", commands[name].usage)
+	}
+}
+
+func runCapture(args []string) error {
+	fs := flag.NewFlagSet("capture", flag.ContinueOnError)
+	payload := fs.Bool("payload", false, "在每个帧之后打印负载的十六进制转储")
+	conn := fs.Uint("conn", 0, "只打印指定编号的连接，0 表示全部")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("capture 需要一个捕获文件")
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return printCapture(os.Stdout, f, *payload, uint32(*conn))
+}
+
+// printCapture - 逐条打印捕获记录，conn 非 0 时只打印该连接的记录
+func printCapture(w io.Writer, r io.Reader, payload bool, conn uint32) error {
+	cr, err := opio.ReadCapture(r)
+	if err != nil {
+		return err
+	}
+	for {
+		rec, err := cr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if conn != 0 && recordConn(rec) != conn {
+			continue
+		}
+		fmt.Fprintln(w, rec)
+		if payload && rec.Frame != nil && len(rec.Frame.Payload) > 0 {
+			fmt.Fprint(w, hex.Dump(rec.Frame.Payload))
+		}
+	}
+}
+
+func recordConn(rec *opio.CaptureRecord) uint32 {
+	if rec.Frame != nil {
+		return rec.Frame.Conn
+	}
+	return rec.Props.Conn
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tc252617228/opio"
+)
+
+func TestPrintCapture(t *testing.T) {
+	var file bytes.Buffer
+	capture := opio.NewCaptureTracer(&file)
+	at := time.Date(2024, 5, 1, 8, 0, 0, 0, time.Local)
+	capture.TraceProps(&opio.PropsEvent{
+		TraceInfo: opio.TraceInfo{Time: at, Conn: 1, Addr: "10.0.0.1:8200", Dir: opio.TraceSent},
+		Props:     map[string]interface{}{opio.PropAction: opio.ActionSelect, opio.PropTable: "Point"},
+	})
+	capture.TraceFrame(&opio.FrameEvent{
+		TraceInfo: opio.TraceInfo{Time: at, Conn: 2, Addr: "10.0.0.1:8200", Dir: opio.TraceReceived},
+		EOF:       true, Mode: opio.ZIP_MODEL_Block, WireLen: 3, Payload: []byte("abcdef"),
+	})
+	require.NoError(t, capture.Flush())
+
+	var out bytes.Buffer
+	require.NoError(t, printCapture(&out, bytes.NewReader(file.Bytes()), true, 0))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, `2024-05-01T08:00:00.000000 #1 10.0.0.1:8200 send props {Action: "Select", Table: "Point"}`, lines[0])
+	assert.Equal(t, "2024-05-01T08:00:00.000000 #2 10.0.0.1:8200 recv frame eof=1 mode=block raw=6 wire=3", lines[1])
+	assert.Contains(t, lines[2], "61 62 63 64 65 66")
+
+	out.Reset()
+	require.NoError(t, printCapture(&out, bytes.NewReader(file.Bytes()), false, 2))
+	assert.Equal(t, 1, strings.Count(out.String(), "\n"), "只打印指定连接的记录")
+}
@@ -0,0 +1,170 @@
+package opio
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tc252617228/opio/internal/utils"
+)
+
+// AdaptiveCompression 定义自适应压缩：只压缩足够大的帧，压缩效果差时改为发送原始数据。
+// 对端按每个帧头中的压缩模式解码，因此同一连接上压缩帧与原始帧可以混合出现。
+type AdaptiveCompression struct {
+	Mode     byte    // 使用的压缩算法，ZIP_MODEL_Frame 或 ZIP_MODEL_Block
+	MinSize  int     // 负载小于该字节数的帧不压缩，0 表示所有帧都尝试压缩
+	MaxRatio float64 // 压缩后长度超过原始长度的 MaxRatio 倍时发送原始数据，取值 (0, 1]，0 表示不检查
+}
+
+// DefaultAdaptiveCompression 返回使用 block 压缩、512 字节以下的帧不压缩、压缩率不足 10% 时回退原始数据的配置。
+func DefaultAdaptiveCompression() AdaptiveCompression {
+	return AdaptiveCompression{Mode: ZIP_MODEL_Block, MinSize: 512, MaxRatio: 0.9}
+}
+
+func (a AdaptiveCompression) validate() error {
+	if a.Mode != ZIP_MODEL_Frame && a.Mode != ZIP_MODEL_Block {
+		return errors.New("opio: AdaptiveCompression.Mode must be ZIP_MODEL_Frame or ZIP_MODEL_Block")
+	}
+	if a.MinSize < 0 {
+		return errors.New("opio: AdaptiveCompression.MinSize must not be negative")
+	}
+	if a.MaxRatio < 0 || a.MaxRatio > 1 {
+		return errors.New("opio: AdaptiveCompression.MaxRatio must be in [0, 1]")
+	}
+	return nil
+}
+
+// compressSetting - 连接的压缩设置，零值表示不压缩
+type compressSetting struct {
+	mode     byte
+	minSize  int
+	maxRatio float64
+}
+
+func (s compressSetting) validate() error {
+	switch s.mode {
+	case ZIP_MODEL_Uncompressed, ZIP_MODEL_Frame, ZIP_MODEL_Block:
+	default:
+		return fmt.Errorf("opio: unknown compression mode %d", s.mode)
+	}
+	if s.minSize < 0 || s.maxRatio < 0 || s.maxRatio > 1 {
+		return errors.New("opio: compression threshold out of range")
+	}
+	return nil
+}
+
+// ModeTraffic 是某一压缩模式下的收发统计。
+type ModeTraffic struct {
+	Frames       uint64        // 帧数
+	RawBytes     uint64        // 压缩前 (发送) 或解压后 (接收) 的负载字节数
+	WireBytes    uint64        // 网络上实际传输的字节数，包含 4 字节帧头
+	CompressTime time.Duration // 压缩 (发送) 或解压 (接收) 耗时
+}
+
+// Ratio 返回 WireBytes 与 RawBytes 之比，没有数据时返回 0。
+func (t ModeTraffic) Ratio() float64 {
+	if t.RawBytes == 0 {
+		return 0
+	}
+	return float64(t.WireBytes) / float64(t.RawBytes)
+}
+
+func (t ModeTraffic) add(o ModeTraffic) ModeTraffic {
+	t.Frames += o.Frames
+	t.RawBytes += o.RawBytes
+	t.WireBytes += o.WireBytes
+	t.CompressTime += o.CompressTime
+	return t
+}
+
+// TrafficStats 是收发流量的快照。Sent 与 Received 按帧实际使用的压缩模式索引：
+// [ZIP_MODEL_Uncompressed] 为原始帧 (包括自适应压缩回退的帧)，[ZIP_MODEL_Frame]、[ZIP_MODEL_Block] 为压缩帧。
+type TrafficStats struct {
+	Sent     [3]ModeTraffic
+	Received [3]ModeTraffic
+}
+
+// TotalSent 返回所有模式发送统计的合计。
+func (s TrafficStats) TotalSent() ModeTraffic {
+	var t ModeTraffic
+	for _, m := range s.Sent {
+		t = t.add(m)
+	}
+	return t
+}
+
+// TotalReceived 返回所有模式接收统计的合计。
+func (s TrafficStats) TotalReceived() ModeTraffic {
+	var t ModeTraffic
+	for _, m := range s.Received {
+		t = t.add(m)
+	}
+	return t
+}
+
+func newTrafficStats(t *utils.TrafficCounter) TrafficStats {
+	var s TrafficStats
+	if t == nil {
+		return s
+	}
+	sent, received := t.Snapshot()
+	for i := range s.Sent {
+		s.Sent[i] = ModeTraffic(sent[i])
+		s.Received[i] = ModeTraffic(received[i])
+	}
+	return s
+}
+
+// SetAdaptiveCompression 为该连接启用自适应压缩。
+func (op *IOConnect) SetAdaptiveCompression(cfg AdaptiveCompression) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	return op.applyCompression(compressSetting{mode: cfg.Mode, minSize: cfg.MinSize, maxRatio: cfg.MaxRatio})
+}
+
+// applyCompression - 设置底层缓冲区的压缩模式与自适应参数，失败时保持原设置
+func (op *IOConnect) applyCompression(s compressSetting) error {
+	if op.io == nil {
+		return ErrConnectionClosed
+	}
+	if err := op.io.SetCompressThreshold(s.minSize, s.maxRatio); err != nil {
+		return err
+	}
+	if err := op.io.SetCompressModel(s.mode); err != nil {
+		_ = op.io.SetCompressThreshold(op.compression.minSize, op.compression.maxRatio)
+		return err
+	}
+	op.compression = s
+	return nil
+}
+
+// TrafficStats 返回该连接建立以来的收发流量统计。
+func (op *IOConnect) TrafficStats() TrafficStats {
+	if op.io == nil {
+		return TrafficStats{}
+	}
+	return newTrafficStats(op.io.Traffic())
+}
+
+// SetAdaptiveCompression 为客户端的所有连接启用自适应压缩，使用中的连接在下次借出时同步。
+// 与 SetCompression 相比，小请求 (例如单点的实时值查询) 不再承担压缩开销，难以压缩的数据也不会变大。
+func (c *Client) SetAdaptiveCompression(cfg AdaptiveCompression) error {
+	if c.closed() {
+		return ErrConnectionClosed
+	}
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	err := c.pool.setCompression(compressSetting{mode: cfg.Mode, minSize: cfg.MinSize, maxRatio: cfg.MaxRatio})
+	if err == nil {
+		c.compressionMode = cfg.Mode
+	}
+	return err
+}
+
+// TrafficStats 返回客户端建立以来所有连接 (包括已关闭的池连接与订阅连接) 的收发流量统计，
+// 可用来比较不同压缩模式节省的带宽与耗费的 CPU 时间。
+func (c *Client) TrafficStats() TrafficStats {
+	return newTrafficStats(c.opts.traffic)
+}
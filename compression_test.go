@@ -0,0 +1,104 @@
+package opio_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tc252617228/opio"
+)
+
+// modeRecorder 记录每个请求帧头中的压缩模式，并对每个请求回复 okResponse。
+type modeRecorder struct {
+	mu    sync.Mutex
+	modes []byte
+}
+
+func (r *modeRecorder) serve(conn net.Conn) {
+	defer conn.Close()
+	if fakeLogin(conn) != nil {
+		return
+	}
+	head := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(conn, head); err != nil {
+			return
+		}
+		if _, err := io.ReadFull(conn, make([]byte, int(head[2])<<8|int(head[3]))); err != nil {
+			return
+		}
+		r.mu.Lock()
+		r.modes = append(r.modes, head[1]&3)
+		r.mu.Unlock()
+		if head[0] == 1 && writeFrame(conn, okResponse) != nil {
+			return
+		}
+	}
+}
+
+func (r *modeRecorder) last() byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.modes[len(r.modes)-1]
+}
+
+func TestAdaptiveCompression(t *testing.T) {
+	srv := &modeRecorder{}
+	host, port := listenLocal(t, srv.serve)
+	client, err := opio.Connect(context.Background(), host, port, "sis", "openplant", time.Second)
+	require.NoError(t, err)
+	defer client.Close()
+
+	require.NoError(t, client.SetAdaptiveCompression(opio.AdaptiveCompression{Mode: opio.ZIP_MODEL_Block, MinSize: 256, MaxRatio: 0.9}))
+
+	before := client.TrafficStats() // 登录握手的流量也计入统计
+	// 小请求低于阈值，按原始帧发送
+	_, err = client.ExecSQL(context.Background(), "SELECT 1")
+	require.NoError(t, err)
+	assert.Equal(t, byte(opio.ZIP_MODEL_Uncompressed), srv.last())
+
+	// 重复度高的大请求被压缩
+	sql := "SELECT ID,GN,PN FROM W3.Point WHERE PN IN (" + strings.Repeat("'W3.NODE.TAG_000001',", 200) + "'X')"
+	_, err = client.ExecSQL(context.Background(), sql)
+	require.NoError(t, err)
+	assert.Equal(t, byte(opio.ZIP_MODEL_Block), srv.last())
+
+	stats := client.TrafficStats()
+	block := stats.Sent[opio.ZIP_MODEL_Block]
+	assert.Equal(t, uint64(1), block.Frames)
+	assert.Less(t, block.WireBytes, block.RawBytes)
+	assert.Less(t, block.Ratio(), 0.9)
+	assert.Equal(t, uint64(1), stats.Sent[opio.ZIP_MODEL_Uncompressed].Frames-before.Sent[opio.ZIP_MODEL_Uncompressed].Frames)
+	assert.Equal(t, uint64(2), stats.TotalSent().Frames-before.TotalSent().Frames)
+	assert.Equal(t, uint64(2), stats.TotalReceived().Frames-before.TotalReceived().Frames)
+	assert.Equal(t, uint64(2*(len(okResponse)+4)), stats.TotalReceived().WireBytes-before.TotalReceived().WireBytes)
+
+	// 关闭自适应压缩后不再压缩
+	require.NoError(t, client.SetCompression(opio.ZIP_MODEL_Uncompressed))
+	_, err = client.ExecSQL(context.Background(), sql)
+	require.NoError(t, err)
+	assert.Equal(t, byte(opio.ZIP_MODEL_Uncompressed), srv.last())
+}
+
+func TestCompressionRejectsInvalidMode(t *testing.T) {
+	host, port := listenLocal(t, serveOK)
+	client, err := opio.Connect(context.Background(), host, port, "sis", "openplant", time.Second)
+	require.NoError(t, err)
+	defer client.Close()
+
+	assert.Error(t, client.SetCompression(7), "无效的压缩模式不应被静默忽略")
+	assert.Error(t, client.SetAdaptiveCompression(opio.AdaptiveCompression{Mode: opio.ZIP_MODEL_Uncompressed}))
+	assert.Error(t, client.SetAdaptiveCompression(opio.AdaptiveCompression{Mode: opio.ZIP_MODEL_Frame, MaxRatio: 1.5}))
+
+	op, err := opio.InitContext(context.Background(), host, port, "sis", "openplant")
+	require.NoError(t, err)
+	defer op.Close()
+	assert.Error(t, op.SetCompressModel(3))
+	require.NoError(t, op.SetCompressModel(opio.ZIP_MODEL_Frame))
+}
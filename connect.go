@@ -1,9 +1,11 @@
 package opio
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
+	"strconv"
 	"time"
 
 	"github.com/tc252617228/opio/internal/utils"
@@ -23,6 +25,67 @@ type IOConnect struct {
 	client  string // client address
 	errno   int32
 	io      *utils.Buffer
+
+	opts        connectOptions  // 建立连接时使用的选项，Copy 与 Reconnect 复用
+	compression compressSetting // 当前设置的压缩模式与自适应参数
+	poisoned    bool            // 请求被取消或中途失败，连接上可能残留未读的应答
+	token       string          // 附加到每个请求的会话令牌，由 Authenticator 维护
+}
+
+const (
+	defaultDialTimeout = 10 * time.Second
+	drainTimeout       = 5 * time.Second // 归还连接前读掉残留应答的最长等待时间
+)
+
+// ConnectPhase 标识建立连接过程中的阶段
+type ConnectPhase string
+
+const (
+	PhaseDial     ConnectPhase = "dial"     // 拨号建立底层连接
+	PhaseTLS      ConnectPhase = "tls"      // TLS 握手 (仅在使用 WithTLS 时)
+	PhaseGreeting ConnectPhase = "greeting" // 读取服务端 100 字节问候包
+	PhaseAuth     ConnectPhase = "auth"     // 发送口令应答并读取 16 字节确认
+
+	// PhaseCredentials 获取登录凭据 (CredentialProvider 或 Authenticator) 失败，
+	// 与服务端拒绝登录的 PhaseAuth 不同，这类失败通常是暂时的，重连策略会按退避重试
+	PhaseCredentials ConnectPhase = "credentials"
+)
+
+// ConnectError 表示建立连接失败，Phase 指明失败发生在哪个阶段。
+// 如果失败是由 ctx 取消或超时引起的，Err 为 ctx.Err()，可以通过 errors.Is(err, context.DeadlineExceeded) 判断。
+type ConnectError struct {
+	Phase ConnectPhase
+	Addr  string
+	Err   error
+}
+
+func (e *ConnectError) Error() string {
+	return fmt.Sprintf("opio: connect %s failed during %s: %v", e.Addr, e.Phase, e.Err)
+}
+
+func (e *ConnectError) Unwrap() error {
+	return e.Err
+}
+
+// newConnectError - 如果 ctx 已结束，优先报告 ctx 的错误而不是被打断的 IO 错误
+func newConnectError(ctx context.Context, phase ConnectPhase, addr string, err error) *ConnectError {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		err = ctxErr
+	} else if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		// 连接上的截止时间可能比 ctx 的定时器先触发
+		err = context.DeadlineExceeded
+	}
+	return &ConnectError{Phase: phase, Addr: addr, Err: err}
+}
+
+// loginError - loginExt 内部使用，记录出错的握手阶段
+type loginError struct {
+	phase ConnectPhase
+	err   error
+}
+
+func (e *loginError) Error() string {
+	return e.err.Error()
 }
 
 func (op *IOConnect) GetAddress() string {
@@ -34,25 +97,87 @@ func (op *IOConnect) Info() string {
 }
 
 // Init - 创建新连接
+// timeout 以秒为单位，同时约束拨号与登录握手；小于等于 0 时使用默认的 10 秒。
 func Init(host string, port int, timeout int, user string, pass string) (*IOConnect, error) {
-	op := &IOConnect{nil, host, int32(port), int32(timeout), user, pass, 0, "", nil, "", 0, nil}
+	d := time.Duration(timeout) * time.Second
+	if d <= 0 {
+		d = defaultDialTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	op, err := InitContext(ctx, host, port, user, pass)
+	if err != nil {
+		return nil, err
+	}
+	op.timeout = int32(timeout)
+	return op, nil
+}
+
+// InitContext - 创建新连接，拨号与整个登录握手 (问候包、口令应答、16 字节确认) 都受 ctx 的截止时间与取消控制。
+// ctx 被取消时半开的 socket 会被立即关闭，返回的错误为 *ConnectError，可通过 Phase 判断失败阶段。
+// opts 可以指定 TLS 或自定义的 Dialer，登录握手在建立好的连接上照常进行。
+func InitContext(ctx context.Context, host string, port int, user string, pass string, opts ...ConnectOption) (*IOConnect, error) {
+	o := newConnectOptions(opts)
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+	return initEndpoints(ctx, host, port, user, pass, o)
+}
+
+func initContext(ctx context.Context, host string, port int, user string, pass string, o connectOptions) (*IOConnect, error) {
+	op := &IOConnect{host: host, port: int32(port), user: user, pass: pass, opts: o}
 	// 使用 net.JoinHostPort 兼容 IPv6
 	addr := net.JoinHostPort(host, fmt.Sprintf("%d", port))
-	conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
+	conn, err := o.dial(ctx, host, addr)
 	if err != nil {
 		return nil, err
 	}
 	op.conn = conn
+	op.io = utils.NewBuffer(op.conn, o.bufSize())
+	if o.traffic != nil {
+		op.io.SetSharedTraffic(o.traffic)
+	}
+	if o.tracer != nil {
+		op.io.SetTracer(newTraceAdapter(o.tracer, addr))
+	}
+	if err = op.loginContext(ctx); err != nil {
+		_ = op.Close()
+		return nil, err
+	}
+	return op, nil
+}
+
+// InitConnContext - 在调用方已经建立好的连接 (例如 net.Pipe、unix socket) 上执行登录握手。
+// 与 InitConnTCP 不同，返回的连接已经完成登录，可以直接发送请求；登录失败时 conn 会被关闭。
+// 由于不知道如何重新建立 conn，返回连接的 Copy 与 Reconnect 会按普通 TCP 拨号 conn 的远端地址。
+func InitConnContext(ctx context.Context, conn net.Conn, user string, pass string) (*IOConnect, error) {
+	op := &IOConnect{user: user, pass: pass}
+	if host, portStr, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil {
+		port, _ := strconv.Atoi(portStr)
+		op.host, op.port = host, int32(port)
+	}
+	op.conn = conn
 	op.io = utils.NewBuffer(op.conn, max_buffer_size)
-	err = op.loginExt()
-	if err != nil {
+	if err := op.loginContext(ctx); err != nil {
+		_ = op.Close()
 		return nil, err
 	}
 	return op, nil
 }
 
 func (op *IOConnect) copyConn() (*IOConnect, error) {
-	return Init(op.host, int(op.port), int(op.timeout), op.user, op.pass)
+	d := time.Duration(op.timeout) * time.Second
+	if d <= 0 {
+		d = defaultDialTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	nop, err := initContext(ctx, op.host, int(op.port), op.user, op.pass, op.opts)
+	if err != nil {
+		return nil, err
+	}
+	nop.timeout = op.timeout
+	return nop, nil
 }
 
 func (op *IOConnect) Copy() (*IOConnect, error) {
@@ -61,10 +186,10 @@ func (op *IOConnect) Copy() (*IOConnect, error) {
 
 // noinspection GoUnusedExportedFunction
 func InitConn(ip string, port int, timeOut int) (*IOConnect, error) {
-	op := &IOConnect{nil, ip, int32(port), int32(timeOut), "", "", 0, "", nil, "", 0, nil}
+	op := &IOConnect{host: ip, port: int32(port), timeout: int32(timeOut)}
 	// 使用 net.JoinHostPort 兼容 IPv6
 	addr := net.JoinHostPort(ip, fmt.Sprintf("%d", port))
-	conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
+	conn, err := net.DialTimeout("tcp", addr, defaultDialTimeout)
 	if err != nil {
 		return nil, err
 	}
@@ -165,7 +290,53 @@ func (op *IOConnect) login() error {
 
 }
 
-func (op *IOConnect) loginExt() error {
+// loginContext - 在 ctx 的控制下完成登录握手。
+// ctx 的截止时间会设置到底层 net.Conn 上，ctx 被取消时关闭 socket 以打断阻塞中的读写。
+func (op *IOConnect) loginContext(ctx context.Context) error {
+	addr := op.conn.RemoteAddr().String()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := op.conn.SetDeadline(deadline); err != nil {
+			return newConnectError(ctx, PhaseGreeting, addr, err)
+		}
+	}
+	stop := make(chan struct{})
+	watcher := make(chan struct{})
+	conn := op.conn
+	go func() {
+		defer close(watcher)
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-stop:
+		}
+	}()
+	err := op.loginExt(ctx)
+	if err == nil {
+		// 登录成功后由 Authenticator 获取会话令牌 (口令认证时不做任何事)
+		err = op.authorize(ctx)
+	}
+	close(stop)
+	<-watcher
+
+	var le *loginError
+	if errors.As(err, &le) {
+		return newConnectError(ctx, le.phase, addr, le.err)
+	}
+	if err != nil {
+		return newConnectError(ctx, PhaseAuth, addr, err)
+	}
+	if ctx.Err() != nil {
+		// 握手完成的同时 ctx 被取消，socket 可能已被关闭
+		return newConnectError(ctx, PhaseAuth, addr, ctx.Err())
+	}
+	// 恢复为无截止时间
+	if err = op.conn.SetDeadline(time.Time{}); err != nil {
+		return newConnectError(ctx, PhaseAuth, addr, err)
+	}
+	return nil
+}
+
+func (op *IOConnect) loginExt(ctx context.Context) error {
 
 	defer op.io.Reset()
 
@@ -173,7 +344,7 @@ func (op *IOConnect) loginExt() error {
 	buf := make([]byte, 100)
 	err = op.io.GetBytes(buf)
 	if err != nil {
-		return err
+		return &loginError{PhaseGreeting, err}
 	}
 	// server: SERVER_VERSION(60) + session(4) + SCRAMBLE(20) + 12 + ver(4)
 	n := 60
@@ -186,10 +357,14 @@ func (op *IOConnect) loginExt() error {
 	op.version = utils.GetInt32(buf[96:])
 
 	// client: client_info(40) + session(4) + user(16) + passwd(2+20) + (18)
+	user, secret, err := op.credentials(ctx)
+	if err != nil {
+		return &loginError{PhaseCredentials, err}
+	}
 	utils.Memset(buf, 0)
-	copy(buf[44:60], []byte(op.user))
-	if len(op.pass) > 0 {
-		reply := utils.Scramle(op.random, []byte(op.pass))
+	copy(buf[44:60], []byte(user))
+	if len(secret) > 0 {
+		reply := utils.Scramle(op.random, []byte(secret))
 		utils.PutInt16(buf[60:], int16(len(reply)))
 		copy(buf[62:82], reply)
 	}
@@ -198,19 +373,19 @@ func (op *IOConnect) loginExt() error {
 	_ = op.io.PutBytes(buf)
 	err = op.io.Flush(true)
 	if err != nil {
-		return err
+		return &loginError{PhaseAuth, err}
 	}
 
 	//  magic, peer, error, magic
 	err = op.io.GetBytes(buf[:16])
 	if err != nil {
-		return err
+		return &loginError{PhaseAuth, err}
 	}
 	op.client = fmt.Sprintf("%d.%d.%d.%d", buf[4], buf[5], buf[6], buf[7])
 	ret := utils.GetInt32(buf[8:])
 	if ret != 0 {
 		e := fmt.Sprintf("login %s:%d error %d", op.host, op.port, ret)
-		return errors.New(e)
+		return &loginError{PhaseAuth, errors.New(e)}
 	}
 
 	return nil
@@ -218,6 +393,16 @@ func (op *IOConnect) loginExt() error {
 
 // Alive -
 func (op *IOConnect) Alive() bool {
+	_, err := op.Echo(time.Millisecond * 10)
+	return err == nil
+}
+
+// Echo - 发送一个心跳包 (urlEcho) 并等待服务端回包，返回往返时间。
+// 探测直接读写底层连接，调用方必须保证连接上没有进行中的请求。失败的连接会被标记为不可复用。
+func (op *IOConnect) Echo(timeout time.Duration) (time.Duration, error) {
+	if op.conn == nil {
+		return 0, ErrConnectionClosed
+	}
 	var err error
 	b := []byte{
 		0x10, 0x20, 0x30, 0x40,
@@ -228,25 +413,32 @@ func (op *IOConnect) Alive() bool {
 		0xA5, //will come back
 		0x10, 0x20, 0x30, 0x40,
 	}
-	if err = op.conn.SetDeadline(time.Now().Add(time.Millisecond * 10)); err != nil {
+	start := time.Now()
+	defer func() {
+		if err != nil {
+			op.poisoned = true
+		}
+	}()
+	if err = op.conn.SetDeadline(start.Add(timeout)); err != nil {
 		//logs.Warn(" SetDeadline  Err", err)
-		return false
+		return 0, err
 	}
 	if _, err = op.conn.Write(b); err != nil {
 		//logs.Warn(" Write Alive message Err", err)
-		return false
+		return 0, err
 	}
 	r := make([]byte, 1)
 	if _, err = op.conn.Read(r); err != nil {
 		//logs.Warn("Read Alive message Err", err)
-		return false
+		return 0, err
 	}
+	rtt := time.Since(start)
 	//back to normal deadline time
-	if err := op.conn.SetDeadline(time.Time{}); err != nil {
+	if err = op.conn.SetDeadline(time.Time{}); err != nil {
 		//logs.Warn("SetDeadline Err", err)
-		return false
+		return 0, err
 	}
-	return true
+	return rtt, nil
 }
 
 // Version -
@@ -259,27 +451,48 @@ func (op *IOConnect) VersionNumber() int32 {
 	return op.version
 }
 
-// Close -
+// Close - 关闭连接并归还收发缓冲区。调用方必须保证没有其他协程仍在该连接上读写。
 func (op *IOConnect) Close() (err error) {
 	if op.conn != nil {
-		op.io.Clear()
-		op.io = nil
 		err = op.conn.Close()
+		op.io.Release() // 归还池化的收发缓冲区
+		op.io = nil
 		op.conn = nil
 	}
 	return err
 }
 
-// Reconnect - 重新连接
+// Reconnect - 关闭当前连接，按原有参数重新拨号并登录，然后恢复之前设置的压缩模式。
+// 拨号与登录受 Init 时的超时约束 (未设置时为 10 秒)。
 func (op *IOConnect) Reconnect() error {
-	_ = op.conn.Close()
-	// 使用 net.JoinHostPort 兼容 IPv6
-	addr := net.JoinHostPort(op.host, fmt.Sprintf("%d", op.port))
-	conn, err := net.Dial("tcp", addr)
+	d := time.Duration(op.timeout) * time.Second
+	if d <= 0 {
+		d = defaultDialTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	return op.ReconnectContext(ctx)
+}
+
+// ReconnectContext - 与 Reconnect 相同，拨号与登录握手受 ctx 控制。
+// 成功后连接会重新建立 utils.Buffer，旧连接上残留的数据和出错状态都会被丢弃。
+func (op *IOConnect) ReconnectContext(ctx context.Context) error {
+	if op.conn != nil {
+		_ = op.Close()
+	}
+	nop, err := initContext(ctx, op.host, int(op.port), op.user, op.pass, op.opts)
 	if err != nil {
 		return err
 	}
-	op.conn = conn
+	timeout, compression := op.timeout, op.compression
+	*op = *nop
+	op.timeout = timeout
+	if compression != (compressSetting{}) {
+		if err = op.applyCompression(compression); err != nil {
+			_ = op.Close()
+			return err
+		}
+	}
 	return nil
 }
 
@@ -290,6 +503,9 @@ func (op *IOConnect) NewRequest(m map[string]interface{}) *Request {
 		props: make(map[string]interface{}, propCapacity),
 	}
 	r.Reset()
+	if op.token != "" {
+		r.SetToken(op.token)
+	}
 
 	for k, v := range m {
 		r.Set(k, v)
@@ -304,17 +520,70 @@ func (op *IOConnect) GetEcho() (int8, error) {
 	return e, err
 }
 
-// SetCompressModel -
+// SetCompressModel - 设置数据网络传输的压缩模型 (ZIP_MODEL_Uncompressed、ZIP_MODEL_Frame 或 ZIP_MODEL_Block)，
+// 同时清除 SetAdaptiveCompression 设置的自适应参数。模式无效时返回错误并保持原设置。
 func (op *IOConnect) SetCompressModel(model byte) (err error) {
-	//TODO 数据网络传输压缩模型
-	_ = op.io.SetCompressModel(model)
-	return nil
+	return op.applyCompression(compressSetting{mode: model})
+}
+
+// Broken - 连接已关闭或底层读写曾经出错时返回 true，此时连接上的数据流已不可信，不能再复用
+func (op *IOConnect) Broken() bool {
+	return op.poisoned || op.conn == nil || op.io == nil || op.io.Err() != nil
+}
+
+// watchContext - 将 ctx 的截止时间设置到底层 net.Conn 上，ctx 被取消时把截止时间提前到当前时刻，
+// 立即打断阻塞中的读写。返回的 stop 函数等待监视 goroutine 退出，调用后才能安全地重置截止时间。
+func (op *IOConnect) watchContext(ctx context.Context) (stop func()) {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = op.conn.SetDeadline(deadline)
+	}
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	quit := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			_ = op.conn.SetDeadline(time.Now())
+		case <-quit:
+		}
+	}()
+	return func() {
+		close(quit)
+		<-exited
+	}
+}
+
+// settle - 一次请求结束后整理连接状态: 失败的请求把连接标记为污染 (poisoned)，
+// 成功的请求读掉残留的应答数据 (例如未关闭的数据集)，保证下一个请求从干净的数据流开始。
+func (op *IOConnect) settle(failed bool) {
+	if failed {
+		op.poisoned = true
+		return
+	}
+	if op.io.Pending() {
+		_ = op.conn.SetReadDeadline(time.Now().Add(drainTimeout))
+		if err := op.io.SkipAll(); err != nil {
+			op.poisoned = true
+			return
+		}
+	}
+	_ = op.conn.SetDeadline(time.Time{})
 }
 
 func (op *IOConnect) SkipAll() (err error) {
 	return op.io.SkipAll()
 }
 
+// interrupt - 只关闭底层 net.Conn，使阻塞在该连接上的读写立即出错返回；缓冲区留给正在使用它的协程在 Close 时归还
+func (op *IOConnect) interrupt() {
+	if op.conn != nil {
+		_ = op.conn.Close()
+	}
+}
+
 func (op *IOConnect) Clear() {
 	op.io.Clear()
 }
@@ -0,0 +1,155 @@
+package opio_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tc252617228/opio"
+)
+
+// listenLocal 启动一个本地监听，handler 在独立 goroutine 中处理每个连接。
+func listenLocal(t *testing.T, handler func(conn net.Conn)) (string, int) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go handler(conn)
+		}
+	}()
+	host, portStr, _ := net.SplitHostPort(ln.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	return host, port
+}
+
+// writeFrame 按 opio 帧格式 (eof, mode, len16) 写出一个未压缩帧。
+func writeFrame(w io.Writer, payload []byte) error {
+	head := []byte{1, 0, byte(len(payload) >> 8), byte(len(payload))}
+	_, err := w.Write(append(head, payload...))
+	return err
+}
+
+func TestConnectGreetingTimeout(t *testing.T) {
+	host, port := listenLocal(t, func(conn net.Conn) {
+		// 接受连接但从不发送问候包
+		_, _ = io.Copy(io.Discard, conn)
+		_ = conn.Close()
+	})
+
+	start := time.Now()
+	_, err := opio.Connect(context.Background(), host, port, "sis", "openplant", 200*time.Millisecond)
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+
+	var ce *opio.ConnectError
+	require.True(t, errors.As(err, &ce), "应返回 *ConnectError: %v", err)
+	assert.Equal(t, opio.PhaseGreeting, ce.Phase)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestConnectCancelClosesSocket(t *testing.T) {
+	closed := make(chan struct{})
+	host, port := listenLocal(t, func(conn net.Conn) {
+		_, _ = io.Copy(io.Discard, conn) // 客户端关闭 socket 后返回
+		close(closed)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	_, err := opio.Connect(ctx, host, port, "sis", "openplant", 0)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("取消后半开的 socket 未被关闭")
+	}
+}
+
+func TestConnectAuthRejected(t *testing.T) {
+	host, port := listenLocal(t, func(conn net.Conn) {
+		defer conn.Close()
+		greeting := make([]byte, 100)
+		copy(greeting, "OpenPlant test")
+		if writeFrame(conn, greeting) != nil {
+			return
+		}
+		reply := make([]byte, 104)
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return
+		}
+		ack := make([]byte, 16)
+		ack[11] = 0xff // errno = 255
+		_ = writeFrame(conn, ack)
+	})
+
+	_, err := opio.Connect(context.Background(), host, port, "sis", "bad", time.Second)
+	var ce *opio.ConnectError
+	require.True(t, errors.As(err, &ce), "应返回 *ConnectError: %v", err)
+	assert.Equal(t, opio.PhaseAuth, ce.Phase)
+}
+
+// fakeLogin 在服务端完成一次成功的登录握手。
+func fakeLogin(conn net.Conn) error {
+	greeting := make([]byte, 100)
+	copy(greeting, "OpenPlant test")
+	if err := writeFrame(conn, greeting); err != nil {
+		return err
+	}
+	if _, err := readMessage(conn); err != nil {
+		return err
+	}
+	return writeFrame(conn, make([]byte, 16))
+}
+
+// readMessage 读取一个完整的客户端消息 (直到 eof 帧)，只支持未压缩帧。
+func readMessage(conn net.Conn) ([]byte, error) {
+	var msg []byte
+	head := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(conn, head); err != nil {
+			return nil, err
+		}
+		body := make([]byte, int(head[2])<<8|int(head[3]))
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return nil, err
+		}
+		msg = append(msg, body...)
+		if head[0] == 1 {
+			return msg, nil
+		}
+	}
+}
+
+// okResponse 是一个 Errno=0、不带数据集的应答: {"Errno": 0} + nil
+var okResponse = []byte{0x81, 0xa5, 'E', 'r', 'r', 'n', 'o', 0x00, 0xc0}
+
+// BenchmarkConnectClose 在 net.Pipe 上反复登录并关闭连接，收发缓冲区从池中复用。
+func BenchmarkConnectClose(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		client, server := net.Pipe()
+		go func() {
+			_ = fakeLogin(server)
+			_, _ = io.Copy(io.Discard, server)
+		}()
+		op, err := opio.InitConnContext(context.Background(), client, "sis", "openplant")
+		if err != nil {
+			b.Fatal(err)
+		}
+		_ = op.Close()
+		_ = server.Close()
+	}
+}
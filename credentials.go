@@ -0,0 +1,84 @@
+package opio
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// CredentialProvider 提供登录使用的用户名与口令。
+// 每个新建立的物理连接 (连接池扩容、断线重连、订阅重连) 登录前都会调用一次 Credentials，
+// 服务端轮换口令后只需更新凭据来源，已经运行的客户端下一次建立连接时就会使用新口令。
+// Credentials 可能被多个协程同时调用。
+type CredentialProvider interface {
+	Credentials(ctx context.Context) (user string, password string, err error)
+}
+
+// WithCredentials 使用 p 提供的凭据登录，此时 Connect / InitContext 的 user 与 pass 参数被忽略。
+// 不能与 WithAuthenticator 同时使用。
+func WithCredentials(p CredentialProvider) ConnectOption {
+	return func(o *connectOptions) {
+		o.credentials = p
+	}
+}
+
+// CredentialsFunc 允许把普通函数用作 CredentialProvider，例如从密钥管理服务读取口令。
+type CredentialsFunc func(ctx context.Context) (user string, password string, err error)
+
+// Credentials 调用 f(ctx)。
+func (f CredentialsFunc) Credentials(ctx context.Context) (string, string, error) {
+	return f(ctx)
+}
+
+// EnvCredentials 每次从环境变量读取用户名与口令，变量未设置时返回错误。
+type EnvCredentials struct {
+	UserVar     string // 用户名所在的环境变量，例如 "OPIO_USER"
+	PasswordVar string // 口令所在的环境变量，例如 "OPIO_PASSWORD"
+}
+
+// Credentials 读取 UserVar 与 PasswordVar。
+func (e EnvCredentials) Credentials(ctx context.Context) (string, string, error) {
+	user, ok := os.LookupEnv(e.UserVar)
+	if !ok {
+		return "", "", fmt.Errorf("opio: environment variable %s is not set", e.UserVar)
+	}
+	pass, ok := os.LookupEnv(e.PasswordVar)
+	if !ok {
+		return "", "", fmt.Errorf("opio: environment variable %s is not set", e.PasswordVar)
+	}
+	return user, pass, nil
+}
+
+// FileCredentials 使用固定的用户名，每次从文件读取口令 (例如挂载的 secret 文件)，忽略末尾的换行。
+type FileCredentials struct {
+	User         string
+	PasswordFile string
+}
+
+// Credentials 返回 User 与 PasswordFile 的当前内容。
+func (f FileCredentials) Credentials(ctx context.Context) (string, string, error) {
+	b, err := os.ReadFile(f.PasswordFile)
+	if err != nil {
+		return "", "", fmt.Errorf("opio: 读取口令文件失败: %w", err)
+	}
+	return f.User, strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// credentials - 登录握手使用的用户名与口令，取自 Authenticator、CredentialProvider 或建立连接时传入的参数
+func (op *IOConnect) credentials(ctx context.Context) (string, string, error) {
+	var user, pass string
+	var err error
+	switch {
+	case op.opts.auth != nil:
+		user, pass, err = op.opts.auth.Handshake(ctx)
+	case op.opts.credentials != nil:
+		user, pass, err = op.opts.credentials.Credentials(ctx)
+	default:
+		return op.user, op.pass, nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("opio: 获取登录凭据失败: %w", err)
+	}
+	return user, pass, nil
+}
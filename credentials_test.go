@@ -0,0 +1,135 @@
+package opio_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tc252617228/opio"
+	"github.com/tc252617228/opio/internal/utils"
+)
+
+func TestCredentialsFetchedPerConnection(t *testing.T) {
+	srv := &tokenServer{delay: 50 * time.Millisecond}
+	host, port := listenLocal(t, srv.serve)
+	secret := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, os.WriteFile(secret, []byte("old\n"), 0o600))
+
+	client, err := opio.Connect(context.Background(), host, port, "", "", time.Second,
+		opio.WithCredentials(opio.FileCredentials{User: "sis", PasswordFile: secret}))
+	require.NoError(t, err)
+	defer client.Close()
+
+	// 轮换口令后，连接池扩容建立的连接使用新口令
+	require.NoError(t, os.WriteFile(secret, []byte("new\n"), 0o600))
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.ExecSQL(context.Background(), "SELECT 1")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	random := make([]byte, 20)
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	require.Len(t, srv.secrets, 2)
+	assert.Equal(t, utils.Scramle(random, []byte("old")), srv.secrets[0])
+	assert.Equal(t, utils.Scramle(random, []byte("new")), srv.secrets[1])
+}
+
+func TestCredentialsOnReconnect(t *testing.T) {
+	srv := &tokenServer{}
+	host, port := listenLocal(t, srv.serve)
+
+	var mu sync.Mutex
+	pass := "first"
+	provider := opio.CredentialsFunc(func(ctx context.Context) (string, string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return "sis", pass, nil
+	})
+	op, err := opio.InitContext(context.Background(), host, port, "", "", opio.WithCredentials(provider))
+	require.NoError(t, err)
+	mu.Lock()
+	pass = "second"
+	mu.Unlock()
+	require.NoError(t, op.ReconnectContext(context.Background()))
+	cp, err := op.Copy()
+	require.NoError(t, err)
+	_ = cp.Close()
+	_ = op.Close()
+
+	random := make([]byte, 20)
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	assert.Equal(t, [][]byte{
+		utils.Scramle(random, []byte("first")),
+		utils.Scramle(random, []byte("second")),
+		utils.Scramle(random, []byte("second")),
+	}, srv.secrets)
+}
+
+func TestCredentialProviderErrors(t *testing.T) {
+	t.Setenv("OPIO_TEST_USER", "sis")
+	t.Setenv("OPIO_TEST_PASSWORD", "openplant")
+	user, pass, err := opio.EnvCredentials{UserVar: "OPIO_TEST_USER", PasswordVar: "OPIO_TEST_PASSWORD"}.Credentials(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "sis", user)
+	assert.Equal(t, "openplant", pass)
+
+	_, _, err = opio.EnvCredentials{UserVar: "OPIO_TEST_USER", PasswordVar: "OPIO_TEST_MISSING"}.Credentials(context.Background())
+	assert.Error(t, err)
+
+	// 获取凭据失败时登录失败，错误链中包含 *ConnectError
+	host, port := listenLocal(t, (&tokenServer{}).serve)
+	_, err = opio.InitContext(context.Background(), host, port, "", "",
+		opio.WithCredentials(opio.FileCredentials{User: "sis", PasswordFile: filepath.Join(t.TempDir(), "missing")}))
+	var ce *opio.ConnectError
+	require.ErrorAs(t, err, &ce)
+	assert.Equal(t, opio.PhaseCredentials, ce.Phase)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestCredentialFailureRetried(t *testing.T) {
+	host, port := listenLocal(t, (&tokenServer{delay: 50 * time.Millisecond}).serve)
+	var mu sync.Mutex
+	calls := 0
+	provider := opio.CredentialsFunc(func(ctx context.Context) (string, string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 2 || calls == 3 {
+			return "", "", errors.New("secret store unavailable")
+		}
+		return "sis", "openplant", nil
+	})
+	client, err := opio.Connect(context.Background(), host, port, "", "", time.Second, opio.WithCredentials(provider))
+	require.NoError(t, err)
+	defer client.Close()
+	require.NoError(t, client.SetReconnectPolicy(opio.ReconnectPolicy{MaxAttempts: 3, InitialBackoff: 5 * time.Millisecond}))
+
+	// 第二个并发请求需要新建连接，获取凭据暂时失败时按重连策略重试
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.ExecSQL(context.Background(), "SELECT 1")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 4, calls)
+}
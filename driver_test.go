@@ -0,0 +1,109 @@
+package opio_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tc252617228/opio"
+	"github.com/tc252617228/opio/opiotest"
+)
+
+func TestSQLDriver(t *testing.T) {
+	srv := opiotest.NewServer()
+	defer srv.Close()
+	srv.AddPoints(
+		opiotest.Point{ID: 1, Name: "W3.AX.1", Type: opio.TypeAX},
+		opiotest.Point{ID: 2, Name: "W3.AX.2", Type: opio.TypeR8},
+		opiotest.Point{ID: 3, Name: "W3.DX.3", Type: opio.TypeDX},
+	)
+	srv.AddArchive(
+		opio.Value{ID: 1, TM: 1700000000, AV: 1.5},
+		opio.Value{ID: 1, TM: 1700000001, AV: 2.5},
+	)
+
+	db, err := sql.Open("opio", "opio://"+opiotest.DefaultUser+":"+opiotest.DefaultPassword+"@"+srv.Addr()+"?pool_max=2")
+	require.NoError(t, err)
+	defer db.Close()
+	ctx := context.Background()
+	require.NoError(t, db.PingContext(ctx))
+
+	rows, err := db.QueryContext(ctx, "SELECT ID, GN, RT FROM Point WHERE GN LIKE ? AND RT IN (?)", "W3.AX.%", []int8{opio.TypeAX, opio.TypeR8})
+	require.NoError(t, err)
+	types, err := rows.ColumnTypes()
+	require.NoError(t, err)
+	require.Len(t, types, 3)
+	assert.Equal(t, "ID", types[0].Name())
+	assert.Equal(t, "INT32", types[0].DatabaseTypeName())
+	assert.Equal(t, reflect.TypeOf(int64(0)), types[0].ScanType())
+	assert.Equal(t, reflect.TypeOf(""), types[1].ScanType())
+	assert.Equal(t, "INT8", types[2].DatabaseTypeName())
+	assert.Equal(t, reflect.TypeOf(int64(0)), types[2].ScanType())
+	var ids []int32
+	for rows.Next() {
+		// ScanType 与扫描到 interface{} 时得到的值类型一致
+		var id, name, typ interface{}
+		require.NoError(t, rows.Scan(&id, &name, &typ))
+		assert.Equal(t, types[0].ScanType(), reflect.TypeOf(id))
+		assert.Equal(t, types[1].ScanType(), reflect.TypeOf(name))
+		assert.Equal(t, types[2].ScanType(), reflect.TypeOf(typ))
+		ids = append(ids, int32(id.(int64)))
+	}
+	require.NoError(t, rows.Err())
+	require.NoError(t, rows.Close())
+	assert.Equal(t, []int32{1, 2}, ids)
+
+	// 时间与浮点列，命名参数
+	var tm time.Time
+	var av float64
+	err = db.QueryRowContext(ctx, "SELECT TM, AV FROM Archive WHERE ID = :id AND AV > :min", sql.Named("id", 1), sql.Named("min", 2)).Scan(&tm, &av)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1700000001), tm.Unix())
+	assert.Equal(t, 2.5, av)
+
+	// 预编译语句与非查询语句
+	stmt, err := db.PrepareContext(ctx, "DELETE FROM Point WHERE GN = ?")
+	require.NoError(t, err)
+	res, err := stmt.ExecContext(ctx, "W3.DX.3")
+	require.NoError(t, err)
+	_, err = res.RowsAffected()
+	assert.ErrorIs(t, err, opio.ErrDriverUnsupported)
+	require.NoError(t, stmt.Close())
+
+	var count int
+	require.NoError(t, db.QueryRowContext(ctx, "SELECT COUNT(*) FROM Point").Scan(&count))
+	assert.Equal(t, 2, count)
+
+	err = db.QueryRowContext(ctx, "SELECT ID FROM Point WHERE ID = ?", 42).Scan(&count)
+	assert.True(t, errors.Is(err, sql.ErrNoRows), "%v", err)
+
+	_, err = db.ExecContext(ctx, "DELETE FROM Point WHERE ID = ?", 1, 2)
+	assert.ErrorIs(t, err, opio.ErrInvalidSQLArg)
+	_, err = db.QueryContext(ctx, "SELECT * FROM Missing")
+	var serverErr *opio.OpioServerError
+	assert.True(t, errors.As(err, &serverErr), "%v", err)
+
+	_, err = db.BeginTx(ctx, nil)
+	assert.ErrorIs(t, err, opio.ErrDriverUnsupported)
+}
+
+func TestSQLDriverClientConnector(t *testing.T) {
+	_, client := opiotest.NewClient(t, func(srv *opiotest.Server) {
+		srv.AddPoints(opiotest.Point{ID: 7, Name: "W3.AX.7", Type: opio.TypeAX})
+	})
+
+	db := sql.OpenDB(client.Connector())
+	var name string
+	require.NoError(t, db.QueryRow("SELECT GN FROM Point WHERE ID = ?", 7).Scan(&name))
+	assert.Equal(t, "W3.AX.7", name)
+
+	// 关闭 sql.DB 不会关闭调用方的 Client
+	require.NoError(t, db.Close())
+	require.NoError(t, client.Ping(context.Background()))
+	assert.Equal(t, 0, client.PoolStats().InUse)
+}
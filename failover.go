@@ -0,0 +1,342 @@
+package opio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Endpoint 是一个 OpenPlant 服务端地址。
+type Endpoint struct {
+	Host string
+	Port int
+}
+
+// String 返回 "host:port" 形式的地址。
+func (e Endpoint) String() string {
+	return net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+}
+
+// ParseEndpoint 解析 "host" 或 "host:port" 形式的地址，省略端口时使用 DefaultPort。
+func ParseEndpoint(s string) (Endpoint, error) {
+	s = strings.TrimSpace(s)
+	host, port := s, DefaultPort
+	if h, p, err := net.SplitHostPort(s); err == nil {
+		if port, err = strconv.Atoi(p); err != nil {
+			return Endpoint{}, fmt.Errorf("opio: invalid port in endpoint %q", s)
+		}
+		host = h
+	}
+	if host == "" {
+		return Endpoint{}, fmt.Errorf("opio: endpoint %q is missing host", s)
+	}
+	if port <= 0 || port > 65535 {
+		return Endpoint{}, fmt.Errorf("opio: invalid port in endpoint %q", s)
+	}
+	return Endpoint{Host: host, Port: port}, nil
+}
+
+// FailoverPolicy 决定在多个端点之间选择连接目标的方式。
+type FailoverPolicy int
+
+const (
+	// FailoverSticky 总是优先连接排在前面的端点 (主服务器)：新连接按顺序尝试，
+	// 后台定期探测更高优先级的端点，恢复后自动切回。拨号失败的端点在 ProbeInterval 内排到最后，
+	// 主服务器停机期间新建连接直接使用当前端点，不必每次先等待主服务器的拨号超时。
+	FailoverSticky FailoverPolicy = iota
+	// FailoverRoundRobin 留在当前可用的端点上，直到它失效才依次尝试后面的端点，不会主动切回。
+	FailoverRoundRobin
+)
+
+func (p FailoverPolicy) String() string {
+	switch p {
+	case FailoverSticky:
+		return "sticky"
+	case FailoverRoundRobin:
+		return "round_robin"
+	}
+	return "unknown"
+}
+
+// FailoverConfig 定义主备服务器之间的故障切换。
+type FailoverConfig struct {
+	Endpoints     []Endpoint     // 备用端点，优先级依次排在 Connect 的 host:port 之后
+	Policy        FailoverPolicy // 端点选择策略，默认为 FailoverSticky
+	ProbeInterval time.Duration  // FailoverSticky 下探测更高优先级端点是否恢复的周期，也是拨号失败的端点暂停优先尝试的时长，0 表示 30 秒
+
+	// OnFailover 在活动端点切换后调用 (在发起切换的协程中同步执行，不应阻塞)。
+	// err 为导致切换的连接错误，由探测发起的切回主服务器时为 nil。
+	OnFailover func(from, to Endpoint, err error)
+}
+
+// WithFailover 为 Connect 配置备用端点。拨号或登录失败、连接中断时自动切换到下一个可用的端点，
+// 切换后连接池中指向旧端点的连接会被逐步替换，客户端创建的订阅也会重新连接到新的端点。
+// 用于 InitContext 时依次尝试各个端点，返回第一个成功建立的连接。
+func WithFailover(cfg FailoverConfig) ConnectOption {
+	return func(o *connectOptions) {
+		o.failover = &cfg
+	}
+}
+
+func (cfg FailoverConfig) validate() error {
+	if cfg.Policy != FailoverSticky && cfg.Policy != FailoverRoundRobin {
+		return fmt.Errorf("opio: unknown FailoverPolicy %d", cfg.Policy)
+	}
+	if cfg.ProbeInterval < 0 {
+		return errors.New("opio: FailoverConfig.ProbeInterval must not be negative")
+	}
+	for _, ep := range cfg.Endpoints {
+		if ep.Host == "" || ep.Port <= 0 || ep.Port > 65535 {
+			return fmt.Errorf("opio: invalid failover endpoint %q", ep)
+		}
+	}
+	return nil
+}
+
+func (cfg FailoverConfig) probeInterval() time.Duration {
+	if cfg.ProbeInterval <= 0 {
+		return 30 * time.Second
+	}
+	return cfg.ProbeInterval
+}
+
+// endpoint - 连接的服务端地址
+func (op *IOConnect) endpoint() Endpoint {
+	return Endpoint{Host: op.host, Port: int(op.port)}
+}
+
+// initEndpoints - 依次尝试主端点与备用端点，返回第一个成功建立的连接 (InitContext 使用)
+func initEndpoints(ctx context.Context, host string, port int, user string, pass string, o connectOptions) (*IOConnect, error) {
+	op, err := initContext(ctx, host, port, user, pass, o)
+	if err == nil || o.failover == nil {
+		return op, err
+	}
+	for _, ep := range o.failover.Endpoints {
+		if ctx.Err() != nil {
+			break
+		}
+		if op, err = initContext(ctx, ep.Host, ep.Port, user, pass, o); err == nil {
+			return op, nil
+		}
+	}
+	return nil, err
+}
+
+// ActiveEndpoint 返回客户端当前使用的服务端端点 (最近一次成功建立连接的端点)。
+func (c *Client) ActiveEndpoint() Endpoint {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.endpoints[c.active]
+}
+
+// dialOrder - 本次拨号尝试端点的顺序
+func (c *Client) dialOrder() []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := len(c.endpoints)
+	order := make([]int, 0, n)
+	if c.failover.Policy == FailoverSticky {
+		// 按优先级排列，最近拨号失败的端点 (活动端点除外) 在重试时间之前排到最后
+		now := time.Now()
+		var later []int
+		for i := 0; i < n; i++ {
+			if i != c.active && i < len(c.retryAt) && now.Before(c.retryAt[i]) {
+				later = append(later, i)
+				continue
+			}
+			order = append(order, i)
+		}
+		return append(order, later...)
+	}
+	// round-robin 从当前端点开始；当前端点刚刚断开时先尝试下一个，当前端点放在最后
+	start := c.active
+	if c.activeDown {
+		start++
+	}
+	for i := 0; i < n; i++ {
+		order = append(order, (start+i)%n)
+	}
+	return order
+}
+
+// endpointUp - 在端点 i 上成功建立了连接，如果与当前活动端点不同则切换并触发 OnFailover
+func (c *Client) endpointUp(i int, cause error) {
+	c.mu.Lock()
+	from, to := c.endpoints[c.active], c.endpoints[i]
+	changed := i != c.active
+	if cause == nil {
+		cause = c.downErr
+	}
+	c.active = i
+	c.activeDown = false
+	c.downErr = nil
+	if i < len(c.retryAt) {
+		c.retryAt[i] = time.Time{}
+	}
+	hook := c.failover.OnFailover
+	c.mu.Unlock()
+	if !changed {
+		return
+	}
+	if c.Logger != nil {
+		c.Logger.Printf("opio: failover from %s to %s: %v", from, to, cause)
+	}
+	if c.pool != nil {
+		c.pool.purgeIdle() // 使用中的指向旧端点的连接在归还时关闭
+	}
+	c.migrateSubscriptions(to)
+	if hook != nil {
+		hook(from, to, cause)
+	}
+}
+
+// endpointLost - op 所在的连接已断开，如果它属于当前活动端点，round-robin 策略下的下一次拨号先尝试其他端点
+func (c *Client) endpointLost(op *IOConnect, err error) {
+	ep := op.endpoint()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.endpoints[c.active] == ep {
+		c.activeDown = true
+		c.downErr = err
+	}
+}
+
+// endpointFailed - 在端点 i 上拨号或登录失败，FailoverSticky 下该端点在 ProbeInterval 内排到其他端点之后
+func (c *Client) endpointFailed(i int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.retryAt == nil {
+		c.retryAt = make([]time.Time, len(c.endpoints))
+	}
+	c.retryAt[i] = time.Now().Add(c.failover.probeInterval())
+}
+
+// staleEndpoint - 连接不属于当前活动端点 (发生过切换)，归还时应关闭
+func (c *Client) staleEndpoint(op *IOConnect) bool {
+	ep := op.endpoint()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.endpoints) > 1 && c.endpoints[c.active] != ep
+}
+
+// startFailoverProbe - FailoverSticky 且配置了备用端点时，启动切回主服务器的后台探测
+func (c *Client) startFailoverProbe() {
+	if len(c.endpoints) < 2 || c.failover.Policy != FailoverSticky {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failoverStop = make(chan struct{})
+	go c.failoverProbe(c.failover.probeInterval(), c.failoverStop)
+}
+
+// stopFailoverProbe - 停止后台探测 (Close 时调用)
+func (c *Client) stopFailoverProbe() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failoverStop != nil {
+		close(c.failoverStop)
+		c.failoverStop = nil
+	}
+}
+
+func (c *Client) failoverProbe(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		c.mu.Lock()
+		active := c.active
+		c.mu.Unlock()
+		// 只探测优先级高于当前端点的端点，按顺序找到第一个恢复的
+		for i := 0; i < active; i++ {
+			op, err := c.dialEndpoint(ctx, c.endpoints[i])
+			if err != nil {
+				continue
+			}
+			_ = op.Close()
+			c.endpointUp(i, nil)
+			break
+		}
+	}
+}
+
+// dialOnce - 按端点顺序拨号并登录，返回第一个成功建立的连接，全部失败时返回最后一个错误
+func (c *Client) dialOnce(ctx context.Context) (*IOConnect, error) {
+	var lastErr error
+	for _, i := range c.dialOrder() {
+		op, err := c.dialEndpoint(ctx, c.endpoints[i])
+		if err == nil {
+			c.mu.Lock()
+			c.caps = op.Capabilities() // 切换端点后服务端版本可能不同
+			c.mu.Unlock()
+			c.endpointUp(i, lastErr)
+			return op, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+		c.endpointFailed(i)
+	}
+	return nil, lastErr
+}
+
+// dialEndpoint - 按客户端的连接参数在指定端点上拨号并登录一次，dialTimeout 约束单次尝试
+func (c *Client) dialEndpoint(ctx context.Context, ep Endpoint) (*IOConnect, error) {
+	if c.dialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.dialTimeout)
+		defer cancel()
+	}
+	op, err := initContext(ctx, ep.Host, ep.Port, c.user, c.pass, c.opts)
+	if err != nil {
+		return nil, err
+	}
+	// op.timeout 以秒为单位，向上取整，避免不足 1 秒的超时变成 0 (Reconnect 时退回默认的 10 秒)
+	op.timeout = int32((c.dialTimeout + time.Second - 1) / time.Second)
+	return op, nil
+}
+
+// trackSubscription / untrackSubscription - 登记客户端创建的订阅，切换端点时一并迁移
+func (c *Client) trackSubscription(sub *Subscribe) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.subs == nil {
+		c.subs = make(map[*Subscribe]struct{})
+	}
+	c.subs[sub] = struct{}{}
+}
+
+func (c *Client) untrackSubscription(sub *Subscribe) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.subs, sub)
+}
+
+// migrateSubscriptions - 打断连接在其他端点上的订阅，订阅的读取协程会经由客户端重新连接到 ep
+func (c *Client) migrateSubscriptions(ep Endpoint) {
+	c.mu.Lock()
+	subs := make([]*Subscribe, 0, len(c.subs))
+	for sub := range c.subs {
+		subs = append(subs, sub)
+	}
+	c.mu.Unlock()
+	for _, sub := range subs {
+		sub.migrate(ep)
+	}
+}
@@ -0,0 +1,159 @@
+package opio_test
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tc252617228/opio"
+)
+
+// switchServer 模拟一台可以被停机的服务端：down 非 0 时新连接在问候包之前被关闭，
+// 已建立的连接在收到下一个请求时断开。
+type switchServer struct {
+	down  int32
+	dials int32
+}
+
+func (s *switchServer) serve(conn net.Conn) {
+	defer conn.Close()
+	atomic.AddInt32(&s.dials, 1)
+	if atomic.LoadInt32(&s.down) != 0 || fakeLogin(conn) != nil {
+		return
+	}
+	for {
+		if _, err := readMessage(conn); err != nil || atomic.LoadInt32(&s.down) != 0 {
+			return
+		}
+		if writeFrame(conn, okResponse) != nil {
+			return
+		}
+	}
+}
+
+func (s *switchServer) endpoint(t *testing.T) opio.Endpoint {
+	host, port := listenLocal(t, s.serve)
+	return opio.Endpoint{Host: host, Port: port}
+}
+
+type failoverEvent struct {
+	from, to opio.Endpoint
+	err      error
+}
+
+func TestFailoverStickyReturnsToPrimary(t *testing.T) {
+	primary, standby := &switchServer{down: 1}, &switchServer{}
+	p, s := primary.endpoint(t), standby.endpoint(t)
+
+	events := make(chan failoverEvent, 4)
+	client, err := opio.Connect(context.Background(), p.Host, p.Port, "sis", "openplant", time.Second,
+		opio.WithFailover(opio.FailoverConfig{
+			Endpoints:     []opio.Endpoint{s},
+			ProbeInterval: 30 * time.Millisecond,
+			OnFailover:    func(from, to opio.Endpoint, err error) { events <- failoverEvent{from, to, err} },
+		}))
+	require.NoError(t, err, "主服务器不可用时应连接到备用服务器")
+	defer client.Close()
+
+	ev := <-events
+	assert.Equal(t, p, ev.from)
+	assert.Equal(t, s, ev.to)
+	assert.Error(t, ev.err)
+	assert.Equal(t, s, client.ActiveEndpoint())
+	_, err = client.ExecSQL(context.Background(), "SELECT 1")
+	require.NoError(t, err)
+
+	// 主服务器恢复后由后台探测切回
+	atomic.StoreInt32(&primary.down, 0)
+	select {
+	case ev = <-events:
+	case <-time.After(2 * time.Second):
+		t.Fatal("主服务器恢复后未切回")
+	}
+	assert.Equal(t, s, ev.from)
+	assert.Equal(t, p, ev.to)
+	assert.NoError(t, ev.err)
+
+	dials := atomic.LoadInt32(&primary.dials)
+	_, err = client.ExecSQL(context.Background(), "SELECT 1")
+	require.NoError(t, err)
+	assert.Greater(t, atomic.LoadInt32(&primary.dials), dials, "切回后指向备用服务器的空闲连接不再复用")
+}
+
+func TestFailoverStickySkipsFailedPrimary(t *testing.T) {
+	primary, standby := &switchServer{down: 1}, &switchServer{}
+	p, s := primary.endpoint(t), standby.endpoint(t)
+
+	client, err := opio.Connect(context.Background(), p.Host, p.Port, "sis", "openplant", time.Second,
+		opio.WithFailover(opio.FailoverConfig{Endpoints: []opio.Endpoint{s}, ProbeInterval: time.Hour}))
+	require.NoError(t, err)
+	defer client.Close()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&primary.dials))
+
+	// 每次调用都新建连接：主服务器刚刚拨号失败，在 ProbeInterval 内直接连接备用服务器
+	require.NoError(t, client.SetPoolConfig(opio.PoolConfig{MaxConns: 1, MaxLifetime: time.Nanosecond}))
+	for i := 0; i < 3; i++ {
+		_, err = client.ExecSQL(context.Background(), "SELECT 1")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&primary.dials))
+	assert.Equal(t, int32(4), atomic.LoadInt32(&standby.dials))
+	assert.Equal(t, s, client.ActiveEndpoint())
+}
+
+func TestFailoverRoundRobinOnBrokenConnection(t *testing.T) {
+	primary, standby := &switchServer{}, &switchServer{}
+	p, s := primary.endpoint(t), standby.endpoint(t)
+
+	var failovers int32
+	client, err := opio.Connect(context.Background(), p.Host, p.Port, "sis", "openplant", time.Second,
+		opio.WithFailover(opio.FailoverConfig{
+			Endpoints:  []opio.Endpoint{s},
+			Policy:     opio.FailoverRoundRobin,
+			OnFailover: func(from, to opio.Endpoint, err error) { atomic.AddInt32(&failovers, 1) },
+		}))
+	require.NoError(t, err)
+	defer client.Close()
+	assert.Equal(t, p, client.ActiveEndpoint())
+
+	// 主服务器停机：正在使用的连接断开，下一次调用切换到备用服务器
+	atomic.StoreInt32(&primary.down, 1)
+	_, err = client.ExecSQL(context.Background(), "SELECT 1")
+	require.Error(t, err)
+	_, err = client.ExecSQL(context.Background(), "SELECT 1")
+	require.NoError(t, err)
+	assert.Equal(t, s, client.ActiveEndpoint())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&failovers))
+
+	// round-robin 不会主动切回，直到备用服务器也失效
+	atomic.StoreInt32(&primary.down, 0)
+	_, err = client.ExecSQL(context.Background(), "SELECT 1")
+	require.NoError(t, err)
+	assert.Equal(t, s, client.ActiveEndpoint())
+
+	atomic.StoreInt32(&standby.down, 1)
+	_, _ = client.ExecSQL(context.Background(), "SELECT 1")
+	_, err = client.ExecSQL(context.Background(), "SELECT 1")
+	require.NoError(t, err)
+	assert.Equal(t, p, client.ActiveEndpoint())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&failovers))
+}
+
+func TestFailoverAllEndpointsDown(t *testing.T) {
+	primary, standby := &switchServer{down: 1}, &switchServer{down: 1}
+	p, s := primary.endpoint(t), standby.endpoint(t)
+
+	_, err := opio.Connect(context.Background(), p.Host, p.Port, "sis", "openplant", time.Second,
+		opio.WithFailover(opio.FailoverConfig{Endpoints: []opio.Endpoint{s}}))
+	require.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&primary.dials))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&standby.dials))
+
+	_, err = opio.Connect(context.Background(), p.Host, p.Port, "sis", "openplant", time.Second,
+		opio.WithFailover(opio.FailoverConfig{Endpoints: []opio.Endpoint{{Host: "", Port: 1}}}))
+	assert.Error(t, err, "无效的备用端点应被拒绝")
+}
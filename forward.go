@@ -0,0 +1,127 @@
+package opio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Forward 把 Server 收到的 Request 风格请求转发给上游服务器，并把上游的应答 (属性与结果集) 复制到 res，
+// 用于在 Server 之上实现网关与代理。请求与应答中的数据行按原始编码转发，不做类型转换。
+// 上游返回的业务错误写入 res 的 Errno 与 Error，不作为错误返回；返回的错误表示请求没有完成 (连接失败、超时等)。
+// 订阅请求 (Async) 不能转发，应改用 Subscribe。
+func (c *Client) Forward(ctx context.Context, req *Request, res *Response) error {
+	if c.closed() {
+		return ErrConnectionClosed
+	}
+	if req.IsAsync() {
+		return errors.New("opio.Client.Forward: subscription requests cannot be forwarded")
+	}
+
+	var cancel context.CancelFunc
+	if _, deadlineSet := ctx.Deadline(); !deadlineSet && c.defaultTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.defaultTimeout)
+		defer cancel()
+	}
+
+	// 先读出请求中的数据行 (Insert/Update 等)，断线重试时可以重新发送
+	name, action, cols := req.GetTableName(), req.GetAction(), req.GetColumns()
+	var rows [][]byte
+	if set := req.GetDataSet(); set != nil {
+		for {
+			ok, err := set.Next()
+			if err != nil {
+				return fmt.Errorf("opio.Client.Forward: 读取请求数据行失败 (Table: %s): %w", name, err)
+			}
+			if !ok {
+				break
+			}
+			rows = append(rows, append([]byte(nil), set.GetRow()...))
+		}
+	}
+	props := make(map[string]interface{}, len(req.GetProp()))
+	for k, v := range req.GetProp() {
+		switch k {
+		case PropReqId, PropToken, PropColumns:
+			// 请求 ID 与令牌由上游连接决定，列定义在下面重新构造
+		default:
+			props[k] = v
+		}
+	}
+
+	run := c.withConn
+	if action == ActionSelect {
+		run = c.withReadConn
+	}
+	err := run(ctx, func(op *IOConnect) error {
+		up := op.NewRequest(props)
+		defer up.Reset()
+		if cols != nil {
+			t := NewTable(name, 0)
+			t.AddColumns(cols)
+			up.Set(PropColumns, t)
+		}
+		if err := up.Write(); err != nil {
+			return fmt.Errorf("opio.Client.Forward: 发送请求失败 (Table: %s): %w", name, err)
+		}
+		if len(rows) > 0 {
+			t := NewTable(name, uint(len(rows)))
+			t.AddColumns(cols)
+			for _, row := range rows {
+				t.appendRow(row)
+			}
+			if err := up.WriteContent(t); err != nil {
+				return fmt.Errorf("opio.Client.Forward: 发送数据行失败 (Table: %s): %w", name, err)
+			}
+		}
+		_ = up.buff.EncodeNil()
+		if err := up.buff.Flush(true); err != nil {
+			return fmt.Errorf("opio.Client.Forward: 发送请求失败 (Table: %s): %w", name, err)
+		}
+
+		upRes, err := up.GetResponse()
+		if err != nil {
+			return fmt.Errorf("opio.Client.Forward: 获取响应失败 (Table: %s): %w", name, err)
+		}
+		for k, v := range upRes.GetProp() {
+			switch k {
+			case PropReqId, PropColumns:
+			default:
+				res.Set(k, v)
+			}
+		}
+		set := upRes.GetDataSet()
+		if set == nil || len(set.GetColumns()) == 0 {
+			return nil
+		}
+		defer set.Close()
+		table := upRes.GetTableName()
+		if table == "" {
+			table = name
+		}
+		ds := res.DataSet(table)
+		ds.AddColumns(set.GetColumns())
+		for {
+			ok, err := set.Next()
+			if err != nil {
+				return fmt.Errorf("opio.Client.Forward: 读取数据集下一行时出错 (Table: %s): %w", name, err)
+			}
+			if !ok {
+				return nil
+			}
+			ds.appendRow(append([]byte(nil), set.GetRow()...))
+		}
+	})
+	if err != nil {
+		if ctxErr := ctxError(ctx, "opio.Client.Forward: 转发操作", name); ctxErr != nil {
+			return ctxErr
+		}
+	}
+	return err
+}
+
+// appendRow - 追加一行已编码的行数据
+func (t *Table) appendRow(data []byte) {
+	t.rows = append(t.rows, OPRow{Data: data})
+	t.rowCount++
+}
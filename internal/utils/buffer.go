@@ -7,6 +7,8 @@ import (
 	"io"
 	"math"
 	"reflect"
+	"sync"
+	"time"
 
 	"github.com/pierrec/lz4"
 )
@@ -41,15 +43,19 @@ type Buffer struct {
 
 	mode_in byte
 
-	//lz 流模型缓存区
+	//Out 与 In 底层的池化缓冲区，Release 时归还
+	outBuf *[]byte
+	inBuf  *[]byte
+
+	//lz 流模型缓存区，第一次收发 frame 压缩帧时才分配
 	zip_compress_out_buf *bytes.Buffer
 
 	zip_uncompress_in_buf  *bytes.Buffer
 	zip_uncompress_out_buf *bytes.Buffer
 
-	//双缓冲的lz4 缓冲区
-	pack_buf   [][]byte
-	unpack_buf [][]byte
+	//双缓冲的lz4 缓冲区，第一次压缩/解压时才从 bufPool 取得
+	pack_buf   [2]*[]byte
+	unpack_buf [2]*[]byte
 
 	//数据打包解包计数器
 	pack_index   int32
@@ -67,9 +73,46 @@ type Buffer struct {
 
 	//判断是否是心跳头
 	isHeartHead bool
+
+	//读取帧头用，避免每个帧分配一次
+	head [headSize]byte
+
+	//底层读写发生的第一个错误，出错后缓冲区内的数据流不再可信
+	ioErr error
+
+	//自适应压缩：负载小于 compressMin 字节的帧不压缩；
+	//compressMaxRatio > 0 时，压缩后与压缩前的长度比超过该值则改为发送原始数据
+	compressMin      int
+	compressMaxRatio float64
+
+	//本连接的收发统计，shared 不为空时同时累加到共享的统计上 (例如同一个 Client 的所有连接)
+	traffic *TrafficCounter
+	shared  *TrafficCounter
+
+	//观察收发帧的 Tracer，nil 表示不跟踪
+	tracer Tracer
+}
+
+// bufPool - 按协议最大帧长分配的缓冲区，连接的收发缓冲区与 lz4 双缓冲共用。
+// 连接关闭 (Release) 后归还，新连接优先复用，避免大量订阅连接各自占用几百 KB 的空闲内存。
+var bufPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, maxSize)
+		return &b
+	},
+}
+
+func getBuf() *[]byte {
+	return bufPool.Get().(*[]byte)
 }
 
-// NewBuffer -
+func putBuf(b *[]byte) {
+	if b != nil {
+		bufPool.Put(b)
+	}
+}
+
+// NewBuffer - 只分配发送缓冲区，接收缓冲区在第一次读取时、压缩相关的缓冲区在第一次压缩/解压时才分配
 func NewBuffer(io io.ReadWriteCloser, size int) *Buffer {
 	if size > maxSize {
 		size = maxSize
@@ -77,7 +120,8 @@ func NewBuffer(io io.ReadWriteCloser, size int) *Buffer {
 	buf := &Buffer{}
 	buf.io = io
 	buf.size = size
-	buf.Out = make([]byte, size)
+	buf.outBuf = getBuf()
+	buf.Out = (*buf.outBuf)[:size]
 	buf.outOff = headSize
 
 	buf.mode = ZIP_MODEL_Uncompressed
@@ -85,23 +129,58 @@ func NewBuffer(io io.ReadWriteCloser, size int) *Buffer {
 	buf.lz4_head_code = lz4_head_code
 	buf.hash = XXHZero{}
 
+	buf.traffic = new(TrafficCounter)
+
+	return buf
+}
+
+// initFrame - 第一次使用 frame 压缩模式时分配流模型缓冲区
+func (b *Buffer) initFrame() {
+	if b.zr != nil {
+		return
+	}
 	//压缩缓冲区
-	buf.zip_compress_out_buf = new(bytes.Buffer)
+	b.zip_compress_out_buf = new(bytes.Buffer)
 
 	//解压缩缓冲区
-	buf.zip_uncompress_in_buf = new(bytes.Buffer)
-	buf.zip_uncompress_out_buf = new(bytes.Buffer)
-	buf.zr = lz4.NewReader(buf.zip_uncompress_in_buf)
+	b.zip_uncompress_in_buf = new(bytes.Buffer)
+	b.zip_uncompress_out_buf = new(bytes.Buffer)
+	b.zr = lz4.NewReader(b.zip_uncompress_in_buf)
+}
 
-	buf.pack_buf = make([][]byte, 2)
-	buf.pack_buf[0] = make([]byte, maxSize)
-	buf.pack_buf[1] = make([]byte, maxSize)
+// packBuf - 返回第 i 个压缩缓冲区，需要时从 bufPool 取得
+func (b *Buffer) packBuf(i int32) []byte {
+	if b.pack_buf[i&1] == nil {
+		b.pack_buf[i&1] = getBuf()
+	}
+	return *b.pack_buf[i&1]
+}
 
-	buf.unpack_buf = make([][]byte, 2)
-	buf.unpack_buf[0] = make([]byte, maxSize)
-	buf.unpack_buf[1] = make([]byte, maxSize)
+// unpackBuf - 返回第 i 个解压缓冲区，需要时从 bufPool 取得
+func (b *Buffer) unpackBuf(i int32) []byte {
+	if b.unpack_buf[i&1] == nil {
+		b.unpack_buf[i&1] = getBuf()
+	}
+	return *b.unpack_buf[i&1]
+}
 
-	return buf
+// Release - 把所有池化的缓冲区归还 bufPool，之后 Buffer 不能再使用。
+// 调用方必须保证没有其他协程仍在读写该 Buffer。
+func (b *Buffer) Release() {
+	b.Out, b.In = nil, nil
+	putBuf(b.outBuf)
+	putBuf(b.inBuf)
+	b.outBuf, b.inBuf = nil, nil
+	for i := range b.pack_buf {
+		putBuf(b.pack_buf[i])
+		putBuf(b.unpack_buf[i])
+		b.pack_buf[i], b.unpack_buf[i] = nil, nil
+	}
+	b.zip_compress_out_buf = nil
+	b.zip_uncompress_in_buf = nil
+	b.zip_uncompress_out_buf = nil
+	b.zr = nil
+	b.inOff, b.inEnd, b.outOff = 0, 0, headSize
 }
 
 func (b *Buffer) SetCompressModel(model byte) error {
@@ -114,6 +193,42 @@ func (b *Buffer) SetCompressModel(model byte) error {
 	}
 }
 
+// SetCompressThreshold - 设置自适应压缩的参数：负载小于 minSize 字节的帧直接发送原始数据；
+// maxRatio 在 (0, 1] 之间时，压缩后长度超过原始长度的 maxRatio 倍 (压缩效果差) 也发送原始数据。
+// 两者都为 0 时每个帧都按 SetCompressModel 设置的模式压缩。
+func (b *Buffer) SetCompressThreshold(minSize int, maxRatio float64) error {
+	if minSize < 0 || maxRatio < 0 || maxRatio > 1 {
+		return fmt.Errorf("CompressThreshold error !! minSize:%d must not be negative, maxRatio:%v must be in [0, 1]", minSize, maxRatio)
+	}
+	b.compressMin = minSize
+	b.compressMaxRatio = maxRatio
+	return nil
+}
+
+// SetSharedTraffic - 除本连接的统计外，把收发流量同时累加到 t 上
+func (b *Buffer) SetSharedTraffic(t *TrafficCounter) {
+	b.shared = t
+}
+
+// Traffic - 返回本连接的收发统计
+func (b *Buffer) Traffic() *TrafficCounter {
+	return b.traffic
+}
+
+func (b *Buffer) addSent(mode byte, raw, wire int, elapsed time.Duration) {
+	b.traffic.AddSent(mode, raw, wire, elapsed)
+	if b.shared != nil {
+		b.shared.AddSent(mode, raw, wire, elapsed)
+	}
+}
+
+func (b *Buffer) addReceived(mode byte, raw, wire int, elapsed time.Duration) {
+	b.traffic.AddReceived(mode, raw, wire, elapsed)
+	if b.shared != nil {
+		b.shared.AddReceived(mode, raw, wire, elapsed)
+	}
+}
+
 // Reset -
 func (b *Buffer) Reset() {
 	b.inOff = 0
@@ -121,19 +236,18 @@ func (b *Buffer) Reset() {
 	b.outOff = headSize
 }
 
-// Clear -
+// Clear - 丢弃缓冲区中未发送和未读取的数据，保留已分配的缓冲区
 func (b *Buffer) Clear() {
 	b.inOff = 0
 	b.inEnd = 0
 	b.outOff = headSize
-	b.Out = make([]byte, b.size)
-	b.In = make([]byte, b.size)
 
 	b.hash.Reset()
-	b.zip_compress_out_buf.Reset()
-	b.zip_uncompress_in_buf.Reset()
-	b.zip_uncompress_out_buf.Reset()
-
+	if b.zr != nil {
+		b.zip_compress_out_buf.Reset()
+		b.zip_uncompress_in_buf.Reset()
+		b.zip_uncompress_out_buf.Reset()
+	}
 }
 
 // PutBool -
@@ -322,17 +436,24 @@ func (b *Buffer) Flush(eof bool) error {
 		e = 1
 	}
 
-	if b.mode != ZIP_MODEL_Uncompressed {
+	if b.mode != ZIP_MODEL_Uncompressed && n > 0 && n >= b.compressMin {
 		size := 0
 		var temp []byte
 		tempMode := b.mode
+		data := b.Out[headSize:b.outOff]
 
+		start := time.Now()
 		switch tempMode {
 		case ZIP_MODEL_Frame:
-			temp, size, tempMode = b.compress_frame(b.Out[headSize:b.outOff])
+			temp, size, tempMode = b.compress_frame(data)
 		case ZIP_MODEL_Block:
-			temp, size, tempMode = b.compress_block(b.Out[headSize:b.outOff])
+			temp, size, tempMode = b.compress_block(data)
+		}
+		//压缩效果差时发送原始数据，省去对端解压的开销
+		if tempMode != ZIP_MODEL_Uncompressed && b.compressMaxRatio > 0 && float64(size) > float64(n)*b.compressMaxRatio {
+			temp, size, tempMode = data, n, ZIP_MODEL_Uncompressed
 		}
+		elapsed := time.Since(start)
 
 		//计算压缩数据包
 		b.Out[0] = byte(e)
@@ -349,6 +470,10 @@ func (b *Buffer) Flush(eof bool) error {
 		if err != nil {
 			return err
 		}
+		b.addSent(tempMode, n, size+headSize, elapsed)
+		if b.tracer != nil {
+			b.tracer.TraceFrame(true, eof, tempMode, data, size, false)
+		}
 	} else {
 		b.Out[0] = byte(e)
 		b.Out[1] = 0
@@ -358,6 +483,10 @@ func (b *Buffer) Flush(eof bool) error {
 		if err != nil {
 			return err
 		}
+		b.addSent(ZIP_MODEL_Uncompressed, n, b.outOff, 0)
+		if b.tracer != nil {
+			b.tracer.TraceFrame(true, eof, ZIP_MODEL_Uncompressed, b.Out[headSize:b.outOff], n, false)
+		}
 	}
 	b.outOff = headSize
 	return nil
@@ -365,7 +494,7 @@ func (b *Buffer) Flush(eof bool) error {
 
 func (b *Buffer) compress_block(data []byte) ([]byte, int, byte) {
 	b.pack_index++
-	buf := b.pack_buf[b.pack_index&1]
+	buf := b.packBuf(b.pack_index)
 	n, err := lz4.CompressBlock(data, buf, nil)
 	if err != nil || n == 0 || n >= len(data) {
 		return data, len(data), ZIP_MODEL_Uncompressed
@@ -375,7 +504,7 @@ func (b *Buffer) compress_block(data []byte) ([]byte, int, byte) {
 
 func (b *Buffer) uncompress_block(data []byte) ([]byte, int, error) {
 	b.unpack_index++
-	buf := b.unpack_buf[b.unpack_index&1]
+	buf := b.unpackBuf(b.unpack_index)
 	n, err := lz4.UncompressBlock(data, buf)
 	if err != nil {
 		return data, len(data), err
@@ -384,6 +513,7 @@ func (b *Buffer) uncompress_block(data []byte) ([]byte, int, error) {
 }
 
 func (b *Buffer) compress_frame(data []byte) ([]byte, int, byte) {
+	b.initFrame()
 	b.zip_compress_out_buf.Reset()
 	b.hash.Reset()
 
@@ -392,7 +522,7 @@ func (b *Buffer) compress_frame(data []byte) ([]byte, int, byte) {
 		b.hash.Reset()
 	}()
 	b.unpack_index++
-	buf := b.unpack_buf[b.unpack_index&1]
+	buf := b.unpackBuf(b.unpack_index)
 
 	n, err := lz4.CompressBlock(data, buf, nil)
 	if err == nil && n > 0 {
@@ -413,6 +543,7 @@ func (b *Buffer) compress_frame(data []byte) ([]byte, int, byte) {
 }
 
 func (b *Buffer) uncompress_frame(data []byte) ([]byte, int, error) {
+	b.initFrame()
 	defer func() {
 		b.zip_uncompress_in_buf.Reset()
 		b.zip_uncompress_out_buf.Reset()
@@ -438,6 +569,7 @@ func (b *Buffer) readFull(data []byte) error {
 	for off < len(data) {
 		num, err = ioBufer.Read(data[off:])
 		if err != nil {
+			b.setErr(err)
 			return err
 		}
 		off += num
@@ -454,6 +586,7 @@ func (b *Buffer) writeFull(data []byte) error {
 	for off < len(data) {
 		num, err = ioBuffer.Write(data[off:])
 		if err != nil {
+			b.setErr(err)
 			return err
 		}
 		off += num
@@ -464,9 +597,28 @@ func (b *Buffer) writeFull(data []byte) error {
 // 直接裸写tcp,心跳回包时用
 func (b *Buffer) DirectWrite(data []byte) error {
 	_, err := b.io.Write(data)
+	if err != nil {
+		b.setErr(err)
+	}
 	return err
 }
 
+func (b *Buffer) setErr(err error) {
+	if b.ioErr == nil {
+		b.ioErr = err
+	}
+}
+
+// Err - 返回底层读写发生的第一个错误
+func (b *Buffer) Err() error {
+	return b.ioErr
+}
+
+// Pending - 当前应答还没有读完 (未读到 eof 帧或缓冲区中仍有未消费的数据) 时返回 true
+func (b *Buffer) Pending() bool {
+	return !b.inEof || b.inOff < b.inEnd
+}
+
 func (b *Buffer) ReadEcho() (int8, error) {
 	echo := []byte{0}
 	err := b.readFull(echo)
@@ -524,7 +676,7 @@ func (b *Buffer) PeekN(buf []byte) (bool, error) {
 
 // read -
 func (b *Buffer) Read() error {
-	head := []byte{0, 0, 0, 0}
+	head := b.head[:]
 	err := b.readFull(head)
 	if err != nil {
 		return err
@@ -547,11 +699,14 @@ func (b *Buffer) Read() error {
 	}
 
 	n := (int(head[2]) << 8) | int(head[3])
-	if len(b.In) < n {
-		b.In = make([]byte, n)
+	//原始帧总是读入 inBuf (帧长不超过 65535)，解压后的数据在 unpack_buf 或流模型缓冲区中
+	if b.inBuf == nil {
+		b.inBuf = getBuf()
 	}
+	//GetBytes 与 PeekN 按 len(b.In) 拷贝，b.In 的长度必须与帧长一致
+	b.In = (*b.inBuf)[:n]
 
-	err = b.readFull(b.In[:n])
+	err = b.readFull(b.In)
 	if err != nil {
 		return err
 	}
@@ -560,7 +715,9 @@ func (b *Buffer) Read() error {
 	zip := head[1] & 3 //zip 模型仅提供了前两位进行设置压缩算法
 	b.mode_in = zip
 
+	wire := n + headSize
 	if zip != ZIP_MODEL_Uncompressed {
+		start := time.Now()
 		switch zip {
 		case ZIP_MODEL_Frame:
 			b.In, n, err = b.uncompress_frame(b.In[:n])
@@ -574,12 +731,54 @@ func (b *Buffer) Read() error {
 				return err
 			}
 		}
+		b.addReceived(zip, n, wire, time.Since(start))
+	} else {
+		b.addReceived(zip, n, wire, 0)
+	}
+	if b.tracer != nil {
+		b.tracer.TraceFrame(false, b.inEof, zip, b.In[:n], wire-headSize, b.isHeartHead)
 	}
 	b.inOff = 0
 	b.inEnd = n
 	return nil
 }
 
+// frameSource - DecodeFrames 的只读数据源
+type frameSource struct {
+	*bytes.Reader
+}
+
+func (frameSource) Write(p []byte) (int, error) { return 0, io.ErrClosedPipe }
+func (frameSource) Close() error                { return nil }
+
+// DecodeFrames - 把一段连续的帧 (例如录制的一次发送) 解码为消息：逐帧解压，按 eof 标记拼接，
+// 心跳探测包 (含 4 字节魔数) 单独作为一条消息。data 不是完整的帧序列时返回错误。
+func DecodeFrames(data []byte) ([][]byte, error) {
+	src := frameSource{bytes.NewReader(data)}
+	b := NewBuffer(src, headSize)
+	defer b.Release()
+	var msgs [][]byte
+	var msg []byte
+	for src.Len() > 0 {
+		if err := b.Read(); err != nil {
+			return nil, err
+		}
+		if b.isHeartHead {
+			msgs = append(msgs, append([]byte{0x10, 0x20, 0x30, 0x40}, b.In[:b.inEnd]...))
+			continue
+		}
+		msg = append(msg, b.In[:b.inEnd]...)
+		if b.inEof {
+			msgs = append(msgs, msg)
+			msg = nil
+		}
+	}
+	if msg != nil {
+		return nil, errors.New("utils: 最后一条消息没有结束帧")
+	}
+	return msgs, nil
+}
+
 // GetBytes -
 func (b *Buffer) GetBytes(buf []byte) error {
 	off := 0
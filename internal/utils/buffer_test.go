@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// loopback - 写入的数据可以原样读出的 io.ReadWriteCloser
+type loopback struct {
+	bytes.Buffer
+}
+
+func (l *loopback) Close() error { return nil }
+
+// replay - 重复读出同一段数据，写入的数据被丢弃
+type replay struct {
+	data []byte
+	off  int
+}
+
+func (r *replay) Read(p []byte) (int, error) {
+	if r.off == len(r.data) {
+		r.off = 0
+	}
+	n := copy(p, r.data[r.off:])
+	r.off += n
+	return n, nil
+}
+
+func (r *replay) Write(p []byte) (int, error) { return len(p), nil }
+
+func (r *replay) Close() error { return nil }
+
+// frames - 生成 count 个负载为 size 字节、可压缩的数据帧，最后一个帧带 eof 标记
+func frames(tb testing.TB, mode byte, size int, count int) []byte {
+	out := &loopback{}
+	b := NewBuffer(out, maxSize)
+	defer b.Release()
+	if err := b.SetCompressModel(mode); err != nil {
+		tb.Fatal(err)
+	}
+	payload := bytes.Repeat([]byte("W3.NODE.TAG_000001"), size/18+1)[:size]
+	for i := 0; i < count; i++ {
+		if err := b.PutBytes(payload); err != nil {
+			tb.Fatal(err)
+		}
+		if err := b.Flush(i == count-1); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return out.Bytes()
+}
+
+func TestBufferRoundTrip(t *testing.T) {
+	for _, mode := range []byte{ZIP_MODEL_Uncompressed, ZIP_MODEL_Frame, ZIP_MODEL_Block} {
+		data := frames(t, mode, 4000, 3)
+		b := NewBuffer(&replay{data: data}, maxSize)
+		got := make([]byte, 3*4000)
+		if err := b.GetBytes(got); err != nil {
+			t.Fatalf("mode %d: %v", mode, err)
+		}
+		if b.Pending() {
+			t.Fatalf("mode %d: 读完最后一个帧后不应再有未读数据", mode)
+		}
+		want := bytes.Repeat([]byte("W3.NODE.TAG_000001"), 4000/18+1)[:4000]
+		if !bytes.Equal(got[8000:], want) {
+			t.Fatalf("mode %d: 数据不一致", mode)
+		}
+		b.Release()
+		b.Release() // 重复 Release 是安全的
+	}
+}
+
+func TestDecodeFrames(t *testing.T) {
+	want := bytes.Repeat(bytes.Repeat([]byte("W3.NODE.TAG_000001"), 4000/18+1)[:4000], 3)
+	for _, mode := range []byte{ZIP_MODEL_Uncompressed, ZIP_MODEL_Frame, ZIP_MODEL_Block} {
+		data := frames(t, mode, 4000, 3)
+		msgs, err := DecodeFrames(append(data, data...))
+		if err != nil {
+			t.Fatalf("mode %d: %v", mode, err)
+		}
+		if len(msgs) != 2 || !bytes.Equal(msgs[0], want) || !bytes.Equal(msgs[1], want) {
+			t.Fatalf("mode %d: 解码的消息不一致", mode)
+		}
+		if _, err := DecodeFrames(data[:len(data)-1]); err == nil {
+			t.Fatalf("mode %d: 不完整的帧应返回错误", mode)
+		}
+	}
+}
+
+// BenchmarkBufferConnectClose 模拟建立连接、登录收发一次、关闭连接的循环。
+// 收发缓冲区来自 bufPool，未使用压缩时不会分配 lz4 缓冲区。
+func BenchmarkBufferConnectClose(b *testing.B) {
+	data := frames(b, ZIP_MODEL_Uncompressed, 100, 1)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf := NewBuffer(&replay{data: data}, maxSize)
+		_ = buf.PutBytes(data[:100])
+		_ = buf.Flush(true)
+		if err := buf.SkipAll(); err != nil {
+			b.Fatal(err)
+		}
+		buf.Release()
+	}
+}
+
+// BenchmarkBufferLargeResult 读取由 64 个接近 64KB 的帧组成的大结果集。
+func BenchmarkBufferLargeResult(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		mode byte
+	}{
+		{"uncompressed", ZIP_MODEL_Uncompressed},
+		{"block", ZIP_MODEL_Block},
+		{"frame", ZIP_MODEL_Frame},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			data := frames(b, bc.mode, maxSize-headSize-256, 64)
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				buf := NewBuffer(&replay{data: data}, maxSize)
+				if err := buf.SkipAll(); err != nil && err != io.EOF {
+					b.Fatal(err)
+				}
+				buf.Release()
+			}
+		})
+	}
+}
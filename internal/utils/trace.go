@@ -0,0 +1,23 @@
+package utils
+
+// Tracer - 观察 Buffer 收发的每个网络帧，以及上层在编码前/解码后报告的请求与应答属性表。
+// 回调在收发数据的协程中同步执行，payload 只在调用期间有效。
+type Tracer interface {
+	// TraceFrame - out 为 true 表示发送。payload 为压缩前 (发送) 或解压后 (接收) 的负载，
+	// wire 为帧负载在网络上的长度 (不含 4 字节帧头)，heartbeat 表示服务端插入的心跳探测帧。
+	TraceFrame(out bool, eof bool, mode byte, payload []byte, wire int, heartbeat bool)
+	// TraceProps - 请求发送前或应答属性表解码后的属性表
+	TraceProps(out bool, props map[string]interface{})
+}
+
+// SetTracer - 设置观察本连接收发的 Tracer，nil 表示不跟踪
+func (b *Buffer) SetTracer(t Tracer) {
+	b.tracer = t
+}
+
+// TraceProps - 向 Tracer 报告一个属性表，未设置 Tracer 时不做任何事
+func (b *Buffer) TraceProps(out bool, props map[string]interface{}) {
+	if b.tracer != nil {
+		b.tracer.TraceProps(out, props)
+	}
+}
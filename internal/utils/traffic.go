@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ModeTraffic - 某一压缩模式下的收发统计
+type ModeTraffic struct {
+	Frames       uint64        //帧数
+	RawBytes     uint64        //压缩前 (发送) 或解压后 (接收) 的负载字节数
+	WireBytes    uint64        //网络上实际传输的字节数，包含 4 字节帧头
+	CompressTime time.Duration //压缩 (发送) 或解压 (接收) 耗时
+}
+
+// modeCounter - 只包含 uint64 字段，保证 32 位平台上原子操作的对齐
+type modeCounter struct {
+	frames uint64
+	raw    uint64
+	wire   uint64
+	nanos  uint64
+}
+
+func (m *modeCounter) add(raw, wire int, elapsed time.Duration) {
+	atomic.AddUint64(&m.frames, 1)
+	atomic.AddUint64(&m.raw, uint64(raw))
+	atomic.AddUint64(&m.wire, uint64(wire))
+	if elapsed > 0 {
+		atomic.AddUint64(&m.nanos, uint64(elapsed))
+	}
+}
+
+func (m *modeCounter) load() ModeTraffic {
+	return ModeTraffic{
+		Frames:       atomic.LoadUint64(&m.frames),
+		RawBytes:     atomic.LoadUint64(&m.raw),
+		WireBytes:    atomic.LoadUint64(&m.wire),
+		CompressTime: time.Duration(atomic.LoadUint64(&m.nanos)),
+	}
+}
+
+// TrafficCounter - 按帧实际使用的压缩模式 (帧头第 2 字节的低两位) 统计收发流量。
+// 所有计数都是原子操作，可以在连接使用中被其他协程读取，也可以被多个 Buffer 共享用来汇总。
+// 必须通过 new/& 分配，不能作为值嵌入其他结构体。
+type TrafficCounter struct {
+	sent     [4]modeCounter
+	received [4]modeCounter
+}
+
+// AddSent - 记录一个发送的帧
+func (t *TrafficCounter) AddSent(mode byte, raw, wire int, elapsed time.Duration) {
+	t.sent[mode&3].add(raw, wire, elapsed)
+}
+
+// AddReceived - 记录一个接收的帧
+func (t *TrafficCounter) AddReceived(mode byte, raw, wire int, elapsed time.Duration) {
+	t.received[mode&3].add(raw, wire, elapsed)
+}
+
+// Snapshot - 返回按压缩模式索引的发送与接收统计
+func (t *TrafficCounter) Snapshot() (sent, received [4]ModeTraffic) {
+	for i := range t.sent {
+		sent[i] = t.sent[i].load()
+		received[i] = t.received[i].load()
+	}
+	return sent, received
+}
@@ -0,0 +1,167 @@
+package opio
+
+import (
+	"errors"
+	"time"
+)
+
+// HealthState 描述客户端到服务端链路的健康状况。
+type HealthState int
+
+const (
+	HealthHealthy  HealthState = iota // 最近的请求或探测都成功
+	HealthDegraded                    // 最近有探测或请求因连接问题失败，但尚未确认链路中断
+	HealthBroken                      // 连续失败达到阈值，或无法建立新连接
+)
+
+// healthBrokenAfter - 连续失败多少次后认为链路已中断
+const healthBrokenAfter = 3
+
+func (s HealthState) String() string {
+	switch s {
+	case HealthHealthy:
+		return "healthy"
+	case HealthDegraded:
+		return "degraded"
+	case HealthBroken:
+		return "broken"
+	}
+	return "unknown"
+}
+
+// Health 是客户端链路健康状况的快照。
+type Health struct {
+	State               HealthState
+	LastRoundTrip       time.Time     // 最近一次成功往返 (请求、登录或保活探测) 的时间
+	RTT                 time.Duration // 最近一次保活探测的往返时间
+	ConsecutiveFailures int           // 连续失败的次数，任意一次成功后清零
+	LastError           error         // 最近一次失败的错误
+}
+
+// KeepaliveConfig 定义后台保活任务的参数。
+type KeepaliveConfig struct {
+	Interval time.Duration // 探测周期，每个周期探测空闲超过 Interval/2 的连接。0 表示关闭保活
+	Timeout  time.Duration // 单次探测等待回包的超时，0 表示 3 秒
+}
+
+// DefaultKeepaliveConfig 返回每 30 秒探测一次、超时 3 秒的保活配置，适合会静默丢弃空闲连接的防火墙环境。
+func DefaultKeepaliveConfig() KeepaliveConfig {
+	return KeepaliveConfig{Interval: 30 * time.Second, Timeout: 3 * time.Second}
+}
+
+// SetKeepalive 启动 (或重新配置) 后台保活任务：定期用 IOConnect.Echo 心跳协议探测连接池中的空闲连接。
+// 探测失败的连接会被关闭，并按断线处理 (触发 OnDisconnect、补足 MinConns)，
+// 因此午休后的第一个请求不会落在一个已被防火墙丢弃的连接上。cfg.Interval 为 0 时停止保活。
+func (c *Client) SetKeepalive(cfg KeepaliveConfig) error {
+	if c.closed() {
+		return ErrConnectionClosed
+	}
+	if cfg.Interval < 0 || cfg.Timeout < 0 {
+		return errors.New("opio: KeepaliveConfig durations must not be negative")
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 3 * time.Second
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.keepaliveStop != nil {
+		close(c.keepaliveStop)
+		c.keepaliveStop = nil
+	}
+	if cfg.Interval > 0 {
+		c.keepaliveStop = make(chan struct{})
+		go c.keepalive(cfg, c.keepaliveStop)
+	}
+	return nil
+}
+
+// stopKeepalive - 停止后台保活任务 (Close 时调用)
+func (c *Client) stopKeepalive() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.keepaliveStop != nil {
+		close(c.keepaliveStop)
+		c.keepaliveStop = nil
+	}
+}
+
+func (c *Client) keepalive(cfg KeepaliveConfig, stop chan struct{}) {
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		_, err := c.pool.checkIdle(cfg.Interval/2, func(op *IOConnect) error {
+			rtt, err := op.Echo(cfg.Timeout)
+			if err == nil {
+				c.recordRoundTrip(rtt)
+			} else {
+				c.endpointLost(op, err)
+			}
+			return err
+		})
+		if err != nil {
+			c.recordFailure(err)
+			c.connectionLost(err)
+		}
+		if err != nil || c.Health().State != HealthHealthy {
+			// 尝试重新建立连接，成功或失败都会反映到 Health 上
+			c.pool.fill()
+		}
+	}
+}
+
+// Health 返回客户端链路健康状况的快照。
+// 请求、登录和保活探测的结果都会更新该状态：连接断开使状态降为 degraded，
+// 连续失败 3 次或无法建立新连接时为 broken，任意一次成功的往返都会恢复为 healthy。
+func (c *Client) Health() Health {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h := Health{
+		LastRoundTrip:       c.lastRoundTrip,
+		RTT:                 c.rtt,
+		ConsecutiveFailures: c.failures,
+		LastError:           c.lastErr,
+	}
+	switch {
+	case c.dialBroken || c.failures >= healthBrokenAfter:
+		h.State = HealthBroken
+	case c.failures > 0:
+		h.State = HealthDegraded
+	default:
+		h.State = HealthHealthy
+	}
+	return h
+}
+
+// recordRoundTrip - 记录一次成功的往返，rtt 为 0 时保留上一次探测的往返时间
+func (c *Client) recordRoundTrip(rtt time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastRoundTrip = time.Now()
+	if rtt > 0 {
+		c.rtt = rtt
+	}
+	c.failures = 0
+	c.dialBroken = false
+}
+
+// recordFailure - 记录一次由连接问题引起的失败
+func (c *Client) recordFailure(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failures++
+	c.lastErr = err
+}
+
+// recordDialFailure - 按重连策略重试后仍无法建立新连接，链路视为中断
+func (c *Client) recordDialFailure(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failures++
+	c.lastErr = err
+	c.dialBroken = true
+}
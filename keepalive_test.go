@@ -0,0 +1,136 @@
+package opio_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tc252617228/opio"
+)
+
+// echoServer 回应心跳探测 (0x10203040 开头的 25 字节) 并对普通请求回复 okResponse。
+// mute 非 0 时模拟被防火墙丢弃的链路：不再回应心跳，新连接也收不到问候包。
+// echoDelay 为回应心跳前的等待时间。
+type echoServer struct {
+	mute      int32
+	echoes    int32
+	dials     int32
+	echoDelay time.Duration
+}
+
+func (s *echoServer) serve(conn net.Conn) {
+	defer conn.Close()
+	atomic.AddInt32(&s.dials, 1)
+	if atomic.LoadInt32(&s.mute) != 0 {
+		_, _ = io.Copy(io.Discard, conn)
+		return
+	}
+	if fakeLogin(conn) != nil {
+		return
+	}
+	head := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(conn, head); err != nil {
+			return
+		}
+		if head[0] == 0x10 && head[1] == 0x20 && head[2] == 0x30 && head[3] == 0x40 {
+			if _, err := io.ReadFull(conn, make([]byte, 21)); err != nil {
+				return
+			}
+			if atomic.LoadInt32(&s.mute) != 0 {
+				continue
+			}
+			time.Sleep(s.echoDelay)
+			atomic.AddInt32(&s.echoes, 1)
+			if _, err := conn.Write([]byte{0xA5}); err != nil {
+				return
+			}
+			continue
+		}
+		if _, err := io.ReadFull(conn, make([]byte, int(head[2])<<8|int(head[3]))); err != nil {
+			return
+		}
+		if head[0] == 1 && writeFrame(conn, okResponse) != nil {
+			return
+		}
+	}
+}
+
+func TestKeepaliveProbesIdleConnections(t *testing.T) {
+	srv := &echoServer{}
+	host, port := listenLocal(t, srv.serve)
+	client, err := opio.Connect(context.Background(), host, port, "sis", "openplant", time.Second)
+	require.NoError(t, err)
+	defer client.Close()
+
+	require.NoError(t, client.SetKeepalive(opio.KeepaliveConfig{Interval: 30 * time.Millisecond, Timeout: time.Second}))
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&srv.echoes) >= 2 }, 2*time.Second, 10*time.Millisecond)
+
+	h := client.Health()
+	assert.Equal(t, opio.HealthHealthy, h.State)
+	assert.Greater(t, h.RTT, time.Duration(0))
+	assert.WithinDuration(t, time.Now(), h.LastRoundTrip, time.Second)
+
+	// 探测与普通请求交替进行时数据流不会错位
+	_, err = client.ExecSQL(context.Background(), "SELECT 1")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&srv.dials))
+}
+
+func TestKeepaliveDetectsDroppedLink(t *testing.T) {
+	srv := &echoServer{}
+	host, port := listenLocal(t, srv.serve)
+	client, err := opio.Connect(context.Background(), host, port, "sis", "openplant", 200*time.Millisecond)
+	require.NoError(t, err)
+	defer client.Close()
+
+	var disconnects int32
+	require.NoError(t, client.SetReconnectPolicy(opio.ReconnectPolicy{
+		OnDisconnect: func(err error) { atomic.AddInt32(&disconnects, 1) },
+	}))
+	assert.Equal(t, opio.HealthHealthy, client.Health().State)
+
+	atomic.StoreInt32(&srv.mute, 1)
+	require.NoError(t, client.SetKeepalive(opio.KeepaliveConfig{Interval: 30 * time.Millisecond, Timeout: 50 * time.Millisecond}))
+	assert.Eventually(t, func() bool { return client.Health().State == opio.HealthBroken }, 3*time.Second, 10*time.Millisecond,
+		"探测失败且无法重新建立连接时应为 broken")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&disconnects))
+	assert.Error(t, client.Health().LastError)
+
+	// 链路恢复后保活任务重新建立连接
+	atomic.StoreInt32(&srv.mute, 0)
+	assert.Eventually(t, func() bool { return client.Health().State == opio.HealthHealthy }, 3*time.Second, 10*time.Millisecond)
+	_, err = client.ExecSQL(context.Background(), "SELECT 1")
+	assert.NoError(t, err)
+
+	require.NoError(t, client.SetKeepalive(opio.KeepaliveConfig{}))
+	assert.Error(t, client.SetKeepalive(opio.KeepaliveConfig{Interval: -1}))
+}
+
+func TestKeepaliveProbeHoldsPoolSlot(t *testing.T) {
+	srv := &echoServer{echoDelay: 50 * time.Millisecond}
+	host, port := listenLocal(t, srv.serve)
+	client, err := opio.Connect(context.Background(), host, port, "sis", "openplant", time.Second)
+	require.NoError(t, err)
+	defer client.Close()
+	cfg := opio.DefaultPoolConfig()
+	cfg.MaxConns = 1
+	require.NoError(t, client.SetPoolConfig(cfg))
+	require.NoError(t, client.SetKeepalive(opio.KeepaliveConfig{Interval: 20 * time.Millisecond, Timeout: time.Second}))
+
+	// 探测中的连接占用槽位，请求等待探测结束，而不是在 MaxConns 之外另建连接
+	deadline := time.Now().Add(400 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		_, err = client.ExecSQL(context.Background(), "SELECT 1")
+		require.NoError(t, err)
+		time.Sleep(15 * time.Millisecond)
+	}
+	assert.Greater(t, atomic.LoadInt32(&srv.echoes), int32(0))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&srv.dials))
+	assert.LessOrEqual(t, client.PoolStats().Open, 1)
+}
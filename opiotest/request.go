@@ -0,0 +1,489 @@
+package opiotest
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tc252617228/opio"
+	"github.com/tc252617228/opio/internal/utils"
+)
+
+// request - 解码后的 Request 风格请求
+type request struct {
+	props   map[string]interface{}
+	columns []Column      // Columns 属性
+	keys    []interface{} // Indexes 属性
+	filters []opio.Filter // Filters 属性
+	rows    [][]byte      // 属性表之后的数据行 (Insert/Update)
+}
+
+// result - Request 风格请求的应答，cols 为空时只返回错误码
+type result struct {
+	errno int32
+	err   string
+	table string
+	cols  []Column
+	rows  [][]interface{}
+}
+
+func failed(err error) *result {
+	return &result{errno: errnoFailed, err: err.Error()}
+}
+
+func (r *request) str(key string) string {
+	s, _ := r.props[key].(string)
+	return s
+}
+
+func (r *request) num(key string) (float64, bool) {
+	f, err := toFloat(r.props[key])
+	return f, err == nil
+}
+
+// readRequest - 读取属性表与随后的数据行，与 opio.Request 的编码方式对应
+func readRequest(in *utils.Buffer) (*request, error) {
+	n, err := in.DecodeMapStart()
+	if err != nil {
+		return nil, err
+	}
+	r := &request{props: make(map[string]interface{}, n)}
+	for i := uint32(0); i < n && err == nil; i++ {
+		var key string
+		if key, err = in.DecodeString(); err != nil {
+			break
+		}
+		switch key {
+		case opio.PropColumns:
+			r.columns, err = readColumns(in)
+		case opio.PropIndexes:
+			r.keys, err = readIndexes(in)
+		case opio.PropFilters:
+			r.filters, err = readFilters(in)
+		default:
+			r.props[key], err = in.DecodeValue()
+		}
+	}
+	for err == nil {
+		var size uint32
+		if size, err = in.DecodeArrayStart(); err != nil || size == 0xffffffff {
+			break
+		}
+		for i := uint32(0); i < size && err == nil; i++ {
+			var row []byte
+			if row, err = in.DecodeBytes(); err == nil {
+				r.rows = append(r.rows, row)
+			}
+		}
+	}
+	return r, err
+}
+
+func readColumns(in *utils.Buffer) ([]Column, error) {
+	n, err := in.DecodeArrayStart()
+	if err != nil || n == 0xffffffff {
+		return nil, err
+	}
+	cols := make([]Column, n)
+	for i := range cols {
+		var m uint32
+		if m, err = in.DecodeMapStart(); err != nil {
+			return nil, err
+		}
+		for j := uint32(0); j < m && err == nil; j++ {
+			var key string
+			if key, err = in.DecodeString(); err != nil {
+				break
+			}
+			var v interface{}
+			if key == "Name" {
+				cols[i].Name, err = in.DecodeString()
+			} else if v, err = in.DecodeValue(); err == nil && (key == "Type" || key == "Length") {
+				f, _ := toFloat(v)
+				if key == "Type" {
+					cols[i].Type = int(uint8(f))
+				} else {
+					cols[i].Length = int(uint8(f))
+				}
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return cols, nil
+}
+
+func readIndexes(in *utils.Buffer) ([]interface{}, error) {
+	_, tag, err := in.DecodeExtendStart()
+	if err != nil {
+		return nil, err
+	}
+	n, err := in.DecodeArrayStart()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]interface{}, n)
+	for i := range keys {
+		switch tag {
+		case opio.INT32_ARRAY:
+			keys[i], err = in.DecodeInt32()
+		case opio.INT64_ARRAY:
+			keys[i], err = in.DecodeInt64()
+		case opio.STRING_ARRAY:
+			keys[i], err = in.DecodeString()
+		default:
+			err = fmt.Errorf("unsupported index type %d", tag)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+func readFilters(in *utils.Buffer) ([]opio.Filter, error) {
+	n, err := in.DecodeArrayStart()
+	if err != nil || n == 0xffffffff {
+		return nil, err
+	}
+	filters := make([]opio.Filter, n)
+	for i := range filters {
+		var m uint32
+		if m, err = in.DecodeMapStart(); err != nil {
+			return nil, err
+		}
+		for j := uint32(0); j < m && err == nil; j++ {
+			var key string
+			if key, err = in.DecodeString(); err != nil {
+				break
+			}
+			switch key {
+			case "L":
+				filters[i].Left, err = in.DecodeString()
+			case "O":
+				filters[i].Operator, err = in.DecodeUint8()
+			case "R":
+				filters[i].Right, err = in.DecodeString()
+			case "Or":
+				filters[i].Relation, err = in.DecodeUint8()
+			default:
+				_, err = in.DecodeValue()
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return filters, nil
+}
+
+// decodeRows - 按请求的 Columns 解码数据行
+func (r *request) decodeRows() ([][]interface{}, error) {
+	t := opio.NewTable(r.str(opio.PropTable), 0)
+	for _, c := range r.columns {
+		t.AddColumn(c.Name, c.Type, c.Length)
+	}
+	set := &opio.OPDataSet{}
+	set.SetTable(t)
+	rows := make([][]interface{}, len(r.rows))
+	for i, raw := range r.rows {
+		set.ClearRow()
+		set.SetRow(raw)
+		rows[i] = make([]interface{}, len(r.columns))
+		for j := range r.columns {
+			v, err := set.GetValue(uint32(j))
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %w", r.columns[j].Name, err)
+			}
+			rows[i][j] = v
+		}
+	}
+	return rows, nil
+}
+
+func (c *conn) serveRequest() error {
+	r, err := readRequest(c.in)
+	if err != nil {
+		return err
+	}
+	c.srv.countRequest(r.str(opio.PropAction))
+	if async, ok := r.num(opio.PropAsync); ok && async != 0 {
+		c.srv.subscribe(c, r)
+		return nil
+	}
+	res, pushes := c.srv.handle(r)
+	err = c.reply(res)
+	pushes.send()
+	return err
+}
+
+// handle - 执行 Request 风格的请求，返回应答与需要推送给订阅者的数据
+func (s *Server) handle(r *request) (*result, pushes) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	action := r.str(opio.PropAction)
+	if action == opio.ActionExecSQL {
+		return s.execSQL(r.str(opio.PropSQL))
+	}
+	t, err := s.table(r.str(opio.PropTable))
+	if err != nil {
+		return failed(err), nil
+	}
+	where, err := r.cond(t)
+	if err != nil {
+		return failed(err), nil
+	}
+	switch action {
+	case opio.ActionSelect:
+		res, err := t.query(r.columnNames(), where, r.str(opio.PropOrderBy), r.str(opio.PropLimit))
+		if err != nil {
+			return failed(err), nil
+		}
+		return res, nil
+	case opio.ActionInsert, opio.ActionReplace:
+		rows, err := r.decodeRows()
+		if err != nil {
+			return failed(err), nil
+		}
+		changed, err := t.insert(r.columnNames(), rows)
+		if err != nil {
+			return failed(err), nil
+		}
+		return &result{}, s.collectPushes(t, changed)
+	case opio.ActionUpdate:
+		rows, err := r.decodeRows()
+		if err != nil {
+			return failed(err), nil
+		}
+		if len(rows) == 0 {
+			return failed(fmt.Errorf("no values to update")), nil
+		}
+		changed, err := t.update(r.columnNames(), rows[0], where)
+		if err != nil {
+			return failed(err), nil
+		}
+		return &result{}, s.collectPushes(t, changed)
+	case opio.ActionDelete:
+		t.remove(where)
+		return &result{}, nil
+	}
+	return failed(fmt.Errorf("unsupported action %q", action)), nil
+}
+
+func (r *request) columnNames() []string {
+	names := make([]string, len(r.columns))
+	for i, c := range r.columns {
+		names[i] = c.Name
+	}
+	return names
+}
+
+// keyColumn - Indexes 属性对应的列：优先使用 Key 属性，否则整数索引按 ID、字符串索引按 GN 匹配
+func (r *request) keyColumn() string {
+	if k := r.str(opio.PropKey); k != "" {
+		return k
+	}
+	if _, ok := r.keys[0].(string); ok {
+		return "GN"
+	}
+	return "ID"
+}
+
+// cond - Indexes 与 Filters 共同确定的行过滤条件
+func (r *request) cond(t *table) (cond, error) {
+	where, err := t.filterCond(r.filters)
+	if err != nil || len(r.keys) == 0 {
+		return where, err
+	}
+	in, err := t.compareCond(r.keyColumn(), opio.OperIn, r.keys)
+	if err != nil {
+		return nil, err
+	}
+	return func(row []interface{}) bool { return in(row) && where(row) }, nil
+}
+
+// query - 查询满足条件的行并投影到指定的列，columns 为空或为 "*" 时返回所有列。调用方持有 s.mu
+func (t *table) query(columns []string, where cond, orderBy, limit string) (*result, error) {
+	idx, err := t.project(columns)
+	if err != nil {
+		return nil, err
+	}
+	rows := t.match(where)
+	if orderBy != "" {
+		if err = t.sortRows(rows, orderBy); err != nil {
+			return nil, err
+		}
+	}
+	if rows, err = limitRows(rows, limit); err != nil {
+		return nil, err
+	}
+	res := &result{table: t.name, cols: make([]Column, len(idx)), rows: make([][]interface{}, len(rows))}
+	for i, j := range idx {
+		res.cols[i] = t.cols[j]
+	}
+	for i, row := range rows {
+		out := make([]interface{}, len(idx))
+		for k, j := range idx {
+			out[k] = row[j]
+		}
+		res.rows[i] = out
+	}
+	return res, nil
+}
+
+// project - 列名对应的列下标
+func (t *table) project(columns []string) ([]int, error) {
+	if len(columns) == 0 || (len(columns) == 1 && columns[0] == "*") {
+		idx := make([]int, len(t.cols))
+		for i := range idx {
+			idx[i] = i
+		}
+		return idx, nil
+	}
+	idx := make([]int, len(columns))
+	for i, name := range columns {
+		if idx[i] = t.column(name); idx[i] < 0 {
+			return nil, fmt.Errorf("column %s not exist in table %s", name, t.name)
+		}
+	}
+	return idx, nil
+}
+
+// insert - 按列名写入数据行，返回写入的行
+func (t *table) insert(columns []string, rows [][]interface{}) ([][]interface{}, error) {
+	idx, err := t.project(columns)
+	if err != nil {
+		return nil, err
+	}
+	changed := make([][]interface{}, 0, len(rows))
+	for _, values := range rows {
+		row := make([]interface{}, len(t.cols))
+		for k, j := range idx {
+			if row[j], err = normalize(t.cols[j].Type, values[k]); err != nil {
+				return nil, fmt.Errorf("column %s: %w", t.cols[j].Name, err)
+			}
+		}
+		changed = append(changed, t.put(row))
+	}
+	return changed, nil
+}
+
+// update - 把满足条件的行的指定列更新为 values，返回更新后的行
+func (t *table) update(columns []string, values []interface{}, where cond) ([][]interface{}, error) {
+	idx, err := t.project(columns)
+	if err != nil {
+		return nil, err
+	}
+	set := make([]interface{}, len(idx))
+	for k, j := range idx {
+		if set[k], err = normalize(t.cols[j].Type, values[k]); err != nil {
+			return nil, fmt.Errorf("column %s: %w", t.cols[j].Name, err)
+		}
+	}
+	var changed [][]interface{}
+	for i, row := range t.rows {
+		if !where(row) {
+			continue
+		}
+		// 复制后修改，已经收集的推送数据不受影响
+		row = append([]interface{}(nil), row...)
+		for k, j := range idx {
+			row[j] = set[k]
+		}
+		t.rows[i] = row
+		changed = append(changed, row)
+	}
+	return changed, nil
+}
+
+// reply - 写出应答。rows 的每个值必须是 normalize 之后的类型
+func (c *conn) reply(res *result) error {
+	var rows [][]byte
+	var cols []opio.Column
+	if res.cols != nil {
+		var err error
+		if rows, cols, err = encodeRows(res.table, res.cols, res.rows); err != nil {
+			res = failed(err)
+		}
+	}
+	c.srv.mu.Lock()
+	heartbeats := c.srv.heartbeats
+	c.srv.mu.Unlock()
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if err := c.probe(heartbeats); err != nil {
+		return err
+	}
+	out := c.out
+	n := uint32(1)
+	if res.err != "" {
+		n++
+	}
+	if res.cols != nil {
+		n += 2
+	}
+	_ = out.EncodeMapStart(n)
+	_ = out.EncodeString(opio.PropErrNo)
+	_ = out.EncodeInt32(res.errno)
+	if res.err != "" {
+		_ = out.EncodeString(opio.PropError)
+		_ = out.EncodeString(res.err)
+	}
+	if res.cols != nil {
+		_ = out.EncodeString(opio.PropTable)
+		_ = out.EncodeString(res.table)
+		_ = out.EncodeString(opio.PropColumns)
+		_ = out.EncodeArrayStart(uint32(len(cols)))
+		for _, col := range cols {
+			_ = out.EncodeMapStart(3)
+			_ = out.EncodeString("Name")
+			_ = out.EncodeString(col.GetName())
+			_ = out.EncodeString("Type")
+			_ = out.EncodeUint8(col.GetType())
+			_ = out.EncodeString("Length")
+			_ = out.EncodeUint8(col.GetLength())
+		}
+	}
+	if len(rows) > 0 {
+		_ = out.EncodeArrayStart(uint32(len(rows)))
+		for _, row := range rows {
+			_ = out.EncodeExtendLen(uint32(len(row)), opio.VtRow)
+			_ = out.PutBytes(row)
+		}
+	}
+	_ = out.EncodeNil()
+	return out.Flush(true)
+}
+
+// encodeRows - 按 opio 的行格式编码数据行，同时返回编码使用的列定义 (长度按类型修正)
+func encodeRows(name string, cols []Column, rows [][]interface{}) ([][]byte, []opio.Column, error) {
+	t := opio.NewTable(name, uint(len(rows)))
+	for _, c := range cols {
+		t.AddColumn(c.Name, c.Type, c.Length)
+	}
+	for _, row := range rows {
+		for i, v := range row {
+			col := uint32(i)
+			switch x := v.(type) {
+			case nil:
+				if cols[i].Type == opio.VtString || cols[i].Type == opio.VtBinary {
+					_ = t.SetColumnEmpty(col)
+				}
+			case time.Time:
+				_ = t.SetColumnDateTime(col, x)
+			default:
+				_ = t.SetColumnValue(col, x)
+			}
+		}
+		t.BindRow()
+	}
+	if errs := t.GetErrors(); len(errs) > 0 {
+		return nil, nil, errs[0]
+	}
+	out := make([][]byte, 0, len(rows))
+	for _, row := range t.GetRow() {
+		out = append(out, row.Data)
+	}
+	return out, t.GetColumns(), nil
+}
@@ -0,0 +1,374 @@
+// Package opiotest 提供进程内的 OpenPlant 模拟服务端，用于在没有实际服务器的情况下端到端测试 opio 客户端代码。
+//
+//	srv := opiotest.NewServer()
+//	defer srv.Close()
+//	srv.AddPoints(opiotest.Point{ID: 1001, Name: "AI1001", Type: opio.TypeR8})
+//	srv.SetRealtime(opio.Value{ID: 1001, TM: int32(time.Now().Unix()), AV: 12.5})
+//	client, err := srv.Connect(ctx)
+//
+// 模拟服务端实现了登录握手、Request 风格的 Select/Insert/Update/Delete/ExecSQL (作用于内存表)、
+// V3 二进制的实时/历史/统计命令、异步订阅推送以及心跳探测，行为尽量贴近 OpenPlant，但只覆盖测试常用的子集。
+package opiotest
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tc252617228/opio"
+	"github.com/tc252617228/opio/internal/utils"
+)
+
+const (
+	// DefaultUser 与 DefaultPassword 是 Connect 使用的登录凭据，未调用 AddUser 时服务端接受任意凭据。
+	DefaultUser     = "sis"
+	DefaultPassword = "openplant"
+
+	bufferSize = 65536
+
+	// errnoFailed - 请求失败时应答中的错误码
+	errnoFailed int32 = -1
+	// errnoAuth - 登录失败时确认包中的错误码
+	errnoAuth int32 = -2
+
+	// probeMarker - 服务端心跳探测中要求客户端原样返回的字节，不会出现在帧头的第一个字节 (0/1 或 0x10)
+	probeMarker byte = 0x5A
+)
+
+// Server 是监听在本机回环地址上的模拟 OpenPlant 服务端。所有方法都可以被多个协程同时调用。
+type Server struct {
+	Host string // 监听地址，通常为 127.0.0.1
+	Port int    // 监听端口
+
+	ln net.Listener
+	wg sync.WaitGroup
+
+	mu         sync.Mutex
+	closed     bool
+	conns      map[*conn]struct{}
+	tables     map[string]*table // 键为小写表名
+	users      map[string]string
+	version    int32
+	heartbeats int // 每个应答之前发送的心跳探测数
+	replies    int // 收到的心跳回包数
+	requests   map[string]int
+	subs       map[*conn][]*subscription
+}
+
+// NewServer 启动一个监听在 127.0.0.1 随机端口上的模拟服务端，预置空的 Point、Realtime 与 Archive 表。
+// 测试结束时调用 Close。
+func NewServer() *Server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("opiotest: 监听本机端口失败: " + err.Error())
+	}
+	addr := ln.Addr().(*net.TCPAddr)
+	s := &Server{
+		Host:     addr.IP.String(),
+		Port:     addr.Port,
+		ln:       ln,
+		conns:    make(map[*conn]struct{}),
+		tables:   make(map[string]*table),
+		users:    make(map[string]string),
+		version:  0x030500,
+		requests: make(map[string]int),
+		subs:     make(map[*conn][]*subscription),
+	}
+	s.createBuiltinTables()
+	s.wg.Add(1)
+	go s.accept()
+	return s
+}
+
+// Addr 返回 "host:port" 形式的监听地址。
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// Connect 使用 DefaultUser/DefaultPassword 连接到模拟服务端。
+func (s *Server) Connect(ctx context.Context, opts ...opio.ConnectOption) (*opio.Client, error) {
+	return opio.Connect(ctx, s.Host, s.Port, DefaultUser, DefaultPassword, 5*time.Second, opts...)
+}
+
+// NewClient 启动模拟服务端，调用 seed 预置数据 (为空时跳过)，再连接到它。
+// 服务端与客户端都在测试结束时关闭，连接失败时测试立即失败。
+//
+//	srv, client := opiotest.NewClient(t, func(srv *opiotest.Server) {
+//		srv.AddPoints(opiotest.Point{ID: 1001, Name: "AI1001", Type: opio.TypeR8})
+//	})
+func NewClient(tb testing.TB, seed func(*Server), opts ...opio.ConnectOption) (*Server, *opio.Client) {
+	tb.Helper()
+	srv := NewServer()
+	tb.Cleanup(srv.Close)
+	if seed != nil {
+		seed(srv)
+	}
+	client, err := srv.Connect(context.Background(), opts...)
+	if err != nil {
+		tb.Fatalf("opiotest: 连接模拟服务端失败: %v", err)
+	}
+	tb.Cleanup(func() { _ = client.Close() })
+	return srv, client
+}
+
+// Close 停止监听并断开所有连接，等待服务协程退出。
+func (s *Server) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	_ = s.ln.Close()
+	for c := range s.conns {
+		_ = c.nc.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// AddUser 添加一个允许登录的用户。添加过用户之后，服务端会校验登录口令，未知用户或口令错误时拒绝登录。
+func (s *Server) AddUser(user, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[user] = password
+}
+
+// SetVersion 设置之后的登录问候包中声明的服务端版本，默认为 3.5.0。
+func (s *Server) SetVersion(major, minor, patch int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version = int32(uint8(major))<<16 | int32(uint8(minor))<<8 | int32(uint8(patch))
+}
+
+// SetHeartbeats 设置在每个 Request 风格的应答与订阅推送之前发送的心跳探测数 (默认为 0)，
+// 用于测试客户端对服务端心跳的处理，收到的回包数见 HeartbeatReplies。
+func (s *Server) SetHeartbeats(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.heartbeats = n
+}
+
+// HeartbeatReplies 返回客户端对心跳探测的回包数。
+func (s *Server) HeartbeatReplies() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.replies
+}
+
+// Requests 返回按 Action 统计的已处理请求数，V3 二进制命令记为 "V3"，客户端心跳 (IOConnect.Echo) 记为 "Echo"。
+func (s *Server) Requests(action string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[action]
+}
+
+func (s *Server) countRequest(action string) {
+	s.mu.Lock()
+	s.requests[action]++
+	s.mu.Unlock()
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+	for {
+		nc, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		c := newConn(s, nc)
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = nc.Close()
+			return
+		}
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			c.serve()
+			s.mu.Lock()
+			delete(s.conns, c)
+			s.unsubscribeAll(c)
+			s.mu.Unlock()
+			_ = nc.Close()
+		}()
+	}
+}
+
+// conn - 一个客户端连接。读写使用各自的缓冲区，订阅推送可以与请求处理并发写入 (由 wmu 串行化)。
+type conn struct {
+	srv *Server
+	nc  net.Conn
+	br  *bufio.Reader
+	in  *utils.Buffer
+
+	wmu sync.Mutex
+	out *utils.Buffer
+}
+
+// connReader - 经由 bufio.Reader 读取的连接，以便在消息之间识别心跳回包
+type connReader struct {
+	br *bufio.Reader
+	net.Conn
+}
+
+func (r connReader) Read(p []byte) (int, error) {
+	return r.br.Read(p)
+}
+
+func newConn(s *Server, nc net.Conn) *conn {
+	br := bufio.NewReader(nc)
+	return &conn{
+		srv: s,
+		nc:  nc,
+		br:  br,
+		in:  utils.NewBuffer(connReader{br, nc}, bufferSize),
+		out: utils.NewBuffer(nc, bufferSize),
+	}
+}
+
+func (c *conn) serve() {
+	defer c.in.Release()
+	defer c.out.Release()
+	if !c.login() {
+		return
+	}
+	probe := make([]byte, 21)
+	for {
+		if err := c.skipReplies(); err != nil {
+			return
+		}
+		echo, err := c.in.PeekN(probe)
+		if err != nil {
+			return
+		}
+		if echo {
+			// 客户端心跳 (IOConnect.Echo)：原样返回探测中的标记字节
+			if c.in.GetBytes(probe) != nil {
+				return
+			}
+			c.srv.countRequest("Echo")
+			c.wmu.Lock()
+			err = c.out.DirectWrite(probe[16:17])
+			c.wmu.Unlock()
+		} else if b, e := c.in.Peek(); e != nil {
+			return
+		} else if b == byte(opio.MAGIC>>24) {
+			c.srv.countRequest("V3")
+			err = c.serveV3()
+		} else {
+			err = c.serveRequest()
+		}
+		if err != nil {
+			return
+		}
+		if c.in.SkipAll() != nil {
+			return
+		}
+	}
+}
+
+// skipReplies - 在两条消息之间读取客户端对心跳探测的回包
+func (c *conn) skipReplies() error {
+	for {
+		b, err := c.br.Peek(1)
+		if err != nil {
+			return err
+		}
+		if b[0] != probeMarker {
+			return nil
+		}
+		_, _ = c.br.ReadByte()
+		c.srv.mu.Lock()
+		c.srv.replies++
+		c.srv.mu.Unlock()
+	}
+}
+
+// login - 发送问候包，校验客户端的登录包并返回确认包
+func (c *conn) login() bool {
+	c.srv.mu.Lock()
+	version := c.srv.version
+	users := len(c.srv.users)
+	c.srv.mu.Unlock()
+
+	// SERVER_VERSION(60) + session(4) + SCRAMBLE(20) + 12 + ver(4)
+	greeting := make([]byte, 100)
+	copy(greeting, "OpenPlant opiotest")
+	random := greeting[64:84]
+	if _, err := io.ReadFull(rand.Reader, random); err != nil {
+		return false
+	}
+	binary.BigEndian.PutUint32(greeting[96:], uint32(version))
+	if c.writeFrame(greeting) != nil {
+		return false
+	}
+
+	// client_info(40) + session(4) + user(16) + passwd(2+20) + (18)
+	reply := make([]byte, 100)
+	if c.in.GetBytes(reply) != nil || c.in.SkipAll() != nil {
+		return false
+	}
+	errno := int32(0)
+	if users > 0 {
+		user := strings.TrimRight(string(reply[44:60]), "\x00")
+		n := int(binary.BigEndian.Uint16(reply[60:]))
+		if n > 20 {
+			n = 20
+		}
+		c.srv.mu.Lock()
+		pass, ok := c.srv.users[user]
+		c.srv.mu.Unlock()
+		if !ok || string(utils.Scramle(random, []byte(pass))) != string(reply[62:62+n]) {
+			errno = errnoAuth
+		}
+	}
+
+	// magic, peer, error, magic
+	ack := make([]byte, 16)
+	binary.BigEndian.PutUint32(ack, uint32(opio.MAGIC))
+	if addr, ok := c.nc.RemoteAddr().(*net.TCPAddr); ok {
+		copy(ack[4:8], addr.IP.To4())
+	}
+	binary.BigEndian.PutUint32(ack[8:], uint32(errno))
+	binary.BigEndian.PutUint32(ack[12:], uint32(opio.MAGIC))
+	return c.writeFrame(ack) == nil && errno == 0
+}
+
+func (c *conn) writeFrame(p []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if err := c.out.PutBytes(p); err != nil {
+		return err
+	}
+	return c.out.Flush(true)
+}
+
+// probe - 发送服务端心跳探测，调用方持有 c.wmu。客户端在读取应答时回复 probeMarker，由 skipReplies 读取。
+func (c *conn) probe(n int) error {
+	b := []byte{
+		0x10, 0x20, 0x30, 0x40,
+		0, 0, 0, 110,
+		0x46, 0, 0, 0,
+		0, 0, 0, 0,
+		0, 0, 0, 0,
+		probeMarker,
+		0x10, 0x20, 0x30, 0x40,
+	}
+	for i := 0; i < n; i++ {
+		if err := c.out.DirectWrite(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
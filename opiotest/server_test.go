@@ -0,0 +1,256 @@
+package opiotest_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tc252617228/opio"
+	"github.com/tc252617228/opio/opiotest"
+)
+
+// seedPoints 预置一个模拟量与一个开关量测点
+func seedPoints(srv *opiotest.Server) {
+	srv.AddPoints(
+		opiotest.Point{ID: 1001, Name: "W3.UNIT1.AI1001", Type: opio.TypeR8, Desc: "温度", Unit: "℃"},
+		opiotest.Point{ID: 1002, Name: "W3.UNIT1.DX1002", Type: opio.TypeDX, Desc: "开关"},
+	)
+}
+
+func TestServerRequest(t *testing.T) {
+	srv, client := opiotest.NewClient(t, seedPoints)
+	ctx := context.Background()
+
+	res, err := client.Query(ctx, "Point", []string{"ID", "GN"}, &opio.QueryOptions{
+		Filters: []opio.Filter{{Left: "GN", Operator: opio.OperLike, Right: "%DX%"}},
+	})
+	require.NoError(t, err)
+	require.Len(t, res.Rows, 1)
+	assert.Equal(t, int32(1002), res.Rows[0]["ID"])
+	assert.Equal(t, "W3.UNIT1.DX1002", res.Rows[0]["GN"])
+
+	require.NoError(t, client.Insert(ctx, "Point", []map[string]interface{}{
+		{"ID": int32(1003), "GN": "W3.UNIT1.AI1003", "RT": opio.TypeR8, "ED": "压力"},
+	}))
+	require.NoError(t, client.Update(ctx, "Point", map[string]interface{}{"EU": "MPa"},
+		[]opio.Filter{{Left: "ID", Operator: opio.OperEQ, Right: "1003"}}))
+	res, err = client.ExecSQL(ctx, "SELECT ID, EU FROM Point WHERE ID >= 1002 ORDER BY ID DESC LIMIT 1")
+	require.NoError(t, err)
+	require.Len(t, res.Rows, 1)
+	assert.Equal(t, int32(1003), res.Rows[0]["ID"])
+	assert.Equal(t, "MPa", res.Rows[0]["EU"])
+
+	// IN 列表中带引号的值可以包含逗号与单引号
+	require.NoError(t, client.Update(ctx, "Point", map[string]interface{}{"ED": "A,B"},
+		[]opio.Filter{{Left: "ID", Operator: opio.OperEQ, Right: "1001"}}))
+	require.NoError(t, client.Update(ctx, "Point", map[string]interface{}{"ED": "it's"},
+		[]opio.Filter{{Left: "ID", Operator: opio.OperEQ, Right: "1002"}}))
+	res, err = client.Query(ctx, "Point", []string{"ID"}, &opio.QueryOptions{
+		Filters: []opio.Filter{{Left: "ED", Operator: opio.OperIn, Right: "'A,B', 'it''s' ,压力"}},
+	})
+	require.NoError(t, err)
+	assert.Len(t, res.Rows, 3)
+	_, err = client.Query(ctx, "Point", []string{"ID"}, &opio.QueryOptions{
+		Filters: []opio.Filter{{Left: "ED", Operator: opio.OperIn, Right: "'A,B"}},
+	})
+	assert.Error(t, err)
+
+	require.NoError(t, client.DeleteByID(ctx, "Point", "GN", "W3.UNIT1.AI1003"))
+	assert.Len(t, srv.Rows("Point"), 2)
+	require.NoError(t, client.Ping(ctx))
+
+	_, err = client.ExecSQL(ctx, "SELECT * FROM Missing")
+	var serverErr *opio.OpioServerError
+	assert.ErrorAs(t, err, &serverErr)
+	assert.Equal(t, 3, srv.Requests(opio.ActionUpdate))
+}
+
+func TestServerRealtimeArchive(t *testing.T) {
+	srv, client := opiotest.NewClient(t, seedPoints)
+	ctx := context.Background()
+	now := int32(time.Now().Unix())
+
+	require.NoError(t, client.WriteRealtime(ctx, []opio.Value{{ID: 1001, TM: now, AV: 12.5}, {ID: 1002, TM: now, AV: 1}}))
+	values := []opio.Value{{ID: 1001}, {ID: 1002}}
+	require.NoError(t, client.ReadRealtime(ctx, values))
+	assert.Equal(t, 12.5, values[0].AV)
+	assert.Equal(t, opio.TypeDX, values[1].RT)
+	assert.Equal(t, float64(1), values[1].AV)
+	assert.Equal(t, now, values[1].TM)
+
+	begin := time.Unix(int64(now), 0).Add(-time.Hour)
+	require.NoError(t, client.WriteArchive(ctx, []*opio.Archive{{ID: 1001, Type: opio.TypeR8, Data: []opio.Value{
+		{TM: now - 3000, AV: 1}, {TM: now - 2000, AV: 3}, {TM: now - 1000, AV: 2},
+	}}}, false))
+	assert.Len(t, srv.Rows("Archive"), 3)
+
+	archives, err := client.ReadArchive(ctx, []int32{1001}, opio.ModeRaw, begin, time.Unix(int64(now), 0), 0)
+	require.NoError(t, err)
+	require.Len(t, archives, 1)
+	require.Len(t, archives[0].Data, 3)
+	assert.Equal(t, 3.0, archives[0].Data[1].AV)
+
+	stats, err := client.ReadStat(ctx, []int32{1001}, opio.ModeStat, begin, time.Unix(int64(now), 0), 0)
+	require.NoError(t, err)
+	require.Len(t, stats, 1)
+	require.Len(t, stats[0].Data, 1)
+	assert.Equal(t, 3.0, stats[0].Data[0].Max)
+	assert.Equal(t, 1.0, stats[0].Data[0].Min)
+	assert.Equal(t, 2.0, stats[0].Data[0].Mean)
+}
+
+func TestServerSubscribe(t *testing.T) {
+	srv, client := opiotest.NewClient(t, seedPoints)
+	now := int32(time.Now().Unix())
+	srv.SetRealtime(opio.Value{ID: 1001, TM: now, AV: 1})
+
+	sub, err := client.Subscribe(context.Background(), "Realtime", "ID", []int32{1001}, &opio.SubscribeOptions{Snapshot: true})
+	require.NoError(t, err)
+	defer sub.Close()
+
+	next := func() map[string]interface{} {
+		select {
+		case ev := <-sub.Events():
+			require.NoError(t, ev.Err)
+			return ev.Data
+		case <-time.After(5 * time.Second):
+			t.Fatal("等待订阅推送超时")
+			return nil
+		}
+	}
+	assert.Equal(t, 1.0, next()["AV"], "快照")
+	srv.SetRealtime(opio.Value{ID: 1001, TM: now + 1, AV: 2})
+	assert.Equal(t, 2.0, next()["AV"])
+
+	require.NoError(t, sub.AddKeys([]int32{1002}))
+	require.Eventually(t, func() bool { return srv.Requests(opio.ActionSelect) >= 2 }, 5*time.Second, 10*time.Millisecond)
+	srv.SetRealtime(opio.Value{ID: 1002, TM: now + 2, AV: 1})
+	assert.Equal(t, int32(1002), next()["ID"])
+}
+
+// relay 把连接转发到 addr，drop 断开当前所有转发中的连接
+type relay struct {
+	net.Listener
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func newRelay(t *testing.T, addr string) *relay {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	r := &relay{Listener: ln}
+	t.Cleanup(func() { _ = ln.Close(); r.drop() })
+	go func() {
+		for {
+			down, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			up, err := net.Dial("tcp", addr)
+			if err != nil {
+				_ = down.Close()
+				continue
+			}
+			r.mu.Lock()
+			r.conns = append(r.conns, down, up)
+			r.mu.Unlock()
+			go func() { _, _ = io.Copy(up, down); _ = up.Close() }()
+			go func() { _, _ = io.Copy(down, up); _ = down.Close() }()
+		}
+	}()
+	return r
+}
+
+func (r *relay) drop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range r.conns {
+		_ = c.Close()
+	}
+	r.conns = nil
+}
+
+func TestServerSubscribeReconnect(t *testing.T) {
+	srv, _ := opiotest.NewClient(t, seedPoints)
+	r := newRelay(t, srv.Addr())
+	host, port, _ := net.SplitHostPort(r.Addr().String())
+	p, _ := strconv.Atoi(port)
+	client, err := opio.Connect(context.Background(), host, p, opiotest.DefaultUser, opiotest.DefaultPassword, time.Second)
+	require.NoError(t, err)
+	defer client.Close()
+
+	sub, err := client.Subscribe(context.Background(), "Realtime", "ID", []int32{1001}, nil)
+	require.NoError(t, err)
+	defer sub.Close()
+	reconnected := make(chan struct{}, 16)
+	go func() {
+		for ev := range sub.Events() {
+			var serverErr *opio.OpioServerError
+			if errors.As(ev.Err, &serverErr) && serverErr.Code == -90 {
+				reconnected <- struct{}{}
+			}
+		}
+	}()
+
+	// 增删订阅键与读取协程断线重连 (替换并归还缓冲区) 并发进行
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			_ = sub.AddKeys([]int32{1002})
+			_ = sub.RemoveKeys([]int32{1002})
+		}
+	}()
+	for i := 0; i < 3; i++ {
+		r.drop()
+		select {
+		case <-reconnected:
+		case <-time.After(5 * time.Second):
+			t.Fatal("等待订阅重连超时")
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestServerHeartbeats(t *testing.T) {
+	srv, client := opiotest.NewClient(t, func(srv *opiotest.Server) {
+		srv.SetVersion(4, 0, 1)
+		srv.SetHeartbeats(2)
+		srv.AddPoints(opiotest.Point{ID: 1, Name: "W3.N.P1"})
+	})
+	assert.Equal(t, "4.0.1", client.Capabilities().String())
+
+	res, err := client.Query(context.Background(), "Point", []string{"*"}, nil)
+	require.NoError(t, err)
+	require.Len(t, res.Rows, 1)
+	assert.Equal(t, "W3.N.P1", res.Rows[0]["GN"])
+	require.NoError(t, client.Ping(context.Background()))
+	require.Eventually(t, func() bool { return srv.HeartbeatReplies() == 4 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestServerRejectsUnknownUser(t *testing.T) {
+	srv := opiotest.NewServer()
+	defer srv.Close()
+	srv.AddUser("admin", "secret")
+
+	_, err := srv.Connect(context.Background())
+	assert.Error(t, err)
+	client, err := opio.Connect(context.Background(), srv.Host, srv.Port, "admin", "secret", time.Second)
+	require.NoError(t, err)
+	require.NoError(t, client.Close())
+}
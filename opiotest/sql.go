@@ -0,0 +1,690 @@
+package opiotest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/tc252617228/opio"
+)
+
+// 模拟服务端支持的 SQL 子集：
+//
+//	SELECT * | 列[, 列] | COUNT(*) [AS 名称] | 字面值[, ...] [FROM 表 [WHERE 条件] [ORDER BY 列 [ASC|DESC], ...] [LIMIT [偏移,] 数量 | LIMIT 数量 OFFSET 偏移]]
+//	INSERT INTO 表 [(列, ...)] VALUES (值, ...)[, (值, ...)]
+//	UPDATE 表 SET 列 = 值[, ...] [WHERE 条件]
+//	DELETE FROM 表 [WHERE 条件]
+//
+// 条件由 列 比较运算符 值、[NOT] IN (值, ...)、[NOT] LIKE '模式'、IS [NOT] NULL 通过 AND/OR/NOT 与括号组合。
+
+const (
+	tokEOF = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokSymbol
+)
+
+type token struct {
+	kind int
+	text string
+}
+
+func tokenize(sql string) ([]token, error) {
+	var toks []token
+	r := []rune(sql)
+	for i := 0; i < len(r); {
+		c := r[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '\'':
+			var b strings.Builder
+			i++
+			for {
+				if i >= len(r) {
+					return nil, fmt.Errorf("unterminated string in %q", sql)
+				}
+				if r[i] == '\'' {
+					if i+1 < len(r) && r[i+1] == '\'' {
+						b.WriteRune('\'')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				b.WriteRune(r[i])
+				i++
+			}
+			toks = append(toks, token{tokString, b.String()})
+		case unicode.IsDigit(c) || (c == '-' && i+1 < len(r) && unicode.IsDigit(r[i+1]) && numberAllowed(toks)):
+			j := i + 1
+			for j < len(r) && (unicode.IsDigit(r[j]) || r[j] == '.') {
+				j++
+			}
+			toks = append(toks, token{tokNumber, string(r[i:j])})
+			i = j
+		case unicode.IsLetter(c) || c == '_' || c == '"' || c == '`':
+			if c == '"' || c == '`' {
+				j := i + 1
+				for j < len(r) && r[j] != c {
+					j++
+				}
+				if j >= len(r) {
+					return nil, fmt.Errorf("unterminated identifier in %q", sql)
+				}
+				toks = append(toks, token{tokIdent, string(r[i+1 : j])})
+				i = j + 1
+				continue
+			}
+			j := i + 1
+			for j < len(r) && (unicode.IsLetter(r[j]) || unicode.IsDigit(r[j]) || r[j] == '_' || r[j] == '.') {
+				j++
+			}
+			toks = append(toks, token{tokIdent, string(r[i:j])})
+			i = j
+		default:
+			sym := string(c)
+			if i+1 < len(r) {
+				switch two := string(r[i : i+2]); two {
+				case "<=", ">=", "<>", "!=":
+					sym = two
+				}
+			}
+			if !strings.Contains("=<>!(),*;", string(c)) {
+				return nil, fmt.Errorf("unexpected %q in %q", c, sql)
+			}
+			toks = append(toks, token{tokSymbol, sym})
+			i += len(sym)
+		}
+	}
+	return append(toks, token{kind: tokEOF}), nil
+}
+
+// numberAllowed - '-' 只有出现在运算符或分隔符之后时才是负号
+func numberAllowed(toks []token) bool {
+	return len(toks) == 0 || toks[len(toks)-1].kind == tokSymbol && toks[len(toks)-1].text != ")"
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// keyword - 下一个记号是关键字 kw 时读取它
+func (p *parser) keyword(kw string) bool {
+	if t := p.peek(); t.kind == tokIdent && strings.EqualFold(t.text, kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// symbol - 下一个记号是符号 s 时读取它
+func (p *parser) symbol(s string) bool {
+	if t := p.peek(); t.kind == tokSymbol && t.text == s {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectKeyword(kw string) error {
+	if !p.keyword(kw) {
+		return p.unexpected(kw)
+	}
+	return nil
+}
+
+func (p *parser) expectSymbol(s string) error {
+	if !p.symbol(s) {
+		return p.unexpected(s)
+	}
+	return nil
+}
+
+func (p *parser) unexpected(want string) error {
+	t := p.peek()
+	if t.kind == tokEOF {
+		return fmt.Errorf("syntax error: expect %s at end of statement", want)
+	}
+	return fmt.Errorf("syntax error: expect %s near %q", want, t.text)
+}
+
+func (p *parser) ident() (string, error) {
+	t := p.peek()
+	if t.kind != tokIdent {
+		return "", p.unexpected("identifier")
+	}
+	p.pos++
+	// 去掉 "库.表" 或 "表.列" 的前缀
+	if i := strings.LastIndexByte(t.text, '.'); i >= 0 {
+		return t.text[i+1:], nil
+	}
+	return t.text, nil
+}
+
+// literal - 数字、字符串、NULL、TRUE/FALSE
+func (p *parser) literal() (interface{}, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokNumber:
+		p.pos++
+		if !strings.Contains(t.text, ".") {
+			if n, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+				return n, nil
+			}
+		}
+		return strconv.ParseFloat(t.text, 64)
+	case tokString:
+		p.pos++
+		return t.text, nil
+	case tokIdent:
+		switch strings.ToUpper(t.text) {
+		case "NULL":
+			p.pos++
+			return nil, nil
+		case "TRUE":
+			p.pos++
+			return true, nil
+		case "FALSE":
+			p.pos++
+			return false, nil
+		}
+	}
+	return nil, p.unexpected("value")
+}
+
+func (p *parser) end() error {
+	p.symbol(";")
+	if p.peek().kind != tokEOF {
+		return p.unexpected("end of statement")
+	}
+	return nil
+}
+
+// execSQL - 执行 SQL，调用方持有 s.mu
+func (s *Server) execSQL(sql string) (*result, pushes) {
+	toks, err := tokenize(sql)
+	if err != nil {
+		return failed(err), nil
+	}
+	p := &parser{toks: toks}
+	var res *result
+	var ps pushes
+	switch {
+	case p.keyword("SELECT"):
+		res, err = s.sqlSelect(p)
+	case p.keyword("INSERT"):
+		ps, err = s.sqlInsert(p)
+	case p.keyword("UPDATE"):
+		ps, err = s.sqlUpdate(p)
+	case p.keyword("DELETE"):
+		err = s.sqlDelete(p)
+	default:
+		err = p.unexpected("SELECT, INSERT, UPDATE or DELETE")
+	}
+	if err != nil {
+		return failed(err), nil
+	}
+	if res == nil {
+		res = &result{}
+	}
+	return res, ps
+}
+
+// selectItem - SELECT 列表中的一项
+type selectItem struct {
+	column string
+	count  bool
+	value  interface{}
+	isLit  bool
+	alias  string
+}
+
+func (s *Server) sqlSelect(p *parser) (*result, error) {
+	var items []selectItem
+	for {
+		var it selectItem
+		switch t := p.peek(); {
+		case p.symbol("*"):
+			it.column = "*"
+		case t.kind == tokIdent && strings.EqualFold(t.text, "COUNT") && p.toks[p.pos+1].text == "(":
+			p.pos += 2
+			if err := p.expectSymbol("*"); err != nil {
+				return nil, err
+			}
+			if err := p.expectSymbol(")"); err != nil {
+				return nil, err
+			}
+			it.count, it.alias = true, "COUNT(*)"
+		case t.kind == tokIdent && !isLiteralKeyword(t.text):
+			it.column, _ = p.ident()
+		default:
+			v, err := p.literal()
+			if err != nil {
+				return nil, err
+			}
+			it.value, it.isLit, it.alias = v, true, t.text
+		}
+		if p.keyword("AS") {
+			alias, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			it.alias = alias
+		}
+		items = append(items, it)
+		if !p.symbol(",") {
+			break
+		}
+	}
+	if !p.keyword("FROM") {
+		if err := p.end(); err != nil {
+			return nil, err
+		}
+		return literalRow(items)
+	}
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	t, err := s.table(name)
+	if err != nil {
+		return nil, err
+	}
+	where, err := p.where(t)
+	if err != nil {
+		return nil, err
+	}
+	var orderBy, limit string
+	if p.keyword("ORDER") {
+		if orderBy, err = p.orderBy(); err != nil {
+			return nil, err
+		}
+	}
+	if p.keyword("LIMIT") {
+		if limit, err = p.limit(); err != nil {
+			return nil, err
+		}
+	}
+	if err = p.end(); err != nil {
+		return nil, err
+	}
+	for _, it := range items {
+		if it.isLit {
+			return nil, fmt.Errorf("literal %q with FROM is not supported", it.alias)
+		}
+	}
+	if len(items) == 1 && items[0].count {
+		n := int64(len(t.match(where)))
+		return &result{table: t.name, cols: []Column{{Name: items[0].alias, Type: opio.VtInt64}}, rows: [][]interface{}{{n}}}, nil
+	}
+	columns := make([]string, len(items))
+	for i, it := range items {
+		if it.count {
+			return nil, fmt.Errorf("COUNT(*) must be the only selected column")
+		}
+		columns[i] = it.column
+	}
+	res, err := t.query(columns, where, orderBy, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i, it := range items {
+		if it.alias != "" {
+			res.cols[i].Name = it.alias
+		}
+	}
+	return res, nil
+}
+
+func isLiteralKeyword(s string) bool {
+	switch strings.ToUpper(s) {
+	case "NULL", "TRUE", "FALSE":
+		return true
+	}
+	return false
+}
+
+// literalRow - 没有 FROM 的 SELECT 返回一行字面值
+func literalRow(items []selectItem) (*result, error) {
+	res := &result{cols: make([]Column, len(items)), rows: [][]interface{}{make([]interface{}, len(items))}}
+	for i, it := range items {
+		if !it.isLit {
+			return nil, fmt.Errorf("column %s requires FROM", it.column)
+		}
+		typ := opio.VtString
+		switch it.value.(type) {
+		case int64:
+			typ = opio.VtInt64
+		case float64:
+			typ = opio.VtDouble
+		case bool:
+			typ = opio.VtBool
+		}
+		res.cols[i] = Column{Name: it.alias, Type: typ}
+		res.rows[0][i] = it.value
+	}
+	return res, nil
+}
+
+func (p *parser) orderBy() (string, error) {
+	if err := p.expectKeyword("BY"); err != nil {
+		return "", err
+	}
+	var parts []string
+	for {
+		col, err := p.ident()
+		if err != nil {
+			return "", err
+		}
+		if p.keyword("DESC") {
+			col += " desc"
+		} else {
+			p.keyword("ASC")
+		}
+		parts = append(parts, col)
+		if !p.symbol(",") {
+			return strings.Join(parts, ","), nil
+		}
+	}
+}
+
+// limit - 转换为 limitRows 的 "[offset,] count" 形式
+func (p *parser) limit() (string, error) {
+	num := func() (string, error) {
+		t := p.next()
+		if t.kind != tokNumber {
+			return "", fmt.Errorf("syntax error: invalid limit %q", t.text)
+		}
+		return t.text, nil
+	}
+	first, err := num()
+	if err != nil {
+		return "", err
+	}
+	if p.symbol(",") {
+		count, err := num()
+		return first + "," + count, err
+	}
+	if p.keyword("OFFSET") {
+		offset, err := num()
+		return offset + "," + first, err
+	}
+	return first, nil
+}
+
+func (s *Server) sqlInsert(p *parser) (pushes, error) {
+	if err := p.expectKeyword("INTO"); err != nil {
+		return nil, err
+	}
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	t, err := s.table(name)
+	if err != nil {
+		return nil, err
+	}
+	var columns []string
+	if p.symbol("(") {
+		for {
+			col, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			columns = append(columns, col)
+			if !p.symbol(",") {
+				break
+			}
+		}
+		if err = p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, c := range t.cols {
+			columns = append(columns, c.Name)
+		}
+	}
+	if err = p.expectKeyword("VALUES"); err != nil {
+		return nil, err
+	}
+	var rows [][]interface{}
+	for {
+		if err = p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		var row []interface{}
+		for {
+			v, err := p.literal()
+			if err != nil {
+				return nil, err
+			}
+			row = append(row, v)
+			if !p.symbol(",") {
+				break
+			}
+		}
+		if err = p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		if len(row) != len(columns) {
+			return nil, fmt.Errorf("%d values for %d columns", len(row), len(columns))
+		}
+		rows = append(rows, row)
+		if !p.symbol(",") {
+			break
+		}
+	}
+	if err = p.end(); err != nil {
+		return nil, err
+	}
+	changed, err := t.insert(columns, rows)
+	if err != nil {
+		return nil, err
+	}
+	return s.collectPushes(t, changed), nil
+}
+
+func (s *Server) sqlUpdate(p *parser) (pushes, error) {
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	t, err := s.table(name)
+	if err != nil {
+		return nil, err
+	}
+	if err = p.expectKeyword("SET"); err != nil {
+		return nil, err
+	}
+	var columns []string
+	var values []interface{}
+	for {
+		col, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expectSymbol("="); err != nil {
+			return nil, err
+		}
+		v, err := p.literal()
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, col)
+		values = append(values, v)
+		if !p.symbol(",") {
+			break
+		}
+	}
+	where, err := p.where(t)
+	if err != nil {
+		return nil, err
+	}
+	if err = p.end(); err != nil {
+		return nil, err
+	}
+	changed, err := t.update(columns, values, where)
+	if err != nil {
+		return nil, err
+	}
+	return s.collectPushes(t, changed), nil
+}
+
+func (s *Server) sqlDelete(p *parser) error {
+	if err := p.expectKeyword("FROM"); err != nil {
+		return err
+	}
+	name, err := p.ident()
+	if err != nil {
+		return err
+	}
+	t, err := s.table(name)
+	if err != nil {
+		return err
+	}
+	where, err := p.where(t)
+	if err != nil {
+		return err
+	}
+	if err = p.end(); err != nil {
+		return err
+	}
+	t.remove(where)
+	return nil
+}
+
+// where - 可选的 WHERE 子句
+func (p *parser) where(t *table) (cond, error) {
+	if !p.keyword("WHERE") {
+		return matchAll, nil
+	}
+	return p.or(t)
+}
+
+func (p *parser) or(t *table) (cond, error) {
+	left, err := p.and(t)
+	for err == nil && p.keyword("OR") {
+		var right cond
+		if right, err = p.and(t); err == nil {
+			l := left
+			left = func(row []interface{}) bool { return l(row) || right(row) }
+		}
+	}
+	return left, err
+}
+
+func (p *parser) and(t *table) (cond, error) {
+	left, err := p.not(t)
+	for err == nil && p.keyword("AND") {
+		var right cond
+		if right, err = p.not(t); err == nil {
+			l := left
+			left = func(row []interface{}) bool { return l(row) && right(row) }
+		}
+	}
+	return left, err
+}
+
+func (p *parser) not(t *table) (cond, error) {
+	if p.keyword("NOT") {
+		c, err := p.not(t)
+		if err != nil {
+			return nil, err
+		}
+		return func(row []interface{}) bool { return !c(row) }, nil
+	}
+	if p.symbol("(") {
+		c, err := p.or(t)
+		if err == nil {
+			err = p.expectSymbol(")")
+		}
+		return c, err
+	}
+	return p.predicate(t)
+}
+
+var sqlOperators = map[string]int{
+	"=": opio.OperEQ, "!=": opio.OperNE, "<>": opio.OperNE,
+	">": opio.OperGT, "<": opio.OperLT, ">=": opio.OperGE, "<=": opio.OperLE,
+}
+
+func (p *parser) predicate(t *table) (cond, error) {
+	col, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	if p.keyword("IS") {
+		oper := opio.OperEQ
+		if p.keyword("NOT") {
+			oper = opio.OperNE
+		}
+		if err = p.expectKeyword("NULL"); err != nil {
+			return nil, err
+		}
+		return t.compareCond(col, oper, nil)
+	}
+	negate := p.keyword("NOT")
+	switch {
+	case p.keyword("IN"):
+		if err = p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		var list []interface{}
+		for {
+			v, err := p.literal()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+			if !p.symbol(",") {
+				break
+			}
+		}
+		if err = p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		oper := opio.OperIn
+		if negate {
+			oper = opio.OperNotIn
+		}
+		return t.compareCond(col, oper, list)
+	case p.keyword("LIKE"):
+		v, err := p.literal()
+		if err != nil {
+			return nil, err
+		}
+		oper := opio.OperLike
+		if negate {
+			oper = opio.OperNotLike
+		}
+		return t.compareCond(col, oper, v)
+	case negate:
+		return nil, p.unexpected("IN or LIKE")
+	}
+	tok := p.peek()
+	oper, ok := sqlOperators[tok.text]
+	if tok.kind != tokSymbol || !ok {
+		return nil, p.unexpected("comparison operator")
+	}
+	p.pos++
+	v, err := p.literal()
+	if err != nil {
+		return nil, err
+	}
+	return t.compareCond(col, oper, v)
+}
@@ -0,0 +1,141 @@
+package opiotest
+
+import (
+	"fmt"
+
+	"github.com/tc252617228/opio"
+)
+
+// subscription - 一个连接上对某个表的订阅
+type subscription struct {
+	conn  *conn
+	table *table
+	key   int                      // 键列下标
+	keys  map[interface{}]struct{} // 按键列类型 normalize 之后的订阅键
+}
+
+// push - 一次待发送的订阅推送
+type push struct {
+	conn *conn
+	res  *result
+}
+
+type pushes []push
+
+// send - 发送推送，写入失败的连接由其服务协程处理
+func (ps pushes) send() {
+	for _, p := range ps {
+		_ = p.conn.reply(p.res)
+	}
+}
+
+// subscribe - 处理 Async=1 的请求：建立订阅或按 Subscribe 属性增删订阅键。
+// 订阅请求没有应答，Snapshot 为真时立即推送订阅键的当前数据，之后每次数据变化时推送变化的行。
+func (s *Server) subscribe(c *conn, r *request) {
+	s.mu.Lock()
+	p, err := s.addSubscription(c, r)
+	s.mu.Unlock()
+	if err != nil {
+		p = pushes{{conn: c, res: failed(err)}}
+	}
+	p.send()
+}
+
+// addSubscription - 调用方持有 s.mu
+func (s *Server) addSubscription(c *conn, r *request) (pushes, error) {
+	t, err := s.table(r.str(opio.PropTable))
+	if err != nil {
+		return nil, err
+	}
+	if len(r.keys) == 0 {
+		return nil, nil
+	}
+	key := t.column(r.keyColumn())
+	if key < 0 {
+		return nil, fmt.Errorf("column %s not exist in table %s", r.keyColumn(), t.name)
+	}
+	var sub *subscription
+	for _, x := range s.subs[c] {
+		if x.table == t {
+			sub = x
+		}
+	}
+	change, isChange := r.num(opio.PropSubscribe)
+	if sub == nil || !isChange {
+		sub = &subscription{conn: c, table: t, key: key, keys: make(map[interface{}]struct{})}
+		s.unsubscribe(c, t)
+		s.subs[c] = append(s.subs[c], sub)
+	}
+	added := make(map[interface{}]struct{}, len(r.keys))
+	for _, k := range r.keys {
+		v, err := normalize(t.cols[sub.key].Type, k)
+		if err != nil {
+			return nil, err
+		}
+		if isChange && change == 0 {
+			delete(sub.keys, v)
+		} else {
+			sub.keys[v] = struct{}{}
+			added[v] = struct{}{}
+		}
+	}
+	if snapshot, _ := r.num(opio.PropSnapshot); snapshot == 0 || len(added) == 0 {
+		return nil, nil
+	}
+	rows := t.match(func(row []interface{}) bool {
+		_, ok := added[row[sub.key]]
+		return ok
+	})
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return pushes{{conn: c, res: t.snapshot(rows)}}, nil
+}
+
+// unsubscribe - 删除连接 c 上对表 t 的订阅，调用方持有 s.mu
+func (s *Server) unsubscribe(c *conn, t *table) {
+	subs := s.subs[c][:0]
+	for _, x := range s.subs[c] {
+		if x.table != t {
+			subs = append(subs, x)
+		}
+	}
+	s.subs[c] = subs
+}
+
+// unsubscribeAll - 连接断开时删除其所有订阅，调用方持有 s.mu
+func (s *Server) unsubscribeAll(c *conn) {
+	delete(s.subs, c)
+}
+
+// collectPushes - 收集订阅了变化行的连接及其推送数据，调用方持有 s.mu。
+// 推送在释放 s.mu 之后由 pushes.send 发送。
+func (s *Server) collectPushes(t *table, changed [][]interface{}) pushes {
+	var ps pushes
+	for _, subs := range s.subs {
+		for _, sub := range subs {
+			if sub.table != t {
+				continue
+			}
+			var rows [][]interface{}
+			for _, row := range changed {
+				if _, ok := sub.keys[row[sub.key]]; ok {
+					rows = append(rows, row)
+				}
+			}
+			if len(rows) > 0 {
+				ps = append(ps, push{conn: sub.conn, res: t.snapshot(rows)})
+			}
+		}
+	}
+	return ps
+}
+
+// snapshot - 包含所有列的行副本，可以在释放 s.mu 之后编码
+func (t *table) snapshot(rows [][]interface{}) *result {
+	res := &result{table: t.name, cols: append([]Column(nil), t.cols...), rows: make([][]interface{}, len(rows))}
+	for i, row := range rows {
+		res.rows[i] = append([]interface{}(nil), row...)
+	}
+	return res
+}
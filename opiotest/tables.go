@@ -0,0 +1,683 @@
+package opiotest
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tc252617228/opio"
+)
+
+// Column 描述内存表的一列。
+type Column struct {
+	Name   string
+	Type   int  // 列类型，opio.Vt* 常量
+	Length int  // 定长字符串/二进制的长度，其他类型忽略
+	Key    bool // 主键列：插入主键已存在的行时替换原有的行
+}
+
+// Point 是 AddPoints 写入 Point 表的测点。
+type Point struct {
+	ID   int32
+	Name string // 测点名 (PN)，同时作为全局名称 (GN)
+	Type int8   // 测点类型 (RT)，opio.TypeAX/TypeDX/TypeI2/TypeI4/TypeR8，决定 V3 命令中数值的编码
+	Desc string // 描述 (ED)
+	Unit string // 单位 (EU)
+}
+
+// table - 内存表，行按列顺序存放经过 normalize 的值
+type table struct {
+	name string
+	cols []Column
+	key  int // 主键列下标，-1 表示没有主键
+	rows [][]interface{}
+}
+
+func (s *Server) createBuiltinTables() {
+	s.createTable("Point", []Column{
+		{Name: "ID", Type: opio.VtInt32, Key: true},
+		{Name: "PN", Type: opio.VtString},
+		{Name: "GN", Type: opio.VtString},
+		{Name: "RT", Type: opio.VtInt8},
+		{Name: "ED", Type: opio.VtString},
+		{Name: "EU", Type: opio.VtString},
+	})
+	s.createTable("Realtime", []Column{
+		{Name: "ID", Type: opio.VtInt32, Key: true},
+		{Name: "GN", Type: opio.VtString},
+		{Name: "TM", Type: opio.VtDateTime},
+		{Name: "DS", Type: opio.VtInt16},
+		{Name: "AV", Type: opio.VtDouble},
+	})
+	s.createTable("Archive", []Column{
+		{Name: "ID", Type: opio.VtInt32},
+		{Name: "GN", Type: opio.VtString},
+		{Name: "TM", Type: opio.VtDateTime},
+		{Name: "DS", Type: opio.VtInt16},
+		{Name: "AV", Type: opio.VtDouble},
+	})
+}
+
+// CreateTable 创建 (或清空并重建) 一张内存表，表名不区分大小写。
+func (s *Server) CreateTable(name string, cols ...Column) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.createTable(name, cols)
+}
+
+func (s *Server) createTable(name string, cols []Column) {
+	t := &table{name: name, cols: append([]Column(nil), cols...), key: -1}
+	for i, c := range cols {
+		if c.Key {
+			t.key = i
+			break
+		}
+	}
+	s.tables[strings.ToLower(name)] = t
+}
+
+// Insert 向内存表写入数据行 (键为列名，缺少的列为空)，订阅了这些行的客户端会收到推送。
+func (s *Server) Insert(tableName string, rows ...map[string]interface{}) error {
+	s.mu.Lock()
+	t, err := s.table(tableName)
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	changed := make([][]interface{}, 0, len(rows))
+	for _, m := range rows {
+		row := make([]interface{}, len(t.cols))
+		for name, v := range m {
+			i := t.column(name)
+			if i < 0 {
+				s.mu.Unlock()
+				return fmt.Errorf("opiotest: 表 %s 中没有列 %s", t.name, name)
+			}
+			if row[i], err = normalize(t.cols[i].Type, v); err != nil {
+				s.mu.Unlock()
+				return fmt.Errorf("opiotest: 列 %s: %w", name, err)
+			}
+		}
+		changed = append(changed, t.put(row))
+	}
+	pushes := s.collectPushes(t, changed)
+	s.mu.Unlock()
+	pushes.send()
+	return nil
+}
+
+// Rows 返回内存表当前所有行的副本 (键为列名)，用于断言客户端写入的数据。
+func (s *Server) Rows(tableName string) []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.table(tableName)
+	if err != nil {
+		return nil
+	}
+	out := make([]map[string]interface{}, len(t.rows))
+	for i, row := range t.rows {
+		m := make(map[string]interface{}, len(t.cols))
+		for j, c := range t.cols {
+			m[c.Name] = row[j]
+		}
+		out[i] = m
+	}
+	return out
+}
+
+// AddPoints 向 Point 表写入测点。
+func (s *Server) AddPoints(points ...Point) {
+	rows := make([]map[string]interface{}, len(points))
+	for i, p := range points {
+		rows[i] = map[string]interface{}{"ID": p.ID, "PN": p.Name, "GN": p.Name, "RT": p.Type, "ED": p.Desc, "EU": p.Unit}
+	}
+	_ = s.Insert("Point", rows...)
+}
+
+// SetRealtime 更新测点的实时值 (按 ID 替换 Realtime 表中的行)，订阅了这些测点的客户端会收到推送。
+func (s *Server) SetRealtime(values ...opio.Value) {
+	_ = s.Insert("Realtime", s.valueRows(values)...)
+}
+
+// AddArchive 向 Archive 表追加历史值，V3 的 ReadArchive/ReadStat 与 Request 风格的 Archive 查询都从这里读取。
+func (s *Server) AddArchive(values ...opio.Value) {
+	_ = s.Insert("Archive", s.valueRows(values)...)
+}
+
+func (s *Server) valueRows(values []opio.Value) []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rows := make([]map[string]interface{}, len(values))
+	for i, v := range values {
+		name, _ := s.point(v.ID)
+		rows[i] = map[string]interface{}{"ID": v.ID, "GN": name, "TM": time.Unix(int64(v.TM), 0), "DS": v.DS, "AV": v.AV}
+	}
+	return rows
+}
+
+// point - 测点的全局名称与类型，未知测点按 TypeR8 处理。调用方持有 s.mu
+func (s *Server) point(id int32) (string, int8) {
+	if t, err := s.table("Point"); err == nil {
+		gn, rt := t.column("GN"), t.column("RT")
+		if row := t.find(id); row != nil && gn >= 0 && rt >= 0 {
+			name, _ := row[gn].(string)
+			typ, _ := row[rt].(int8)
+			return name, typ
+		}
+	}
+	return "", opio.TypeR8
+}
+
+// table - 调用方持有 s.mu
+func (s *Server) table(name string) (*table, error) {
+	t, ok := s.tables[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("table %s not exist", name)
+	}
+	return t, nil
+}
+
+// column - 列名不区分大小写，不存在时返回 -1
+func (t *table) column(name string) int {
+	for i, c := range t.cols {
+		if strings.EqualFold(c.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// find - 按主键查找行
+func (t *table) find(key interface{}) []interface{} {
+	if t.key < 0 {
+		return nil
+	}
+	k, err := normalize(t.cols[t.key].Type, key)
+	if err != nil {
+		return nil
+	}
+	for _, row := range t.rows {
+		if compare(row[t.key], k) == 0 {
+			return row
+		}
+	}
+	return nil
+}
+
+// put - 追加一行，主键已存在时替换原有的行
+func (t *table) put(row []interface{}) []interface{} {
+	if t.key >= 0 && row[t.key] != nil {
+		for i, old := range t.rows {
+			if compare(old[t.key], row[t.key]) == 0 {
+				t.rows[i] = row
+				return row
+			}
+		}
+	}
+	t.rows = append(t.rows, row)
+	return row
+}
+
+// cond - 行过滤条件
+type cond func(row []interface{}) bool
+
+func matchAll(row []interface{}) bool { return true }
+
+// match - 返回满足条件的行
+func (t *table) match(c cond) [][]interface{} {
+	var out [][]interface{}
+	for _, row := range t.rows {
+		if c(row) {
+			out = append(out, row)
+		}
+	}
+	return out
+}
+
+// remove - 删除满足条件的行，返回删除的行数
+func (t *table) remove(c cond) int {
+	kept := t.rows[:0]
+	for _, row := range t.rows {
+		if !c(row) {
+			kept = append(kept, row)
+		}
+	}
+	n := len(t.rows) - len(kept)
+	for i := len(kept); i < len(t.rows); i++ {
+		t.rows[i] = nil
+	}
+	t.rows = kept
+	return n
+}
+
+// compareCond - 列与字面值比较的条件，oper 为 opio.Oper* 常量；OperIn/OperNotIn 的 right 为 []interface{}
+func (t *table) compareCond(column string, oper int, right interface{}) (cond, error) {
+	i := t.column(column)
+	if i < 0 {
+		return nil, fmt.Errorf("column %s not exist in table %s", column, t.name)
+	}
+	typ := t.cols[i].Type
+	switch oper {
+	case opio.OperIn, opio.OperNotIn:
+		list, _ := right.([]interface{})
+		set := make([]interface{}, 0, len(list))
+		for _, v := range list {
+			n, err := normalize(typ, v)
+			if err != nil {
+				return nil, err
+			}
+			set = append(set, n)
+		}
+		in := oper == opio.OperIn
+		return func(row []interface{}) bool {
+			for _, v := range set {
+				if compare(row[i], v) == 0 {
+					return in
+				}
+			}
+			return !in
+		}, nil
+	case opio.OperLike, opio.OperNotLike, opio.OperReqexp:
+		pattern := fmt.Sprint(right)
+		if oper != opio.OperReqexp {
+			pattern = likePattern(pattern)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		want := oper != opio.OperNotLike
+		return func(row []interface{}) bool {
+			return row[i] != nil && re.MatchString(fmt.Sprint(row[i])) == want
+		}, nil
+	}
+	v, err := normalize(typ, right)
+	if err != nil {
+		return nil, err
+	}
+	return func(row []interface{}) bool {
+		if row[i] == nil || v == nil {
+			// 与空值比较只有 = NULL 与 != NULL 有意义
+			eq := row[i] == nil && v == nil
+			return (oper == opio.OperEQ && eq) || (oper == opio.OperNE && !eq)
+		}
+		r := compare(row[i], v)
+		switch oper {
+		case opio.OperEQ:
+			return r == 0
+		case opio.OperNE:
+			return r != 0
+		case opio.OperGT:
+			return r > 0
+		case opio.OperLT:
+			return r < 0
+		case opio.OperGE:
+			return r >= 0
+		case opio.OperLE:
+			return r <= 0
+		}
+		return false
+	}, nil
+}
+
+// likePattern - 把 SQL LIKE 模式 (% 与 _) 转为正则表达式
+func likePattern(p string) string {
+	var b strings.Builder
+	b.WriteString("(?is)^")
+	for _, r := range p {
+		switch r {
+		case '%':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// filterCond - Request 的 Filters 属性：依次按每个条件的 Relation 与下一个条件组合
+func (t *table) filterCond(filters []opio.Filter) (cond, error) {
+	if len(filters) == 0 {
+		return matchAll, nil
+	}
+	conds := make([]cond, len(filters))
+	for i, f := range filters {
+		var right interface{} = unquote(f.Right)
+		if f.Operator == opio.OperIn || f.Operator == opio.OperNotIn {
+			parts, err := splitList(f.Right)
+			if err != nil {
+				return nil, err
+			}
+			list := make([]interface{}, len(parts))
+			for j, p := range parts {
+				list[j] = p
+			}
+			right = list
+		}
+		c, err := t.compareCond(f.Left, int(f.Operator), right)
+		if err != nil {
+			return nil, err
+		}
+		conds[i] = c
+	}
+	return func(row []interface{}) bool {
+		ok := conds[0](row)
+		for i := 1; i < len(conds); i++ {
+			if filters[i-1].Relation == opio.RelationOr {
+				ok = ok || conds[i](row)
+			} else {
+				ok = ok && conds[i](row)
+			}
+		}
+		return ok
+	}, nil
+}
+
+// unquote - 过滤条件的右值可以是带单引号的 SQL 字符串 (例如 opio.Where 生成的条件)，也可以是不加引号的值
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+	}
+	return s
+}
+
+// splitList - 拆分 IN/NOT IN 条件的值列表 (例如 a, 'b,c')：逗号分隔，单引号内的逗号不拆分，引号内连续两个单引号表示一个单引号
+func splitList(s string) ([]string, error) {
+	var list []string
+	var b strings.Builder
+	quoted := false // 当前值带引号
+	in := false     // 位于引号内
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case in && ch == '\'':
+			if i+1 < len(s) && s[i+1] == '\'' {
+				b.WriteByte('\'')
+				i++
+			} else {
+				in = false
+			}
+		case in:
+			b.WriteByte(ch)
+		case ch == '\'' && strings.TrimSpace(b.String()) == "" && !quoted:
+			b.Reset()
+			in, quoted = true, true
+		case ch == ',':
+			list = append(list, listItem(b.String(), quoted))
+			b.Reset()
+			quoted = false
+		case quoted:
+			// 引号之后到逗号之前只允许空白
+			if ch != ' ' && ch != '\t' {
+				return nil, fmt.Errorf("invalid IN list %q", s)
+			}
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	if in {
+		return nil, fmt.Errorf("unterminated string in IN list %q", s)
+	}
+	return append(list, listItem(b.String(), quoted)), nil
+}
+
+func listItem(s string, quoted bool) string {
+	if quoted {
+		return s
+	}
+	return strings.TrimSpace(s)
+}
+
+// sortRows - 按 "列 [ASC|DESC][, 列 [ASC|DESC]]" 排序
+func (t *table) sortRows(rows [][]interface{}, orderBy string) error {
+	type key struct {
+		col  int
+		desc bool
+	}
+	var keys []key
+	for _, part := range strings.Split(orderBy, ",") {
+		f := strings.Fields(part)
+		if len(f) == 0 {
+			continue
+		}
+		i := t.column(f[0])
+		if i < 0 {
+			return fmt.Errorf("column %s not exist in table %s", f[0], t.name)
+		}
+		keys = append(keys, key{i, len(f) > 1 && strings.EqualFold(f[1], "desc")})
+	}
+	sort.SliceStable(rows, func(a, b int) bool {
+		for _, k := range keys {
+			if r := compare(rows[a][k.col], rows[b][k.col]); r != 0 {
+				return (r < 0) != k.desc
+			}
+		}
+		return false
+	})
+	return nil
+}
+
+// limitRows - 按 "[offset,] count" 分页
+func limitRows(rows [][]interface{}, limit string) ([][]interface{}, error) {
+	if strings.TrimSpace(limit) == "" {
+		return rows, nil
+	}
+	parts := strings.Split(limit, ",")
+	nums := make([]int, len(parts))
+	for i, p := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || n < 0 || len(parts) > 2 {
+			return nil, fmt.Errorf("invalid limit %q", limit)
+		}
+		nums[i] = n
+	}
+	offset, count := 0, nums[0]
+	if len(nums) == 2 {
+		offset, count = nums[0], nums[1]
+	}
+	if offset > len(rows) {
+		offset = len(rows)
+	}
+	rows = rows[offset:]
+	if count < len(rows) {
+		rows = rows[:count]
+	}
+	return rows, nil
+}
+
+// normalize - 把值转换为列类型对应的 Go 类型：整数列为 int8/int16/int32/int64，
+// VtFloat 为 float32，VtDouble 为 float64，VtDateTime 为 time.Time (数值按 Unix 秒)，
+// VtString 为 string，VtBinary 为 []byte。字符串会按列类型解析。nil 表示空值。
+func normalize(typ int, v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	switch typ {
+	case opio.VtBool:
+		switch x := v.(type) {
+		case bool:
+			return x, nil
+		case string:
+			return strconv.ParseBool(x)
+		}
+		f, err := toFloat(v)
+		return f != 0, err
+	case opio.VtInt8, opio.VtInt16, opio.VtInt32, opio.VtInt64:
+		var n int64
+		switch x := v.(type) {
+		case string:
+			i, err := strconv.ParseInt(strings.TrimSpace(x), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid integer %q", x)
+			}
+			n = i
+		case time.Time:
+			n = x.Unix()
+		default:
+			f, err := toFloat(v)
+			if err != nil {
+				return nil, err
+			}
+			n = int64(f)
+			if i, ok := v.(int64); ok { // 避免大整数经 float64 损失精度
+				n = i
+			}
+		}
+		switch typ {
+		case opio.VtInt8:
+			return int8(n), nil
+		case opio.VtInt16:
+			return int16(n), nil
+		case opio.VtInt32:
+			return int32(n), nil
+		}
+		return n, nil
+	case opio.VtFloat, opio.VtDouble:
+		var f float64
+		if s, ok := v.(string); ok {
+			x, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q", s)
+			}
+			f = x
+		} else {
+			x, err := toFloat(v)
+			if err != nil {
+				return nil, err
+			}
+			f = x
+		}
+		if typ == opio.VtFloat {
+			return float32(f), nil
+		}
+		return f, nil
+	case opio.VtDateTime:
+		switch x := v.(type) {
+		case time.Time:
+			return x, nil
+		case string:
+			for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05Z07:00", "2006-01-02"} {
+				if tm, err := time.ParseInLocation(layout, x, time.Local); err == nil {
+					return tm, nil
+				}
+			}
+			if f, err := strconv.ParseFloat(x, 64); err == nil {
+				return unixTime(f), nil
+			}
+			return nil, fmt.Errorf("invalid datetime %q", x)
+		}
+		f, err := toFloat(v)
+		return unixTime(f), err
+	case opio.VtString:
+		switch x := v.(type) {
+		case string:
+			return x, nil
+		case []byte:
+			return string(x), nil
+		}
+		return fmt.Sprint(v), nil
+	case opio.VtBinary:
+		switch x := v.(type) {
+		case []byte:
+			return x, nil
+		case string:
+			return []byte(x), nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported value %T for column type %d", v, typ)
+}
+
+func unixTime(f float64) time.Time {
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(frac*1e9))
+}
+
+func toFloat(v interface{}) (float64, error) {
+	switch x := v.(type) {
+	case bool:
+		if x {
+			return 1, nil
+		}
+		return 0, nil
+	case int:
+		return float64(x), nil
+	case int8:
+		return float64(x), nil
+	case int16:
+		return float64(x), nil
+	case int32:
+		return float64(x), nil
+	case int64:
+		return float64(x), nil
+	case uint:
+		return float64(x), nil
+	case uint8:
+		return float64(x), nil
+	case uint16:
+		return float64(x), nil
+	case uint32:
+		return float64(x), nil
+	case uint64:
+		return float64(x), nil
+	case float32:
+		return float64(x), nil
+	case float64:
+		return x, nil
+	}
+	return 0, fmt.Errorf("not a number: %T", v)
+}
+
+// compare - 比较两个经过 normalize 的同类型值，空值最小
+func compare(a, b interface{}) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return -1
+		}
+		return 1
+	}
+	switch x := a.(type) {
+	case string:
+		return strings.Compare(x, fmt.Sprint(b))
+	case []byte:
+		y, _ := b.([]byte)
+		return strings.Compare(string(x), string(y))
+	case time.Time:
+		y, _ := b.(time.Time)
+		switch {
+		case x.Before(y):
+			return -1
+		case x.After(y):
+			return 1
+		}
+		return 0
+	case int64:
+		if y, ok := b.(int64); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	fa, _ := toFloat(a)
+	fb, _ := toFloat(b)
+	switch {
+	case fa < fb:
+		return -1
+	case fa > fb:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,388 @@
+package opiotest
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/tc252617228/opio"
+	"github.com/tc252617228/opio/internal/utils"
+)
+
+// V3 二进制命令，与 opio 的 api_v3.go 对应
+const (
+	cmdSelect  int32 = 110
+	cmdInsert  int32 = 130
+	urlDynamic int32 = 0x23000000
+	urlArchive int32 = 0x30000000
+)
+
+// sample - 一个历史值
+type sample struct {
+	tm int32
+	ds int16
+	av float64
+}
+
+// serveV3 - 处理以 MAGIC 开头的二进制命令
+func (c *conn) serveV3() error {
+	in := c.in
+	_, _ = in.GetInt32() // MAGIC
+	cmd, _ := in.GetInt32()
+	url, err := in.GetInt32()
+	if err != nil {
+		return err
+	}
+	switch {
+	case cmd == cmdSelect && url == urlDynamic:
+		return c.readRealtime()
+	case cmd == cmdInsert && url == urlDynamic:
+		return c.writeRealtime()
+	case cmd == cmdSelect && url == urlArchive:
+		return c.readArchive()
+	case cmd == cmdInsert && url == urlArchive:
+		return c.writeArchive()
+	}
+	return fmt.Errorf("unsupported command %d, url %#x", cmd, url)
+}
+
+// echo - 写入类命令的应答：一个未分帧的字节，0 表示成功
+func (c *conn) echo(code int8) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return c.out.DirectWrite([]byte{byte(code)})
+}
+
+func (c *conn) readRealtime() error {
+	in := c.in
+	_, _ = in.GetInt16()
+	_, _ = in.GetInt16()
+	count, err := in.GetInt32()
+	ids := make([]int32, 0, count)
+	for i := int32(0); i < count && err == nil; i++ {
+		var id int32
+		if id, err = in.GetInt32(); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	s := c.srv
+	s.mu.Lock()
+	values := make([]*opio.Value, len(ids))
+	if t, e := s.table("Realtime"); e == nil {
+		for i, id := range ids {
+			if row := t.find(id); row != nil {
+				_, rt := s.point(id)
+				v := &opio.Value{ID: id, RT: rt}
+				v.TM, v.DS, v.AV = t.sample(row)
+				values[i] = v
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	out := c.out
+	_ = out.PutInt32(opio.MAGIC)
+	_ = out.PutInt32(0)
+	_ = out.PutInt32(int32(len(values)))
+	for _, v := range values {
+		if v == nil {
+			// 没有实时值的测点
+			_ = out.PutInt8(-1)
+			_ = out.PutInt32(errnoFailed)
+			continue
+		}
+		_ = out.PutInt8(v.RT)
+		putValue(out, v.RT, sample{v.TM, v.DS, v.AV})
+	}
+	_ = out.PutInt32(opio.MAGIC)
+	return out.Flush(true)
+}
+
+func (c *conn) writeRealtime() error {
+	in := c.in
+	_, _ = in.GetInt16()
+	_, _ = in.GetInt16() // flag
+	count, _ := in.GetInt32()
+	_, err := in.GetInt8() // 值类型，固定为 TypeR8
+	values := make([]opio.Value, 0, count)
+	for i := int32(0); i < count && err == nil; i++ {
+		var v opio.Value
+		v.ID, _ = in.GetInt32()
+		v.TM, _ = in.GetInt32()
+		v.DS, _ = in.GetInt16()
+		if v.AV, err = in.GetFloat64(); err == nil {
+			values = append(values, v)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	c.srv.SetRealtime(values...)
+	return c.echo(0)
+}
+
+func (c *conn) writeArchive() error {
+	in := c.in
+	_, _ = in.GetInt16()
+	_, _ = in.GetInt16() // flag
+	count, err := in.GetInt32()
+	var values []opio.Value
+	for i := int32(0); i < count && err == nil; i++ {
+		id, _ := in.GetInt32()
+		typ, _ := in.GetInt8()
+		var n int32
+		n, err = in.GetInt32()
+		for j := int32(0); j < n && err == nil; j++ {
+			var v sample
+			if v, err = getValue(in, typ); err == nil {
+				values = append(values, opio.Value{ID: id, RT: typ, TM: v.tm, DS: v.ds, AV: v.av})
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	c.srv.AddArchive(values...)
+	return c.echo(0)
+}
+
+// archiveQuery - ArchiveQuery 中一个测点的查询条件
+type archiveQuery struct {
+	id, mode, begin, end, interval int32
+}
+
+func (c *conn) readArchive() error {
+	in := c.in
+	_, _ = in.GetInt32()
+	count, err := in.GetInt32()
+	queries := make([]archiveQuery, 0, count)
+	for i := int32(0); i < count && err == nil; i++ {
+		var q archiveQuery
+		q.id, _ = in.GetInt32()
+		q.mode, _ = in.GetInt32()
+		_, _ = in.GetInt32()
+		q.begin, _ = in.GetInt32()
+		q.end, _ = in.GetInt32()
+		if q.interval, err = in.GetInt32(); err == nil {
+			queries = append(queries, q)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	s := c.srv
+	s.mu.Lock()
+	types := make([]int8, len(queries))
+	data := make([][]sample, len(queries))
+	t, _ := s.table("Archive")
+	for i, q := range queries {
+		_, types[i] = s.point(q.id)
+		if t != nil {
+			data[i] = t.samples(q.id, q.begin, q.end)
+		}
+	}
+	s.mu.Unlock()
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	out := c.out
+	_ = out.PutInt32(opio.MAGIC)
+	_ = out.PutInt32(0)
+	_ = out.PutInt32(int32(len(queries)))
+	for i, q := range queries {
+		_ = out.PutInt8(1)
+		_ = out.PutInt32(int32(i))
+		_ = out.PutInt8(types[i])
+		if q.mode&opio.ModeStatMask != 0 {
+			stats := statistics(data[i], q)
+			_ = out.PutInt32(int32(len(stats)))
+			for _, v := range stats {
+				putStat(out, q.mode, v)
+			}
+			continue
+		}
+		values := data[i]
+		if q.mode == opio.ModeSpan && q.interval > 0 {
+			values = span(values, q)
+		}
+		_ = out.PutInt32(int32(len(values)))
+		for _, v := range values {
+			putValue(out, types[i], v)
+		}
+	}
+	_ = out.PutInt8(0)
+	_ = out.PutInt32(opio.MAGIC)
+	return out.Flush(true)
+}
+
+// sample - 取 Realtime/Archive 行中的 TM、DS、AV
+func (t *table) sample(row []interface{}) (tm int32, ds int16, av float64) {
+	if i := t.column("TM"); i >= 0 {
+		if x, ok := row[i].(time.Time); ok {
+			tm = int32(x.Unix())
+		}
+	}
+	if i := t.column("DS"); i >= 0 {
+		ds, _ = row[i].(int16)
+	}
+	if i := t.column("AV"); i >= 0 {
+		av, _ = toFloat(row[i])
+	}
+	return tm, ds, av
+}
+
+// samples - 测点在 [begin, end] 内按时间排序的历史值，调用方持有 s.mu
+func (t *table) samples(id, begin, end int32) []sample {
+	key := t.column("ID")
+	if key < 0 {
+		return nil
+	}
+	var out []sample
+	for _, row := range t.rows {
+		if x, ok := row[key].(int32); !ok || x != id {
+			continue
+		}
+		var v sample
+		v.tm, v.ds, v.av = t.sample(row)
+		if v.tm >= begin && v.tm <= end {
+			out = append(out, v)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].tm < out[j].tm })
+	return out
+}
+
+// span - 等间距值：每个时刻取不晚于该时刻的最后一个历史值
+func span(values []sample, q archiveQuery) []sample {
+	var out []sample
+	j := -1
+	for tm := q.begin; tm <= q.end; tm += q.interval {
+		for j+1 < len(values) && values[j+1].tm <= tm {
+			j++
+		}
+		if j >= 0 {
+			out = append(out, sample{tm: tm, ds: values[j].ds, av: values[j].av})
+		}
+	}
+	return out
+}
+
+// statistics - 按 interval 划分时间窗口 (interval<=0 时整个时间段为一个窗口) 统计原始值，跳过没有数据的窗口。
+// 模拟服务端不做时间加权：Avg 与 Mean 都是算术平均，Flow 为 Avg 乘以窗口秒数。
+func statistics(values []sample, q archiveQuery) []opio.StatVal {
+	window := q.interval
+	if window <= 0 {
+		window = q.end - q.begin + 1
+	}
+	var out []opio.StatVal
+	j := 0
+	for start := q.begin; start <= q.end; start += window {
+		var v opio.StatVal
+		n := 0
+		for ; j < len(values) && values[j].tm < start+window; j++ {
+			x := values[j]
+			if n == 0 || x.av > v.Max {
+				v.Max, v.MaxTime = x.av, x.tm
+			}
+			if n == 0 || x.av < v.Min {
+				v.Min, v.MinTime = x.av, x.tm
+			}
+			v.Sum += x.av
+			n++
+		}
+		if n == 0 {
+			continue
+		}
+		v.Time = start
+		v.Mean = v.Sum / float64(n)
+		v.Avg = v.Mean
+		v.Flow = v.Avg * float64(window)
+		out = append(out, v)
+	}
+	return out
+}
+
+func putValue(out *utils.Buffer, typ int8, v sample) {
+	_ = out.PutInt32(v.tm)
+	_ = out.PutInt16(v.ds)
+	switch typ & 15 {
+	case opio.TypeAX:
+		_ = out.PutFloat32(float32(v.av))
+	case opio.TypeDX:
+		_ = out.PutInt8(int8(v.av))
+	case opio.TypeI2:
+		_ = out.PutInt16(int16(v.av))
+	case opio.TypeI4:
+		_ = out.PutInt32(int32(v.av))
+	default:
+		_ = out.PutFloat64(v.av)
+	}
+}
+
+func getValue(in *utils.Buffer, typ int8) (v sample, err error) {
+	v.tm, _ = in.GetInt32()
+	v.ds, _ = in.GetInt16()
+	switch typ & 15 {
+	case opio.TypeAX:
+		var f float32
+		f, err = in.GetFloat32()
+		v.av = float64(f)
+	case opio.TypeDX:
+		var i int8
+		i, err = in.GetInt8()
+		v.av = float64(i)
+	case opio.TypeI2:
+		var i int16
+		i, err = in.GetInt16()
+		v.av = float64(i)
+	case opio.TypeI4:
+		var i int32
+		i, err = in.GetInt32()
+		v.av = float64(i)
+	default:
+		v.av, err = in.GetFloat64()
+	}
+	return v, err
+}
+
+// putStat - 与 opio.StatVal.Read 对应，ModeStat 为 62 字节的完整统计值
+func putStat(out *utils.Buffer, mode int32, v opio.StatVal) {
+	switch mode {
+	case opio.ModeFlow, opio.ModeMax, opio.ModeMin, opio.ModeAvg, opio.ModeMean, opio.ModeSum, opio.ModeStat:
+	default:
+		// opio.StatVal.Read 不读取未知统计模式的数据
+		return
+	}
+	_ = out.PutInt32(v.Time)
+	_ = out.PutInt16(v.Status)
+	switch mode {
+	case opio.ModeFlow:
+		_ = out.PutFloat64(v.Flow)
+	case opio.ModeMax:
+		_ = out.PutFloat64(v.Max)
+	case opio.ModeMin:
+		_ = out.PutFloat64(v.Min)
+	case opio.ModeAvg:
+		_ = out.PutFloat64(v.Avg)
+	case opio.ModeMean:
+		_ = out.PutFloat64(v.Mean)
+	case opio.ModeSum:
+		_ = out.PutFloat64(v.Sum)
+	case opio.ModeStat:
+		_ = out.PutFloat64(v.Flow)
+		_ = out.PutFloat64(v.Max)
+		_ = out.PutFloat64(v.Min)
+		_ = out.PutInt32(v.MaxTime)
+		_ = out.PutInt32(v.MinTime)
+		_ = out.PutFloat64(v.Avg)
+		_ = out.PutFloat64(v.Mean)
+		_ = out.PutFloat64(v.Sum)
+	}
+}
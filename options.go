@@ -0,0 +1,115 @@
+package opio
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+
+	"github.com/tc252617228/opio/internal/utils"
+)
+
+// Dialer 建立到 OpenPlant 服务的底层连接。
+// *net.Dialer、golang.org/x/net/proxy 提供的 SOCKS5 ContextDialer 等都满足该接口。
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// DialerFunc 允许把普通函数用作 Dialer，例如连接 unix socket 或返回 net.Pipe 的一端。
+type DialerFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// DialContext 调用 f(ctx, network, address)。
+func (f DialerFunc) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return f(ctx, network, address)
+}
+
+// ConnectOption 配置建立连接的方式 (底层拨号器、TLS 等)，用于 Connect 与 InitContext。
+// 无论使用哪种传输方式，登录握手都在建立好的连接上照常进行。
+type ConnectOption func(*connectOptions)
+
+type connectOptions struct {
+	dialer      Dialer
+	tlsConfig   *tls.Config
+	bufferSize  int
+	traffic     *utils.TrafficCounter // 新建连接同时把收发流量累加到这里 (Client 内部使用)
+	failover    *FailoverConfig       // 备用端点，见 WithFailover
+	auth        Authenticator         // 登录认证方式，nil 时使用 credentials 或 Connect 传入的用户名与口令
+	credentials CredentialProvider    // 每个新连接登录前获取凭据，见 WithCredentials
+	tracer      Tracer                // 跟踪收发的帧与属性表，见 WithTracer
+}
+
+// WithDialer 使用自定义的 Dialer 建立底层连接，拨号时传入的 network 为 "tcp"，address 为 "host:port"。
+// 例如通过 SOCKS 跳板机拨号，或忽略地址直接连接 unix socket。
+func WithDialer(d Dialer) ConnectOption {
+	return func(o *connectOptions) {
+		o.dialer = d
+	}
+}
+
+// WithTLS 在底层连接建立后进行 TLS 握手 (例如连接 stunnel 一类的加密终结器)。
+// cfg.ServerName 为空且未设置 InsecureSkipVerify 时，使用连接的主机名校验证书。
+func WithTLS(cfg *tls.Config) ConnectOption {
+	return func(o *connectOptions) {
+		o.tlsConfig = cfg
+	}
+}
+
+// WithBufferSize 设置每个连接的读写缓冲区大小 (字节)，即单个网络帧的最大长度，
+// 不能超过协议允许的 65536 字节。默认为 65536。
+func WithBufferSize(size int) ConnectOption {
+	return func(o *connectOptions) {
+		o.bufferSize = size
+	}
+}
+
+func newConnectOptions(opts []ConnectOption) connectOptions {
+	var o connectOptions
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	return o
+}
+
+// validate - 检查互相冲突的选项
+func (o connectOptions) validate() error {
+	if o.auth != nil && o.credentials != nil {
+		return errors.New("opio: WithAuthenticator and WithCredentials cannot be used together, pass the CredentialProvider to the Authenticator instead")
+	}
+	return nil
+}
+
+func (o connectOptions) bufSize() int {
+	if o.bufferSize <= 0 || o.bufferSize > max_buffer_size {
+		return max_buffer_size
+	}
+	return o.bufferSize
+}
+
+// dial - 按选项建立底层连接，TLS 握手失败时返回 PhaseTLS 阶段的 *ConnectError
+func (o connectOptions) dial(ctx context.Context, host string, addr string) (net.Conn, error) {
+	dialer := o.dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, newConnectError(ctx, PhaseDial, addr, err)
+	}
+	if o.tlsConfig == nil {
+		return conn, nil
+	}
+
+	cfg := o.tlsConfig
+	if cfg.ServerName == "" && !cfg.InsecureSkipVerify {
+		cfg = cfg.Clone()
+		cfg.ServerName = host
+	}
+	tlsConn := tls.Client(conn, cfg)
+	if err = tlsConn.HandshakeContext(ctx); err != nil {
+		_ = conn.Close()
+		return nil, newConnectError(ctx, PhaseTLS, addr, err)
+	}
+	return tlsConn, nil
+}
@@ -0,0 +1,121 @@
+package opio_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tc252617228/opio"
+)
+
+// selfSignedCert 生成一个 127.0.0.1 的自签名证书，返回服务端证书和信任它的根证书池
+func selfSignedCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "opio test"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, roots
+}
+
+// serveOK 完成登录后对每个请求回复 okResponse
+func serveOK(conn net.Conn) {
+	defer conn.Close()
+	if fakeLogin(conn) != nil {
+		return
+	}
+	for {
+		if _, err := readMessage(conn); err != nil {
+			return
+		}
+		if writeFrame(conn, okResponse) != nil {
+			return
+		}
+	}
+}
+
+func TestConnectWithTLS(t *testing.T) {
+	cert, roots := selfSignedCert(t)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveOK(conn)
+		}
+	}()
+	host, portStr, _ := net.SplitHostPort(ln.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	client, err := opio.Connect(context.Background(), host, port, "sis", "openplant", time.Second,
+		opio.WithTLS(&tls.Config{RootCAs: roots}))
+	require.NoError(t, err)
+	defer client.Close()
+	_, err = client.ExecSQL(context.Background(), "SELECT 1")
+	assert.NoError(t, err)
+
+	// 不信任服务端证书时在 TLS 阶段失败
+	_, err = opio.Connect(context.Background(), host, port, "sis", "openplant", time.Second,
+		opio.WithTLS(&tls.Config{}))
+	var ce *opio.ConnectError
+	require.ErrorAs(t, err, &ce)
+	assert.Equal(t, opio.PhaseTLS, ce.Phase)
+}
+
+func TestConnectWithPipeDialer(t *testing.T) {
+	var dials int32
+	dialer := opio.DialerFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+		atomic.AddInt32(&dials, 1)
+		client, server := net.Pipe()
+		go serveOK(server)
+		return client, nil
+	})
+
+	client, err := opio.Connect(context.Background(), "plant", 8200, "sis", "openplant", time.Second,
+		opio.WithDialer(dialer))
+	require.NoError(t, err)
+	defer client.Close()
+	_, err = client.ExecSQL(context.Background(), "SELECT 1")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&dials))
+}
+
+func TestInitConnContextLogsIn(t *testing.T) {
+	local, remote := net.Pipe()
+	go serveOK(remote)
+	op, err := opio.InitConnContext(context.Background(), local, "sis", "openplant")
+	require.NoError(t, err)
+	assert.False(t, op.Broken())
+	assert.NoError(t, op.Close())
+}
@@ -0,0 +1,274 @@
+package opio
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidPagination 表示 Paginate 的参数无效 (页大小、键列) 或与 QueryOptions 冲突。
+	ErrInvalidPagination = errors.New("opio: invalid pagination")
+	// ErrInvalidPageToken 表示页令牌无法解码，或者不是由同一个查询 (表、键列、过滤条件) 生成的。
+	ErrInvalidPageToken = errors.New("opio: invalid page token")
+)
+
+// Pager 按键列分页读取一张表，由 Client.Paginate 创建。每一页是一次独立的查询
+// (过滤条件 AND 键列 > 上一页最后一行的键，按键列升序，LIMIT 页大小)，
+// 因此翻页的代价与页码无关，并发插入的行也不会导致跳过或重复已读的行。
+//
+// 用法:
+//
+//	pager := client.Paginate(ctx, "Point", []string{"ID", "GN"}, opts, 1000, "ID")
+//	if err := pager.Resume(r.URL.Query().Get("page")); err != nil { ... } // 可选：从令牌继续
+//	for pager.Next() {
+//	    res := pager.Page()
+//	    next := pager.Token() // 交给 HTTP 客户端，用于请求下一页，最后一页为 ""
+//	}
+//	if err := pager.Err(); err != nil { ... }
+//
+// Pager 不能在多个 goroutine 中并发使用。
+type Pager struct {
+	c         *Client
+	ctx       context.Context
+	table     string
+	columns   []string
+	opts      *QueryOptions
+	filters   []Filter
+	pageSize  int
+	keyColumn string
+	query     string // 查询的摘要，写入令牌以拒绝其他查询的令牌
+
+	after *pageKey // 下一页从这个键之后开始，nil 表示从头开始
+	page  *QueryResult
+	done  bool
+	err   error
+}
+
+// pageKey - 页令牌的内容：查询摘要与最后一行的键 (带类型，解码后重新渲染，令牌中不含 SQL 文本)
+type pageKey struct {
+	Query string `json:"q"`
+	Type  string `json:"t"` // i 整数, u 无符号整数, f 浮点数, s 字符串, d 时间 (RFC 3339)
+	Value string `json:"v"`
+}
+
+// Paginate 返回按 keyColumn 分页读取 tableName 的 Pager，每页最多 pageSize 行。
+// keyColumn 的值必须在表中唯一 (例如 ID)，类型为整数、浮点数、字符串或时间。
+// opts 的 Filters/Where 与 DB 作用于每一页，过滤条件之间只能是 AND 关系；opts.OrderBy 与 opts.Limit 由分页决定，
+// 必须为空。columns 中没有 keyColumn 时会自动加上。参数无效时 Next 返回 false，Err 返回 ErrInvalidPagination
+// (过滤条件无效时为 ErrInvalidFilter)。
+// 客户端的默认超时分别作用于每一页的查询。
+func (c *Client) Paginate(ctx context.Context, tableName string, columns []string, opts *QueryOptions, pageSize int, keyColumn string) *Pager {
+	p := &Pager{c: c, ctx: ctx, table: tableName, opts: opts, pageSize: pageSize, keyColumn: keyColumn}
+	p.err = p.init(columns)
+	return p
+}
+
+func (p *Pager) init(columns []string) error {
+	if p.pageSize <= 0 {
+		return fmt.Errorf("%w: 页大小必须大于 0，得到 %d", ErrInvalidPagination, p.pageSize)
+	}
+	if !validIdent(p.keyColumn) {
+		return fmt.Errorf("%w: 无效的键列 %q", ErrInvalidPagination, p.keyColumn)
+	}
+	if p.opts != nil && (p.opts.OrderBy != "" || p.opts.Limit != "") {
+		return fmt.Errorf("%w: OrderBy 与 Limit 由分页决定，不能在 QueryOptions 中设置", ErrInvalidPagination)
+	}
+	filters, err := p.opts.filters()
+	if err != nil {
+		return err
+	}
+	for i := 0; i+1 < len(filters); i++ {
+		if filters[i].Relation == RelationOr {
+			return fmt.Errorf("%w: 过滤条件包含 OR，无法与键列条件组合", ErrInvalidPagination)
+		}
+	}
+	p.filters = filters
+
+	p.columns = columns
+	if len(columns) > 0 && !(len(columns) == 1 && columns[0] == "*") {
+		found := false
+		for _, col := range columns {
+			found = found || strings.EqualFold(col, p.keyColumn)
+		}
+		if !found {
+			p.columns = append(append([]string(nil), columns...), p.keyColumn)
+		}
+	}
+
+	// 查询摘要: 表、键列、数据库与过滤条件
+	h := sha256.New()
+	db := ""
+	if p.opts != nil {
+		db = p.opts.DB
+	}
+	fmt.Fprintf(h, "%s\x00%s\x00%s", strings.ToLower(p.table), strings.ToLower(p.keyColumn), db)
+	for _, f := range filters {
+		fmt.Fprintf(h, "\x00%s %d %s %d", f.Left, f.Operator, f.Right, f.Relation)
+	}
+	p.query = base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:12])
+	return nil
+}
+
+// Resume 从 Token 返回的令牌继续分页，下一次 Next 读取令牌之后的一页。空令牌表示从头开始。
+// 令牌无法解码或属于其他查询时返回 ErrInvalidPageToken。
+func (p *Pager) Resume(token string) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.page, p.done = nil, false
+	if token == "" {
+		p.after = nil
+		return nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPageToken, err)
+	}
+	var key pageKey
+	if err = json.Unmarshal(raw, &key); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPageToken, err)
+	}
+	if key.Query != p.query {
+		return fmt.Errorf("%w: 令牌不属于这个查询", ErrInvalidPageToken)
+	}
+	if _, err = key.literal(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPageToken, err)
+	}
+	p.after = &key
+	return nil
+}
+
+// Next 读取下一页。没有更多的页或出错时返回 false，出错原因由 Err 返回。
+func (p *Pager) Next() bool {
+	p.page = nil
+	if p.err != nil || p.done {
+		return false
+	}
+	filters := append([]Filter(nil), p.filters...)
+	if p.after != nil {
+		lit, err := p.after.literal()
+		if err != nil {
+			p.err = fmt.Errorf("%w: 键列 %s: %v", ErrInvalidPagination, p.keyColumn, err)
+			return false
+		}
+		if n := len(filters); n > 0 {
+			filters[n-1].Relation = RelationAnd
+		}
+		filters = append(filters, Filter{Left: p.keyColumn, Operator: OperGT, Right: lit, Relation: RelationAnd})
+	}
+	opts := &QueryOptions{Filters: filters, OrderBy: p.keyColumn + " ASC", Limit: strconv.Itoa(p.pageSize)}
+	if p.opts != nil {
+		opts.DB = p.opts.DB
+	}
+	res, err := p.c.Query(p.ctx, p.table, p.columns, opts)
+	if err != nil {
+		p.err = fmt.Errorf("opio.Pager.Next: %w", err)
+		return false
+	}
+	if len(res.Rows) < p.pageSize {
+		p.done = true
+	}
+	if len(res.Rows) == 0 {
+		return false
+	}
+	if len(res.Rows) > p.pageSize {
+		// 服务端忽略了 Limit 时，多出的行留给下一页
+		res.Rows = res.Rows[:p.pageSize]
+	}
+	key, err := p.keyOf(res.Rows[len(res.Rows)-1])
+	if err != nil {
+		p.err = err
+		return false
+	}
+	p.after = key
+	p.page = res
+	return true
+}
+
+// keyOf - 从行中取出键列的值
+func (p *Pager) keyOf(row map[string]interface{}) (*pageKey, error) {
+	v, ok := row[p.keyColumn]
+	if !ok {
+		for name, value := range row {
+			if strings.EqualFold(name, p.keyColumn) {
+				v, ok = value, true
+				break
+			}
+		}
+	}
+	if !ok || v == nil {
+		return nil, fmt.Errorf("%w: 结果中没有键列 %s 的值", ErrInvalidPagination, p.keyColumn)
+	}
+	key := &pageKey{Query: p.query}
+	rv := reflect.ValueOf(v)
+	switch x := v.(type) {
+	case string:
+		key.Type, key.Value = "s", x
+	case time.Time:
+		key.Type, key.Value = "d", x.Format(time.RFC3339Nano)
+	default:
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			key.Type, key.Value = "i", strconv.FormatInt(rv.Int(), 10)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			key.Type, key.Value = "u", strconv.FormatUint(rv.Uint(), 10)
+		case reflect.Float32, reflect.Float64:
+			key.Type, key.Value = "f", strconv.FormatFloat(rv.Float(), 'g', -1, 64)
+		default:
+			return nil, fmt.Errorf("%w: 键列 %s 的类型 %T 不能用于分页", ErrInvalidPagination, p.keyColumn, v)
+		}
+	}
+	return key, nil
+}
+
+// literal - 把令牌中的键渲染为过滤条件的值
+func (k *pageKey) literal() (string, error) {
+	var v interface{}
+	var err error
+	switch k.Type {
+	case "i":
+		v, err = strconv.ParseInt(k.Value, 10, 64)
+	case "u":
+		v, err = strconv.ParseUint(k.Value, 10, 64)
+	case "f":
+		v, err = strconv.ParseFloat(k.Value, 64)
+	case "s":
+		v = k.Value
+	case "d":
+		v, err = time.Parse(time.RFC3339Nano, k.Value)
+	default:
+		return "", fmt.Errorf("未知的键类型 %q", k.Type)
+	}
+	if err != nil {
+		return "", err
+	}
+	return sqlLiteral(v)
+}
+
+// Page 返回 Next 读取的当前页。
+func (p *Pager) Page() *QueryResult {
+	return p.page
+}
+
+// Token 返回当前页之后的页令牌：base64url 编码，不含 SQL 文本，可以交给 HTTP 客户端，之后用 Resume 继续。
+// 没有更多的页时返回 ""。最后一页恰好满页时，需要再读一次空页才能确定结束，此时 Token 仍然非空。
+func (p *Pager) Token() string {
+	if p.done || p.after == nil {
+		return ""
+	}
+	raw, _ := json.Marshal(p.after)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// Err 返回参数检查或分页查询中遇到的错误。
+func (p *Pager) Err() error {
+	return p.err
+}
@@ -0,0 +1,148 @@
+package opio_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tc252617228/opio"
+	"github.com/tc252617228/opio/opiotest"
+)
+
+// seedPoints 预置 ID 为 10、20 ... n*10 的 n 个测点，每第 5 个为开关量
+func seedPoints(n int) func(*opiotest.Server) {
+	return func(srv *opiotest.Server) {
+		for i := 1; i <= n; i++ {
+			typ := opio.TypeAX
+			if i%5 == 0 {
+				typ = opio.TypeDX
+			}
+			srv.AddPoints(opiotest.Point{ID: int32(i * 10), Name: fmt.Sprintf("W3.P%03d", i), Type: typ})
+		}
+	}
+}
+
+func pageIDs(res *opio.QueryResult) []int32 {
+	ids := make([]int32, len(res.Rows))
+	for i, row := range res.Rows {
+		ids[i] = row["ID"].(int32)
+	}
+	return ids
+}
+
+func TestPaginate(t *testing.T) {
+	srv, client := opiotest.NewClient(t, seedPoints(25))
+	ctx := context.Background()
+	opts := &opio.QueryOptions{Where: opio.Where("RT").Eq(opio.TypeAX)} // 20 行
+
+	pager := client.Paginate(ctx, "Point", []string{"GN"}, opts, 8, "ID")
+	var pages [][]int32
+	var tokens []string
+	for pager.Next() {
+		pages = append(pages, pageIDs(pager.Page()))
+		tokens = append(tokens, pager.Token())
+		if len(pages) == 1 {
+			// 翻页期间插入的行：键小于已读位置的不会出现，之后的按顺序出现，已读的行不会重复
+			srv.AddPoints(
+				opiotest.Point{ID: 15, Name: "W3.NEW.15", Type: opio.TypeAX},
+				opiotest.Point{ID: 255, Name: "W3.NEW.255", Type: opio.TypeAX},
+			)
+		}
+	}
+	require.NoError(t, pager.Err())
+	require.Len(t, pages, 3)
+	assert.Equal(t, []int32{10, 20, 30, 40, 60, 70, 80, 90}, pages[0])
+	assert.Equal(t, []int32{110, 120, 130, 140, 160, 170, 180, 190}, pages[1])
+	assert.Equal(t, []int32{210, 220, 230, 240, 255}, pages[2])
+	assert.NotEmpty(t, tokens[0])
+	assert.Empty(t, tokens[2])
+	assert.Nil(t, pager.Page())
+
+	// 另一个 Pager 从令牌继续，例如下一次 HTTP 请求
+	resumed := client.Paginate(ctx, "Point", []string{"GN"}, opts, 8, "ID")
+	require.NoError(t, resumed.Resume(tokens[0]))
+	require.True(t, resumed.Next())
+	assert.Equal(t, pages[1], pageIDs(resumed.Page()))
+	assert.Equal(t, tokens[1], resumed.Token())
+
+	// 令牌属于其他查询或被篡改
+	other := client.Paginate(ctx, "Point", nil, nil, 8, "ID")
+	assert.ErrorIs(t, other.Resume(tokens[0]), opio.ErrInvalidPageToken)
+	assert.ErrorIs(t, resumed.Resume("not a token"), opio.ErrInvalidPageToken)
+	assert.ErrorIs(t, resumed.Resume("eyJxIjoiIiwidCI6InMiLCJ2IjoieCJ9"), opio.ErrInvalidPageToken)
+
+	// 字符串键，页大小整除时最后读到一个空页
+	srv.AddPoints(opiotest.Point{ID: 300, Name: "W3.NEW.O'9", Type: opio.TypeDX})
+	byName := client.Paginate(ctx, "Point", []string{"ID"}, &opio.QueryOptions{
+		Filters: []opio.Filter{{Left: "GN", Operator: opio.OperLike, Right: "'W3.NEW.%'"}},
+	}, 1, "GN")
+	var names []string
+	for byName.Next() {
+		require.Len(t, byName.Page().Rows, 1)
+		names = append(names, byName.Page().Rows[0]["GN"].(string))
+	}
+	require.NoError(t, byName.Err())
+	assert.Equal(t, []string{"W3.NEW.15", "W3.NEW.255", "W3.NEW.O'9"}, names)
+	assert.Empty(t, byName.Token())
+}
+
+func TestPaginateQuotedKeys(t *testing.T) {
+	srv, client := opiotest.NewClient(t, func(srv *opiotest.Server) {
+		// 首尾带单引号的键：不加引号发送时会被当作 SQL 字符串去掉引号，排序位置错误
+		srv.AddPoints(
+			opiotest.Point{ID: 1, Name: "'Q1'", Type: opio.TypeAX},
+			opiotest.Point{ID: 2, Name: "'Q2'", Type: opio.TypeAX},
+			opiotest.Point{ID: 3, Name: "O'Q3", Type: opio.TypeAX},
+		)
+	})
+	ctx := context.Background()
+
+	byName := client.Paginate(ctx, "Point", []string{"ID"}, nil, 1, "GN")
+	var ids []int32
+	for byName.Next() {
+		ids = append(ids, pageIDs(byName.Page())...)
+	}
+	require.NoError(t, byName.Err())
+	assert.Equal(t, []int32{1, 2, 3}, ids)
+
+	// 时间键按服务端的时间格式加引号
+	base := int32(time.Now().Add(-time.Hour).Unix())
+	srv.SetRealtime(
+		opio.Value{ID: 3, TM: base + 2, AV: 3},
+		opio.Value{ID: 1, TM: base, AV: 1},
+		opio.Value{ID: 2, TM: base + 1, AV: 2},
+	)
+	byTime := client.Paginate(ctx, "Realtime", []string{"ID"}, nil, 2, "TM")
+	var pages [][]int32
+	for byTime.Next() {
+		pages = append(pages, pageIDs(byTime.Page()))
+	}
+	require.NoError(t, byTime.Err())
+	assert.Equal(t, [][]int32{{1, 2}, {3}}, pages)
+}
+
+func TestPaginateInvalid(t *testing.T) {
+	_, client := opiotest.NewClient(t, seedPoints(3))
+	ctx := context.Background()
+
+	invalid := []*opio.Pager{
+		client.Paginate(ctx, "Point", nil, nil, 0, "ID"),
+		client.Paginate(ctx, "Point", nil, nil, 10, "ID > 0 --"),
+		client.Paginate(ctx, "Point", nil, &opio.QueryOptions{OrderBy: "GN"}, 10, "ID"),
+		client.Paginate(ctx, "Point", nil, &opio.QueryOptions{Limit: "10, 20"}, 10, "ID"),
+		client.Paginate(ctx, "Point", nil, &opio.QueryOptions{Where: opio.Where("RT").Eq(0).Or(opio.Col("RT").Eq(1))}, 10, "ID"),
+	}
+	for _, p := range invalid {
+		assert.False(t, p.Next())
+		assert.ErrorIs(t, p.Err(), opio.ErrInvalidPagination)
+		assert.ErrorIs(t, p.Resume(""), opio.ErrInvalidPagination)
+	}
+
+	missing := client.Paginate(ctx, "Missing", nil, nil, 10, "ID")
+	assert.False(t, missing.Next())
+	var serverErr *opio.OpioServerError
+	assert.ErrorAs(t, missing.Err(), &serverErr)
+}
@@ -0,0 +1,508 @@
+package opio
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// PoolConfig 定义 Client 内置连接池的参数。
+type PoolConfig struct {
+	MinConns    int           // 保持打开的最少连接数 (空闲 + 使用中)，后台维护任务会补足
+	MaxConns    int           // 同时打开的最多连接数，超出时借用方会等待直到有连接归还或 ctx 结束
+	IdleTimeout time.Duration // 空闲超过该时长的连接会被关闭 (不低于 MinConns)。0 表示不限制
+	MaxLifetime time.Duration // 连接自创建起的最长存活时间，到期后在归还或借出时被关闭。0 表示不限制
+	HealthCheck bool          // 借出空闲连接前是否用 IOConnect.Echo 做一次存活探测
+	// HealthCheckTimeout 是存活探测等待回包的超时，应大于链路的往返时间。0 表示使用默认值 (1s)
+	HealthCheckTimeout time.Duration
+}
+
+// PoolStats 是连接池当前状态的快照。
+type PoolStats struct {
+	Open  int // 打开的连接总数
+	Idle  int // 空闲连接数
+	InUse int // 正在被借用的连接数
+}
+
+const (
+	defaultPoolMinConns    = 1
+	defaultPoolMaxConns    = 4
+	defaultPoolIdleTimeout = 5 * time.Minute
+	defaultPoolHealthCheck = time.Second
+	poolMaintainInterval   = 30 * time.Second
+)
+
+// DefaultPoolConfig 返回 Connect 创建客户端时使用的默认连接池配置。
+func DefaultPoolConfig() PoolConfig {
+	return PoolConfig{
+		MinConns:    defaultPoolMinConns,
+		MaxConns:    defaultPoolMaxConns,
+		IdleTimeout: defaultPoolIdleTimeout,
+	}
+}
+
+func (cfg PoolConfig) validate() error {
+	if cfg.MaxConns < 1 {
+		return errors.New("opio: PoolConfig.MaxConns must be at least 1")
+	}
+	if cfg.MinConns < 0 || cfg.MinConns > cfg.MaxConns {
+		return errors.New("opio: PoolConfig.MinConns must be between 0 and MaxConns")
+	}
+	if cfg.IdleTimeout < 0 || cfg.MaxLifetime < 0 || cfg.HealthCheckTimeout < 0 {
+		return errors.New("opio: PoolConfig timeouts must not be negative")
+	}
+	return nil
+}
+
+// healthCheckTimeout - 存活探测的超时，未设置时使用默认值
+func (cfg PoolConfig) healthCheckTimeout() time.Duration {
+	if cfg.HealthCheckTimeout > 0 {
+		return cfg.HealthCheckTimeout
+	}
+	return defaultPoolHealthCheck
+}
+
+// pooledConn - 连接池中的一个物理连接
+type pooledConn struct {
+	op          *IOConnect
+	createdAt   time.Time
+	lastUsed    time.Time
+	lastChecked time.Time // 最近一次保活探测成功的时间，探测不计入 lastUsed，不影响空闲超时
+}
+
+// connPool - Client 内置的连接池，每次调用借出一个连接，调用结束后归还。
+type connPool struct {
+	mu          sync.Mutex
+	cfg         PoolConfig
+	dial        func(ctx context.Context) (*IOConnect, error)
+	slots       int           // 已占用的并发槽位数，借出的连接各占一个，不超过 cfg.MaxConns
+	wake        chan struct{} // 槽位释放、MaxConns 变化或池关闭时关闭并替换，唤醒等待槽位的借用方
+	idle        []*pooledConn
+	active      map[*IOConnect]*pooledConn
+	compression compressSetting
+	stale       func(op *IOConnect) bool // 连接指向的端点已被切换掉时返回 true，此类连接不再复用
+	closed      bool
+	stop        chan struct{}
+	fillMu      sync.Mutex // 串行化 fill，维护任务与保活任务可能同时补足连接
+}
+
+func newConnPool(cfg PoolConfig, dial func(ctx context.Context) (*IOConnect, error)) *connPool {
+	p := &connPool{
+		cfg:    cfg,
+		dial:   dial,
+		wake:   make(chan struct{}),
+		active: make(map[*IOConnect]*pooledConn),
+		stop:   make(chan struct{}),
+	}
+	go p.maintain()
+	return p
+}
+
+// put - 将一个已建立的连接作为空闲连接放入池中
+func (p *connPool) put(op *IOConnect) {
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.idle = append(p.idle, &pooledConn{op: op, createdAt: now, lastUsed: now})
+}
+
+func (p *connPool) expired(pc *pooledConn, now time.Time) bool {
+	if p.cfg.MaxLifetime > 0 && now.Sub(pc.createdAt) >= p.cfg.MaxLifetime {
+		return true
+	}
+	return p.cfg.IdleTimeout > 0 && now.Sub(pc.lastUsed) >= p.cfg.IdleTimeout
+}
+
+// acquireSlot - 占用一个并发槽位。槽位用完时等待，直到有连接归还、MaxConns 调大、池关闭或 ctx 结束。
+// MaxConns 调小后，使用中的连接归还到新的上限以下之前不会再借出连接。
+func (p *connPool) acquireSlot(ctx context.Context) error {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return ErrConnectionClosed
+		}
+		if p.slots < p.cfg.MaxConns {
+			p.slots++
+			p.mu.Unlock()
+			return nil
+		}
+		wake := p.wake
+		p.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// releaseSlot - 释放一个并发槽位
+func (p *connPool) releaseSlot() {
+	p.mu.Lock()
+	p.releaseSlotLocked()
+	p.mu.Unlock()
+}
+
+func (p *connPool) releaseSlotLocked() {
+	p.slots--
+	p.wakeLocked()
+}
+
+// wakeLocked - 唤醒所有等待槽位的借用方，由它们重新检查槽位
+func (p *connPool) wakeLocked() {
+	close(p.wake)
+	p.wake = make(chan struct{})
+}
+
+// acquire - 借出一个连接。池满时等待，直到有连接归还或 ctx 结束。
+func (p *connPool) acquire(ctx context.Context) (*IOConnect, error) {
+	if err := p.acquireSlot(ctx); err != nil {
+		return nil, err
+	}
+
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.releaseSlotLocked()
+			p.mu.Unlock()
+			return nil, ErrConnectionClosed
+		}
+		n := len(p.idle)
+		if n == 0 {
+			p.mu.Unlock()
+			break
+		}
+		pc := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		healthCheck, timeout := p.cfg.HealthCheck, p.cfg.healthCheckTimeout()
+		expired := p.expired(pc, time.Now())
+		p.mu.Unlock()
+
+		if expired || p.isStale(pc.op) || (healthCheck && !alive(pc.op, timeout)) {
+			_ = pc.op.Close()
+			continue
+		}
+		if err := p.checkout(pc); err != nil {
+			p.releaseSlot()
+			return nil, err
+		}
+		return pc.op, nil
+	}
+
+	op, err := p.dialConn(ctx)
+	if err != nil {
+		p.releaseSlot()
+		return nil, err
+	}
+	now := time.Now()
+	if err = p.checkout(&pooledConn{op: op, createdAt: now, lastUsed: now}); err != nil {
+		p.releaseSlot()
+		return nil, err
+	}
+	return op, nil
+}
+
+// checkout - 登记为使用中的连接，并同步池的压缩模式
+func (p *connPool) checkout(pc *pooledConn) error {
+	p.mu.Lock()
+	compression := p.compression
+	if p.closed {
+		p.mu.Unlock()
+		_ = pc.op.Close()
+		return ErrConnectionClosed
+	}
+	p.active[pc.op] = pc
+	p.mu.Unlock()
+
+	if pc.op.compression != compression {
+		if err := pc.op.applyCompression(compression); err != nil {
+			p.mu.Lock()
+			delete(p.active, pc.op)
+			p.mu.Unlock()
+			_ = pc.op.Close()
+			return err
+		}
+	}
+	return nil
+}
+
+// release - 归还连接。连接已损坏、已过期或池已关闭时直接关闭该连接。
+func (p *connPool) release(op *IOConnect) {
+	if op == nil {
+		return
+	}
+	now := time.Now()
+	stale := p.isStale(op)
+	p.mu.Lock()
+	pc, ok := p.active[op]
+	if !ok {
+		p.mu.Unlock()
+		return
+	}
+	delete(p.active, op)
+	p.releaseSlotLocked()
+	discard := p.closed || stale || op.Broken() || len(p.idle) >= p.cfg.MaxConns ||
+		(p.cfg.MaxLifetime > 0 && now.Sub(pc.createdAt) >= p.cfg.MaxLifetime)
+	if !discard {
+		pc.lastUsed = now
+		p.idle = append(p.idle, pc)
+	}
+	p.mu.Unlock()
+
+	if discard {
+		_ = op.Close()
+	}
+}
+
+// dialConn - 按客户端的连接参数新建一个物理连接
+func (p *connPool) dialConn(ctx context.Context) (*IOConnect, error) {
+	op, err := p.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	compression := p.compression
+	p.mu.Unlock()
+	if compression != (compressSetting{}) {
+		if err = op.applyCompression(compression); err != nil {
+			_ = op.Close()
+			return nil, err
+		}
+	}
+	return op, nil
+}
+
+// purgeIdle - 关闭所有空闲连接。服务端重启后这些连接通常都已失效，下次借用时会重新建立。
+func (p *connPool) purgeIdle() {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.mu.Unlock()
+	for _, pc := range idle {
+		_ = pc.op.Close()
+	}
+}
+
+// checkIdle - 对空闲 (且未被探测) 超过 idleFor 的连接逐个调用 probe。
+// 探测期间连接从空闲列表中取出并占用一个并发槽位，既不会被借出，也不会让借用方因空闲列表变空而多建连接；
+// 槽位不足时剩余的连接留到下个周期探测。探测失败的连接被关闭，返回第一个失败的错误。
+func (p *connPool) checkIdle(idleFor time.Duration, probe func(op *IOConnect) error) (checked int, err error) {
+	now := time.Now()
+	var due []*pooledConn
+	p.mu.Lock()
+	kept := p.idle[:0]
+	for _, pc := range p.idle {
+		last := pc.lastUsed
+		if pc.lastChecked.After(last) {
+			last = pc.lastChecked
+		}
+		if now.Sub(last) >= idleFor && p.slots < p.cfg.MaxConns {
+			p.slots++
+			due = append(due, pc)
+			continue
+		}
+		kept = append(kept, pc)
+	}
+	p.idle = kept
+	p.mu.Unlock()
+
+	for _, pc := range due {
+		if perr := probe(pc.op); perr != nil {
+			_ = pc.op.Close()
+			p.releaseSlot()
+			if err == nil {
+				err = perr
+			}
+			continue
+		}
+		pc.lastChecked = time.Now()
+		p.mu.Lock()
+		closed := p.closed
+		if !closed {
+			p.idle = append(p.idle, pc)
+		}
+		p.releaseSlotLocked()
+		p.mu.Unlock()
+		if closed {
+			_ = pc.op.Close()
+		}
+	}
+	return len(due), err
+}
+
+// setConfig - 更新连接池参数。调大 MaxConns 立即唤醒等待的借用方；
+// 调小时已借出的连接不受影响，但归还到新的上限以下之前不会再借出连接。
+func (p *connPool) setConfig(cfg PoolConfig) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrConnectionClosed
+	}
+	p.cfg = cfg
+	p.wakeLocked()
+	return nil
+}
+
+// alive - 在 timeout 内完成一次心跳往返时返回 true
+func alive(op *IOConnect, timeout time.Duration) bool {
+	_, err := op.Echo(timeout)
+	return err == nil
+}
+
+// setCompression - 设置池中所有连接的压缩模式。使用中的连接在下次借出时同步。
+// 设置先整体校验，无效时所有连接保持原设置；个别空闲连接应用失败 (例如已经关闭) 时关闭并移出该连接，
+// 池中不会留下设置不一致的连接。
+func (p *connPool) setCompression(s compressSetting) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrConnectionClosed
+	}
+	idle := p.idle[:0]
+	for _, pc := range p.idle {
+		if err := pc.op.applyCompression(s); err != nil {
+			_ = pc.op.Close()
+			continue
+		}
+		idle = append(idle, pc)
+	}
+	for i := len(idle); i < len(p.idle); i++ {
+		p.idle[i] = nil
+	}
+	p.idle = idle
+	p.compression = s
+	return nil
+}
+
+func (p *connPool) isStale(op *IOConnect) bool {
+	return p.stale != nil && p.stale(op)
+}
+
+func (p *connPool) isClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed
+}
+
+func (p *connPool) stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return PoolStats{
+		Open:  len(p.idle) + len(p.active),
+		Idle:  len(p.idle),
+		InUse: len(p.active),
+	}
+}
+
+// maintain - 定期关闭超时的空闲连接，并补足 MinConns
+func (p *connPool) maintain() {
+	ticker := time.NewTicker(poolMaintainInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.prune()
+			p.fill()
+		}
+	}
+}
+
+func (p *connPool) prune() {
+	now := time.Now()
+	var stale []*pooledConn
+	p.mu.Lock()
+	open := len(p.idle) + len(p.active)
+	kept := p.idle[:0]
+	for _, pc := range p.idle {
+		if open > p.cfg.MinConns && p.expired(pc, now) {
+			stale = append(stale, pc)
+			open--
+			continue
+		}
+		kept = append(kept, pc)
+	}
+	p.idle = kept
+	p.mu.Unlock()
+	for _, pc := range stale {
+		_ = pc.op.Close()
+	}
+}
+
+// fill - 补足 MinConns。每次拨号占用一个并发槽位，槽位用完时不再补足，同一时间只有一个 fill 在拨号。
+func (p *connPool) fill() {
+	p.fillMu.Lock()
+	defer p.fillMu.Unlock()
+
+	// 连接池关闭时中止进行中的拨号 (重连策略可能在退避等待中)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-p.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	for {
+		p.mu.Lock()
+		need := !p.closed && len(p.idle)+len(p.active) < p.cfg.MinConns && p.slots < p.cfg.MaxConns
+		if need {
+			p.slots++
+		}
+		p.mu.Unlock()
+		if !need {
+			return
+		}
+		op, err := p.dialConn(ctx)
+		if err != nil {
+			p.releaseSlot()
+			return
+		}
+		now := time.Now()
+		p.mu.Lock()
+		closed := p.closed
+		if !closed {
+			p.idle = append(p.idle, &pooledConn{op: op, createdAt: now, lastUsed: now})
+		}
+		p.releaseSlotLocked()
+		p.mu.Unlock()
+		if closed {
+			_ = op.Close()
+			return
+		}
+	}
+}
+
+// close - 关闭连接池及所有空闲连接，使用中的连接在归还时关闭
+func (p *connPool) close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrConnectionClosed
+	}
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	close(p.stop)
+	p.wakeLocked()
+	p.mu.Unlock()
+
+	var firstErr error
+	for _, pc := range idle {
+		if err := pc.op.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
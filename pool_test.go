@@ -0,0 +1,199 @@
+package opio_test
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tc252617228/opio"
+	"github.com/tc252617228/opio/opiotest"
+)
+
+func TestClientPoolConcurrentUse(t *testing.T) {
+	var current, peak, dials int32
+	host, port := listenLocal(t, func(conn net.Conn) {
+		defer conn.Close()
+		atomic.AddInt32(&dials, 1)
+		if fakeLogin(conn) != nil {
+			return
+		}
+		for {
+			if _, err := readMessage(conn); err != nil {
+				return
+			}
+			n := atomic.AddInt32(&current, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond) // 让并发请求互相重叠
+			atomic.AddInt32(&current, -1)
+			if writeFrame(conn, okResponse) != nil {
+				return
+			}
+		}
+	})
+
+	client, err := opio.Connect(context.Background(), host, port, "sis", "openplant", time.Second)
+	require.NoError(t, err)
+	defer client.Close()
+
+	cfg := opio.DefaultPoolConfig()
+	cfg.MaxConns = 3
+	require.NoError(t, client.SetPoolConfig(cfg))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := 0; i < 12; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.ExecSQL(ctx, "SELECT 1")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, atomic.LoadInt32(&peak), int32(3), "并发连接数不应超过 MaxConns")
+	assert.LessOrEqual(t, atomic.LoadInt32(&dials), int32(3))
+	stats := client.PoolStats()
+	assert.Equal(t, 0, stats.InUse)
+	assert.Equal(t, stats.Open, stats.Idle)
+
+	require.NoError(t, client.Close())
+	assert.Equal(t, 0, client.PoolStats().Open)
+	_, err = client.ExecSQL(ctx, "SELECT 1")
+	assert.ErrorIs(t, err, opio.ErrConnectionClosed)
+}
+
+func TestPoolShrinkMaxConns(t *testing.T) {
+	var current, peakAfter int32
+	host, port := listenLocal(t, func(conn net.Conn) {
+		defer conn.Close()
+		if fakeLogin(conn) != nil {
+			return
+		}
+		for {
+			msg, err := readMessage(conn)
+			if err != nil {
+				return
+			}
+			n := atomic.AddInt32(&current, 1)
+			if bytes.Contains(msg, []byte("SELECT 2")) {
+				for {
+					p := atomic.LoadInt32(&peakAfter)
+					if n <= p || atomic.CompareAndSwapInt32(&peakAfter, p, n) {
+						break
+					}
+				}
+			}
+			time.Sleep(50 * time.Millisecond)
+			atomic.AddInt32(&current, -1)
+			if writeFrame(conn, okResponse) != nil {
+				return
+			}
+		}
+	})
+	client, err := opio.Connect(context.Background(), host, port, "sis", "openplant", time.Second)
+	require.NoError(t, err)
+	defer client.Close()
+	cfg := opio.DefaultPoolConfig()
+	cfg.MaxConns = 3
+	require.NoError(t, client.SetPoolConfig(cfg))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	query := func(sql string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.ExecSQL(ctx, sql)
+			assert.NoError(t, err)
+		}()
+	}
+	for i := 0; i < 3; i++ {
+		query("SELECT 1")
+	}
+	require.Eventually(t, func() bool { return client.PoolStats().InUse == 3 }, time.Second, time.Millisecond)
+
+	// 调小 MaxConns 时已借出的连接仍占用槽位，归还到新的上限以下之前不会再借出
+	cfg.MaxConns = 1
+	require.NoError(t, client.SetPoolConfig(cfg))
+	for i := 0; i < 3; i++ {
+		query("SELECT 2")
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&peakAfter))
+	assert.LessOrEqual(t, client.PoolStats().Open, 3)
+}
+
+func TestPoolConfigValidation(t *testing.T) {
+	host, port := listenLocal(t, func(conn net.Conn) {
+		defer conn.Close()
+		_ = fakeLogin(conn)
+		_, _ = readMessage(conn)
+	})
+	client, err := opio.Connect(context.Background(), host, port, "sis", "openplant", time.Second)
+	require.NoError(t, err)
+	defer client.Close()
+
+	assert.Error(t, client.SetPoolConfig(opio.PoolConfig{MaxConns: 0}))
+	assert.Error(t, client.SetPoolConfig(opio.PoolConfig{MinConns: 3, MaxConns: 2}))
+	assert.Error(t, client.SetPoolConfig(opio.PoolConfig{MaxConns: 2, HealthCheckTimeout: -time.Second}))
+	assert.NoError(t, client.SetPoolConfig(opio.PoolConfig{MinConns: 0, MaxConns: 2}))
+}
+
+// slowConn - 每次读取前延迟，模拟往返时间较长的链路
+type slowConn struct {
+	net.Conn
+	delay time.Duration
+}
+
+func (c *slowConn) Read(p []byte) (int, error) {
+	time.Sleep(c.delay)
+	return c.Conn.Read(p)
+}
+
+func TestPoolHealthCheckTimeout(t *testing.T) {
+	srv := opiotest.NewServer()
+	defer srv.Close()
+	var dials int32
+	dialer := opio.DialerFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+		atomic.AddInt32(&dials, 1)
+		conn, err := (&net.Dialer{}).DialContext(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		return &slowConn{Conn: conn, delay: 30 * time.Millisecond}, nil
+	})
+	client, err := srv.Connect(context.Background(), opio.WithDialer(dialer))
+	require.NoError(t, err)
+	defer client.Close()
+
+	// 探测超时大于往返时间，空闲连接通过探测后被复用
+	cfg := opio.PoolConfig{MaxConns: 1, HealthCheck: true, HealthCheckTimeout: time.Second}
+	require.NoError(t, client.SetPoolConfig(cfg))
+	for i := 0; i < 2; i++ {
+		_, err = client.Query(context.Background(), "Point", []string{"ID"}, nil)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&dials))
+	assert.Equal(t, 2, srv.Requests("Echo"))
+
+	// 探测超时小于往返时间，空闲连接被判定失效并重新拨号
+	cfg.HealthCheckTimeout = 5 * time.Millisecond
+	require.NoError(t, client.SetPoolConfig(cfg))
+	_, err = client.Query(context.Background(), "Point", []string{"ID"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&dials))
+}
@@ -0,0 +1,139 @@
+package opio
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// ReconnectPolicy 定义 Client 在连接断开或新建连接失败时的重连策略。
+// 零值表示不重连：新建连接只尝试一次，失败立即返回错误。
+type ReconnectPolicy struct {
+	MaxAttempts     int           // 首次拨号失败后最多再尝试的次数，0 表示不重试，负数表示一直重试直到 ctx 结束
+	InitialBackoff  time.Duration // 第一次重试前的等待时长
+	MaxBackoff      time.Duration // 退避时长的上限，0 表示不限制
+	Multiplier      float64       // 每次重试后退避时长的增长倍数，小于 1 时按 2 处理
+	Jitter          float64       // 抖动比例 (0~1)，实际等待时长在 [d*(1-Jitter), d*(1+Jitter)] 内随机，避免多个客户端同时重连
+	RetryIdempotent bool          // 幂等的读操作 (Query、ReadRealtime、ReadArchive、ReadStat) 在连接断开后重连并重试一次
+
+	// OnDisconnect 在检测到连接断开时调用 (一次断线只调用一次)，err 为导致断开的网络错误。
+	OnDisconnect func(err error)
+	// OnReconnect 在断线后第一次成功建立连接时调用，attempts 为本次建连尝试的次数。
+	OnReconnect func(attempts int)
+}
+
+// DefaultReconnectPolicy 返回一个适合长期运行的采集程序的重连策略：
+// 最多重试 10 次，退避从 200ms 开始翻倍增长到 30s，带 20% 抖动，并对幂等读操作重试一次。
+func DefaultReconnectPolicy() ReconnectPolicy {
+	return ReconnectPolicy{
+		MaxAttempts:     10,
+		InitialBackoff:  200 * time.Millisecond,
+		MaxBackoff:      30 * time.Second,
+		Multiplier:      2,
+		Jitter:          0.2,
+		RetryIdempotent: true,
+	}
+}
+
+func (p ReconnectPolicy) validate() error {
+	if p.InitialBackoff < 0 || p.MaxBackoff < 0 {
+		return errors.New("opio: ReconnectPolicy backoff must not be negative")
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return errors.New("opio: ReconnectPolicy.Jitter must be between 0 and 1")
+	}
+	return nil
+}
+
+// backoff - 第 retry 次重试 (从 1 开始) 前的等待时长
+func (p ReconnectPolicy) backoff(retry int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	d := float64(p.InitialBackoff) * math.Pow(multiplier, float64(retry-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(d)
+}
+
+// SetReconnectPolicy 设置客户端的断线重连策略。
+// 策略对之后新建的连接生效；连接池会在借用时按策略带退避地重新拨号、登录并恢复压缩模式。
+func (c *Client) SetReconnectPolicy(policy ReconnectPolicy) error {
+	if c.closed() {
+		return ErrConnectionClosed
+	}
+	if err := policy.validate(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.reconnect = policy
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *Client) reconnectPolicy() ReconnectPolicy {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reconnect
+}
+
+// dial - 连接池新建连接时调用，按重连策略带退避地重试。
+// 口令被拒绝 (PhaseAuth) 时重试没有意义，直接返回错误。
+func (c *Client) dial(ctx context.Context) (*IOConnect, error) {
+	policy := c.reconnectPolicy()
+	for attempt := 1; ; attempt++ {
+		op, err := c.dialOnce(ctx)
+		if err == nil {
+			c.recordRoundTrip(0)
+			c.connectionRestored(attempt)
+			return op, nil
+		}
+		var ce *ConnectError
+		if ctx.Err() != nil || (errors.As(err, &ce) && ce.Phase == PhaseAuth) {
+			return nil, err
+		}
+		if policy.MaxAttempts >= 0 && attempt > policy.MaxAttempts {
+			c.recordDialFailure(err)
+			return nil, err
+		}
+		timer := time.NewTimer(policy.backoff(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		}
+	}
+}
+
+// connectionLost - 检测到连接断开。服务端重启时池中的空闲连接通常都已失效，一并关闭。
+func (c *Client) connectionLost(err error) {
+	c.pool.purgeIdle()
+	c.mu.Lock()
+	first := !c.disconnected
+	c.disconnected = true
+	hook := c.reconnect.OnDisconnect
+	c.mu.Unlock()
+	if first && hook != nil {
+		hook(err)
+	}
+}
+
+// connectionRestored - 新连接建立成功，如果之前处于断线状态则触发 OnReconnect
+func (c *Client) connectionRestored(attempts int) {
+	c.mu.Lock()
+	restored := c.disconnected
+	c.disconnected = false
+	hook := c.reconnect.OnReconnect
+	c.mu.Unlock()
+	if restored && hook != nil {
+		hook(attempts)
+	}
+}
@@ -0,0 +1,121 @@
+package opio_test
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tc252617228/opio"
+)
+
+// restartingServer 模拟一次服务端重启：第一个连接处理完登录后在收到首个请求时断开，
+// 随后 rejected 个连接在问候包之前被直接关闭，之后的连接正常服务。
+func restartingServer(t *testing.T, rejected int32) (string, int, *int32) {
+	var dials int32
+	host, port := listenLocal(t, func(conn net.Conn) {
+		defer conn.Close()
+		n := atomic.AddInt32(&dials, 1)
+		if n > 1 && n <= 1+rejected {
+			return
+		}
+		if fakeLogin(conn) != nil {
+			return
+		}
+		for {
+			if _, err := readMessage(conn); err != nil || n == 1 {
+				return
+			}
+			if writeFrame(conn, okResponse) != nil {
+				return
+			}
+		}
+	})
+	return host, port, &dials
+}
+
+func TestReconnectRetriesIdempotentRead(t *testing.T) {
+	host, port, dials := restartingServer(t, 2)
+	client, err := opio.Connect(context.Background(), host, port, "sis", "openplant", time.Second)
+	require.NoError(t, err)
+	defer client.Close()
+
+	var disconnects, reconnectAttempts int32
+	policy := opio.DefaultReconnectPolicy()
+	policy.InitialBackoff = 10 * time.Millisecond
+	policy.OnDisconnect = func(err error) { atomic.AddInt32(&disconnects, 1) }
+	policy.OnReconnect = func(attempts int) { atomic.StoreInt32(&reconnectAttempts, int32(attempts)) }
+	require.NoError(t, client.SetReconnectPolicy(policy))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = client.Query(ctx, "Point", []string{"ID"}, nil)
+	require.NoError(t, err, "幂等读操作应在重连后重试成功")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&disconnects))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&reconnectAttempts), "两次被拒绝后第三次拨号成功")
+	assert.Equal(t, int32(4), atomic.LoadInt32(dials))
+
+	_, err = client.ExecSQL(ctx, "SELECT 1")
+	assert.NoError(t, err)
+}
+
+func TestReconnectDoesNotRetryWrites(t *testing.T) {
+	host, port, dials := restartingServer(t, 0)
+	client, err := opio.Connect(context.Background(), host, port, "sis", "openplant", time.Second)
+	require.NoError(t, err)
+	defer client.Close()
+
+	var disconnects int32
+	policy := opio.DefaultReconnectPolicy()
+	policy.OnDisconnect = func(err error) { atomic.AddInt32(&disconnects, 1) }
+	require.NoError(t, client.SetReconnectPolicy(policy))
+
+	_, err = client.ExecSQL(context.Background(), "DELETE FROM Point")
+	require.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&disconnects))
+	assert.Equal(t, int32(1), atomic.LoadInt32(dials), "非幂等操作不应自动重试")
+}
+
+func TestReconnectGivesUpAfterMaxAttempts(t *testing.T) {
+	host, port, dials := restartingServer(t, 100)
+	client, err := opio.Connect(context.Background(), host, port, "sis", "openplant", time.Second)
+	require.NoError(t, err)
+	defer client.Close()
+
+	require.NoError(t, client.SetReconnectPolicy(opio.ReconnectPolicy{
+		MaxAttempts:     2,
+		InitialBackoff:  time.Millisecond,
+		RetryIdempotent: true,
+	}))
+	_, err = client.Query(context.Background(), "Point", []string{"ID"}, nil)
+	require.Error(t, err)
+	var ce *opio.ConnectError
+	assert.ErrorAs(t, err, &ce)
+	assert.Equal(t, int32(1+3), atomic.LoadInt32(dials), "首次拨号加两次重试")
+
+	assert.Error(t, client.SetReconnectPolicy(opio.ReconnectPolicy{Jitter: 2}))
+}
+
+func TestIOConnectReconnect(t *testing.T) {
+	var logins int32
+	host, port := listenLocal(t, func(conn net.Conn) {
+		defer conn.Close()
+		if fakeLogin(conn) == nil {
+			atomic.AddInt32(&logins, 1)
+		}
+		_, _ = readMessage(conn)
+	})
+
+	op, err := opio.Init(host, port, 1, "sis", "openplant")
+	require.NoError(t, err)
+	defer op.Close()
+	require.NoError(t, op.SetCompressModel(opio.ZIP_MODEL_Frame))
+
+	require.NoError(t, op.Reconnect())
+	assert.False(t, op.Broken())
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&logins) == 2 }, time.Second, 10*time.Millisecond,
+		"Reconnect 应重新执行登录握手")
+}
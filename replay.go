@@ -0,0 +1,329 @@
+package opio
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/tc252617228/opio/internal/utils"
+)
+
+// sessionMagic - 会话文件头
+var sessionMagic = []byte("OPIOSES\x01")
+
+const (
+	sessionOpen  byte = 0 // 新连接，数据为服务端地址
+	sessionWrite byte = 1 // 客户端发送的数据
+	sessionRead  byte = 2 // 客户端收到的数据
+)
+
+// ErrReplayMismatch 表示回放时客户端的行为与录制的会话不一致 (发送了多余的数据或在请求之前读取应答)。
+var ErrReplayMismatch = errors.New("opio: replay diverged from recorded session")
+
+// SessionRecorder 把经过它的连接上收发的原始字节 (登录握手、请求、V3 二进制命令、订阅推送) 录制到一个会话文件，
+// 之后可以用 LoadSession 在没有服务端的情况下回放。一个录制器可以录制多个连接 (例如连接池和订阅)，按建立顺序编号。
+// 录制的是网络上的实际字节，客户端发送的帧保留协商的压缩方式，可以用于复现与压缩有关的问题。
+//
+// 文件格式 (整数均为大端序)：8 字节文件头 "OPIOSES\x01"，之后每条记录为
+// kind(u8: 0 新连接, 1 发送, 2 接收) + conn(u32) + 数据(u32 长度 + 字节)，新连接记录的数据为服务端地址。
+type SessionRecorder struct {
+	mu    sync.Mutex
+	w     *bufio.Writer
+	err   error
+	conns uint32
+}
+
+// NewSessionRecorder 创建写入 w 的录制器并写出文件头。录制结束后调用 Flush。
+func NewSessionRecorder(w io.Writer) *SessionRecorder {
+	r := &SessionRecorder{w: bufio.NewWriter(w)}
+	_, r.err = r.w.Write(sessionMagic)
+	return r
+}
+
+// Wrap 返回录制 conn 上收发数据的连接，例如 InitConnContext(ctx, rec.Wrap(conn), user, pass)。
+func (r *SessionRecorder) Wrap(conn net.Conn) net.Conn {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id := r.conns
+	r.conns++
+	r.record(sessionOpen, id, []byte(conn.RemoteAddr().String()))
+	return &recordConn{Conn: conn, rec: r, id: id}
+}
+
+// Dialer 返回录制经 d 建立的每个连接的拨号器，d 为 nil 时使用 net.Dialer。用于 WithDialer。
+func (r *SessionRecorder) Dialer(d Dialer) Dialer {
+	if d == nil {
+		d = &net.Dialer{}
+	}
+	return DialerFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := d.DialContext(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		return r.Wrap(conn), nil
+	})
+}
+
+// Flush 把缓冲的记录写入底层 Writer，返回录制过程中遇到的第一个错误。
+func (r *SessionRecorder) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err == nil {
+		r.err = r.w.Flush()
+	}
+	return r.err
+}
+
+// record - 调用方持有 r.mu
+func (r *SessionRecorder) record(kind byte, id uint32, p []byte) {
+	if r.err != nil {
+		return
+	}
+	var head [9]byte
+	head[0] = kind
+	binary.BigEndian.PutUint32(head[1:], id)
+	binary.BigEndian.PutUint32(head[5:], uint32(len(p)))
+	if _, r.err = r.w.Write(head[:]); r.err == nil {
+		_, r.err = r.w.Write(p)
+	}
+}
+
+// recordConn - 录制收发数据的 net.Conn
+type recordConn struct {
+	net.Conn
+	rec *SessionRecorder
+	id  uint32
+}
+
+func (c *recordConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.rec.mu.Lock()
+		c.rec.record(sessionRead, c.id, p[:n])
+		c.rec.mu.Unlock()
+	}
+	return n, err
+}
+
+func (c *recordConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.rec.mu.Lock()
+		c.rec.record(sessionWrite, c.id, p[:n])
+		c.rec.mu.Unlock()
+	}
+	return n, err
+}
+
+// sessionConn - 一个录制的连接
+type sessionConn struct {
+	addr   string
+	chunks []sessionChunk
+}
+
+type sessionChunk struct {
+	write bool
+	data  []byte
+}
+
+// Session 是 SessionRecorder 录制的会话，可以按录制时的顺序回放其中的连接。
+type Session struct {
+	mu    sync.Mutex
+	conns []*sessionConn
+	next  int // Dialer 下一次返回的连接
+}
+
+// LoadSession 读取 SessionRecorder 写出的会话文件。
+func LoadSession(r io.Reader) (*Session, error) {
+	br := bufio.NewReader(r)
+	head := make([]byte, len(sessionMagic))
+	if _, err := io.ReadFull(br, head); err != nil {
+		return nil, fmt.Errorf("opio: 读取会话文件头失败: %w", err)
+	}
+	if !bytes.Equal(head, sessionMagic) {
+		return nil, errors.New("opio: 不是 opio 会话文件")
+	}
+	s := &Session{}
+	byID := make(map[uint32]*sessionConn)
+	var rec [9]byte
+	for {
+		if _, err := io.ReadFull(br, rec[:]); err == io.EOF {
+			return s, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("opio: 会话文件不完整: %w", err)
+		}
+		id := binary.BigEndian.Uint32(rec[1:])
+		data := make([]byte, binary.BigEndian.Uint32(rec[5:]))
+		if _, err := io.ReadFull(br, data); err != nil {
+			return nil, fmt.Errorf("opio: 会话文件不完整: %w", err)
+		}
+		if rec[0] == sessionOpen {
+			c := &sessionConn{addr: string(data)}
+			byID[id] = c
+			s.conns = append(s.conns, c)
+			continue
+		}
+		c, ok := byID[id]
+		if !ok || rec[0] > sessionRead {
+			return nil, fmt.Errorf("opio: 会话文件中的记录无效 (kind %d, conn %d)", rec[0], id)
+		}
+		// 合并同方向的相邻记录，回放时不依赖录制时的读写粒度
+		if n := len(c.chunks); n > 0 && c.chunks[n-1].write == (rec[0] == sessionWrite) {
+			c.chunks[n-1].data = append(c.chunks[n-1].data, data...)
+		} else {
+			c.chunks = append(c.chunks, sessionChunk{write: rec[0] == sessionWrite, data: data})
+		}
+	}
+}
+
+// Len 返回会话中录制的连接数。
+func (s *Session) Len() int {
+	return len(s.conns)
+}
+
+// Conn 返回回放第 i 个 (从 0 开始) 录制连接的 net.Conn，可以交给 InitConnTCP 或 InitConnContext。
+// 回放的连接按录制的顺序提供服务端数据：读取随后的应答之前，校验客户端发送的数据与录制时一致。
+// 校验按解压后的消息进行 (与帧的压缩方式和拆分无关)，订阅请求中随机生成的请求 ID 不参与比较；
+// 发送的内容不同、多发送数据或在请求发出之前读取应答时返回 ErrReplayMismatch。
+// 录制的数据读完后 Read 返回 io.EOF。
+func (s *Session) Conn(i int) net.Conn {
+	return &replayConn{script: s.conns[i]}
+}
+
+// Dialer 返回按录制顺序依次回放各个连接的拨号器，忽略拨号地址。用于 WithDialer。
+func (s *Session) Dialer() Dialer {
+	return DialerFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.next >= len(s.conns) {
+			return nil, fmt.Errorf("opio: 录制的会话中只有 %d 个连接: %w", len(s.conns), ErrReplayMismatch)
+		}
+		s.next++
+		return s.Conn(s.next - 1), nil
+	})
+}
+
+// replayConn - 回放一个录制连接的 net.Conn
+type replayConn struct {
+	mu     sync.Mutex
+	script *sessionConn
+	chunk  int    // 当前的录制片段
+	off    int    // 当前片段中已经回放的字节数
+	sent   []byte // 客户端在当前发送片段中已经发送、尚未校验的数据
+	closed bool
+}
+
+// advance - 跳过已经回放完的片段
+func (c *replayConn) advance() {
+	for c.chunk < len(c.script.chunks) && c.off == len(c.script.chunks[c.chunk].data) {
+		c.chunk++
+		c.off = 0
+	}
+}
+
+func (c *replayConn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return 0, net.ErrClosed
+	}
+	c.advance()
+	if c.chunk < len(c.script.chunks) && c.script.chunks[c.chunk].write {
+		if err := c.verify(c.script.chunks[c.chunk].data); err != nil {
+			return 0, err
+		}
+		c.chunk++
+		c.off = 0
+		c.sent = nil
+		c.advance()
+	}
+	if c.chunk == len(c.script.chunks) {
+		return 0, io.EOF
+	}
+	ch := c.script.chunks[c.chunk]
+	n := copy(p, ch.data[c.off:])
+	c.off += n
+	return n, nil
+}
+
+func (c *replayConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return 0, net.ErrClosed
+	}
+	c.advance()
+	if c.chunk == len(c.script.chunks) || !c.script.chunks[c.chunk].write {
+		return 0, fmt.Errorf("opio: 录制时客户端在此处没有发送数据: %w", ErrReplayMismatch)
+	}
+	// 压缩后的长度可能与录制时不同，在读取应答之前再一并校验
+	c.sent = append(c.sent, p...)
+	return len(p), nil
+}
+
+// verify - 校验客户端发送的数据与录制的发送片段一致
+func (c *replayConn) verify(recorded []byte) error {
+	if len(c.sent) == 0 {
+		return fmt.Errorf("opio: 录制时客户端在此处还应发送 %d 字节: %w", len(recorded), ErrReplayMismatch)
+	}
+	if bytes.Equal(c.sent, recorded) {
+		return nil
+	}
+	want, err := utils.DecodeFrames(recorded)
+	if err != nil {
+		return fmt.Errorf("opio: 解析录制的请求失败: %v: %w", err, ErrReplayMismatch)
+	}
+	got, err := utils.DecodeFrames(c.sent)
+	if err != nil {
+		return fmt.Errorf("opio: 解析客户端发送的数据失败: %v: %w", err, ErrReplayMismatch)
+	}
+	if len(got) != len(want) {
+		return fmt.Errorf("opio: 客户端发送了 %d 条消息，录制时为 %d 条: %w", len(got), len(want), ErrReplayMismatch)
+	}
+	for i := range want {
+		maskReqID(want[i])
+		maskReqID(got[i])
+		if !bytes.Equal(got[i], want[i]) {
+			return fmt.Errorf("opio: 客户端发送的第 %d 条消息与录制时不同: %w", i+1, ErrReplayMismatch)
+		}
+	}
+	return nil
+}
+
+// reqIDKey - 请求属性表中的 "Reqid" 键与 int64 类型标记，订阅的请求 ID 是随机生成的
+var reqIDKey = []byte("\xa5" + PropReqId + "\xd3")
+
+// maskReqID - 把消息中的请求 ID 清零
+func maskReqID(msg []byte) {
+	if i := bytes.Index(msg, reqIDKey); i >= 0 && i+len(reqIDKey)+8 <= len(msg) {
+		copy(msg[i+len(reqIDKey):], make([]byte, 8))
+	}
+}
+
+func (c *replayConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *replayConn) LocalAddr() net.Addr  { return replayAddr("replay") }
+func (c *replayConn) RemoteAddr() net.Addr { return replayAddr(c.script.addr) }
+
+// 回放的数据已经全部在内存中，读写不会阻塞，截止时间没有意义
+func (c *replayConn) SetDeadline(t time.Time) error      { return nil }
+func (c *replayConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *replayConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// replayAddr - 录制时的服务端地址
+type replayAddr string
+
+func (a replayAddr) Network() string { return "tcp" }
+func (a replayAddr) String() string  { return string(a) }
@@ -0,0 +1,140 @@
+package opio_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tc252617228/opio"
+	"github.com/tc252617228/opio/opiotest"
+)
+
+// recordQuery 在 versionServer 上执行一次 Point 查询并录制会话
+func recordQuery(t *testing.T, path string) {
+	srv := &versionServer{version: 0x030512, info: "OpenPlant 3.5.18"}
+	host, port := listenLocal(t, srv.serve)
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+	rec := opio.NewSessionRecorder(f)
+
+	client, err := opio.Connect(context.Background(), host, port, "sis", "openplant", time.Second,
+		opio.WithDialer(rec.Dialer(nil)))
+	require.NoError(t, err)
+	res, err := client.Query(context.Background(), "Point", []string{"ID"}, nil)
+	require.NoError(t, err)
+	require.Len(t, res.Rows, 2)
+	require.NoError(t, client.Close())
+	require.NoError(t, rec.Flush())
+}
+
+func loadSession(t *testing.T, path string) *opio.Session {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	sess, err := opio.LoadSession(f)
+	require.NoError(t, err)
+	return sess
+}
+
+func TestSessionRecordReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "query.opses")
+	recordQuery(t, path)
+	sess := loadSession(t, path)
+	require.Equal(t, 1, sess.Len())
+
+	// 回放时没有服务端，拨号地址被忽略
+	client, err := opio.Connect(context.Background(), "192.0.2.1", 8200, "sis", "openplant", time.Second,
+		opio.WithDialer(sess.Dialer()))
+	require.NoError(t, err)
+	defer client.Close()
+	assert.Equal(t, "3.5.18", client.Capabilities().String())
+	res, err := client.Query(context.Background(), "Point", []string{"ID"}, nil)
+	require.NoError(t, err)
+	require.Len(t, res.Rows, 2)
+	assert.Equal(t, int32(7), res.Rows[0]["ID"])
+	assert.Equal(t, int32(8), res.Rows[1]["ID"])
+
+	// 同一个会话可以再次直接回放到调用方的连接上
+	op, err := opio.InitConnContext(context.Background(), sess.Conn(0), "sis", "openplant")
+	require.NoError(t, err)
+	assert.Equal(t, "OpenPlant 3.5.18", op.Info())
+	require.NoError(t, op.Close())
+}
+
+func TestSessionReplayDiverged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "query.opses")
+	recordQuery(t, path)
+	sess := loadSession(t, path)
+
+	op, err := opio.InitConnContext(context.Background(), sess.Conn(0), "sis", "openplant")
+	require.NoError(t, err)
+	defer op.Close()
+	_, err = op.Peek()
+	assert.True(t, errors.Is(err, opio.ErrReplayMismatch), "请求发出之前读取应答: %v", err)
+
+	// 请求的长度与录制时相同但内容不同
+	client, err := opio.Connect(context.Background(), "192.0.2.1", 8200, "sis", "openplant", time.Second,
+		opio.WithDialer(sess.Dialer()))
+	require.NoError(t, err)
+	defer client.Close()
+	_, err = client.Query(context.Background(), "Point", []string{"GN"}, nil)
+	assert.True(t, errors.Is(err, opio.ErrReplayMismatch), "请求内容不同: %v", err)
+
+	// 录制的会话只有一个连接
+	_, err = sess.Dialer().DialContext(context.Background(), "tcp", "")
+	assert.True(t, errors.Is(err, opio.ErrReplayMismatch))
+}
+
+func TestLoadSessionRejectsGarbage(t *testing.T) {
+	_, err := opio.LoadSession(bytes.NewReader([]byte("OPIOCAP\x01")))
+	assert.Error(t, err)
+	_, err = opio.LoadSession(bytes.NewReader([]byte("OPIOSES\x01\x01\x00\x00\x00\x00\x00\x00\x00\x01")))
+	assert.Error(t, err, "记录引用了不存在的连接")
+}
+
+func TestSessionReplayWithCompression(t *testing.T) {
+	srv := opiotest.NewServer()
+	defer srv.Close()
+	srv.AddPoints(opiotest.Point{ID: 1, Name: "W3.N.P1", Desc: "主汽压力", Unit: "MPa"})
+	cols := []string{"ID", "PN", "GN", "RT", "ED", "EU"}
+
+	// 录制时客户端开启了压缩
+	path := filepath.Join(t.TempDir(), "compressed.opses")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	rec := opio.NewSessionRecorder(f)
+	client, err := srv.Connect(context.Background(), opio.WithDialer(rec.Dialer(nil)))
+	require.NoError(t, err)
+	require.NoError(t, client.SetCompression(opio.ZIP_MODEL_Block))
+	_, err = client.Query(context.Background(), "Point", cols, nil)
+	require.NoError(t, err)
+	// 录制的是实际发出的压缩帧
+	assert.NotZero(t, client.TrafficStats().Sent[opio.ZIP_MODEL_Block].Frames)
+	require.NoError(t, client.Close())
+	require.NoError(t, rec.Flush())
+	require.NoError(t, f.Close())
+	sess := loadSession(t, path)
+
+	// 回放按解压后的内容校验请求
+	for i := 0; i < 20; i++ {
+		replay := opio.DialerFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+			return sess.Conn(0), nil
+		})
+		client, err := opio.Connect(context.Background(), "192.0.2.1", 8200, "sis", "openplant", time.Second, opio.WithDialer(replay))
+		require.NoError(t, err)
+		require.NoError(t, client.SetCompression(opio.ZIP_MODEL_Block))
+		res, err := client.Query(context.Background(), "Point", cols, nil)
+		require.NoError(t, err)
+		require.Len(t, res.Rows, 1)
+		assert.Equal(t, "MPa", res.Rows[0]["EU"])
+		require.NoError(t, client.Close())
+	}
+}
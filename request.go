@@ -2,6 +2,7 @@ package opio
 
 import (
 	"errors"
+	"sort"
 	"strconv"
 	"sync"
 
@@ -309,6 +310,47 @@ func (req *Request) GetSQL() string {
 	return ""
 }
 
+// GetColumns - 请求的 Columns 属性 (服务端读取请求后使用)，客户端查询所有列时为一个名为 "*" 的列
+func (req *Request) GetColumns() []Column {
+	req.Lock()
+	defer req.Unlock()
+	switch v := req.props[PropColumns].(type) {
+	case Columns:
+		return v.columns
+	case *Table:
+		return v.columns
+	}
+	return nil
+}
+
+// GetIndexes - 请求的 Indexes 属性：[]int32、[]int64 或 []string，没有时为 nil
+func (req *Request) GetIndexes() interface{} {
+	req.Lock()
+	defer req.Unlock()
+	if i, ok := req.props[PropIndexes].(Indexs); ok {
+		return i.GetKeys()
+	}
+	return nil
+}
+
+// GetFilters - 请求的 Filters 属性
+func (req *Request) GetFilters() []Filter {
+	req.Lock()
+	defer req.Unlock()
+	if f, ok := req.props[PropFilters].(Filters); ok {
+		return f.filters
+	}
+	return nil
+}
+
+// IsAsync - 是否为订阅请求 (Async 属性非 0)，包括 Subscribe 属性表示的增删订阅键
+func (req *Request) IsAsync() bool {
+	req.Lock()
+	defer req.Unlock()
+	async, ok := numberValue(req.props[PropAsync])
+	return ok && async != 0
+}
+
 // Set -
 func (req *Request) Set(k string, v interface{}) {
 	req.Lock()
@@ -348,6 +390,7 @@ func (req *Request) Write() error {
 	req.Lock()
 	defer req.Unlock()
 	var err error
+	req.buff.TraceProps(true, req.props)
 	size := len(req.props)
 	_ = req.buff.EncodeMapStart(uint32(size))
 	io := req.buff
@@ -369,10 +412,16 @@ func (req *Request) Write() error {
 		}
 	}
 
-	for key, v := range req.props {
-		if key == PropTable {
-			continue
+	// 其余属性按名称排序编码，相同的请求总是编码为相同的字节 (会话回放按内容校验请求)
+	keys := make([]string, 0, size)
+	for key := range req.props {
+		if key != PropTable {
+			keys = append(keys, key)
 		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		v := req.props[key]
 		err = io.EncodeString(key)
 		if err == nil {
 			switch key {
@@ -482,6 +531,11 @@ func (req *Request) Read() error {
 		req.dataSet.isFirst = true
 	}()
 
+	return req.readProps()
+}
+
+// readProps - 跳过服务端插入的心跳探测，读取属性表
+func (req *Request) readProps() error {
 	var io = req.buff
 
 	var err error
@@ -562,6 +616,7 @@ func (req *Request) Read() error {
 			break
 		}
 	}
+	req.buff.TraceProps(false, req.props)
 	return nil
 }
 
@@ -585,7 +640,9 @@ func (req *Request) ReadV4() error {
 // GetResponse -
 func (req *Request) GetResponse() (res *Response, err error) {
 	res = req.MakeResponse()
-	_ = res.Read()
+	if err = res.Read(); err != nil {
+		return res, err
+	}
 	return res, nil
 }
 
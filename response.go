@@ -1,6 +1,10 @@
 package opio
 
-import "fmt"
+import (
+	"fmt"
+	"math"
+	"time"
+)
 
 // Response -
 type Response struct {
@@ -78,56 +82,32 @@ func (resp *Response) GetErrNo() int32 {
 	return -1
 }
 
-// encodeAndWriteToBuffer encodes the response properties and table into the buffer.
-// 注意：这个方法是根据 Request.write 的行为推断的，可能需要根据实际逻辑调整。
+// encodeAndWriteToBuffer - 写出属性表与结果集，格式与客户端的 Request.Read 对应：结果集为 VtRow 扩展类型的数组。
+// 属性表中没有 Columns (未设置结果集) 时只写出属性表。
 func (resp *Response) encodeAndWriteToBuffer() error {
-	resp.Lock()
-	defer resp.Unlock()
-
-	// 1. 编码属性 (props map)
-	// 使用顶层 EncodeMap 函数
-	_, propsData, err := EncodeMap(resp.props)
-	if err != nil {
-		return fmt.Errorf("response write: failed to encode props map: %w", err)
+	table := resp.resultTable()
+	if table != nil {
+		if errs := table.GetErrors(); len(errs) > 0 {
+			return fmt.Errorf("response write: invalid data set %s: %w", table.Name(), errs[0])
+		}
 	}
-	// 将编码后的属性数据写入缓冲区
-	err = resp.buff.PutBytes(propsData) // 使用 PutBytes
-	if err != nil {
-		return fmt.Errorf("response write: failed to write encoded props to buffer: %w", err)
-	}
-
-	// 2. 编码表格 (table)
-	// Table 没有 Encode 方法，直接写入每行的原始数据
-	if resp.table != nil && resp.table.rowCount > 0 {
-		// 写入行数 (假设需要，这里用 int32)
-		// 注意：协议可能需要不同的方式表示表格数据，这里只是一个可能的实现
-		// err = resp.buff.PutInt32(int32(resp.table.rowCount)) // 示例：写入行数
-		// if err != nil {
-		// 	return fmt.Errorf("response write: failed to write row count: %w", err)
-		// }
-
-		// 迭代写入每行数据
-		for i, row := range resp.table.rows {
-			if row.Data == nil {
-				// 处理空行数据？根据协议决定是跳过、写入空标记还是报错
-				// 暂时跳过空行
-				continue
-			}
-			err = resp.buff.PutBytes(row.Data) // 使用 PutBytes
-			if err != nil {
-				return fmt.Errorf("response write: failed to write row %d data to buffer: %w", i, err)
-			}
+	if err := resp.Request.Write(); err != nil {
+		return fmt.Errorf("response write: failed to write props: %w", err)
+	}
+	if table != nil && len(table.rows) > 0 {
+		if err := resp.WriteContent(table); err != nil {
+			return fmt.Errorf("response write: failed to write rows: %w", err)
 		}
-	} else {
-		// 如果没有表格数据，可能需要写入一个空标记，例如 nil 或空 map/slice
-		// 暂时不写入任何内容表示空表格
-		// err = resp.buff.EncodeNil() // 示例
-		// if err != nil {
-		// 	return fmt.Errorf("response write: failed to write nil for empty table: %w", err)
-		// }
 	}
+	return nil
+}
 
-	return nil // 所有写入成功
+// resultTable - 属性表中的结果集，未设置时返回 nil
+func (resp *Response) resultTable() *Table {
+	resp.Lock()
+	defer resp.Unlock()
+	t, _ := resp.props[PropColumns].(*Table)
+	return t
 }
 
 // Write -
@@ -157,3 +137,101 @@ func (resp *Response) Echo() (bool, error) {
 	}
 	return true, nil
 }
+
+// DataSetWriter 构造应答中的结果集。先用 AddColumn 定义列，再用 Append / AppendMap 逐行写入；
+// 也可以直接使用内嵌 Table 的 SetColumn* 与 BindRow。结果集随应答一起写出。
+type DataSetWriter struct {
+	*Table
+}
+
+// DataSet 为应答创建名为 name 的结果集，替换之前设置的结果集。
+func (resp *Response) DataSet(name string) *DataSetWriter {
+	t := NewTable(name, 0)
+	resp.Lock()
+	defer resp.Unlock()
+	resp.props[PropTable] = name
+	resp.props[PropColumns] = t
+	resp.table = t
+	return &DataSetWriter{Table: t}
+}
+
+// Append 按列的顺序写入一行。nil 表示空值，数值按列类型转换，time.Time 写入 VtDateTime 列。
+// 写入失败的结果集不能再使用，应答会以错误返回。
+func (w *DataSetWriter) Append(values ...interface{}) error {
+	if len(values) != int(w.colCount) {
+		err := fmt.Errorf("data set %s: %d values for %d columns", w.name, len(values), w.colCount)
+		w.errors = append(w.errors, err)
+		return err
+	}
+	for i, v := range values {
+		if err := w.set(uint32(i), v); err != nil {
+			return err
+		}
+	}
+	w.BindRow()
+	return nil
+}
+
+// AppendMap 按列名写入一行，缺少的列为空值，结果集中不存在的列返回错误。
+func (w *DataSetWriter) AppendMap(row map[string]interface{}) error {
+	values := make([]interface{}, w.colCount)
+	for name, v := range row {
+		found := false
+		for i := range w.columns {
+			if w.columns[i].name == name {
+				values[i], found = v, true
+				break
+			}
+		}
+		if !found {
+			err := fmt.Errorf("data set %s: column %s not exist", w.name, name)
+			w.errors = append(w.errors, err)
+			return err
+		}
+	}
+	return w.Append(values...)
+}
+
+// set - 按列类型写入一个值
+func (w *DataSetWriter) set(col uint32, v interface{}) error {
+	typ := w.columns[col].typ
+	switch x := v.(type) {
+	case nil:
+		switch typ {
+		case VtString, VtBinary, VtObject, VtSlice, VtMap, VtStructure:
+			return w.SetColumnEmpty(col)
+		}
+		return nil // 定长列不设置空值位即为空
+	case time.Time:
+		if typ == VtDateTime {
+			return w.SetColumnDateTime(col, x)
+		}
+	case int:
+		v = int64(x)
+	}
+	if _, isBool := v.(bool); !isBool && typ != VtBool {
+		if n, ok := numberValue(v); ok {
+			switch typ {
+			case VtInt8:
+				return w.SetColumnInt8(col, int8(n), 0)
+			case VtInt16:
+				return w.SetColumnInt16(col, int16(n), 0)
+			case VtInt32:
+				return w.SetColumnInt32(col, int32(n), 0)
+			case VtInt64:
+				if i, ok := v.(int64); ok {
+					return w.SetColumnInt64(col, i, 0) // 避免大整数经 float64 损失精度
+				}
+				return w.SetColumnInt64(col, int64(n), 0)
+			case VtFloat:
+				return w.SetColumnFloat(col, float32(n))
+			case VtDouble:
+				return w.SetColumnDouble(col, n)
+			case VtDateTime:
+				whole, frac := math.Modf(n)
+				return w.SetColumnDateTime(col, time.Unix(int64(whole), int64(frac*1e9)))
+			}
+		}
+	}
+	return w.SetColumnValue(col, v)
+}
@@ -0,0 +1,290 @@
+package opio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// ErrRowsClosed 表示在已关闭 (或尚未调用 Next) 的 Rows 上读取数据。
+var ErrRowsClosed = errors.New("opio: rows are closed")
+
+// Rows 是 QueryRows / ExecSQLRows 返回的流式结果集游标，直接建立在 OPDataSet 之上：
+// 只有调用 Next 时才从网络读取下一行所在的数据帧，内存占用与结果集的大小无关。
+//
+// Rows 在关闭之前独占一个连接池中的连接，使用完毕后必须调用 Close (通常用 defer)。
+// Next 返回 false 时 Rows 会自动关闭，之后应检查 Err。ctx 被取消或超时时阻塞中的读取立即返回，
+// Err 返回统一包装的超时 (ErrTimeout) 或取消错误。Rows 不能在多个 goroutine 中并发使用，
+// 要打断阻塞中的 Next 请取消 ctx。
+//
+// 用法:
+//
+//	rows, err := client.QueryRows(ctx, "Archive", []string{"ID", "TM", "AV"}, opts)
+//	if err != nil { ... }
+//	defer rows.Close()
+//	for rows.Next() {
+//	    var id int32
+//	    var tm time.Time
+//	    var av float64
+//	    if err := rows.Scan(&id, &tm, &av); err != nil { ... }
+//	}
+//	if err := rows.Err(); err != nil { ... }
+type Rows struct {
+	c      *Client
+	ctx    context.Context
+	action string
+	table  string
+
+	op   *IOConnect
+	set  *OPDataSet
+	cols []Column
+	stop func() // 停止监视 ctx
+
+	err    error
+	onRow  bool // 游标位于一个有效的行上
+	closed bool
+}
+
+// QueryRows 与 Query 相同，但返回流式的 Rows 游标，不把结果集一次读入内存，适合导出大量数据。
+// 客户端的默认超时 (SetDefaultTimeout) 只作用于发送请求与等待应答头，读取数据行的时长只受 ctx 控制。
+func (c *Client) QueryRows(ctx context.Context, tableName string, columns []string, opts *QueryOptions) (*Rows, error) {
+	filters, err := opts.filters()
+	if err != nil {
+		return nil, fmt.Errorf("opio.Client.QueryRows: %w", err)
+	}
+	return c.openRows(ctx, "opio.Client.QueryRows: 查询操作", tableName, func(req *Request) {
+		c.setQuery(req, tableName, columns, opts, filters)
+	})
+}
+
+// ExecSQLRows 与 ExecSQL 相同 (包括 args 的绑定)，但返回流式的 Rows 游标。没有结果集的语句返回一个没有行的 Rows。
+// 默认超时的处理与 QueryRows 相同。
+func (c *Client) ExecSQLRows(ctx context.Context, sql string, args ...interface{}) (*Rows, error) {
+	if len(args) > 0 {
+		bound, err := BindSQL(sql, args...)
+		if err != nil {
+			return nil, fmt.Errorf("opio.Client.ExecSQLRows: %w", err)
+		}
+		sql = bound
+	}
+	return c.openRows(ctx, "opio.Client.ExecSQLRows: SQL 执行操作", "", func(req *Request) {
+		req.SetService("openplant")
+		req.SetAction(ActionExecSQL)
+		req.SetSQL(sql)
+	})
+}
+
+// openRows 借出连接发送 build 构造的请求并读取应答头，成功时连接交给返回的 Rows，由 Rows.Close 归还。
+func (c *Client) openRows(ctx context.Context, action string, tableName string, build func(req *Request)) (*Rows, error) {
+	if c.closed() {
+		return nil, ErrConnectionClosed
+	}
+	detail := ""
+	if tableName != "" {
+		detail = fmt.Sprintf(" (Table: %s)", tableName)
+	}
+
+	// 默认超时只限制到收到应答头为止
+	open := ctx
+	if _, deadlineSet := ctx.Deadline(); !deadlineSet && c.defaultTimeout > 0 {
+		var cancel context.CancelFunc
+		open, cancel = context.WithTimeout(ctx, c.defaultTimeout)
+		defer cancel()
+	}
+
+	op, err := c.pool.acquire(open)
+	if err != nil {
+		if ctxErr := ctxError(open, action, tableName); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("%s: 获取连接失败: %w", action, err)
+	}
+	stop := op.watchContext(open)
+	var set *OPDataSet
+	if err = op.authorize(open); err == nil {
+		req := op.NewRequest(nil)
+		build(req)
+		if err = req.WriteAndFlush(); err != nil {
+			err = fmt.Errorf("%s: 发送请求失败%s: %w", action, detail, err)
+		} else if res, _ := req.GetResponse(); op.io.Err() != nil {
+			err = fmt.Errorf("%s: 获取响应失败%s: %w", action, detail, op.io.Err())
+		} else if res.GetErrNo() != 0 {
+			serverErr := &OpioServerError{Code: res.GetErrNo(), Message: res.GetError()}
+			err = fmt.Errorf("%s: 执行失败%s: %w", action, detail, serverErr)
+		} else {
+			set = res.GetDataSet()
+		}
+	}
+	stop()
+	if err != nil {
+		c.settleConn(open, op, err)
+		c.pool.release(op)
+		if ctxErr := ctxError(open, action, tableName); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+
+	rows := &Rows{c: c, ctx: ctx, action: action, table: tableName, op: op, set: set}
+	if set != nil {
+		rows.cols = set.GetColumns()
+	}
+	// 之后的读取只受调用方 ctx 的控制
+	_ = op.conn.SetDeadline(time.Time{})
+	rows.stop = op.watchContext(ctx)
+	return rows, nil
+}
+
+// Columns 返回结果集的列定义。
+func (r *Rows) Columns() []Column {
+	return r.cols
+}
+
+// Next 移动到下一行，按需从网络读取数据。没有更多行或出错时返回 false 并关闭 Rows，出错原因由 Err 返回。
+func (r *Rows) Next() bool {
+	r.onRow = false
+	if r.closed {
+		return false
+	}
+	if err := ctxError(r.ctx, r.action, r.table); err != nil {
+		// 已缓冲的数据行也不再返回，取消后立即结束迭代
+		r.err = err
+		r.release()
+		return false
+	}
+	if r.set == nil {
+		r.release()
+		return false
+	}
+	ok, err := r.set.Next()
+	if err != nil {
+		if ctxErr := ctxError(r.ctx, r.action, r.table); ctxErr != nil {
+			err = ctxErr
+		} else {
+			err = fmt.Errorf("%s: 读取数据集下一行时出错: %w", r.action, err)
+		}
+		r.err = err
+	}
+	if !ok {
+		r.release()
+		return false
+	}
+	r.onRow = true
+	return true
+}
+
+// Values 返回当前行各列的值，顺序与 Columns 相同；与 Query 一致，无法解码的列值为 nil。
+func (r *Rows) Values() ([]interface{}, error) {
+	if !r.onRow {
+		return nil, ErrRowsClosed
+	}
+	values := make([]interface{}, len(r.cols))
+	for i := range r.cols {
+		if v, err := r.set.GetValue(uint32(i)); err == nil {
+			values[i] = v
+		}
+	}
+	return values, nil
+}
+
+// Scan 把当前行各列的值按顺序复制到 dest 指向的变量中，dest 的个数必须与列数相同。
+// 列值为 nil 时目标被置为零值 (指针目标为 nil)；*interface{} 接收原始值，
+// 其他类型按 QueryResult.Scan 的规则转换 (例如数字与字符串互转、整数时间戳转 time.Time)。
+func (r *Rows) Scan(dest ...interface{}) error {
+	values, err := r.Values()
+	if err != nil {
+		return err
+	}
+	if len(dest) != len(values) {
+		return fmt.Errorf("opio.Rows.Scan: 目标个数 %d 与列数 %d 不一致", len(dest), len(values))
+	}
+	for i, d := range dest {
+		if err = scanValue(d, values[i]); err != nil {
+			return fmt.Errorf("opio.Rows.Scan: 列 '%s': %w", r.cols[i].GetName(), err)
+		}
+	}
+	return nil
+}
+
+// Err 返回迭代过程中遇到的错误，正常读完所有行时返回 nil。
+func (r *Rows) Err() error {
+	return r.err
+}
+
+// Close 关闭游标并归还连接：未读完的数据行会被读掉 (SkipAll)，读不完或出错的连接被丢弃而不是放回连接池。
+// 可以重复调用，返回迭代过程中遇到的错误。
+func (r *Rows) Close() error {
+	r.release()
+	return r.err
+}
+
+func (r *Rows) release() {
+	if r.closed {
+		return
+	}
+	r.closed = true
+	r.onRow = false
+	r.stop()
+	// settle 在限定时间内读掉剩余的应答，之后关闭数据集不会再读取网络
+	r.c.settleConn(r.ctx, r.op, r.err)
+	if r.set != nil {
+		r.set.Close()
+	}
+	r.c.pool.release(r.op)
+	r.op, r.set = nil, nil
+}
+
+// scanValue 把 Rows 中的一个列值 v 复制到 dest 指向的变量。
+func scanValue(dest interface{}, v interface{}) error {
+	if d, ok := dest.(*interface{}); ok {
+		if d == nil {
+			return fmt.Errorf("%w: 目标为 nil", ErrScanTargetInvalid)
+		}
+		*d = v
+		return nil
+	}
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() {
+		return fmt.Errorf("%w: 目标不是指针或为 nil", ErrScanTargetInvalid)
+	}
+	target := dv.Elem()
+	if v == nil {
+		target.Set(reflect.Zero(target.Type()))
+		return nil
+	}
+	return assignScanned(target, reflect.ValueOf(v))
+}
+
+// assignScanned 把 src 赋给 target：指针目标分配新值，数字之间直接转换，其余交给 assignWithConversion。
+func assignScanned(target reflect.Value, src reflect.Value) error {
+	targetType := target.Type()
+	if src.Type().AssignableTo(targetType) {
+		target.Set(src)
+		return nil
+	}
+	if targetType.Kind() == reflect.Ptr {
+		ptr := reflect.New(targetType.Elem())
+		if err := assignScanned(ptr.Elem(), src); err != nil {
+			return err
+		}
+		target.Set(ptr)
+		return nil
+	}
+	if isNumberKind(src.Kind()) && isNumberKind(targetType.Kind()) {
+		target.Set(src.Convert(targetType))
+		return nil
+	}
+	return assignWithConversion(target, src)
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package opio_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tc252617228/opio"
+	"github.com/tc252617228/opio/opiotest"
+)
+
+// seedArchive 在 Archive 表中预置测点 1001 的 n 行历史值，v4 为 true 时服务端声明 4.1.0 版本
+func seedArchive(n int, v4 bool) func(*opiotest.Server) {
+	return func(srv *opiotest.Server) {
+		if v4 {
+			srv.SetVersion(4, 1, 0)
+		}
+		srv.AddPoints(opiotest.Point{ID: 1001, Name: "W3.UNIT1.AI1001", Type: opio.TypeR8})
+		values := make([]opio.Value, n)
+		for i := range values {
+			values[i] = opio.Value{ID: 1001, TM: int32(1700000000 + i), AV: float64(i)}
+		}
+		srv.AddArchive(values...)
+	}
+}
+
+func TestRowsStream(t *testing.T) {
+	for _, v4 := range []bool{false, true} {
+		_, client := opiotest.NewClient(t, seedArchive(20000, v4))
+		ctx := context.Background()
+
+		rows, err := client.QueryRows(ctx, "Archive", []string{"ID", "GN", "TM", "AV"}, nil)
+		require.NoError(t, err)
+		require.Len(t, rows.Columns(), 4)
+		n := 0
+		for rows.Next() {
+			var (
+				id int64
+				gn *string
+				tm time.Time
+				av interface{}
+			)
+			require.NoError(t, rows.Scan(&id, &gn, &tm, &av))
+			assert.Equal(t, int64(1001), id)
+			require.NotNil(t, gn)
+			assert.Equal(t, "W3.UNIT1.AI1001", *gn)
+			assert.Equal(t, int64(1700000000+n), tm.Unix())
+			assert.Equal(t, float64(n), av)
+			n++
+		}
+		require.NoError(t, rows.Err())
+		assert.Equal(t, 20000, n, "v4=%v", v4)
+		assert.False(t, rows.Next())
+		assert.ErrorIs(t, rows.Scan(new(int)), opio.ErrRowsClosed)
+		assert.Equal(t, 0, client.PoolStats().InUse)
+
+		rows, err = client.ExecSQLRows(ctx, "SELECT ID, AV FROM Archive WHERE AV < 3")
+		require.NoError(t, err)
+		var got []string
+		for rows.Next() {
+			values, err := rows.Values()
+			require.NoError(t, err)
+			assert.Equal(t, int32(1001), values[0])
+			var av string
+			require.NoError(t, rows.Scan(new(int32), &av))
+			got = append(got, av)
+		}
+		require.NoError(t, rows.Close())
+		assert.Equal(t, []string{"0", "1", "2"}, got)
+	}
+}
+
+func TestRowsCloseAndCancel(t *testing.T) {
+	_, client := opiotest.NewClient(t, seedArchive(20000, false))
+	require.NoError(t, client.SetPoolConfig(opio.PoolConfig{MaxConns: 1}))
+
+	// 只读一行就关闭，剩余的数据被读掉，连接回到连接池后可以继续使用
+	rows, err := client.QueryRows(context.Background(), "Archive", []string{"ID", "AV"}, nil)
+	require.NoError(t, err)
+	require.True(t, rows.Next())
+	require.NoError(t, rows.Close())
+	require.NoError(t, rows.Close())
+	res, err := client.ExecSQL(context.Background(), "SELECT ID FROM Point")
+	require.NoError(t, err)
+	assert.Len(t, res.Rows, 1)
+
+	// 迭代中途取消
+	ctx, cancel := context.WithCancel(context.Background())
+	rows, err = client.QueryRows(ctx, "Archive", []string{"ID", "AV"}, nil)
+	require.NoError(t, err)
+	require.True(t, rows.Next())
+	cancel()
+	assert.False(t, rows.Next())
+	assert.True(t, errors.Is(rows.Err(), context.Canceled), "%v", rows.Err())
+	assert.ErrorIs(t, rows.Close(), context.Canceled)
+	res, err = client.ExecSQL(context.Background(), "SELECT ID FROM Point")
+	require.NoError(t, err)
+	assert.Len(t, res.Rows, 1)
+
+	// 服务端错误在打开游标时返回，连接仍然可用
+	_, err = client.ExecSQLRows(context.Background(), "SELECT * FROM Missing")
+	var serverErr *opio.OpioServerError
+	require.True(t, errors.As(err, &serverErr), "%v", err)
+	assert.Equal(t, 0, client.PoolStats().InUse)
+}
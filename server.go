@@ -0,0 +1,505 @@
+package opio
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tc252617228/opio/internal/utils"
+)
+
+// ErrServerClosed 由 Server.Serve 在 Close 之后返回。
+var ErrServerClosed = errors.New("opio: server closed")
+
+// ErrLoginFailed 表示用户名或口令错误，UserVerifier 的实现可以返回它。
+var ErrLoginFailed = errors.New("opio: invalid user or password")
+
+// 服务端返回的错误码
+const (
+	ErrnoFailed      int32 = -1 // 处理请求失败
+	ErrnoLogin       int32 = -2 // 登录失败
+	ErrnoUnsupported int32 = -3 // 没有处理该 Action 与 Table 的 Handler
+)
+
+// defaultServerInfo - 问候包中的服务端版本信息，客户端从中解析版本号 (见 Capabilities)
+const defaultServerInfo = "OpenPlant 3.5.0 opio"
+
+// UserVerifier 校验登录请求。random 为问候包中发给客户端的随机数，scramble 为客户端用口令散列后的应答
+// (客户端没有口令时为空)，可以用 VerifyScramble 与已知口令比较。返回错误时拒绝登录。
+type UserVerifier interface {
+	VerifyUser(user string, random, scramble []byte) error
+}
+
+// UserVerifierFunc 把函数适配为 UserVerifier。
+type UserVerifierFunc func(user string, random, scramble []byte) error
+
+// VerifyUser 调用 f(user, random, scramble)。
+func (f UserVerifierFunc) VerifyUser(user string, random, scramble []byte) error {
+	return f(user, random, scramble)
+}
+
+// StaticUsers 是用户名到口令的映射，只允许其中的用户以正确的口令登录。
+type StaticUsers map[string]string
+
+// VerifyUser 校验用户存在且口令正确，否则返回 ErrLoginFailed。
+func (u StaticUsers) VerifyUser(user string, random, scramble []byte) error {
+	password, ok := u[user]
+	if !ok || !VerifyScramble(random, scramble, password) {
+		return ErrLoginFailed
+	}
+	return nil
+}
+
+// VerifyScramble 判断客户端发送的散列 scramble 是否由 password 与 random 计算而来。
+func VerifyScramble(random, scramble []byte, password string) bool {
+	if password == "" {
+		return len(scramble) == 0
+	}
+	return subtle.ConstantTimeCompare(utils.Scramle(random, []byte(password)), scramble) == 1
+}
+
+// Handler 处理一个 Request 风格的请求。ServeOPIO 返回后 res 被写回客户端，
+// 调用方在此之前读掉请求中未读取的数据 (例如 Insert 的数据行)。
+type Handler interface {
+	ServeOPIO(ctx context.Context, res *Response, req *Request)
+}
+
+// HandlerFunc 把函数适配为 Handler。
+type HandlerFunc func(ctx context.Context, res *Response, req *Request)
+
+// ServeOPIO 调用 f(ctx, res, req)。
+func (f HandlerFunc) ServeOPIO(ctx context.Context, res *Response, req *Request) {
+	f(ctx, res, req)
+}
+
+// ServeMux 按请求的 Action 与 Table 分发请求，二者都不区分大小写。
+// 同时注册了具体表名与任意表 ("") 时优先使用具体表名的 Handler；没有匹配的 Handler 时返回 ErrnoUnsupported。
+type ServeMux struct {
+	mu     sync.RWMutex
+	routes map[serveRoute]Handler
+}
+
+type serveRoute struct {
+	action, table string
+}
+
+// NewServeMux 创建空的 ServeMux。
+func NewServeMux() *ServeMux {
+	return &ServeMux{routes: make(map[serveRoute]Handler)}
+}
+
+// Handle 注册处理 action (ActionSelect、ActionInsert 等) 与表 table 的 Handler，table 为空时匹配任意表。
+func (m *ServeMux) Handle(action, table string, h Handler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.routes[serveRoute{strings.ToLower(action), strings.ToLower(table)}] = h
+}
+
+// HandleFunc 注册处理函数，见 Handle。
+func (m *ServeMux) HandleFunc(action, table string, f func(ctx context.Context, res *Response, req *Request)) {
+	m.Handle(action, table, HandlerFunc(f))
+}
+
+// ServeOPIO 把请求分发给匹配的 Handler。
+func (m *ServeMux) ServeOPIO(ctx context.Context, res *Response, req *Request) {
+	action, table := strings.ToLower(req.GetAction()), strings.ToLower(req.GetTableName())
+	m.mu.RLock()
+	h, ok := m.routes[serveRoute{action, table}]
+	if !ok {
+		h, ok = m.routes[serveRoute{action, ""}]
+	}
+	m.mu.RUnlock()
+	if !ok {
+		res.SetErrNo(ErrnoUnsupported)
+		res.SetError(fmt.Sprintf("unsupported action %s on table %s", req.GetAction(), req.GetTableName()))
+		return
+	}
+	h.ServeOPIO(ctx, res, req)
+}
+
+// Peer 描述发出请求的客户端连接，可以通过 PeerFromContext 在 Handler 中获取。
+type Peer struct {
+	User string   // 登录用户名
+	Addr net.Addr // 客户端地址
+}
+
+type peerKey struct{}
+
+// PeerFromContext 返回 Handler 的 ctx 中的客户端连接信息。
+func PeerFromContext(ctx context.Context) (Peer, bool) {
+	p, ok := ctx.Value(peerKey{}).(Peer)
+	return p, ok
+}
+
+// Pusher 在一个客户端连接上发送订阅推送，可以通过 PusherFromContext 在 Handler 中获取。
+// 订阅请求 (Async=1，见 Request.IsAsync) 没有应答：Handler 保存 Pusher，之后在数据变化时从任意协程调用 Push。
+// 连接断开时 Handler 的 ctx 被取消，之后的 Push 返回 ErrConnectionClosed。
+type Pusher struct {
+	c *serverConn
+}
+
+type pusherKey struct{}
+
+// PusherFromContext 返回 Handler 的 ctx 中的 Pusher。
+func PusherFromContext(ctx context.Context) (*Pusher, bool) {
+	p, ok := ctx.Value(pusherKey{}).(*Pusher)
+	return p, ok
+}
+
+// Push 发送一次推送：fill 构造推送的内容 (通常调用 res.DataSet 写入变化的行)，推送总是按 v3 格式写出，
+// 与该连接上的应答串行发送。结果集出错时不发送并返回该错误。
+func (p *Pusher) Push(fill func(res *Response)) error {
+	res := NewResponse(&Request{buff: p.c.out})
+	fill(res)
+	if t := res.resultTable(); t != nil {
+		if errs := t.GetErrors(); len(errs) > 0 {
+			return errs[0]
+		}
+	}
+	return p.c.write(res)
+}
+
+// Server 是 OpenPlant 协议的服务端框架：接受连接，完成登录握手，读取 Request 风格的请求并交给 Handler 处理，
+// 再把 Response 写回客户端。
+// 客户端的心跳 (IOConnect.Echo) 由 Server 直接应答；V3 二进制命令 (实时/历史数据) 交给 V3，V3 为空时断开连接。
+// 订阅请求同样交给 Handler，推送通过 PusherFromContext 发送。
+// 字段在调用 Serve 之后不应再修改。
+type Server struct {
+	Handler  Handler      // 处理请求，通常为 *ServeMux
+	Verifier UserVerifier // 校验登录，为空时接受任意用户
+	V3       V3Handler    // 处理 V3 二进制命令，为空时不支持这些命令
+
+	// Info 为问候包中的服务端版本信息，客户端从中解析版本号 (见 Capabilities)。
+	// 为空时使用 "OpenPlant 3.5.0 opio"。
+	Info string
+
+	// IdleTimeout 为连接上两个请求之间的最长等待时间，超时后断开连接，0 表示不限制。
+	IdleTimeout time.Duration
+
+	// ErrorLog 记录处理连接时的错误，为空时使用标准库 log 的默认 Logger。
+	ErrorLog *log.Logger
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// ListenAndServe 监听 TCP 地址 addr 并调用 Serve。
+func (s *Server) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve 在 ln 上接受连接，每个连接由一个协程处理。Serve 总是返回非空错误，Close 之后返回 ErrServerClosed。
+func (s *Server) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		_ = ln.Close()
+		return ErrServerClosed
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+		s.conns = make(map[net.Conn]struct{})
+	}
+	s.listeners[ln] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, ln)
+		s.mu.Unlock()
+		_ = ln.Close()
+	}()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = conn.Close()
+			return ErrServerClosed
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.serveConn(conn)
+	}
+}
+
+// Close 停止所有监听并断开所有连接，等待连接协程退出。
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for ln := range s.listeners {
+		_ = ln.Close()
+	}
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return nil
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// serverConn - 服务端的一个客户端连接。读写使用各自的缓冲区：订阅推送可以在读取下一个请求的同时写出，
+// 所有写操作 (应答、推送、心跳回包) 都持有 wmu。
+type serverConn struct {
+	conn net.Conn
+	in   *utils.Buffer
+	out  *utils.Buffer
+
+	wmu    sync.Mutex
+	closed bool // out 已归还，持有 wmu 访问
+}
+
+// serverReader - in 缓冲区的底层连接：读取心跳探测时的裸写回包与应答、推送一样持有 wmu
+type serverReader struct {
+	c *serverConn
+}
+
+func (r serverReader) Read(p []byte) (int, error) { return r.c.conn.Read(p) }
+func (r serverReader) Close() error               { return r.c.conn.Close() }
+
+func (r serverReader) Write(p []byte) (int, error) {
+	r.c.wmu.Lock()
+	defer r.c.wmu.Unlock()
+	return r.c.conn.Write(p)
+}
+
+// write - 写出一个完整的应答
+func (c *serverConn) write(res *Response) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closed {
+		return ErrConnectionClosed
+	}
+	return res.WriteAndFlush()
+}
+
+// writeRaw - 写出未分帧的数据 (V3 写入类命令的应答)
+func (c *serverConn) writeRaw(p []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closed {
+		return ErrConnectionClosed
+	}
+	return c.out.DirectWrite(p)
+}
+
+func (c *serverConn) release() {
+	c.wmu.Lock()
+	c.closed = true
+	c.out.Release()
+	c.wmu.Unlock()
+	c.in.Release()
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	c := &serverConn{conn: conn}
+	c.in = utils.NewBuffer(serverReader{c}, max_buffer_size)
+	c.out = utils.NewBuffer(conn, max_buffer_size)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		_ = conn.Close()
+		c.release()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		s.wg.Done()
+	}()
+
+	user, err := s.handshake(c)
+	if err != nil {
+		if !s.isClosed() && !errors.Is(err, ErrLoginFailed) {
+			s.logf("opio: login from %s failed: %v", conn.RemoteAddr(), err)
+		}
+		return
+	}
+	ctx = context.WithValue(ctx, peerKey{}, Peer{User: user, Addr: conn.RemoteAddr()})
+	ctx = context.WithValue(ctx, pusherKey{}, &Pusher{c: c})
+
+	for {
+		if s.IdleTimeout > 0 {
+			_ = conn.SetReadDeadline(time.Now().Add(s.IdleTimeout))
+		}
+		if err = s.serveRequest(ctx, c); err != nil {
+			if !s.isClosed() && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				s.logf("opio: serve %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+	}
+}
+
+// handshake - 发送问候包，校验客户端的登录包并返回确认包
+func (s *Server) handshake(c *serverConn) (string, error) {
+	info := s.Info
+	if info == "" {
+		info = defaultServerInfo
+	}
+	caps := newCapabilities(0, info)
+
+	// server: SERVER_VERSION(60) + session(4) + SCRAMBLE(20) + 12 + ver(4)
+	greeting := make([]byte, 100)
+	copy(greeting[:60], info)
+	random := make([]byte, 20)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	copy(greeting[64:84], random)
+	utils.PutInt32(greeting[96:], int32(caps.Major<<16|caps.Minor<<8|caps.Patch))
+	_ = c.out.PutBytes(greeting)
+	if err := c.out.Flush(true); err != nil {
+		return "", err
+	}
+
+	// client: client_info(40) + session(4) + user(16) + passwd(2+20) + (18)
+	login := make([]byte, 100)
+	if err := c.in.GetBytes(login); err != nil {
+		return "", err
+	}
+	if err := c.in.SkipAll(); err != nil {
+		return "", err
+	}
+	user := strings.TrimRight(string(login[44:60]), "\x00")
+	n := int(utils.GetInt16(login[60:]))
+	if n < 0 || n > 20 {
+		n = 20
+	}
+	scramble := login[62 : 62+n]
+
+	var verr error
+	if s.Verifier != nil {
+		verr = s.Verifier.VerifyUser(user, random, scramble)
+	}
+
+	// magic, peer, error, magic
+	ack := make([]byte, 16)
+	utils.PutInt32(ack, MAGIC)
+	if addr, ok := c.conn.RemoteAddr().(*net.TCPAddr); ok {
+		copy(ack[4:8], addr.IP.To4())
+	}
+	if verr != nil {
+		utils.PutInt32(ack[8:], ErrnoLogin)
+	}
+	utils.PutInt32(ack[12:], MAGIC)
+	_ = c.out.PutBytes(ack)
+	if err := c.out.Flush(true); err != nil {
+		return "", err
+	}
+	if verr != nil {
+		return "", fmt.Errorf("%w: user %s: %v", ErrLoginFailed, user, verr)
+	}
+	return user, nil
+}
+
+// serveRequest - 读取一个请求 (先应答客户端心跳)：V3 二进制命令交给 serveV3，其余交给 Handler 处理并写回应答。
+// 订阅请求只在出错时应答。
+func (s *Server) serveRequest(ctx context.Context, c *serverConn) error {
+	req := &Request{buff: c.in}
+	req.Reset()
+	probe := make([]byte, 21)
+	for {
+		heartbeat, err := c.in.PeekN(probe)
+		if err != nil {
+			return err
+		}
+		if !heartbeat {
+			break
+		}
+		if echo, err := req.aliveDetectFilter(probe); err != nil {
+			return err
+		} else if !echo {
+			break
+		}
+	}
+	if b, err := c.in.Peek(); err != nil {
+		return err
+	} else if b == byte(MAGIC>>24) {
+		return s.serveV3(ctx, c)
+	}
+
+	if err := req.Read(); err != nil {
+		return err
+	}
+	res := NewResponse(req)
+	res.buff = c.out
+	if id := req.Get(PropReqId); id != nil {
+		res.Set(PropReqId, id)
+	}
+
+	s.handle(ctx, res, req)
+
+	// 读掉 Handler 没有读取的数据行
+	if err := c.in.SkipAll(); err != nil {
+		return err
+	}
+	if t := res.resultTable(); t != nil {
+		if errs := t.GetErrors(); len(errs) > 0 {
+			res.Reset()
+			res.SetErrNo(ErrnoFailed)
+			res.SetError(errs[0].Error())
+		}
+	}
+	if req.IsAsync() && res.GetErrNo() == 0 {
+		return nil
+	}
+	return c.write(res)
+}
+
+// handle - 调用 Handler，Handler 的 panic 作为请求失败返回给客户端
+func (s *Server) handle(ctx context.Context, res *Response, req *Request) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.logf("opio: handler panic: %v", r)
+			res.Reset()
+			res.SetErrNo(ErrnoFailed)
+			res.SetError(fmt.Sprint(r))
+		}
+	}()
+	if s.Handler == nil {
+		res.SetErrNo(ErrnoUnsupported)
+		res.SetError("no handler")
+		return
+	}
+	s.Handler.ServeOPIO(ctx, res, req)
+}
@@ -0,0 +1,265 @@
+package opio_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tc252617228/opio"
+)
+
+// startServer 在本机随机端口上运行 srv，返回监听地址
+func startServer(t *testing.T, srv *opio.Server) (string, int) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ln) }()
+	t.Cleanup(func() {
+		require.NoError(t, srv.Close())
+		assert.True(t, errors.Is(<-done, opio.ErrServerClosed))
+	})
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+func pointMux(inserted *[]map[string]interface{}, mu *sync.Mutex) *opio.ServeMux {
+	mux := opio.NewServeMux()
+	mux.HandleFunc(opio.ActionSelect, "Point", func(ctx context.Context, res *opio.Response, req *opio.Request) {
+		peer, _ := opio.PeerFromContext(ctx)
+		ds := res.DataSet("Point")
+		ds.AddColumn("ID", opio.VtInt32, 0)
+		ds.AddColumn("GN", opio.VtString, 0)
+		ds.AddColumn("USER", opio.VtString, 0)
+		for _, f := range req.GetFilters() {
+			if f.Left == "ID" && f.Right == "2" {
+				_ = ds.Append(2, "W3.N.P2", peer.User)
+				return
+			}
+		}
+		_ = ds.Append(1, "W3.N.P1", peer.User)
+		_ = ds.AppendMap(map[string]interface{}{"ID": int32(2), "GN": "W3.N.P2"})
+	})
+	mux.HandleFunc(opio.ActionInsert, "", func(ctx context.Context, res *opio.Response, req *opio.Request) {
+		set := req.GetDataSet()
+		cols := req.GetColumns()
+		for {
+			ok, err := set.Next()
+			if err != nil || !ok {
+				break
+			}
+			row := make(map[string]interface{}, len(cols))
+			for i, c := range cols {
+				row[c.GetName()], _ = set.GetValue(uint32(i))
+			}
+			mu.Lock()
+			*inserted = append(*inserted, row)
+			mu.Unlock()
+		}
+	})
+	mux.HandleFunc(opio.ActionDelete, "Point", func(ctx context.Context, res *opio.Response, req *opio.Request) {
+		panic("delete is not allowed")
+	})
+	return mux
+}
+
+func TestServerDispatch(t *testing.T) {
+	var mu sync.Mutex
+	var inserted []map[string]interface{}
+	srv := &opio.Server{Handler: pointMux(&inserted, &mu)}
+	host, port := startServer(t, srv)
+
+	client, err := opio.Connect(context.Background(), host, port, "sis", "openplant", time.Second)
+	require.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+
+	res, err := client.Query(ctx, "point", []string{"*"}, nil)
+	require.NoError(t, err)
+	require.Len(t, res.Rows, 2)
+	assert.Equal(t, int32(1), res.Rows[0]["ID"])
+	assert.Equal(t, "sis", res.Rows[0]["USER"])
+	assert.Equal(t, "W3.N.P2", res.Rows[1]["GN"])
+	assert.Empty(t, res.Rows[1]["USER"])
+
+	res, err = client.Query(ctx, "Point", []string{"*"}, &opio.QueryOptions{
+		Filters: []opio.Filter{{Left: "ID", Operator: opio.OperEQ, Right: "2"}},
+	})
+	require.NoError(t, err)
+	require.Len(t, res.Rows, 1)
+	assert.Equal(t, int32(2), res.Rows[0]["ID"])
+
+	require.NoError(t, client.Insert(ctx, "Alarm", []map[string]interface{}{{"ID": int32(7), "AV": 1.5}}))
+	mu.Lock()
+	assert.Equal(t, []map[string]interface{}{{"ID": int32(7), "AV": 1.5}}, inserted)
+	mu.Unlock()
+
+	var serverErr *opio.OpioServerError
+	_, err = client.ExecSQL(ctx, "select 1")
+	require.True(t, errors.As(err, &serverErr), "%v", err)
+	assert.Equal(t, opio.ErrnoUnsupported, serverErr.Code)
+
+	err = client.Delete(ctx, "Point", []opio.Filter{{Left: "ID", Operator: opio.OperEQ, Right: "1"}})
+	require.True(t, errors.As(err, &serverErr), "%v", err)
+	assert.Equal(t, opio.ErrnoFailed, serverErr.Code)
+	assert.Contains(t, serverErr.Message, "not allowed")
+
+	// Handler 出错之后连接仍然可用
+	_, err = client.Query(ctx, "Point", []string{"*"}, nil)
+	require.NoError(t, err)
+}
+
+func TestServerInfoAndEcho(t *testing.T) {
+	var mu sync.Mutex
+	var inserted []map[string]interface{}
+	srv := &opio.Server{Handler: pointMux(&inserted, &mu), Info: "OpenPlant 4.1.2"}
+	host, port := startServer(t, srv)
+
+	op, err := opio.InitContext(context.Background(), host, port, "sis", "openplant")
+	require.NoError(t, err)
+	defer op.Close()
+	assert.Equal(t, "4.1.2", op.Capabilities().String())
+	_, err = op.Echo(time.Second)
+	require.NoError(t, err)
+
+	client, err := opio.Connect(context.Background(), host, port, "sis", "openplant", time.Second)
+	require.NoError(t, err)
+	defer client.Close()
+	res, err := client.Query(context.Background(), "Point", []string{"*"}, nil)
+	require.NoError(t, err)
+	require.Len(t, res.Rows, 2)
+	assert.Equal(t, "W3.N.P1", res.Rows[0]["GN"])
+}
+
+func TestServerVerifier(t *testing.T) {
+	srv := &opio.Server{Handler: opio.NewServeMux(), Verifier: opio.StaticUsers{"admin": "secret", "guest": ""}}
+	host, port := startServer(t, srv)
+
+	_, err := opio.InitContext(context.Background(), host, port, "admin", "wrong")
+	var connErr *opio.ConnectError
+	require.True(t, errors.As(err, &connErr), "%v", err)
+	assert.Equal(t, opio.PhaseAuth, connErr.Phase)
+
+	for user, pass := range map[string]string{"admin": "secret", "guest": ""} {
+		op, err := opio.InitContext(context.Background(), host, port, user, pass)
+		require.NoError(t, err, user)
+		require.NoError(t, op.Close())
+	}
+}
+
+func TestDataSetWriterErrors(t *testing.T) {
+	mux := opio.NewServeMux()
+	mux.HandleFunc(opio.ActionSelect, "", func(ctx context.Context, res *opio.Response, req *opio.Request) {
+		ds := res.DataSet(req.GetTableName())
+		ds.AddColumn("ID", opio.VtInt32, 0)
+		_ = ds.Append(1, "extra")
+	})
+	host, port := startServer(t, &opio.Server{Handler: mux})
+	client, err := opio.Connect(context.Background(), host, port, "sis", "openplant", time.Second)
+	require.NoError(t, err)
+	defer client.Close()
+
+	_, err = client.Query(context.Background(), "Point", []string{"*"}, nil)
+	var serverErr *opio.OpioServerError
+	require.True(t, errors.As(err, &serverErr), "%v", err)
+	assert.Equal(t, opio.ErrnoFailed, serverErr.Code)
+	assert.Contains(t, serverErr.Message, "2 values for 1 columns")
+}
+
+// realtimeStub 是只实现实时数据读写的 V3Handler
+type realtimeStub struct {
+	mu     sync.Mutex
+	values map[int32]opio.Value
+}
+
+func (s *realtimeStub) ReadRealtime(ctx context.Context, values []opio.Value) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range values {
+		if v, ok := s.values[values[i].ID]; ok {
+			values[i] = v
+		} else {
+			values[i].RT = -1
+		}
+	}
+	return nil
+}
+
+func (s *realtimeStub) WriteRealtime(ctx context.Context, values []opio.Value) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range values {
+		if v.ID < 0 {
+			return errors.New("invalid id")
+		}
+		v.RT = opio.TypeR8
+		s.values[v.ID] = v
+	}
+	return nil
+}
+
+func (s *realtimeStub) ReadArchive(ctx context.Context, ids []int32, mode int32, begin, end time.Time, interval int32) ([]*opio.Archive, error) {
+	return nil, errors.New("not supported")
+}
+
+func (s *realtimeStub) WriteArchive(ctx context.Context, archives []*opio.Archive, cache bool) error {
+	return errors.New("not supported")
+}
+
+func (s *realtimeStub) ReadStat(ctx context.Context, ids []int32, mode int32, begin, end time.Time, interval int32) ([]*opio.Stat, error) {
+	return nil, errors.New("not supported")
+}
+
+func TestServerPushAndV3(t *testing.T) {
+	mux := opio.NewServeMux()
+	mux.HandleFunc(opio.ActionSelect, "Realtime", func(ctx context.Context, res *opio.Response, req *opio.Request) {
+		if !req.IsAsync() {
+			return
+		}
+		pusher, ok := opio.PusherFromContext(ctx)
+		require.True(t, ok)
+		keys := req.GetIndexes().([]int32)
+		go func() {
+			for _, id := range keys {
+				_ = pusher.Push(func(res *opio.Response) {
+					ds := res.DataSet("Realtime")
+					ds.AddColumn("ID", opio.VtInt32, 0)
+					ds.AddColumn("AV", opio.VtDouble, 0)
+					_ = ds.Append(id, float64(id)/10)
+				})
+			}
+		}()
+	})
+	stub := &realtimeStub{values: map[int32]opio.Value{}}
+	host, port := startServer(t, &opio.Server{Handler: mux, V3: stub})
+	client, err := opio.Connect(context.Background(), host, port, "sis", "openplant", time.Second)
+	require.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+
+	sub, err := client.Subscribe(ctx, "Realtime", "ID", []int32{7, 8}, nil)
+	require.NoError(t, err)
+	defer sub.Close()
+	for _, id := range []int32{7, 8} {
+		select {
+		case ev := <-sub.Events():
+			require.NoError(t, ev.Err)
+			assert.Equal(t, id, ev.Data["ID"])
+			assert.Equal(t, float64(id)/10, ev.Data["AV"])
+			require.Len(t, ev.Columns, 2)
+		case <-time.After(5 * time.Second):
+			t.Fatal("等待订阅推送超时")
+		}
+	}
+
+	require.NoError(t, client.WriteRealtime(ctx, []opio.Value{{ID: 7, TM: 100, AV: 1.5}}))
+	assert.Error(t, client.WriteRealtime(ctx, []opio.Value{{ID: -1}}))
+	values := []opio.Value{{ID: 7}, {ID: 9}}
+	require.NoError(t, client.ReadRealtime(ctx, values))
+	assert.Equal(t, opio.Value{ID: 7, RT: opio.TypeR8, TM: 100, AV: 1.5}, values[0])
+	assert.Equal(t, int8(-1), values[1].RT)
+}
@@ -0,0 +1,355 @@
+package opio
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tc252617228/opio/internal/utils"
+)
+
+// V3Handler 处理 V3 二进制命令 (实时与历史数据)。方法与 Client 的同名方法一致，
+// 因此 *Client 可以直接作为 Server.V3，把命令转发给上游服务器。
+// 读取实时数据时 values 的 ID 已设置，实现填充其余字段；没有数据的测点把 RT 设为 -1。
+type V3Handler interface {
+	ReadRealtime(ctx context.Context, values []Value) error
+	WriteRealtime(ctx context.Context, values []Value) error
+	ReadArchive(ctx context.Context, ids []int32, mode int32, begin, end time.Time, interval int32) ([]*Archive, error)
+	WriteArchive(ctx context.Context, archives []*Archive, cache bool) error
+	ReadStat(ctx context.Context, ids []int32, mode int32, begin, end time.Time, interval int32) ([]*Stat, error)
+}
+
+// serveV3 - 解码以 MAGIC 开头的二进制命令并调用 V3。格式与 api_v3.go 中客户端的编码对应，
+// 写入类命令以一个未分帧的字节应答 (0 表示成功)。
+func (s *Server) serveV3(ctx context.Context, c *serverConn) error {
+	in := c.in
+	_, _ = in.GetInt32() // MAGIC
+	cmd, _ := in.GetInt32()
+	url, err := in.GetInt32()
+	if err != nil {
+		return err
+	}
+	if s.V3 == nil {
+		return fmt.Errorf("unsupported command %d, url %#x", cmd, url)
+	}
+	switch {
+	case cmd == cmdSelect && url == urlDynamic:
+		return s.readRealtime(ctx, c)
+	case cmd == cmdInsert && url == urlDynamic:
+		return s.writeRealtime(ctx, c)
+	case cmd == cmdSelect && url == urlArchive:
+		return s.readArchive(ctx, c)
+	case cmd == cmdInsert && url == urlArchive:
+		return s.writeArchive(ctx, c)
+	}
+	return fmt.Errorf("unsupported command %d, url %#x", cmd, url)
+}
+
+// echo - 写入类命令的应答，err 非空时记录日志并返回失败
+func (s *Server) echo(c *serverConn, err error) error {
+	code := int8(0)
+	if err != nil {
+		s.logf("opio: V3 command from %s failed: %v", c.conn.RemoteAddr(), err)
+		code = int8(ErrnoFailed)
+	}
+	return c.writeRaw([]byte{byte(code)})
+}
+
+func (s *Server) readRealtime(ctx context.Context, c *serverConn) error {
+	in := c.in
+	_, _ = in.GetInt16()
+	_, _ = in.GetInt16()
+	count, err := in.GetInt32()
+	values := make([]Value, 0, count)
+	for i := int32(0); i < count && err == nil; i++ {
+		var v Value
+		if v.ID, err = in.GetInt32(); err == nil {
+			values = append(values, v)
+		}
+	}
+	if err == nil {
+		err = in.SkipAll()
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = s.V3.ReadRealtime(ctx, values); err != nil {
+		s.logf("opio: V3 command from %s failed: %v", c.conn.RemoteAddr(), err)
+		for i := range values {
+			values[i].RT = -1
+		}
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closed {
+		return ErrConnectionClosed
+	}
+	out := c.out
+	_ = out.PutInt32(MAGIC)
+	_ = out.PutInt32(0)
+	_ = out.PutInt32(int32(len(values)))
+	for i := range values {
+		v := &values[i]
+		_ = out.PutInt8(v.RT)
+		if v.RT == -1 {
+			_ = out.PutInt32(ErrnoFailed)
+			continue
+		}
+		writeValue(out, v.RT, v)
+	}
+	_ = out.PutInt32(MAGIC)
+	return out.Flush(true)
+}
+
+func (s *Server) writeRealtime(ctx context.Context, c *serverConn) error {
+	in := c.in
+	_, _ = in.GetInt16()
+	_, _ = in.GetInt16() // flag
+	count, _ := in.GetInt32()
+	_, err := in.GetInt8() // 值类型，固定为 TypeR8
+	values := make([]Value, 0, count)
+	for i := int32(0); i < count && err == nil; i++ {
+		var v Value
+		v.ID, _ = in.GetInt32()
+		if err = v.ReadR8(in); err == nil {
+			values = append(values, v)
+		}
+	}
+	if err == nil {
+		err = in.SkipAll()
+	}
+	if err != nil {
+		return err
+	}
+	return s.echo(c, s.V3.WriteRealtime(ctx, values))
+}
+
+func (s *Server) writeArchive(ctx context.Context, c *serverConn) error {
+	in := c.in
+	_, _ = in.GetInt16()
+	flag, _ := in.GetInt16()
+	count, err := in.GetInt32()
+	archives := make([]*Archive, 0, count)
+	for i := int32(0); i < count && err == nil; i++ {
+		a := &Archive{}
+		a.ID, _ = in.GetInt32()
+		a.Type, _ = in.GetInt8()
+		var n int32
+		if n, err = in.GetInt32(); err != nil {
+			break
+		}
+		a.Data = make([]Value, n)
+		for j := int32(0); j < n && err == nil; j++ {
+			err = readValue(in, a.Type, &a.Data[j])
+		}
+		archives = append(archives, a)
+	}
+	if err == nil {
+		err = in.SkipAll()
+	}
+	if err != nil {
+		return err
+	}
+	return s.echo(c, s.V3.WriteArchive(ctx, archives, flag&flagCache != 0))
+}
+
+// archiveQuery - ArchiveQuery 中一个测点的查询条件，mode/begin/end/interval 相同的测点合并为一次 V3 调用
+type archiveQuery struct {
+	id                         int32
+	mode, begin, end, interval int32
+}
+
+func (s *Server) readArchive(ctx context.Context, c *serverConn) error {
+	in := c.in
+	_, _ = in.GetInt32()
+	count, err := in.GetInt32()
+	queries := make([]archiveQuery, 0, count)
+	for i := int32(0); i < count && err == nil; i++ {
+		var q archiveQuery
+		q.id, _ = in.GetInt32()
+		q.mode, _ = in.GetInt32()
+		_, _ = in.GetInt32()
+		q.begin, _ = in.GetInt32()
+		q.end, _ = in.GetInt32()
+		if q.interval, err = in.GetInt32(); err == nil {
+			queries = append(queries, q)
+		}
+	}
+	if err == nil {
+		err = in.SkipAll()
+	}
+	if err != nil {
+		return err
+	}
+
+	// 按查询条件分组调用 V3，结果按 ID 对应回请求中的下标
+	type block struct {
+		index   int32
+		archive *Archive
+		stat    *Stat
+		mode    int32
+	}
+	var blocks []block
+	done := make([]bool, len(queries))
+	for i := range queries {
+		if done[i] {
+			continue
+		}
+		q := queries[i]
+		var group []int
+		var ids []int32
+		for j := i; j < len(queries); j++ {
+			r := queries[j]
+			if !done[j] && r.mode == q.mode && r.begin == q.begin && r.end == q.end && r.interval == q.interval {
+				done[j] = true
+				group = append(group, j)
+				ids = append(ids, r.id)
+			}
+		}
+		index := func(id int32) int32 {
+			for k, j := range group {
+				if j >= 0 && queries[j].id == id {
+					group[k] = -1
+					return int32(j)
+				}
+			}
+			return -1
+		}
+		begin, end := time.Unix(int64(q.begin), 0), time.Unix(int64(q.end), 0)
+		if q.mode&ModeStatMask != 0 {
+			stats, e := s.V3.ReadStat(ctx, ids, q.mode, begin, end, q.interval)
+			if e != nil {
+				s.logf("opio: V3 command from %s failed: %v", c.conn.RemoteAddr(), e)
+			}
+			for _, st := range stats {
+				if k := index(st.ID); k >= 0 {
+					blocks = append(blocks, block{index: k, stat: st, mode: q.mode})
+				}
+			}
+			continue
+		}
+		archives, e := s.V3.ReadArchive(ctx, ids, q.mode, begin, end, q.interval)
+		if e != nil {
+			s.logf("opio: V3 command from %s failed: %v", c.conn.RemoteAddr(), e)
+		}
+		for _, a := range archives {
+			if k := index(a.ID); k >= 0 {
+				blocks = append(blocks, block{index: k, archive: a})
+			}
+		}
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closed {
+		return ErrConnectionClosed
+	}
+	out := c.out
+	_ = out.PutInt32(MAGIC)
+	_ = out.PutInt32(0)
+	_ = out.PutInt32(int32(len(queries)))
+	for _, b := range blocks {
+		_ = out.PutInt8(1)
+		_ = out.PutInt32(b.index)
+		if b.stat != nil {
+			writeStat(out, b.stat, b.mode)
+		} else {
+			writeArchiveData(out, b.archive)
+		}
+	}
+	_ = out.PutInt8(0)
+	_ = out.PutInt32(MAGIC)
+	return out.Flush(true)
+}
+
+// writeArchiveData - 与 Archive.Read 对应：类型，出错时为错误码，否则为数量与按类型编码的值
+func writeArchiveData(out *utils.Buffer, a *Archive) {
+	_ = out.PutInt8(a.Type)
+	if a.Type < 0 {
+		_ = out.PutInt32(a.Error)
+		return
+	}
+	_ = out.PutInt32(int32(len(a.Data)))
+	for i := range a.Data {
+		writeValue(out, a.Type, &a.Data[i])
+	}
+}
+
+// writeStat - 与 Stat.Read 对应
+func writeStat(out *utils.Buffer, st *Stat, mode int32) {
+	_ = out.PutInt8(st.Type)
+	if st.Type < 0 {
+		_ = out.PutInt32(st.Error)
+		return
+	}
+	_ = out.PutInt32(int32(len(st.Data)))
+	for i := range st.Data {
+		st.Data[i].write(out, mode)
+	}
+}
+
+// write - 与 StatVal.Read 对应，ModeStat 为 62 字节的完整统计值，未知的统计模式不写出数据
+func (v *StatVal) write(out *utils.Buffer, mode int32) {
+	switch mode {
+	case ModeFlow, ModeMax, ModeMin, ModeAvg, ModeMean, ModeSum, ModeStat:
+	default:
+		return
+	}
+	_ = out.PutInt32(v.Time)
+	_ = out.PutInt16(v.Status)
+	switch mode {
+	case ModeFlow:
+		_ = out.PutFloat64(v.Flow)
+	case ModeMax:
+		_ = out.PutFloat64(v.Max)
+	case ModeMin:
+		_ = out.PutFloat64(v.Min)
+	case ModeAvg:
+		_ = out.PutFloat64(v.Avg)
+	case ModeMean:
+		_ = out.PutFloat64(v.Mean)
+	case ModeSum:
+		_ = out.PutFloat64(v.Sum)
+	case ModeStat:
+		_ = out.PutFloat64(v.Flow)
+		_ = out.PutFloat64(v.Max)
+		_ = out.PutFloat64(v.Min)
+		_ = out.PutInt32(v.MaxTime)
+		_ = out.PutInt32(v.MinTime)
+		_ = out.PutFloat64(v.Avg)
+		_ = out.PutFloat64(v.Mean)
+		_ = out.PutFloat64(v.Sum)
+	}
+}
+
+// writeValue - 按类型写出不带 ID 的值 (时间、状态、值)
+func writeValue(out *utils.Buffer, typ int8, v *Value) {
+	switch typ & 15 {
+	case TypeAX:
+		_ = v.WriteAX(out)
+	case TypeDX:
+		_ = v.WriteDX(out)
+	case TypeI2:
+		_ = v.WriteI2(out)
+	case TypeI4:
+		_ = v.WriteI4(out)
+	default:
+		_ = v.WriteR8(out)
+	}
+}
+
+// readValue - 与 writeValue 对应
+func readValue(in *utils.Buffer, typ int8, v *Value) error {
+	switch typ & 15 {
+	case TypeAX:
+		return v.ReadAX(in)
+	case TypeDX:
+		return v.ReadDX(in)
+	case TypeI2:
+		return v.ReadI2(in)
+	case TypeI4:
+		return v.ReadI4(in)
+	}
+	return v.ReadR8(in)
+}
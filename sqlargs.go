@@ -0,0 +1,276 @@
+package opio
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidSQLArg 表示 SQL 参数与占位符不匹配、参数的类型无法渲染为 SQL 字面值，或表名/列名无效。
+var ErrInvalidSQLArg = errors.New("opio: invalid SQL argument")
+
+// NamedArg 是 SQL 中 :name 占位符对应的参数，由 Named 创建。
+type NamedArg struct {
+	Name  string
+	Value interface{}
+}
+
+// Named 返回命名参数，用于 ExecSQL(ctx, "... WHERE GN = :gn", opio.Named("gn", name))。
+func Named(name string, value interface{}) NamedArg {
+	return NamedArg{Name: name, Value: value}
+}
+
+// BindSQL 把参数绑定到 SQL 语句的占位符上，返回最终发送给服务端的语句。ExecSQL 等方法带参数时使用它，
+// 也可以用它查看参数渲染的结果。
+//
+// 占位符为 ? (按顺序对应 args) 或 :name (对应 Named 参数，或者唯一的 map[string]interface{} 参数)，
+// 同一条语句中不能混用。字符串常量、带引号的标识符与注释中的 ? 和 : 不是占位符。
+//
+// 参数按类型渲染为 SQL 字面值：
+//   - nil 与 nil 指针为 NULL，指针取其指向的值，driver.Valuer 取 Value() 的结果
+//   - 字符串加单引号，单引号转义为两个单引号，不允许包含 NUL 字符
+//   - []byte 为十六进制常量 X'0A1B'
+//   - time.Time 为服务端的时间格式 '2006-01-02 15:04:05.999' (本地时间)
+//   - bool 为 1/0，整数与浮点数原样输出 (NaN/Inf 无效)
+//   - 其他切片展开为逗号分隔的列表，用于 IN (?)，空切片无效
+func BindSQL(sql string, args ...interface{}) (string, error) {
+	named, err := namedArgs(args)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	b.Grow(len(sql) + 16*len(args))
+	positional, names := 0, false
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			// 字符串常量与带引号的标识符，引号重复两次表示引号本身
+			j := i + 1
+			for {
+				k := strings.IndexByte(sql[j:], c)
+				if k < 0 {
+					return "", fmt.Errorf("%w: 语句中有未闭合的引号 %c", ErrInvalidSQLArg, c)
+				}
+				j += k + 1
+				if j < len(sql) && sql[j] == c {
+					j++
+					continue
+				}
+				break
+			}
+			b.WriteString(sql[i:j])
+			i = j
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			j := strings.IndexByte(sql[i:], '\n')
+			if j < 0 {
+				j = len(sql) - i
+			}
+			b.WriteString(sql[i : i+j])
+			i += j
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			j := strings.Index(sql[i+2:], "*/")
+			if j < 0 {
+				return "", fmt.Errorf("%w: 语句中有未闭合的注释", ErrInvalidSQLArg)
+			}
+			b.WriteString(sql[i : i+j+4])
+			i += j + 4
+		case c == '?':
+			if named != nil {
+				return "", fmt.Errorf("%w: ? 占位符不能使用命名参数", ErrInvalidSQLArg)
+			}
+			if positional >= len(args) {
+				return "", fmt.Errorf("%w: 占位符多于参数 (%d 个)", ErrInvalidSQLArg, len(args))
+			}
+			lit, err := sqlArg(args[positional])
+			if err != nil {
+				return "", fmt.Errorf("%w: 第 %d 个参数: %v", ErrInvalidSQLArg, positional+1, err)
+			}
+			b.WriteString(lit)
+			positional++
+			i++
+		case c == ':' && i+1 < len(sql) && sql[i+1] == ':':
+			b.WriteString("::") // 类型转换等，不是占位符
+			i += 2
+		case c == ':' && i+1 < len(sql) && isNameStart(sql[i+1]):
+			j := i + 2
+			for j < len(sql) && (isNameStart(sql[j]) || sql[j] >= '0' && sql[j] <= '9') {
+				j++
+			}
+			name := sql[i+1 : j]
+			if named == nil {
+				return "", fmt.Errorf("%w: 占位符 :%s 需要命名参数", ErrInvalidSQLArg, name)
+			}
+			v, ok := named[name]
+			if !ok {
+				return "", fmt.Errorf("%w: 缺少参数 :%s", ErrInvalidSQLArg, name)
+			}
+			lit, err := sqlArg(v)
+			if err != nil {
+				return "", fmt.Errorf("%w: 参数 :%s: %v", ErrInvalidSQLArg, name, err)
+			}
+			b.WriteString(lit)
+			names = true
+			i = j
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	if named == nil && positional != len(args) {
+		return "", fmt.Errorf("%w: 语句有 %d 个占位符，但提供了 %d 个参数", ErrInvalidSQLArg, positional, len(args))
+	}
+	if named != nil && !names {
+		return "", fmt.Errorf("%w: 语句中没有 :name 占位符", ErrInvalidSQLArg)
+	}
+	return b.String(), nil
+}
+
+// namedArgs - 参数全部为 NamedArg 或者只有一个 map[string]interface{} 时返回名称到值的映射，否则返回 nil
+func namedArgs(args []interface{}) (map[string]interface{}, error) {
+	if len(args) == 1 {
+		if m, ok := args[0].(map[string]interface{}); ok {
+			return m, nil
+		}
+	}
+	var named map[string]interface{}
+	for i, a := range args {
+		n, ok := a.(NamedArg)
+		if i > 0 && ok != (named != nil) {
+			return nil, fmt.Errorf("%w: 命名参数不能与按顺序的参数混用", ErrInvalidSQLArg)
+		}
+		if !ok {
+			continue
+		}
+		if named == nil {
+			named = make(map[string]interface{}, len(args))
+		}
+		named[n.Name] = n.Value
+	}
+	return named, nil
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// sqlArg - 把一个 SQL 参数渲染为字面值，规则见 BindSQL
+func sqlArg(v interface{}) (string, error) {
+	rv := reflect.ValueOf(v)
+	if v == nil || rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return "NULL", nil
+	}
+	if valuer, ok := v.(driver.Valuer); ok {
+		dv, err := valuer.Value()
+		if err != nil {
+			return "", err
+		}
+		if _, again := dv.(driver.Valuer); again {
+			return "", fmt.Errorf("%T.Value 返回了另一个 driver.Valuer", v)
+		}
+		return sqlArg(dv)
+	}
+	switch x := v.(type) {
+	case []byte:
+		return "X'" + strings.ToUpper(hex.EncodeToString(x)) + "'", nil
+	case string, time.Time, bool:
+		return sqlLiteral(x)
+	}
+	switch rv.Kind() {
+	case reflect.Ptr:
+		return sqlArg(rv.Elem().Interface())
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(b), rv)
+			return sqlArg(b)
+		}
+		if rv.Len() == 0 {
+			return "", errors.New("空的列表")
+		}
+		items := make([]string, rv.Len())
+		for i := range items {
+			e := rv.Index(i)
+			if k := reflect.Indirect(e).Kind(); k == reflect.Slice || k == reflect.Array {
+				if _, ok := e.Interface().([]byte); !ok {
+					return "", errors.New("列表不能嵌套")
+				}
+			}
+			lit, err := sqlArg(e.Interface())
+			if err != nil {
+				return "", err
+			}
+			items[i] = lit
+		}
+		return strings.Join(items, ", "), nil
+	}
+	return sqlLiteral(v)
+}
+
+// timeLayout - 时间值在过滤条件与 SQL 中的格式 (本地时间)，有毫秒时带小数部分
+const timeLayout = "2006-01-02 15:04:05.999"
+
+// sqlLiteral 把标量 Go 值渲染为 SQL 字面值：字符串与时间加单引号 (单引号转义为两个单引号)，
+// 整数、浮点数原样输出，布尔值为 1/0。不支持 nil、NaN/Inf、包含 NUL 的字符串与其他类型。
+func sqlLiteral(v interface{}) (string, error) {
+	switch x := v.(type) {
+	case nil:
+		return "", errors.New("值不能为 nil")
+	case string:
+		return quoteString(x)
+	case time.Time:
+		return quoteString(x.Local().Format(timeLayout))
+	case bool:
+		if x {
+			return "1", nil
+		}
+		return "0", nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return "", fmt.Errorf("无效的数值 %v", f)
+		}
+		return strconv.FormatFloat(f, 'f', -1, rv.Type().Bits()), nil
+	case reflect.String:
+		return quoteString(rv.String())
+	case reflect.Bool:
+		return sqlLiteral(rv.Bool())
+	}
+	return "", fmt.Errorf("不支持的值类型 %T", v)
+}
+
+func quoteString(s string) (string, error) {
+	if strings.IndexByte(s, 0) >= 0 {
+		return "", errors.New("字符串不能包含 NUL 字符")
+	}
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'", nil
+}
+
+// validIdent - 表名与列名只能包含字母、数字、下划线与 "."，且不能以数字开头
+func validIdent(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_' || r == '.' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
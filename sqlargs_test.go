@@ -0,0 +1,137 @@
+package opio_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tc252617228/opio"
+	"github.com/tc252617228/opio/opiotest"
+)
+
+type statusValuer struct{ on bool }
+
+func (s statusValuer) Value() (driver.Value, error) {
+	if s.on {
+		return "ON", nil
+	}
+	return nil, nil
+}
+
+func TestBindSQL(t *testing.T) {
+	tm := time.Date(2024, 3, 1, 8, 30, 0, 250e6, time.Local)
+	name := "W3.AX.1"
+	var nilName *string
+	cases := []struct {
+		sql  string
+		args []interface{}
+		want string
+	}{
+		{"SELECT 1", nil, "SELECT 1"},
+		{"ID = ?", []interface{}{int32(-7)}, "ID = -7"},
+		{"GN = ?", []interface{}{"x' OR '1'='1"}, "GN = 'x'' OR ''1''=''1'"},
+		{"AV > ? AND AV < ?", []interface{}{1.5, float32(0.1)}, "AV > 1.5 AND AV < 0.1"},
+		{"TM >= ?", []interface{}{tm}, "TM >= '2024-03-01 08:30:00.25'"},
+		{"AR = ?", []interface{}{true}, "AR = 1"},
+		{"BN = ?", []interface{}{[]byte{0x0a, 0x1b}}, "BN = X'0A1B'"},
+		{"ED = ?", []interface{}{nil}, "ED = NULL"},
+		{"GN = ? OR GN = ?", []interface{}{&name, nilName}, "GN = 'W3.AX.1' OR GN = NULL"},
+		{"RT IN (?)", []interface{}{[]int{0, 1}}, "RT IN (0, 1)"},
+		{"GN IN (?)", []interface{}{[]string{"a", "b'"}}, "GN IN ('a', 'b''')"},
+		{"ST = ?", []interface{}{statusValuer{on: true}}, "ST = 'ON'"},
+		{"ST = ?", []interface{}{statusValuer{}}, "ST = NULL"},
+		{"ID = :id AND GN = :gn OR ND = :id", []interface{}{opio.Named("id", 3), opio.Named("gn", "a")},
+			"ID = 3 AND GN = 'a' OR ND = 3"},
+		{"TM < :before", []interface{}{map[string]interface{}{"before": tm}}, "TM < '2024-03-01 08:30:00.25'"},
+		// 引号与注释中的占位符原样保留
+		{"GN = '?' AND ED = 'it''s :x' AND \"a?\" = ? -- ?\n/* :y ? */", []interface{}{1},
+			"GN = '?' AND ED = 'it''s :x' AND \"a?\" = 1 -- ?\n/* :y ? */"},
+		{"SELECT CAST(ID AS TEXT)::text, ? FROM T", []interface{}{2}, "SELECT CAST(ID AS TEXT)::text, 2 FROM T"},
+	}
+	for _, c := range cases {
+		got, err := opio.BindSQL(c.sql, c.args...)
+		require.NoError(t, err, c.sql)
+		assert.Equal(t, c.want, got)
+	}
+
+	invalid := []struct {
+		sql  string
+		args []interface{}
+	}{
+		{"ID = ?", nil},
+		{"ID = ?", []interface{}{1, 2}},
+		{"ID = 1", []interface{}{1}},
+		{"ID = :id", []interface{}{1}},
+		{"ID = ?", []interface{}{opio.Named("id", 1)}},
+		{"ID = :id", []interface{}{opio.Named("ID", 1)}},
+		{"ID = :id", []interface{}{opio.Named("id", 1), 2}},
+		{"ID = 1", []interface{}{opio.Named("id", 1)}},
+		{"GN = 'abc AND ID = ?", []interface{}{1}},
+		{"ID = ? /* x", []interface{}{1}},
+		{"AV = ?", []interface{}{math.Inf(1)}},
+		{"GN = ?", []interface{}{"a\x00b"}},
+		{"ID IN (?)", []interface{}{[]int{}}},
+		{"ID IN (?)", []interface{}{[][]int{{1}}}},
+		{"ID = ?", []interface{}{struct{}{}}},
+		{"ID = ?", []interface{}{map[string]int{"a": 1}}},
+	}
+	for _, c := range invalid {
+		_, err := opio.BindSQL(c.sql, c.args...)
+		assert.ErrorIs(t, err, opio.ErrInvalidSQLArg, "%s %v", c.sql, c.args)
+	}
+}
+
+func TestExecSQLArgs(t *testing.T) {
+	_, client := opiotest.NewClient(t, seedQuotedPoints)
+	ctx := context.Background()
+
+	res, err := client.ExecSQL(ctx, "SELECT ID FROM Point WHERE GN LIKE ? AND RT IN (?)", "W3.AX.%", []int8{opio.TypeAX, opio.TypeDX})
+	require.NoError(t, err)
+	require.Len(t, res.Rows, 1)
+	assert.Equal(t, int32(1), res.Rows[0]["ID"])
+
+	ids, err := opio.SQLAs[struct{ ID int32 }](ctx, client, "SELECT ID FROM Point WHERE GN = :gn", opio.Named("gn", "W3.AX.O'1"))
+	require.NoError(t, err)
+	require.Len(t, ids, 1)
+	assert.Equal(t, int32(1), ids[0].ID)
+
+	// 注入的字符串只作为值比较，不会匹配任何行
+	res, err = client.ExecSQL(ctx, "SELECT ID FROM Point WHERE GN = ?", "x' OR '1'='1")
+	require.NoError(t, err)
+	assert.Empty(t, res.Rows)
+
+	// 没有参数时语句原样发送，由服务端报告语法错误
+	_, err = client.ExecSQL(ctx, "SELECT ID FROM Point WHERE ID = ?")
+	var serverErr *opio.OpioServerError
+	assert.True(t, errors.As(err, &serverErr), "%v", err)
+	_, err = client.ExecSQL(ctx, "SELECT ID FROM Point WHERE ID = ?", 1, 2)
+	assert.ErrorIs(t, err, opio.ErrInvalidSQLArg)
+	_, err = client.ExecSQLRows(ctx, "SELECT ID FROM Point WHERE ID = ?", math.NaN())
+	assert.ErrorIs(t, err, opio.ErrInvalidSQLArg)
+	assert.Equal(t, 0, client.PoolStats().InUse)
+
+	// DeleteByID 的字符串 ID 同样经过绑定
+	require.NoError(t, client.DeleteByID(ctx, "Point", "GN", "x' OR '1'='1"))
+	res, err = client.ExecSQL(ctx, "SELECT ID FROM Point")
+	require.NoError(t, err)
+	assert.Len(t, res.Rows, 3)
+
+	require.NoError(t, client.DeleteByID(ctx, "Point", "GN", "W3.AX.O'1"))
+	require.NoError(t, client.DeleteByID(ctx, "Point", "ID", uint16(2)))
+	res, err = client.ExecSQL(ctx, "SELECT ID FROM Point")
+	require.NoError(t, err)
+	require.Len(t, res.Rows, 1)
+	assert.Equal(t, int32(3), res.Rows[0]["ID"])
+
+	err = client.DeleteByID(ctx, "Point; DROP TABLE Point", "ID", 3)
+	assert.ErrorIs(t, err, opio.ErrInvalidSQLArg)
+	err = client.DeleteByID(ctx, "Point", "ID = 3 OR 1", 3)
+	assert.ErrorIs(t, err, opio.ErrInvalidSQLArg)
+	err = client.DeleteByID(ctx, "Point", "ID", []int{3})
+	assert.True(t, errors.Is(err, opio.ErrUnsupportedIDType), "%v", err)
+}
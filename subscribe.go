@@ -3,6 +3,7 @@ package opio
 import (
 	"errors"
 	"math/rand"
+	"sync"
 	"time"
 )
 
@@ -26,6 +27,10 @@ type Subscribe struct {
 	keys        map[interface{}]struct{}
 	keysUpdated bool
 	Request
+
+	connMu sync.Mutex                 // 保护 conn，读取协程断线重连时替换连接
+	reqMu  sync.Mutex                 // 保护请求 (Request 与 buff、keys)：change 与读取协程重连后的 makeSubReq 都会写请求
+	redial func() (*IOConnect, error) // 断线后重新建立连接，为空时按原连接参数重连 (Client 创建的订阅经由客户端的端点切换)
 }
 
 func (op *IOConnect) NewSubscribe(tableName string) (*Subscribe, error) {
@@ -33,14 +38,19 @@ func (op *IOConnect) NewSubscribe(tableName string) (*Subscribe, error) {
 	if err != nil {
 		return nil, err
 	}
+	return newSubscribe(nop, tableName)
+}
+
+// newSubscribe - 在已建立的连接 nop 上创建订阅，订阅独占该连接
+func newSubscribe(nop *IOConnect, tableName string) (*Subscribe, error) {
 	sub := &Subscribe{}
 
 	sub.conf = &ConInfo{
-		host:    op.host,
-		port:    op.port,
-		timeout: op.timeout,
-		user:    op.user,
-		pass:    op.pass,
+		host:    nop.host,
+		port:    nop.port,
+		timeout: nop.timeout,
+		user:    nop.user,
+		pass:    nop.pass,
 		tbName:  tableName,
 	}
 
@@ -83,14 +93,45 @@ func (sub *Subscribe) SetSnapshot(v bool) error {
 }
 
 func (sub *Subscribe) Close() {
+	sub.connMu.Lock()
+	defer sub.connMu.Unlock()
 	if !sub.isClose && sub.conn != nil {
 		sub.isClose = true
-		_ = sub.conn.Close()
+		if sub.initialized {
+			//读取协程可能仍在使用缓冲区：只关闭底层连接使其读取出错退出，由读取协程关闭连接并归还缓冲区
+			sub.conn.interrupt()
+		} else {
+			_ = sub.conn.Close()
+		}
 		sub.conf = nil
 		sub.conn = nil
 	}
 }
 
+// closed - 订阅是否已关闭，读取协程与 Close 并发访问 isClose
+func (sub *Subscribe) closed() bool {
+	sub.connMu.Lock()
+	defer sub.connMu.Unlock()
+	return sub.isClose
+}
+
+// migrate - 订阅的连接不在端点 ep 上时打断它，读取协程会按断线处理并重新连接
+func (sub *Subscribe) migrate(ep Endpoint) {
+	sub.connMu.Lock()
+	defer sub.connMu.Unlock()
+	if !sub.isClose && sub.initialized && sub.conn != nil && sub.conn.endpoint() != ep {
+		sub.conn.interrupt()
+	}
+}
+
+// reconnect - 断线后建立新的订阅连接
+func (sub *Subscribe) reconnect(old *IOConnect) (*IOConnect, error) {
+	if sub.redial != nil {
+		return sub.redial()
+	}
+	return old.copyConn()
+}
+
 // 与C API保持一致 by PB
 func (sub *Subscribe) InitSubscribe(key interface{}, keyName string, callback func(res *Response)) error {
 	if !sub.initialized {
@@ -121,13 +162,23 @@ func (sub *Subscribe) InitSubscribe(key interface{}, keyName string, callback fu
 			}
 		}
 		sub.keyName = keyName
-		if err := sub.makeSubReq(); err != nil {
+		sub.reqMu.Lock()
+		err := sub.makeSubReq()
+		sub.reqMu.Unlock()
+		if err != nil {
 			return err
 		}
 		res := &Response{}
 		res.buff = sub.buff
+		conn := sub.conn
 		go func() {
-			for !sub.isClose {
+			defer func() {
+				// 关闭连接会归还 buff，等待进行中的 change 写完
+				sub.reqMu.Lock()
+				_ = conn.Close()
+				sub.reqMu.Unlock()
+			}()
+			for !sub.closed() {
 				res.Reset()
 				e := res.Read()
 				if e == nil {
@@ -136,17 +187,31 @@ func (sub *Subscribe) InitSubscribe(key interface{}, keyName string, callback fu
 					res.SetError(e.Error())
 					res.SetErrNo(-97)
 					callback(res)
-					for !sub.isClose {
-						if con, err := sub.conn.copyConn(); err != nil {
+					for !sub.closed() {
+						if con, err := sub.reconnect(conn); err != nil {
 							time.Sleep(time.Second * 20)
 						} else {
-							sub.conn = con
+							// 替换 buff 与关闭旧连接 (归还旧的 buff) 都不能与 change 的写入交错
+							sub.reqMu.Lock()
+							_ = conn.Close()
+							conn = con
 							sub.buff = con.io
-							res.buff = sub.buff
+							sub.reqMu.Unlock()
+							sub.connMu.Lock()
+							if sub.isClose {
+								//重连期间订阅已被关闭
+								sub.connMu.Unlock()
+								break
+							}
+							sub.conn = con
+							sub.connMu.Unlock()
+							res.buff = con.io
 							res.SetErrNo(-90)
 							callback(res)
 
-							sub.makeSubReq()
+							sub.reqMu.Lock()
+							_ = sub.makeSubReq()
+							sub.reqMu.Unlock()
 							break
 						}
 					}
@@ -157,6 +222,7 @@ func (sub *Subscribe) InitSubscribe(key interface{}, keyName string, callback fu
 	return nil
 }
 
+// makeSubReq - 发送订阅请求，调用方持有 reqMu
 func (sub *Subscribe) makeSubReq() error {
 
 	//keys被更新过需要重新setIndexes
@@ -193,7 +259,9 @@ func (sub *Subscribe) makeSubReq() error {
 
 // add by PB
 func (sub *Subscribe) change(key interface{}, changeType int) error {
-	if sub.initialized && !sub.isClose {
+	sub.reqMu.Lock()
+	defer sub.reqMu.Unlock()
+	if sub.initialized && !sub.closed() {
 		sub.keysUpdated = true
 		sub.SetID(int64(rand.Int()))
 		sub.Set("Subscribe", changeType)
@@ -808,6 +808,10 @@ func (t *Table) SetColumnValue(col uint32, value interface{}) (err error) {
 		return t.SetColumnInt64(col, v, 0)
 	case uint64:
 		return t.SetColumnInt64(col, int64(v), 0)
+	case int:
+		return t.SetColumnInt64(col, int64(v), 0)
+	case uint:
+		return t.SetColumnInt64(col, int64(v), 0)
 	case float32:
 		return t.SetColumnFloat(col, v)
 	case float64:
@@ -816,6 +820,8 @@ func (t *Table) SetColumnValue(col uint32, value interface{}) (err error) {
 		return t.SetColumnString(col, v)
 	case []byte:
 		return t.SetColumnBinary(col, v)
+	case time.Time:
+		return t.SetColumnDateTime(col, v)
 	default:
 		return fmt.Errorf("unknown value type, type:%T, val:%v", v, v)
 	}
@@ -870,6 +876,17 @@ func (t *Table) BindRow() {
 
 }
 
+// discardRow - 丢弃正在设置的行及设置过程中的错误，恢复到上一次 BindRow 之后的状态
+func (t *Table) discardRow() {
+	copy(t.fixedBuf, t.defaultFixedBuf)
+	copy(t.bitBuf, t.defaultBitBuf)
+	for i := range t.variableBuf {
+		t.variableBuf[i] = nil
+	}
+	t.bufSize = t.defaultBufSize
+	t.errors = t.errors[:0]
+}
+
 // RowCount -
 func (t *Table) RowCount() uint {
 	return t.rowCount
@@ -0,0 +1,436 @@
+package opio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TraceDirection 表示被跟踪的数据是发送还是接收的。
+type TraceDirection uint8
+
+const (
+	TraceSent     TraceDirection = iota // 客户端发送
+	TraceReceived                       // 客户端接收
+)
+
+func (d TraceDirection) String() string {
+	if d == TraceSent {
+		return "send"
+	}
+	return "recv"
+}
+
+// TraceInfo 是跟踪事件的公共部分。
+type TraceInfo struct {
+	Time time.Time
+	Conn uint32 // 连接编号，按连接建立的顺序在进程内从 1 开始分配
+	Addr string // 连接的服务端地址
+	Dir  TraceDirection
+}
+
+func (i TraceInfo) header() string {
+	return fmt.Sprintf("%s #%d %s %s", i.Time.Format("2006-01-02T15:04:05.000000"), i.Conn, i.Addr, i.Dir)
+}
+
+// FrameEvent 描述一个网络帧。
+type FrameEvent struct {
+	TraceInfo
+	EOF       bool   // 消息的最后一帧
+	Mode      byte   // 帧实际使用的压缩模式 (ZIP_MODEL_*)
+	RawLen    int    // 压缩前 (发送) 或解压后 (接收) 的负载长度
+	WireLen   int    // 帧负载在网络上的长度，不含 4 字节帧头
+	Heartbeat bool   // 服务端插入的心跳探测帧
+	Payload   []byte // 压缩前或解压后的负载，只在 TraceFrame 调用期间有效
+}
+
+// String 返回单行的帧描述，不含负载。
+func (e *FrameEvent) String() string {
+	kind := "frame"
+	if e.Heartbeat {
+		kind = "heartbeat"
+	}
+	eof := 0
+	if e.EOF {
+		eof = 1
+	}
+	return fmt.Sprintf("%s %s eof=%d mode=%s raw=%d wire=%d", e.header(), kind, eof, modeName(e.Mode), e.RawLen, e.WireLen)
+}
+
+// PropsEvent 描述一个请求 (发送前) 或应答 (解码后) 的属性表。
+type PropsEvent struct {
+	TraceInfo
+	Props map[string]interface{} // 只在 TraceProps 调用期间有效，从捕获文件读出的事件中为 nil
+
+	text string // 从捕获文件读出的格式化属性表
+}
+
+// String 返回单行的属性表描述，属性按名称排序。
+func (e *PropsEvent) String() string {
+	text := e.text
+	if e.Props != nil {
+		text = formatProps(e.Props)
+	}
+	return e.header() + " props " + text
+}
+
+// Tracer 观察连接上收发的每个网络帧 (包括登录握手与 V3 二进制命令) 以及每个 Request / Response 的属性表。
+// 回调在收发数据的协程中同步执行，多个连接可能同时调用同一个 Tracer，实现必须并发安全且不应阻塞。
+// 注意登录握手帧中包含散列后的口令，属性表中可能包含会话令牌。
+type Tracer interface {
+	TraceFrame(e *FrameEvent)
+	TraceProps(e *PropsEvent)
+}
+
+// WithTracer 让新建的连接把收发的帧和属性表报告给 t，用于排查协议问题。
+func WithTracer(t Tracer) ConnectOption {
+	return func(o *connectOptions) {
+		o.tracer = t
+	}
+}
+
+// traceConnSeq - 分配连接编号
+var traceConnSeq uint32
+
+// traceAdapter - 把 utils.Buffer 的回调转换为 Tracer 事件，每个连接一个
+type traceAdapter struct {
+	t    Tracer
+	conn uint32
+	addr string
+}
+
+func newTraceAdapter(t Tracer, addr string) *traceAdapter {
+	return &traceAdapter{t: t, conn: atomic.AddUint32(&traceConnSeq, 1), addr: addr}
+}
+
+func (a *traceAdapter) info(out bool) TraceInfo {
+	dir := TraceReceived
+	if out {
+		dir = TraceSent
+	}
+	return TraceInfo{Time: time.Now(), Conn: a.conn, Addr: a.addr, Dir: dir}
+}
+
+func (a *traceAdapter) TraceFrame(out bool, eof bool, mode byte, payload []byte, wire int, heartbeat bool) {
+	a.t.TraceFrame(&FrameEvent{
+		TraceInfo: a.info(out),
+		EOF:       eof,
+		Mode:      mode,
+		RawLen:    len(payload),
+		WireLen:   wire,
+		Heartbeat: heartbeat,
+		Payload:   payload,
+	})
+}
+
+func (a *traceAdapter) TraceProps(out bool, props map[string]interface{}) {
+	a.t.TraceProps(&PropsEvent{TraceInfo: a.info(out), Props: props})
+}
+
+// LogTracer 把跟踪事件按行写成便于阅读的文本。
+type LogTracer struct {
+	mu      sync.Mutex
+	w       io.Writer
+	payload bool
+}
+
+// NewLogTracer 创建写入 w 的文本跟踪器。payload 为 true 时在每个帧之后附加负载的十六进制转储。
+func NewLogTracer(w io.Writer, payload bool) *LogTracer {
+	return &LogTracer{w: w, payload: payload}
+}
+
+// TraceFrame 写出一行帧描述。
+func (l *LogTracer) TraceFrame(e *FrameEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = fmt.Fprintln(l.w, e.String())
+	if l.payload && len(e.Payload) > 0 {
+		_, _ = io.WriteString(l.w, hex.Dump(e.Payload))
+	}
+}
+
+// TraceProps 写出一行属性表描述。
+func (l *LogTracer) TraceProps(e *PropsEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = fmt.Fprintln(l.w, e.String())
+}
+
+// captureMagic - 捕获文件头
+var captureMagic = []byte("OPIOCAP\x01")
+
+const (
+	captureFrame byte = 1
+	captureProps byte = 2
+)
+
+// CaptureTracer 把跟踪事件写成二进制捕获文件，之后可以用 ReadCapture 或 `opio capture` 命令查看。
+//
+// 文件格式 (整数均为大端序)：8 字节文件头 "OPIOCAP\x01"，之后每条记录为
+// kind(u8: 1 帧, 2 属性表) + dir(u8) + conn(u32) + time(i64 UnixNano) + addr(u16 长度 + 字节)，
+// 帧记录随后为 flags(u8: bit0 eof, bit1 心跳) + mode(u8) + wire(u32) + 负载(u32 长度 + 字节)，
+// 属性表记录随后为格式化后的属性表文本 (u32 长度 + 字节)。
+type CaptureTracer struct {
+	mu  sync.Mutex
+	w   *bufio.Writer
+	err error
+}
+
+// NewCaptureTracer 创建写入 w 的捕获跟踪器并写出文件头。使用完毕后调用 Flush。
+func NewCaptureTracer(w io.Writer) *CaptureTracer {
+	c := &CaptureTracer{w: bufio.NewWriter(w)}
+	_, c.err = c.w.Write(captureMagic)
+	return c
+}
+
+// TraceFrame 写出一条帧记录。
+func (c *CaptureTracer) TraceFrame(e *FrameEvent) {
+	var flags byte
+	if e.EOF {
+		flags |= 1
+	}
+	if e.Heartbeat {
+		flags |= 2
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeInfo(captureFrame, e.TraceInfo)
+	c.write([]byte{flags, e.Mode})
+	c.writeUint32(uint32(e.WireLen))
+	c.writeBytes(e.Payload)
+}
+
+// TraceProps 写出一条属性表记录。
+func (c *CaptureTracer) TraceProps(e *PropsEvent) {
+	text := formatProps(e.Props)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeInfo(captureProps, e.TraceInfo)
+	c.writeBytes([]byte(text))
+}
+
+// Flush 把缓冲的记录写入底层 Writer，返回写入过程中遇到的第一个错误。
+func (c *CaptureTracer) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.err = c.w.Flush()
+	}
+	return c.err
+}
+
+func (c *CaptureTracer) writeInfo(kind byte, info TraceInfo) {
+	c.write([]byte{kind, byte(info.Dir)})
+	c.writeUint32(info.Conn)
+	var t [8]byte
+	binary.BigEndian.PutUint64(t[:], uint64(info.Time.UnixNano()))
+	c.write(t[:])
+	var n [2]byte
+	binary.BigEndian.PutUint16(n[:], uint16(len(info.Addr)))
+	c.write(n[:])
+	c.write([]byte(info.Addr))
+}
+
+func (c *CaptureTracer) writeUint32(v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	c.write(b[:])
+}
+
+func (c *CaptureTracer) writeBytes(p []byte) {
+	c.writeUint32(uint32(len(p)))
+	c.write(p)
+}
+
+func (c *CaptureTracer) write(p []byte) {
+	if c.err == nil {
+		_, c.err = c.w.Write(p)
+	}
+}
+
+// CaptureRecord 是从捕获文件读出的一条记录，Frame 与 Props 中恰有一个非 nil。
+type CaptureRecord struct {
+	Frame *FrameEvent
+	Props *PropsEvent
+}
+
+// String 返回记录的单行描述。
+func (r *CaptureRecord) String() string {
+	if r.Frame != nil {
+		return r.Frame.String()
+	}
+	return r.Props.String()
+}
+
+// CaptureReader 顺序读取 CaptureTracer 写出的捕获文件。
+type CaptureReader struct {
+	r *bufio.Reader
+}
+
+// ReadCapture 校验文件头并返回捕获文件的读取器。
+func ReadCapture(r io.Reader) (*CaptureReader, error) {
+	br := bufio.NewReader(r)
+	head := make([]byte, len(captureMagic))
+	if _, err := io.ReadFull(br, head); err != nil {
+		return nil, fmt.Errorf("opio: 读取捕获文件头失败: %w", err)
+	}
+	if string(head) != string(captureMagic) {
+		return nil, errors.New("opio: 不是 opio 捕获文件")
+	}
+	return &CaptureReader{r: br}, nil
+}
+
+// Next 读取下一条记录，文件结束时返回 io.EOF。帧记录的 Payload 在下一次调用后仍然有效。
+func (cr *CaptureReader) Next() (*CaptureRecord, error) {
+	var head [16]byte // kind + dir + conn + time + addr 长度
+	if _, err := io.ReadFull(cr.r, head[:1]); err != nil {
+		return nil, err // 记录之间的 io.EOF 表示正常结束
+	}
+	if _, err := io.ReadFull(cr.r, head[1:]); err != nil {
+		return nil, cr.truncated(err)
+	}
+	info := TraceInfo{
+		Dir:  TraceDirection(head[1]),
+		Conn: binary.BigEndian.Uint32(head[2:]),
+		Time: time.Unix(0, int64(binary.BigEndian.Uint64(head[6:]))),
+	}
+	addr := make([]byte, binary.BigEndian.Uint16(head[14:]))
+	if _, err := io.ReadFull(cr.r, addr); err != nil {
+		return nil, cr.truncated(err)
+	}
+	info.Addr = string(addr)
+
+	switch head[0] {
+	case captureFrame:
+		var fh [6]byte
+		if _, err := io.ReadFull(cr.r, fh[:]); err != nil {
+			return nil, cr.truncated(err)
+		}
+		payload, err := cr.readBytes()
+		if err != nil {
+			return nil, err
+		}
+		return &CaptureRecord{Frame: &FrameEvent{
+			TraceInfo: info,
+			EOF:       fh[0]&1 != 0,
+			Heartbeat: fh[0]&2 != 0,
+			Mode:      fh[1],
+			WireLen:   int(binary.BigEndian.Uint32(fh[2:])),
+			RawLen:    len(payload),
+			Payload:   payload,
+		}}, nil
+	case captureProps:
+		text, err := cr.readBytes()
+		if err != nil {
+			return nil, err
+		}
+		return &CaptureRecord{Props: &PropsEvent{TraceInfo: info, text: string(text)}}, nil
+	}
+	return nil, fmt.Errorf("opio: 未知的捕获记录类型 %d", head[0])
+}
+
+func (cr *CaptureReader) readBytes() ([]byte, error) {
+	var n [4]byte
+	if _, err := io.ReadFull(cr.r, n[:]); err != nil {
+		return nil, cr.truncated(err)
+	}
+	b := make([]byte, binary.BigEndian.Uint32(n[:]))
+	if _, err := io.ReadFull(cr.r, b); err != nil {
+		return nil, cr.truncated(err)
+	}
+	return b, nil
+}
+
+func (cr *CaptureReader) truncated(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("opio: 捕获文件不完整: %w", err)
+}
+
+// modeName - 压缩模式的名称
+func modeName(mode byte) string {
+	switch mode {
+	case ZIP_MODEL_Uncompressed:
+		return "none"
+	case ZIP_MODEL_Frame:
+		return "frame"
+	case ZIP_MODEL_Block:
+		return "block"
+	}
+	return fmt.Sprintf("%d", mode)
+}
+
+// formatProps - 按名称排序的单行属性表，表结构、索引与过滤条件以可读的形式展开
+func formatProps(props map[string]interface{}) string {
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(k)
+		sb.WriteString(": ")
+		sb.WriteString(formatPropValue(props[k]))
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+func formatPropValue(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return fmt.Sprintf("%q", x)
+	case []byte:
+		return fmt.Sprintf("<%d bytes>", len(x))
+	case *Table:
+		return formatColumns(x.columns)
+	case Columns:
+		return formatColumns(x.columns)
+	case Indexs:
+		switch {
+		case x.key_i32 != nil:
+			return fmt.Sprintf("%s%v", x.key, x.key_i32)
+		case x.key_i64 != nil:
+			return fmt.Sprintf("%s%v", x.key, x.key_i64)
+		}
+		return fmt.Sprintf("%s%q", x.key, x.key_str)
+	case Filters:
+		parts := make([]string, len(x.filters))
+		for i, f := range x.filters {
+			parts[i] = fmt.Sprintf("%s %s %q", f.Left, operName(f.Operator), f.Right)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+func formatColumns(cols []Column) string {
+	names := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = c.name
+	}
+	return "[" + strings.Join(names, " ") + "]"
+}
+
+// operName - 过滤条件操作符的名称
+func operName(op uint8) string {
+	names := [...]string{"=", "!=", ">", "<", ">=", "<=", "in", "not in", "like", "not like", "regexp"}
+	if int(op) < len(names) {
+		return names[op]
+	}
+	return fmt.Sprintf("op%d", op)
+}
@@ -0,0 +1,79 @@
+package opio_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tc252617228/opio"
+)
+
+func TestLogTracer(t *testing.T) {
+	host, port := listenLocal(t, (&tokenServer{}).serve)
+	var out bytes.Buffer
+	client, err := opio.Connect(context.Background(), host, port, "sis", "openplant", time.Second,
+		opio.WithTracer(opio.NewLogTracer(&out, false)))
+	require.NoError(t, err)
+	_, err = client.ExecSQL(context.Background(), "SELECT 1")
+	require.NoError(t, err)
+	client.Close()
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 7, out.String())
+	// 登录握手: 问候包、口令应答、确认
+	assert.Contains(t, lines[0], " recv frame eof=1 mode=none raw=100 wire=100")
+	assert.Contains(t, lines[1], " send frame eof=1 mode=none raw=100 wire=100")
+	assert.Contains(t, lines[2], " recv frame eof=1 mode=none raw=16 wire=16")
+	assert.Contains(t, lines[3], ` send props {Action: "ExecSQL", SQL: "SELECT 1", Service: "openplant"}`)
+	assert.Contains(t, lines[4], " send frame eof=1")
+	assert.Contains(t, lines[5], " recv frame eof=1 mode=none raw=9 wire=9")
+	assert.Contains(t, lines[6], " recv props {Errno: 0}")
+}
+
+func TestCaptureTracerRoundTrip(t *testing.T) {
+	host, port := listenLocal(t, (&tokenServer{}).serve)
+	var file bytes.Buffer
+	capture := opio.NewCaptureTracer(&file)
+	op, err := opio.InitContext(context.Background(), host, port, "sis", "openplant", opio.WithTracer(capture))
+	require.NoError(t, err)
+	req := op.NewRequest(nil)
+	req.SetService("openplant")
+	req.SetAction(opio.ActionSelect)
+	req.SetTableName("Point")
+	require.NoError(t, req.WriteAndFlush())
+	_, err = req.GetResponse()
+	require.NoError(t, err)
+	_ = op.Close()
+	require.NoError(t, capture.Flush())
+
+	cr, err := opio.ReadCapture(&file)
+	require.NoError(t, err)
+	var recs []*opio.CaptureRecord
+	for {
+		rec, err := cr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		recs = append(recs, rec)
+	}
+	require.Len(t, recs, 7)
+	greeting := recs[0].Frame
+	require.NotNil(t, greeting)
+	assert.Equal(t, opio.TraceReceived, greeting.Dir)
+	assert.True(t, greeting.EOF)
+	assert.Equal(t, "OpenPlant test", string(bytes.TrimRight(greeting.Payload, "\x00")))
+	assert.Equal(t, greeting.Conn, recs[6].Props.Conn, "同一连接的记录编号相同")
+	assert.Equal(t, opio.TraceSent, recs[3].Props.Dir)
+	assert.Contains(t, recs[3].String(), `{Action: "Select", Service: "openplant", Table: "Point"}`)
+	assert.Equal(t, opio.TraceReceived, recs[6].Props.Dir)
+	assert.Contains(t, recs[6].String(), "recv props {Errno: 0}")
+
+	_, err = opio.ReadCapture(strings.NewReader("not a capture"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,305 @@
+package opio
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QueryAs 执行 V2 风格的结构化查询，把结果直接解码为 T 的切片。T 必须是结构体类型，
+// 字段与列的对应规则与 QueryResult.Scan 相同 (`opio` 标签、`db` 标签、不区分大小写的字段名，`"-"` 忽略)，
+// 查询的列即 T 中参与映射的字段。
+//
+// 与 Query + Scan 不同，QueryAs 不经过 map[string]interface{}：每个类型的字段表只解析一次并缓存，
+// 每种结果集的列到字段的解码计划也只构建一次，之后逐行用 OPDataSet 的类型化读取方法 (GetInt32、GetString、
+// GetDateTime 等) 直接写入结构体字段。数据按 QueryRows 的方式流式读取，默认超时的处理也与 QueryRows 相同。
+func QueryAs[T any](ctx context.Context, c *Client, tableName string, opts *QueryOptions) ([]T, error) {
+	plan, err := structPlanOf(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return nil, err
+	}
+	rows, err := c.QueryRows(ctx, tableName, plan.columns, opts)
+	if err != nil {
+		return nil, err
+	}
+	return collectAs[T](rows, plan)
+}
+
+// SQLAs 执行 SQL 语句，把结果集直接解码为 T 的切片，映射规则与 QueryAs 相同，args 的绑定与 ExecSQL 相同。
+// 结果集中没有对应字段的列被忽略，没有对应列的字段保持零值。
+func SQLAs[T any](ctx context.Context, c *Client, sql string, args ...interface{}) ([]T, error) {
+	plan, err := structPlanOf(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return nil, err
+	}
+	rows, err := c.ExecSQLRows(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	return collectAs[T](rows, plan)
+}
+
+// collectAs 读完 rows 中的所有行并解码为 T，结束时关闭 rows。
+func collectAs[T any](rows *Rows, plan *structPlan) ([]T, error) {
+	defer rows.Close()
+	bindings := plan.bind(rows.Columns())
+	out := make([]T, 0)
+	for rows.Next() {
+		var zero T
+		out = append(out, zero)
+		v := reflect.ValueOf(&out[len(out)-1]).Elem()
+		for _, b := range bindings {
+			if err := b.decode(rows.set, b.col, v.Field(b.field)); err != nil {
+				return nil, fmt.Errorf("opio: 无法将列 '%s' 解码到字段 %s.%s: %w",
+					rows.cols[b.col].GetName(), plan.typ.Name(), plan.typ.Field(b.field).Name, err)
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// structPlan - 一个结构体类型的字段表，按类型缓存在 structPlans 中
+type structPlan struct {
+	typ     reflect.Type
+	columns []string       // 参与映射的列名，按字段顺序
+	fields  map[string]int // 小写列名 -> 字段下标
+
+	bindings sync.Map // 结果集的列签名 -> []fieldBinding
+}
+
+// fieldBinding - 结果集中一列到结构体字段的解码方式
+type fieldBinding struct {
+	col    uint32
+	field  int
+	decode fieldDecoder
+}
+
+// fieldDecoder - 从数据集当前行的第 col 列读取值并写入字段
+type fieldDecoder func(set *OPDataSet, col uint32, field reflect.Value) error
+
+var structPlans sync.Map // reflect.Type -> *structPlan
+
+// structPlanOf 返回 typ 的字段表，第一次使用某个类型时解析并缓存。
+func structPlanOf(typ reflect.Type) (*structPlan, error) {
+	if p, ok := structPlans.Load(typ); ok {
+		return p.(*structPlan), nil
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%w: %s", ErrScanElementInvalid, typ)
+	}
+	plan := &structPlan{typ: typ, fields: make(map[string]int)}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := field.Tag.Get("opio")
+		if name == "" {
+			name = field.Tag.Get("db")
+		}
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		key := strings.ToLower(name)
+		if _, dup := plan.fields[key]; dup {
+			continue
+		}
+		plan.fields[key] = i
+		plan.columns = append(plan.columns, name)
+	}
+	p, _ := structPlans.LoadOrStore(typ, plan)
+	return p.(*structPlan), nil
+}
+
+// bind 返回 cols 对应的解码计划，相同的列名与列类型只构建一次。
+func (p *structPlan) bind(cols []Column) []fieldBinding {
+	var sig strings.Builder
+	for _, c := range cols {
+		fmt.Fprintf(&sig, "%s:%d,", c.GetName(), c.GetType())
+	}
+	if b, ok := p.bindings.Load(sig.String()); ok {
+		return b.([]fieldBinding)
+	}
+	var bindings []fieldBinding
+	for i, c := range cols {
+		idx, ok := p.fields[strings.ToLower(c.GetName())]
+		if !ok {
+			continue
+		}
+		bindings = append(bindings, fieldBinding{
+			col:    uint32(i),
+			field:  idx,
+			decode: decoderFor(p.typ.Field(idx).Type, c.GetType()),
+		})
+	}
+	b, _ := p.bindings.LoadOrStore(sig.String(), bindings)
+	return b.([]fieldBinding)
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// decoderFor 按字段类型与列类型选择解码方式：数值、时间、字符串与二进制列用对应的类型化读取方法，
+// 其他组合 (例如字符串列解码到数值字段) 先读出列值，再按 QueryResult.Scan 的规则转换。
+func decoderFor(typ reflect.Type, colType uint8) fieldDecoder {
+	if typ.Kind() != reflect.Ptr {
+		if decode := typedDecoder(typ, colType); decode != nil {
+			return decode
+		}
+		return decodeValue
+	}
+	elem := typedDecoder(typ.Elem(), colType)
+	if elem == nil {
+		return decodeValue
+	}
+	return func(set *OPDataSet, col uint32, field reflect.Value) error {
+		ptr := reflect.New(field.Type().Elem())
+		if err := elem(set, col, ptr.Elem()); err != nil {
+			return err
+		}
+		field.Set(ptr)
+		return nil
+	}
+}
+
+// typedDecoder 返回用类型化读取方法解码的方式，没有合适的方法时返回 nil。
+func typedDecoder(typ reflect.Type, colType uint8) fieldDecoder {
+	numeric := colType >= VtBool && colType <= VtDouble
+	switch {
+	case typ == timeType:
+		if colType == VtDateTime || (numeric && colType != VtBool) {
+			return decodeDateTime
+		}
+		return nil
+	case typ.Kind() == reflect.String:
+		if colType == VtString {
+			return decodeString
+		}
+		return nil
+	case typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Uint8:
+		if colType == VtBinary {
+			return decodeBytes
+		}
+		return nil
+	}
+	switch typ.Kind() {
+	case reflect.Bool:
+		if numeric {
+			return decodeBool
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if colType == VtInt32 {
+			return decodeInt32
+		}
+		if numeric || colType == VtDateTime {
+			return decodeInt // 时间列解码为 Unix 秒
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if numeric {
+			return decodeUint
+		}
+	case reflect.Float32, reflect.Float64:
+		if numeric {
+			return decodeFloat
+		}
+	}
+	return nil
+}
+
+func decodeBool(set *OPDataSet, col uint32, field reflect.Value) error {
+	v, err := set.GetBool(col)
+	if err != nil {
+		return err
+	}
+	field.SetBool(v)
+	return nil
+}
+
+func decodeInt32(set *OPDataSet, col uint32, field reflect.Value) error {
+	v, err := set.GetInt32(col)
+	if err != nil {
+		return err
+	}
+	return setInt(field, int64(v))
+}
+
+func decodeInt(set *OPDataSet, col uint32, field reflect.Value) error {
+	v, err := set.GetInt64(col)
+	if err != nil {
+		return err
+	}
+	return setInt(field, v)
+}
+
+func setInt(field reflect.Value, v int64) error {
+	if field.OverflowInt(v) {
+		return fmt.Errorf("值 %d 对于类型 %s 溢出", v, field.Type())
+	}
+	field.SetInt(v)
+	return nil
+}
+
+func decodeUint(set *OPDataSet, col uint32, field reflect.Value) error {
+	v, err := set.GetInt64(col)
+	if err != nil {
+		return err
+	}
+	if v < 0 || field.OverflowUint(uint64(v)) {
+		return fmt.Errorf("值 %d 对于类型 %s 溢出", v, field.Type())
+	}
+	field.SetUint(uint64(v))
+	return nil
+}
+
+func decodeFloat(set *OPDataSet, col uint32, field reflect.Value) error {
+	v, err := set.GetFloat64(col)
+	if err != nil {
+		return err
+	}
+	field.SetFloat(v)
+	return nil
+}
+
+func decodeDateTime(set *OPDataSet, col uint32, field reflect.Value) error {
+	v, err := set.GetDateTime(col)
+	if err != nil {
+		return err
+	}
+	field.Set(reflect.ValueOf(v))
+	return nil
+}
+
+func decodeString(set *OPDataSet, col uint32, field reflect.Value) error {
+	v, err := set.GetString(col)
+	if err != nil {
+		return err
+	}
+	field.SetString(v)
+	return nil
+}
+
+func decodeBytes(set *OPDataSet, col uint32, field reflect.Value) error {
+	v, err := set.GetBytes(col)
+	if err != nil {
+		return err
+	}
+	field.SetBytes(append([]byte(nil), v...))
+	return nil
+}
+
+// decodeValue - 通用解码：读出列值后按 Rows.Scan 的规则赋值，无法解码的列值保持字段的零值
+func decodeValue(set *OPDataSet, col uint32, field reflect.Value) error {
+	v, err := set.GetValue(col)
+	if err != nil || v == nil {
+		return nil
+	}
+	return assignScanned(field, reflect.ValueOf(v))
+}
@@ -0,0 +1,120 @@
+package opio_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tc252617228/opio"
+	"github.com/tc252617228/opio/opiotest"
+)
+
+type archiveRow struct {
+	ID     int32
+	Name   *string   `opio:"GN"`
+	Time   time.Time `db:"TM"`
+	Status uint8     `opio:"DS"`
+	AV     float64
+	Unix   int64 `opio:"-"`
+	hidden string
+}
+
+func TestQueryAs(t *testing.T) {
+	for _, v4 := range []bool{false, true} {
+		_, client := opiotest.NewClient(t, seedArchive(100, v4))
+		ctx := context.Background()
+
+		rows, err := opio.QueryAs[archiveRow](ctx, client, "Archive", &opio.QueryOptions{
+			Filters: []opio.Filter{{Left: "AV", Operator: opio.OperGE, Right: "90"}},
+		})
+		require.NoError(t, err)
+		require.Len(t, rows, 10, "v4=%v", v4)
+		for i, r := range rows {
+			assert.Equal(t, int32(1001), r.ID)
+			require.NotNil(t, r.Name)
+			assert.Equal(t, "W3.UNIT1.AI1001", *r.Name)
+			assert.Equal(t, int64(1700000090+i), r.Time.Unix())
+			assert.Equal(t, float64(90+i), r.AV)
+			assert.Zero(t, r.Unix)
+		}
+
+		// 类型不同的列经过转换：整数列到字符串字段，时间列到整数字段
+		type converted struct {
+			ID string
+			TM int64
+			AV float32
+			GN []byte
+		}
+		conv, err := opio.SQLAs[converted](ctx, client, "SELECT ID, TM, AV, GN, DS FROM Archive WHERE AV < 2")
+		require.NoError(t, err)
+		require.Len(t, conv, 2)
+		assert.Equal(t, converted{ID: "1001", TM: 1700000001, AV: 1, GN: []byte("W3.UNIT1.AI1001")}, conv[1])
+	}
+}
+
+func TestQueryAsErrors(t *testing.T) {
+	_, client := opiotest.NewClient(t, seedArchive(3, false))
+	ctx := context.Background()
+
+	_, err := opio.QueryAs[int](ctx, client, "Archive", nil)
+	assert.ErrorIs(t, err, opio.ErrScanElementInvalid)
+
+	type overflow struct {
+		TM int8
+	}
+	_, err = opio.SQLAs[overflow](ctx, client, "SELECT TM FROM Archive")
+	assert.ErrorContains(t, err, "溢出")
+	assert.Equal(t, 0, client.PoolStats().InUse)
+
+	_, err = opio.SQLAs[archiveRow](ctx, client, "SELECT * FROM Missing")
+	var serverErr *opio.OpioServerError
+	assert.True(t, errors.As(err, &serverErr), "%v", err)
+
+	empty, err := opio.QueryAs[archiveRow](ctx, client, "Archive", &opio.QueryOptions{
+		Filters: []opio.Filter{{Left: "ID", Operator: opio.OperEQ, Right: "1"}},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+}
+
+// seedBenchmarkArchive 在 Archive 表中预置 10 个测点共 5000 行历史值
+func seedBenchmarkArchive(srv *opiotest.Server) {
+	values := make([]opio.Value, 5000)
+	for i := range values {
+		values[i] = opio.Value{ID: int32(1001 + i%10), TM: int32(1700000000 + i), AV: float64(i)}
+	}
+	srv.AddArchive(values...)
+}
+
+// BenchmarkQueryScan 为原有的 Query + QueryResult.Scan 路径
+func BenchmarkQueryScan(b *testing.B) {
+	_, client := opiotest.NewClient(b, seedBenchmarkArchive)
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		res, err := client.Query(ctx, "Archive", []string{"ID", "GN", "TM", "DS", "AV"}, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		var rows []archiveRow
+		if err = res.Scan(&rows); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkQueryAs(b *testing.B) {
+	_, client := opiotest.NewClient(b, seedBenchmarkArchive)
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := opio.QueryAs[archiveRow](ctx, client, "Archive", nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package opio
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ErrInvalidFilter 表示过滤条件构造器中的列名、操作符或值无效，或条件无法转换为请求的 Filters。
+var ErrInvalidFilter = errors.New("opio: invalid filter")
+
+// ColExpr 是过滤条件的左操作数 (列)，由 Where 或 Col 创建，调用它的比较方法得到 Cond。
+type ColExpr struct {
+	name string
+}
+
+// Where 以列 column 开始构造过滤条件，例如:
+//
+//	opio.Where("GN").Like("W3.AX.%").And(opio.Col("RT").In(0, 1))
+//
+// Where 与 Col 相同，只是读起来更自然。
+func Where(column string) ColExpr {
+	return ColExpr{name: column}
+}
+
+// Col 返回列 column，用于在 And/Or 中构造其他条件。
+func Col(column string) ColExpr {
+	return ColExpr{name: column}
+}
+
+// Eq 列 = v
+func (c ColExpr) Eq(v interface{}) *Cond { return c.Op(OperEQ, v) }
+
+// Ne 列 <> v
+func (c ColExpr) Ne(v interface{}) *Cond { return c.Op(OperNE, v) }
+
+// Gt 列 > v
+func (c ColExpr) Gt(v interface{}) *Cond { return c.Op(OperGT, v) }
+
+// Lt 列 < v
+func (c ColExpr) Lt(v interface{}) *Cond { return c.Op(OperLT, v) }
+
+// Ge 列 >= v
+func (c ColExpr) Ge(v interface{}) *Cond { return c.Op(OperGE, v) }
+
+// Le 列 <= v
+func (c ColExpr) Le(v interface{}) *Cond { return c.Op(OperLE, v) }
+
+// In 列的值属于 values。只传入一个切片时按切片的元素展开，例如 In([]int32{1001, 1002})。
+func (c ColExpr) In(values ...interface{}) *Cond { return c.Op(OperIn, values...) }
+
+// NotIn 列的值不属于 values，参数规则与 In 相同。
+func (c ColExpr) NotIn(values ...interface{}) *Cond { return c.Op(OperNotIn, values...) }
+
+// Like 列匹配 SQL LIKE 模式 (% 匹配任意个字符，_ 匹配一个字符)。
+func (c ColExpr) Like(pattern string) *Cond { return c.Op(OperLike, pattern) }
+
+// NotLike 列不匹配 SQL LIKE 模式。
+func (c ColExpr) NotLike(pattern string) *Cond { return c.Op(OperNotLike, pattern) }
+
+// Regexp 列匹配正则表达式 (OperReqexp)。
+func (c ColExpr) Regexp(pattern string) *Cond { return c.Op(OperReqexp, pattern) }
+
+// Op 用操作符 oper (opio.Oper* 常量) 构造条件，并检查操作符与值：
+// OperIn/OperNotIn 需要至少一个值，其他操作符需要恰好一个值，OperLike/OperNotLike/OperReqexp 的值必须是字符串。
+// 值按类型渲染：字符串与时间加单引号并转义，数值与布尔 (1/0) 不加引号。无效的条件在 Filters/SQL 时返回错误。
+func (c ColExpr) Op(oper uint8, values ...interface{}) *Cond {
+	cond := &Cond{column: c.name, oper: oper}
+	if !validIdent(c.name) {
+		cond.err = fmt.Errorf("%w: 无效的列名 %q", ErrInvalidFilter, c.name)
+		return cond
+	}
+	if oper > OperReqexp {
+		cond.err = fmt.Errorf("%w: 未知的操作符 %d (列 %s)", ErrInvalidFilter, oper, c.name)
+		return cond
+	}
+	if oper == OperIn || oper == OperNotIn {
+		values = expandValues(values)
+		if len(values) == 0 {
+			cond.err = fmt.Errorf("%w: %s 需要至少一个值 (列 %s)", ErrInvalidFilter, operSQL[oper], c.name)
+			return cond
+		}
+	} else if len(values) != 1 {
+		cond.err = fmt.Errorf("%w: %s 需要一个值，得到 %d 个 (列 %s)", ErrInvalidFilter, operSQL[oper], len(values), c.name)
+		return cond
+	}
+	if oper == OperLike || oper == OperNotLike || oper == OperReqexp {
+		if _, ok := values[0].(string); !ok {
+			cond.err = fmt.Errorf("%w: %s 的模式必须是字符串，得到 %T (列 %s)", ErrInvalidFilter, operSQL[oper], values[0], c.name)
+			return cond
+		}
+	}
+	cond.values = make([]string, len(values))
+	for i, v := range values {
+		lit, err := sqlLiteral(v)
+		if err != nil {
+			cond.err = fmt.Errorf("%w: %v (列 %s)", ErrInvalidFilter, err, c.name)
+			return cond
+		}
+		cond.values[i] = lit
+	}
+	return cond
+}
+
+// Cond 是一个过滤条件：单个比较，或用 And/Or 组合的一组条件。
+// 只由 AND 或只由 OR 连接的条件可以转换为请求的 Filters (QueryOptions.Where、Update、Delete)；
+// 带分组的条件 (例如 (A OR B) AND C) 只能通过 SQL 渲染为 WHERE 子句，用于 ExecSQL。
+type Cond struct {
+	// 单个比较
+	column string
+	oper   uint8
+	values []string // 已渲染的值
+
+	// 组合条件
+	group    bool
+	relation uint8 // RelationAnd / RelationOr
+	children []*Cond
+
+	err error
+}
+
+// And 返回 c AND others...
+func (c *Cond) And(others ...*Cond) *Cond {
+	return combine(RelationAnd, append([]*Cond{c}, others...))
+}
+
+// Or 返回 c OR others...
+func (c *Cond) Or(others ...*Cond) *Cond {
+	return combine(RelationOr, append([]*Cond{c}, others...))
+}
+
+// And 返回用 AND 连接的条件，nil 条件被忽略。
+func And(conds ...*Cond) *Cond {
+	return combine(RelationAnd, conds)
+}
+
+// Or 返回用 OR 连接的条件，nil 条件被忽略。
+func Or(conds ...*Cond) *Cond {
+	return combine(RelationOr, conds)
+}
+
+// combine - 连接条件，相同关系的子组被展开
+func combine(relation uint8, conds []*Cond) *Cond {
+	g := &Cond{group: true, relation: relation}
+	for _, c := range conds {
+		switch {
+		case c == nil:
+		case c.group && c.relation == relation:
+			g.children = append(g.children, c.children...)
+		default:
+			g.children = append(g.children, c)
+		}
+	}
+	if len(g.children) == 1 {
+		return g.children[0]
+	}
+	return g
+}
+
+// Err 返回构造条件时遇到的第一个错误。
+func (c *Cond) Err() error {
+	if c == nil {
+		return nil
+	}
+	if c.err != nil {
+		return c.err
+	}
+	for _, child := range c.children {
+		if err := child.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Filters 把条件转换为请求的 Filters：每个比较一个 Filter，Relation 为它与下一个条件的关系。
+// 条件中同时有 AND 与 OR 分组时返回 ErrInvalidFilter，此时请改用 SQL。
+func (c *Cond) Filters() ([]Filter, error) {
+	if err := c.Err(); err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, nil
+	}
+	if !c.group {
+		return []Filter{c.filter(RelationAnd)}, nil
+	}
+	if len(c.children) == 0 {
+		return nil, nil
+	}
+	filters := make([]Filter, 0, len(c.children))
+	for _, child := range c.children {
+		if child.group {
+			return nil, fmt.Errorf("%w: 条件 %s 包含分组，无法转换为 Filters，请使用 SQL", ErrInvalidFilter, c)
+		}
+		filters = append(filters, child.filter(c.relation))
+	}
+	filters[len(filters)-1].Relation = RelationAnd
+	return filters, nil
+}
+
+func (c *Cond) filter(relation uint8) Filter {
+	return Filter{Left: c.column, Operator: c.oper, Right: strings.Join(c.values, ","), Relation: relation}
+}
+
+// SQL 把条件渲染为 WHERE 子句 (不含 WHERE 关键字)，组合条件中的分组加括号。
+func (c *Cond) SQL() (string, error) {
+	if err := c.Err(); err != nil {
+		return "", err
+	}
+	if c == nil {
+		return "", nil
+	}
+	var b strings.Builder
+	c.writeSQL(&b)
+	return b.String(), nil
+}
+
+func (c *Cond) writeSQL(b *strings.Builder) {
+	if !c.group {
+		b.WriteString(c.column)
+		b.WriteByte(' ')
+		b.WriteString(operSQL[c.oper])
+		b.WriteByte(' ')
+		if c.oper == OperIn || c.oper == OperNotIn {
+			b.WriteByte('(')
+			b.WriteString(strings.Join(c.values, ", "))
+			b.WriteByte(')')
+		} else {
+			b.WriteString(c.values[0])
+		}
+		return
+	}
+	sep := " AND "
+	if c.relation == RelationOr {
+		sep = " OR "
+	}
+	for i, child := range c.children {
+		if i > 0 {
+			b.WriteString(sep)
+		}
+		if child.group {
+			b.WriteByte('(')
+			child.writeSQL(b)
+			b.WriteByte(')')
+		} else {
+			child.writeSQL(b)
+		}
+	}
+}
+
+// String 返回条件的 SQL 形式，条件无效时返回错误信息。
+func (c *Cond) String() string {
+	s, err := c.SQL()
+	if err != nil {
+		return "<" + err.Error() + ">"
+	}
+	return s
+}
+
+// operSQL - 操作符在 SQL 中的写法
+var operSQL = [...]string{
+	OperEQ:      "=",
+	OperNE:      "<>",
+	OperGT:      ">",
+	OperLT:      "<",
+	OperGE:      ">=",
+	OperLE:      "<=",
+	OperIn:      "IN",
+	OperNotIn:   "NOT IN",
+	OperLike:    "LIKE",
+	OperNotLike: "NOT LIKE",
+	OperReqexp:  "REGEXP",
+}
+
+// expandValues - 唯一的参数是切片 (不包括 []byte) 时展开它的元素
+func expandValues(values []interface{}) []interface{} {
+	if len(values) != 1 {
+		return values
+	}
+	v := reflect.ValueOf(values[0])
+	if v.Kind() != reflect.Slice || v.Type().Elem().Kind() == reflect.Uint8 {
+		return values
+	}
+	out := make([]interface{}, v.Len())
+	for i := range out {
+		out[i] = v.Index(i).Interface()
+	}
+	return out
+}
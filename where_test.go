@@ -0,0 +1,139 @@
+package opio_test
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tc252617228/opio"
+	"github.com/tc252617228/opio/opiotest"
+)
+
+func TestWhereRender(t *testing.T) {
+	tm := time.Date(2024, 3, 1, 8, 30, 0, 0, time.Local)
+	cases := []struct {
+		cond *opio.Cond
+		sql  string
+	}{
+		{opio.Where("ID").Eq(1001), "ID = 1001"},
+		{opio.Where("GN").Eq("O'Brien"), "GN = 'O''Brien'"},
+		{opio.Where("AV").Ge(1.5), "AV >= 1.5"},
+		{opio.Where("TM").Lt(tm), "TM < '2024-03-01 08:30:00'"},
+		{opio.Where("TM").Gt(tm.Add(250 * time.Millisecond)), "TM > '2024-03-01 08:30:00.25'"},
+		{opio.Where("AR").Ne(true), "AR <> 1"},
+		{opio.Where("RT").In([]int8{0, 1}), "RT IN (0, 1)"},
+		{opio.Where("GN").NotIn("a", "b"), "GN NOT IN ('a', 'b')"},
+		{opio.Where("GN").Regexp(`^W3\.`), `GN REGEXP '^W3\.'`},
+		{
+			opio.Where("GN").Like("W3.AX.%").And(opio.Col("RT").In(0, 1)),
+			"GN LIKE 'W3.AX.%' AND RT IN (0, 1)",
+		},
+		{
+			opio.Or(opio.Col("RT").Eq(0), opio.Col("RT").Eq(1)).And(opio.Col("ND").Eq(3)),
+			"(RT = 0 OR RT = 1) AND ND = 3",
+		},
+		{
+			opio.Where("A").Eq(1).And(opio.Col("B").Eq(2)).And(opio.Col("C").NotLike("x%")),
+			"A = 1 AND B = 2 AND C NOT LIKE 'x%'",
+		},
+	}
+	for _, c := range cases {
+		sql, err := c.cond.SQL()
+		require.NoError(t, err)
+		assert.Equal(t, c.sql, sql)
+	}
+
+	filters, err := opio.Where("GN").Like("W3.AX.%").Or(opio.Col("RT").In(0, 1)).Filters()
+	require.NoError(t, err)
+	assert.Equal(t, []opio.Filter{
+		{Left: "GN", Operator: opio.OperLike, Right: "'W3.AX.%'", Relation: opio.RelationOr},
+		{Left: "RT", Operator: opio.OperIn, Right: "0,1", Relation: opio.RelationAnd},
+	}, filters)
+
+	// Filters 与 SQL 使用相同的字面值：字符串与时间加单引号并转义
+	filters, err = opio.Where("GN").Eq("O'Brien").And(
+		opio.Col("TM").Lt(tm),
+		opio.Col("ED").In("a", "b,c", "it's", " x"),
+	).Filters()
+	require.NoError(t, err)
+	assert.Equal(t, []opio.Filter{
+		{Left: "GN", Operator: opio.OperEQ, Right: "'O''Brien'", Relation: opio.RelationAnd},
+		{Left: "TM", Operator: opio.OperLT, Right: "'2024-03-01 08:30:00'", Relation: opio.RelationAnd},
+		{Left: "ED", Operator: opio.OperIn, Right: "'a','b,c','it''s',' x'", Relation: opio.RelationAnd},
+	}, filters)
+}
+
+func TestWhereInvalid(t *testing.T) {
+	invalid := []*opio.Cond{
+		opio.Where("ID; DROP").Eq(1),
+		opio.Where("ID").Op(42, 1),
+		opio.Where("ID").In(),
+		opio.Where("ID").Op(opio.OperEQ, 1, 2),
+		opio.Where("ID").Op(opio.OperLike, 1),
+		opio.Where("ID").Eq(nil),
+		opio.Where("AV").Eq(math.NaN()),
+		opio.Where("ID").Eq(struct{}{}),
+		opio.Where("ID").Eq(1).And(opio.Col("X").In([]string{})),
+	}
+	for _, c := range invalid {
+		_, err := c.SQL()
+		assert.ErrorIs(t, err, opio.ErrInvalidFilter, "%v", c)
+		_, err = c.Filters()
+		assert.ErrorIs(t, err, opio.ErrInvalidFilter)
+	}
+
+	grouped := opio.Where("A").Eq(1).Or(opio.Col("B").Eq(2)).And(opio.Col("C").Eq(3))
+	_, err := grouped.Filters()
+	assert.ErrorIs(t, err, opio.ErrInvalidFilter)
+}
+
+// seedQuotedPoints 预置三个测点，其中一个的名称带单引号
+func seedQuotedPoints(srv *opiotest.Server) {
+	srv.AddPoints(
+		opiotest.Point{ID: 1, Name: "W3.AX.O'1", Type: opio.TypeAX},
+		opiotest.Point{ID: 2, Name: "W3.AX.2", Type: opio.TypeR8},
+		opiotest.Point{ID: 3, Name: "W3.DX.3", Type: opio.TypeDX},
+	)
+}
+
+func TestWhereQuery(t *testing.T) {
+	_, client := opiotest.NewClient(t, seedQuotedPoints)
+	ctx := context.Background()
+
+	res, err := client.Query(ctx, "Point", []string{"ID"}, &opio.QueryOptions{
+		Where: opio.Where("GN").Like("W3.AX.%").And(opio.Col("RT").In(opio.TypeAX, opio.TypeDX)),
+	})
+	require.NoError(t, err)
+	require.Len(t, res.Rows, 1)
+	assert.Equal(t, int32(1), res.Rows[0]["ID"])
+
+	res, err = client.Query(ctx, "Point", []string{"ID"}, &opio.QueryOptions{Where: opio.Where("GN").Eq("W3.AX.O'1")})
+	require.NoError(t, err)
+	require.Len(t, res.Rows, 1)
+	res, err = client.Query(ctx, "Point", []string{"ID"}, &opio.QueryOptions{Where: opio.Where("GN").In("W3.AX.O'1", "W3.DX.3")})
+	require.NoError(t, err)
+	require.Len(t, res.Rows, 2)
+	// 与手工加引号的 Filter 相同
+	res, err = client.Query(ctx, "Point", []string{"ID"}, &opio.QueryOptions{
+		Filters: []opio.Filter{{Left: "GN", Operator: opio.OperEQ, Right: "'W3.AX.O''1'"}},
+	})
+	require.NoError(t, err)
+	require.Len(t, res.Rows, 1)
+
+	_, err = client.Query(ctx, "Point", nil, &opio.QueryOptions{
+		Where:   opio.Where("ID").Eq(1),
+		Filters: []opio.Filter{{Left: "ID", Operator: opio.OperEQ, Right: "1"}},
+	})
+	assert.ErrorIs(t, err, opio.ErrInvalidFilter)
+
+	// 带分组的条件通过 SQL 执行
+	where, err := opio.Or(opio.Col("RT").Eq(opio.TypeAX), opio.Col("RT").Eq(opio.TypeDX)).And(opio.Col("GN").NotLike("%.3")).SQL()
+	require.NoError(t, err)
+	res, err = client.ExecSQL(ctx, "SELECT ID FROM Point WHERE "+where)
+	require.NoError(t, err)
+	require.Len(t, res.Rows, 1)
+	assert.Equal(t, int32(1), res.Rows[0]["ID"])
+}